@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// CaddyGatewayConfigSpec configures every Gateway using a GatewayClass that
+// references the CaddyGatewayConfig as its parameters. Unset fields use the
+// controller's flags.
+type CaddyGatewayConfigSpec struct {
+	// Image is the Caddy image provisioned for each Gateway, overriding the
+	// controller's `--provision-image`. Only used when the controller
+	// provisions Caddy.
+	//
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Replicas is the number of Caddy instances provisioned for each Gateway,
+	// overriding the controller's `--provision-replicas`. Only used when the
+	// controller provisions Caddy, and ignored for Gateways using the host
+	// network. Can't be set together with Autoscaling.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Autoscaling scales the Caddy instances provisioned for each Gateway
+	// with a HorizontalPodAutoscaler, which then owns their replicas. Only
+	// used when the controller provisions Caddy, and ignored for Gateways
+	// using the host network.
+	//
+	// +optional
+	Autoscaling *CaddyGatewayAutoscaling `json:"autoscaling,omitempty"`
+
+	// AdminPort is the port Caddy's admin endpoint listens on, overriding the
+	// port of the controller's `--caddy-admin-listen`.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	AdminPort *int32 `json:"adminPort,omitempty"`
+
+	// LogLevel is the minimum level of the logs Caddy emits.
+	//
+	// +optional
+	// +kubebuilder:validation:Enum=DEBUG;INFO;WARN;ERROR
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// Resources are the compute resources of the Caddy containers
+	// provisioned for each Gateway. Only used when the controller provisions
+	// Caddy.
+	//
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Timeouts are the default timeouts of HTTPRoute rules that don't set
+	// any timeouts of their own.
+	//
+	// +optional
+	Timeouts *gatewayv1.HTTPRouteTimeouts `json:"timeouts,omitempty"`
+}
+
+// CaddyGatewayAutoscaling configures the HorizontalPodAutoscaler created for
+// the Caddy instances of each Gateway. Without any target, the average CPU
+// utilization is kept at 80%.
+type CaddyGatewayAutoscaling struct {
+	// MinReplicas is the lowest number of Caddy instances, defaults to 1.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the highest number of Caddy instances.
+	//
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the average CPU utilization of the
+	// Caddy instances to scale towards, as a percentage of their requested
+	// CPU. Requires Resources to request CPU.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetRequestsPerSecond is the average number of requests per second
+	// handled by each Caddy instance to scale towards. The rate is read from
+	// the RequestsPerSecondMetric pods metric, which must be served by a
+	// custom metrics adapter, e.g. the Prometheus adapter computing the rate
+	// of Caddy's `caddy_http_requests_total`.
+	//
+	// +optional
+	TargetRequestsPerSecond *resource.Quantity `json:"targetRequestsPerSecond,omitempty"`
+
+	// RequestsPerSecondMetric is the name of the pods metric
+	// TargetRequestsPerSecond applies to, defaults to
+	// `caddy_http_requests_per_second`.
+	//
+	// +optional
+	RequestsPerSecondMetric string `json:"requestsPerSecondMetric,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=gateway-api
+
+// CaddyGatewayConfig is referenced by a GatewayClass's `parametersRef` to
+// configure the Caddy instances of every Gateway using the GatewayClass.
+type CaddyGatewayConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CaddyGatewayConfigSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CaddyGatewayConfigList contains a list of CaddyGatewayConfig.
+type CaddyGatewayConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CaddyGatewayConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CaddyGatewayConfig{}, &CaddyGatewayConfigList{})
+}
@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CaddyHTTPFilterSpec is a Caddy HTTP handler, added to the handlers of every
+// HTTPRoute rule with an ExtensionRef filter referencing the CaddyHTTPFilter.
+type CaddyHTTPFilterSpec struct {
+	// Handler is the JSON config of a Caddy HTTP handler, its `handler` key
+	// is the name of the handler's module, e.g. `encode`. The module must be
+	// included in the Caddy image.
+	//
+	// ref; https://caddyserver.com/docs/json/apps/http/servers/routes/handle/
+	//
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Handler runtime.RawExtension `json:"handler"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:categories=gateway-api
+
+// CaddyHTTPFilter is referenced by HTTPRoute ExtensionRef filters to use Caddy
+// HTTP handlers that aren't covered by the Gateway API's filters.
+type CaddyHTTPFilter struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CaddyHTTPFilterSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CaddyHTTPFilterList contains a list of CaddyHTTPFilter.
+type CaddyHTTPFilterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CaddyHTTPFilter `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CaddyHTTPFilter{}, &CaddyHTTPFilterList{})
+}
@@ -4,12 +4,19 @@
 package caddy
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
@@ -17,24 +24,72 @@ import (
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	gateway "github.com/caddyserver/gateway/internal"
-	caddyv2 "github.com/caddyserver/gateway/internal/caddyv2"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddytls"
-	"github.com/caddyserver/gateway/internal/layer4"
+	"github.com/caddyserver/gateway/pkg/caddyconfig"
+	caddyv2 "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/requestbody"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
 )
 
 // Config represents the configuration for a Caddy server.
-type Config struct {
-	Admin   *caddyv2.AdminConfig `json:"admin,omitempty"`
-	Logging *caddyv2.Logging     `json:"logging,omitempty"`
-	Apps    *Apps                `json:"apps,omitempty"`
-}
+type Config = caddyconfig.Config
 
 // Apps is the configuration for "apps" on a Caddy server.
-type Apps struct {
-	HTTP   *caddyhttp.App `json:"http,omitempty"`
-	TLS    *caddytls.TLS  `json:"tls,omitempty"`
-	Layer4 *layer4.App    `json:"layer4,omitempty"`
+type Apps = caddyconfig.Apps
+
+// configPullTLSDir is the directory in Caddy pods containing the certificates
+// used to authenticate with the controller when pulling configs.
+const configPullTLSDir = "/var/run/secrets/tls"
+
+// GeneratorOptions are options for generating configs that apply to every
+// Gateway, usually set by the controller's flags. Zero values use the
+// defaults.
+type GeneratorOptions struct {
+	// AdminListen is the address for Caddy's admin endpoint to listen on.
+	// Defaults to `:2019`.
+	AdminListen string
+
+	// GracePeriod is how long Caddy waits for active connections to close
+	// when reloading its config, before forcefully closing them. Defaults to
+	// 15s.
+	GracePeriod time.Duration
+
+	// CatchAllStatusCode is the status code of the response to requests that
+	// don't match any route. Defaults to 421 (Misdirected Request).
+	CatchAllStatusCode int
+
+	// ReservedPathPrefixes are path prefixes that routes never match, e.g.
+	// `/.well-known/acme-challenge/`. Requests for them are responded to with
+	// a 404 before any route is tried, so catch-all routes can't shadow them.
+	ReservedPathPrefixes []string
+
+	// AllowedFilterHandlers are the Caddy HTTP handler modules
+	// CaddyHTTPFilters may use, filters using any other module are responded
+	// to with a 500. CaddyHTTPFilters can't be used if empty.
+	AllowedFilterHandlers []string
+}
+
+// Default GeneratorOptions.
+const (
+	DefaultAdminListen        = ":2019"
+	DefaultGracePeriod        = 15 * time.Second
+	DefaultCatchAllStatusCode = http.StatusMisdirectedRequest
+)
+
+// withDefaults returns the options with defaults applied to any unset
+// options.
+func (o GeneratorOptions) withDefaults() GeneratorOptions {
+	if o.AdminListen == "" {
+		o.AdminListen = DefaultAdminListen
+	}
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = DefaultGracePeriod
+	}
+	if o.CatchAllStatusCode == 0 {
+		o.CatchAllStatusCode = DefaultCatchAllStatusCode
+	}
+	return o
 }
 
 // Input is provided to us by the Gateway Controller and is used to
@@ -43,6 +98,10 @@ type Input struct {
 	Gateway      *gatewayv1.Gateway
 	GatewayClass *gatewayv1.GatewayClass
 
+	// Parameters are the parsed parameters of the GatewayClass, if any.
+	Parameters *Parameters
+
+	// Routes are sorted in place when generating a config.
 	HTTPRoutes []gatewayv1.HTTPRoute
 	GRPCRoutes []gatewayv1.GRPCRoute
 	TCPRoutes  []gatewayv1alpha2.TCPRoute
@@ -54,36 +113,214 @@ type Input struct {
 
 	Services []corev1.Service
 
-	Client client.Client
+	// Client is used to get any Secrets, ConfigMaps, ClusterTrustBundles and
+	// CaddyHTTPFilters referenced by the Gateway and its routes.
+	Client client.Reader
+
+	// GeneratorOptions may be overridden for every Gateway using a
+	// GatewayClass by its Parameters.
+	GeneratorOptions
+
+	// ConfigPullURL, if set, configures Caddy to pull its config from this
+	// URL every ConfigPullInterval, authenticating with mTLS. This keeps Caddy
+	// up to date even if it restarts while the controller is unavailable.
+	ConfigPullURL      string
+	ConfigPullInterval time.Duration
+
+	// DisableBackendAutoTLS disables connecting to backends over TLS when no
+	// BackendTLSPolicy targets them, but their Service port is named `https`,
+	// is port 443 or has an appProtocol of `https`.
+	DisableBackendAutoTLS bool
+
+	// PodUpstreams proxies HTTP requests directly to the ready endpoints of a
+	// Service, from EndpointSlices, rather than to the Service's ClusterIP.
+	// Headless Services are always proxied to using their EndpointSlices.
+	PodUpstreams   bool
+	EndpointSlices []discoveryv1.EndpointSlice
+
+	// Draining generates a config for a Caddy instance that is being drained,
+	// causing it to fail health checks. See GatewayAnnotationHealthCheckPath.
+	Draining bool
 
 	httpServers   map[string]*caddyhttp.Server
 	layer4Servers map[string]*layer4.Server
 	config        *Config
 	loadPems      []caddytls.CertKeyPEMPair
+
+	// clientCertificates are the client certificate Secrets referenced by
+	// the BackendTLSPolicies used by the config, by name.
+	clientCertificates map[string]*corev1.Secret
+
+	routeSummaries    map[routeSummaryKey]*RouteSummary
+	listenerSummaries map[gatewayv1.SectionName]*ListenerSummary
+
+	// services and endpointSlices index Services and EndpointSlices by the
+	// namespace and name of their Service, so resolving a backend doesn't
+	// require scanning every Service for every route.
+	services       map[types.NamespacedName]*corev1.Service
+	endpointSlices map[types.NamespacedName][]*discoveryv1.EndpointSlice
+
+	defaultBackendCAs []string
+	bodyLimits        bodyLimits
+}
+
+// ClientCertificates returns the client certificate Secrets that the generated
+// config expects to be mounted under ClientCertificatesPath, sorted by name.
+//
+// This is only valid after Config has been called.
+func (i *Input) ClientCertificates() []*corev1.Secret {
+	secrets := make([]*corev1.Secret, 0, len(i.clientCertificates))
+	for _, s := range i.clientCertificates {
+		secrets = append(secrets, s)
+	}
+	slices.SortFunc(secrets, func(a, b *corev1.Secret) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return secrets
+}
+
+// HasServers reports whether the generated config has any servers. A config
+// without servers is generated when none of the Gateway's listeners can be
+// configured, e.g. because their protocols aren't supported, and would stop
+// Caddy from serving any traffic.
+//
+// This is only valid after Config has been called.
+func (i *Input) HasServers() bool {
+	return len(i.httpServers) > 0 || len(i.layer4Servers) > 0
 }
 
 // Config generates a JSON config for use with a Caddy server.
 func (i *Input) Config() ([]byte, error) {
+	config, err := i.Build()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(config)
+}
+
+// bootstrapPullDelay is how long Caddy instances started with BootstrapConfig
+// wait before pulling their config, and between attempts until it is served.
+const bootstrapPullDelay = time.Second
+
+// BootstrapConfig generates the config Caddy instances are started with when
+// they are created by the controller. It doesn't serve anything, only pulling
+// the Gateway's config from url, which then keeps pulling every interval.
+func BootstrapConfig(opts GeneratorOptions, url string) ([]byte, error) {
+	return json.Marshal(&Config{
+		Admin: &caddyv2.AdminConfig{
+			Listen: opts.withDefaults().AdminListen,
+			Config: pullConfigSettings(url, bootstrapPullDelay),
+		},
+	})
+}
+
+// pullConfigSettings configures Caddy to pull its config from url every
+// interval, authenticating with the certificates in configPullTLSDir.
+func pullConfigSettings(url string, interval time.Duration) *caddyv2.ConfigSettings {
+	return &caddyv2.ConfigSettings{
+		Load: &caddyv2.HTTPLoader{
+			URL:     url,
+			Timeout: caddyv2.Duration(30 * time.Second),
+			TLS: &caddyv2.HTTPLoaderTLS{
+				ClientCertificateFile:    configPullTLSDir + "/tls.crt",
+				ClientCertificateKeyFile: configPullTLSDir + "/tls.key",
+				RootCAPEMFiles:           []string{configPullTLSDir + "/ca.crt"},
+			},
+		},
+		LoadDelay: caddyv2.Duration(interval),
+	}
+}
+
+// Build generates a config for use with a Caddy server.
+func (i *Input) Build() (*Config, error) {
 	i.httpServers = map[string]*caddyhttp.Server{}
 	i.layer4Servers = map[string]*layer4.Server{}
+	i.loadPems = nil
+	i.clientCertificates = nil
+	i.routeSummaries = nil
+	i.listenerSummaries = nil
+	i.sortRoutes()
+	i.indexBackends()
+	var err error
+	if i.defaultBackendCAs, err = i.getDefaultBackendCAs(context.Background()); err != nil {
+		return nil, err
+	}
+	if i.bodyLimits, err = getBodyLimits(i.Gateway); err != nil {
+		return nil, err
+	}
+	opts := i.generatorOptions()
 	i.config = &Config{
-		Admin: &caddyv2.AdminConfig{Listen: ":2019"},
+		Admin: &caddyv2.AdminConfig{Listen: opts.AdminListen},
 		Apps:  &Apps{},
 	}
+	if i.ConfigPullURL != "" {
+		i.config.Admin.Config = pullConfigSettings(i.ConfigPullURL, i.ConfigPullInterval)
+	}
+	if i.Parameters != nil && i.Parameters.LogLevel != "" {
+		i.config.Logging = &caddyv2.Logging{
+			Logs: map[string]*caddyv2.CustomLog{
+				"default": {BaseLog: caddyv2.BaseLog{Level: i.Parameters.LogLevel}},
+			},
+		}
+	}
 	for _, l := range i.Gateway.Spec.Listeners {
+		// Listeners with an invalid hostname are not accepted, they are
+		// reported on the listener's status rather than failing the config.
+		if l.Hostname != nil && gateway.ValidateHostname(string(*l.Hostname)) != nil {
+			continue
+		}
 		if err := i.handleListener(l); err != nil {
 			return nil, err
 		}
 	}
 	if len(i.httpServers) > 0 {
-		for _, s := range i.httpServers {
+		for key, s := range i.httpServers {
+			s.ID = ServerID(client.ObjectKeyFromObject(i.Gateway), "http", key)
+
+			if isStrictSNIHost(i.Gateway) && len(s.TLSConnPolicies) > 0 {
+				strict := true
+				s.StrictSNIHost = &strict
+				requireSNIHost(s.Routes)
+			}
+
+			if len(opts.ReservedPathPrefixes) > 0 {
+				s.Routes = append([]caddyhttp.Route{getReservedPathsRoute(opts.ReservedPathPrefixes)}, s.Routes...)
+			}
+
+			if size := i.bodyLimits.MaxRequestBodySize; size > 0 {
+				// Without any matchers or being terminal, this route applies
+				// the limit to every route after it.
+				s.Routes = append([]caddyhttp.Route{{
+					Handlers: []caddyhttp.Handler{
+						&requestbody.RequestBody{MaxSize: size},
+					},
+				}}, s.Routes...)
+			}
+
+			// Servers are keyed by their port.
+			port, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, err
+			}
+			if len(s.TLSConnPolicies) > 0 {
+				if route, ok := getAbortUnknownHostsRoute(i.Gateway, gatewayv1.PortNumber(port)); ok {
+					s.Routes = append([]caddyhttp.Route{route}, s.Routes...)
+				}
+			}
+
+			// Health checks are usually sent to an IP rather than a hostname,
+			// so must be handled before unknown hosts are aborted.
+			if path := i.Gateway.Annotations[GatewayAnnotationHealthCheckPath]; path != "" {
+				s.Routes = append([]caddyhttp.Route{i.getHealthCheckRoute(path)}, s.Routes...)
+			}
+
 			// For all servers register a catch-all route that will match any
 			// request that didn't already get handled.
 			s.Routes = append(s.Routes, caddyhttp.Route{
 				Handlers: []caddyhttp.Handler{
 					&caddyhttp.StaticResponse{
 						Close:      true,
-						StatusCode: caddyhttp.WeakString(strconv.Itoa(http.StatusMisdirectedRequest)),
+						StatusCode: caddyhttp.WeakString(strconv.Itoa(opts.CatchAllStatusCode)),
 						Body:       "unable to route request\n",
 						Headers: http.Header{
 							"Caddy-Instance": {"{system.hostname}"},
@@ -95,14 +332,16 @@ func (i *Input) Config() ([]byte, error) {
 		}
 		i.config.Apps.HTTP = &caddyhttp.App{
 			Servers: i.httpServers,
-			// TODO: make this user configurable.
 			// This is used to allow us to ensure the config reloads in a reasonable
 			// amount of time. Without it, Caddy will wait "indefinitely" which
 			// is not what we want to happen.
-			GracePeriod: caddyv2.Duration(15 * time.Second),
+			GracePeriod: caddyv2.Duration(opts.GracePeriod),
 		}
 	}
 	if len(i.layer4Servers) > 0 {
+		for key, s := range i.layer4Servers {
+			s.ID = ServerID(client.ObjectKeyFromObject(i.Gateway), "layer4", key)
+		}
 		i.config.Apps.Layer4 = &layer4.App{
 			Servers: i.layer4Servers,
 		}
@@ -114,8 +353,152 @@ func (i *Input) Config() ([]byte, error) {
 			},
 			DisableOCSPStapling: true,
 		}
+		if i.Parameters != nil {
+			i.Parameters.configureTLS(i.config.Apps.TLS)
+		}
+	}
+	return i.config, nil
+}
+
+// generatorOptions returns the options to generate the config with, applying
+// any overrides from the GatewayClass's Parameters and then the defaults.
+func (i *Input) generatorOptions() GeneratorOptions {
+	return i.Parameters.GeneratorOptions(i.GeneratorOptions).withDefaults()
+}
+
+// sortRoutes sorts the routes of each kind, as they are listed from a cache
+// in no particular order, so the same routes always generate the same config.
+// Maps don't need sorting, as encoding/json always marshals them sorted by key.
+//
+// Routes are sorted by the precedence the Gateway API gives to conflicting
+// routes, the oldest route first, then by namespace and name.
+// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.HTTPRouteRule
+func (i *Input) sortRoutes() {
+	sortByAge(i.HTTPRoutes)
+	sortByAge(i.GRPCRoutes)
+	sortByAge(i.TCPRoutes)
+	sortByAge(i.TLSRoutes)
+	sortByAge(i.UDPRoutes)
+}
+
+// sortByAge sorts objects in place, the oldest object first, then by
+// namespace and name.
+func sortByAge[T any, PT interface {
+	*T
+	client.Object
+}](objs []T) {
+	slices.SortStableFunc(objs, func(a, b T) int {
+		oa, ob := PT(&a), PT(&b)
+		ta, tb := oa.GetCreationTimestamp(), ob.GetCreationTimestamp()
+		if !ta.Equal(&tb) {
+			if ta.Before(&tb) {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(oa.GetNamespace(), ob.GetNamespace()); c != 0 {
+			return c
+		}
+		return cmp.Compare(oa.GetName(), ob.GetName())
+	})
+}
+
+// indexBackends indexes Services and EndpointSlices for getService and
+// getEndpointUpstreams.
+func (i *Input) indexBackends() {
+	i.services = make(map[types.NamespacedName]*corev1.Service, len(i.Services))
+	for idx := range i.Services {
+		s := &i.Services[idx]
+		i.services[client.ObjectKeyFromObject(s)] = s
+	}
+	i.endpointSlices = make(map[types.NamespacedName][]*discoveryv1.EndpointSlice)
+	for idx := range i.EndpointSlices {
+		slice := &i.EndpointSlices[idx]
+		name := slice.Labels[discoveryv1.LabelServiceName]
+		if name == "" {
+			continue
+		}
+		key := types.NamespacedName{Namespace: slice.Namespace, Name: name}
+		i.endpointSlices[key] = append(i.endpointSlices[key], slice)
+	}
+}
+
+// getService returns the Service with the given namespace and name, or nil if
+// it doesn't exist.
+func (i *Input) getService(namespace, name string) *corev1.Service {
+	return i.services[types.NamespacedName{Namespace: namespace, Name: name}]
+}
+
+// isBackendAllowed returns true if a route of the given kind in namespace may
+// reference the backend. Backends in other namespaces must be allowed by a
+// ReferenceGrant, routes referencing them are still attached to Gateways, so
+// backends that aren't allowed must be skipped when generating a config.
+func (i *Input) isBackendAllowed(namespace string, kind gatewayv1.Kind, bor gatewayv1.BackendObjectReference) bool {
+	gvk := gatewayv1.SchemeGroupVersion.WithKind(string(kind))
+	return gateway.IsBackendReferenceAllowed(namespace, gatewayv1.BackendRef{BackendObjectReference: bor}, gvk, i.Grants)
+}
+
+// requireSNIHost adds a matcher to every route requiring the request's Host
+// to match the client's SNI. Caddy already rejects these requests when
+// StrictSNIHost is enabled, this guards against the host being changed by
+// anything before the routes are evaluated.
+func requireSNIHost(routes []caddyhttp.Route) {
+	vars := caddyhttp.MatchVars{
+		"{http.request.host}": {"{http.request.tls.server_name}"},
+	}
+	for i := range routes {
+		if len(routes[i].MatcherSets) == 0 {
+			routes[i].MatcherSets = []caddyhttp.Match{{}}
+		}
+		for j := range routes[i].MatcherSets {
+			routes[i].MatcherSets[j].Vars = vars
+		}
+	}
+}
+
+// getHealthCheckRoute returns a route that responds to health checks on the
+// given path, failing them if the instance is being drained.
+func (i *Input) getHealthCheckRoute(path string) caddyhttp.Route {
+	status, body := http.StatusOK, "OK\n"
+	if i.Draining {
+		status, body = http.StatusServiceUnavailable, "draining\n"
+	}
+	return caddyhttp.Route{
+		MatcherSets: []caddyhttp.Match{
+			{Path: caddyhttp.MatchPath{path}},
+		},
+		Handlers: []caddyhttp.Handler{
+			&caddyhttp.StaticResponse{
+				StatusCode: caddyhttp.WeakString(strconv.Itoa(status)),
+				Body:       body,
+				Headers: http.Header{
+					"Caddy-Instance": {"{system.hostname}"},
+				},
+			},
+		},
+		Terminal: true,
+	}
+}
+
+// getReservedPathsRoute returns a route responding with a 404 to requests for
+// any of the reserved path prefixes, so they are never handled by routes after
+// it.
+func getReservedPathsRoute(prefixes []string) caddyhttp.Route {
+	paths := make(caddyhttp.MatchPath, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		paths = append(paths, prefix+"*")
+	}
+	return caddyhttp.Route{
+		MatcherSets: []caddyhttp.Match{
+			{Path: paths},
+		},
+		Handlers: []caddyhttp.Handler{
+			&caddyhttp.StaticResponse{
+				StatusCode: caddyhttp.WeakString(strconv.Itoa(http.StatusNotFound)),
+			},
+		},
+		Terminal: true,
 	}
-	return json.Marshal(i.config)
 }
 
 func (i *Input) handleListener(l gatewayv1.Listener) error {
@@ -177,6 +560,16 @@ func (i *Input) handleHTTPListener(l gatewayv1.Listener) error {
 			},
 		}
 	}
+	if isH2CListener(i.Gateway, l) {
+		// Caddy only serves h2c on servers without TLS, as it would otherwise
+		// be unreachable, so refuse rather than silently ignoring it.
+		if l.Protocol != gatewayv1.HTTPProtocolType {
+			return fmt.Errorf("listener %q: h2c is only supported on HTTP listeners", l.Name)
+		}
+		// HTTP/2 and HTTP/3 require TLS, so h1 and h2c are the only protocols
+		// that can be served on this port.
+		s.Protocols = []string{"h1", "h2c"}
+	}
 	server, err := i.getHTTPServer(s, l)
 	if err != nil {
 		return err
@@ -219,7 +612,12 @@ func (i *Input) handleLayer4Listener(l gatewayv1.Listener) error {
 	return nil
 }
 
-func isRouteForListener(gw *gatewayv1.Gateway, l gatewayv1.Listener, rNS string, rs gatewayv1.RouteStatus) bool {
+func isRouteForListener(gw *gatewayv1.Gateway, l gatewayv1.Listener, kind gatewayv1.Kind, rNS string, rs gatewayv1.RouteStatus) bool {
+	// Route kinds are already checked when routes are attached, but check them
+	// again so a route can never be programmed on an incompatible listener.
+	if !gateway.IsRouteKindAllowed(l, kind) {
+		return false
+	}
 	for _, p := range rs.Parents {
 		if !gateway.MatchesControllerName(p.ControllerName) {
 			continue
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+// benchmarkInput returns an Input for a Gateway with an HTTP listener and
+// routes HTTPRoutes, each with its own hostname and Service.
+func benchmarkInput(routes int) *Input {
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			GatewayClassName: "caddy",
+			Listeners: []gatewayv1.Listener{{
+				Name:     "http",
+				Protocol: gatewayv1.HTTPProtocolType,
+				Port:     80,
+			}},
+		},
+	}
+	i := &Input{
+		Gateway:      gw,
+		GatewayClass: &gatewayv1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "caddy"}},
+		HTTPRoutes:   make([]gatewayv1.HTTPRoute, 0, routes),
+		Services:     make([]corev1.Service, 0, routes),
+	}
+	pathType := gatewayv1.PathMatchPathPrefix
+	pathValue := "/api"
+	port := gatewayv1.PortNumber(80)
+	for n := range routes {
+		name := "app-" + strconv.Itoa(n)
+		i.Services = append(i.Services, corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: "10.0." + strconv.Itoa(n/256%256) + "." + strconv.Itoa(n%256),
+				Ports:     []corev1.ServicePort{{Name: "http", Port: 80}},
+			},
+		})
+		i.HTTPRoutes = append(i.HTTPRoutes, gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+				},
+				Hostnames: []gatewayv1.Hostname{gatewayv1.Hostname(name + ".example.com")},
+				Rules: []gatewayv1.HTTPRouteRule{{
+					Matches: []gatewayv1.HTTPRouteMatch{{
+						Path: &gatewayv1.HTTPPathMatch{
+							Type:  &pathType,
+							Value: &pathValue,
+						},
+					}},
+					BackendRefs: []gatewayv1.HTTPBackendRef{{
+						BackendRef: gatewayv1.BackendRef{
+							BackendObjectReference: gatewayv1.BackendObjectReference{
+								Name: gatewayv1.ObjectName(name),
+								Port: &port,
+							},
+						},
+					}},
+				}},
+			},
+			Status: gatewayv1.HTTPRouteStatus{
+				RouteStatus: gatewayv1.RouteStatus{
+					Parents: []gatewayv1.RouteParentStatus{{
+						ParentRef:      gatewayv1.ParentReference{Name: "gateway"},
+						ControllerName: gateway.ControllerName,
+					}},
+				},
+			},
+		})
+	}
+	return i
+}
+
+func BenchmarkInputConfig(b *testing.B) {
+	for _, routes := range []int{10, 100, 1_000, 10_000} {
+		b.Run(strconv.Itoa(routes)+"-routes", func(b *testing.B) {
+			i := benchmarkInput(routes)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, err := i.Config(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+)
+
+func TestInputConfigDeterministic(t *testing.T) {
+	i := benchmarkInput(50)
+	// Give some routes the same age, so they are ordered by name.
+	now := time.Now()
+	for n := range i.HTTPRoutes {
+		i.HTTPRoutes[n].CreationTimestamp = metav1.NewTime(now.Add(time.Duration(n/5) * time.Second))
+	}
+
+	want, err := i.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := i.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, again) {
+		t.Fatal("generating the config twice returned different configs")
+	}
+
+	// Resources are listed from a cache in no particular order.
+	slices.Reverse(i.HTTPRoutes)
+	slices.Reverse(i.Services)
+	got, err := i.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("config depends on the order of the input\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestReservedPathPrefixes(t *testing.T) {
+	i := benchmarkInput(2)
+	i.ReservedPathPrefixes = []string{"/.well-known/acme-challenge/"}
+
+	config, err := i.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := config.Apps.HTTP.Servers["80"]
+	if s == nil {
+		t.Fatal("no server for port 80")
+	}
+	// The reserved paths must be handled before any of the routes.
+	route := s.Routes[0]
+	if !route.Terminal || len(route.MatcherSets) != 1 || !slices.Equal(route.MatcherSets[0].Path, caddyhttp.MatchPath{"/.well-known/acme-challenge/*"}) {
+		t.Errorf("first route = %+v, want the reserved paths route", route)
+	}
+}
+
+func TestInvalidListenerHostname(t *testing.T) {
+	i := benchmarkInput(1)
+	valid := gatewayv1.Hostname("*.example.com")
+	invalid := gatewayv1.Hostname("-app-.example.com")
+	i.Gateway.Spec.Listeners = []gatewayv1.Listener{
+		{Name: "http", Hostname: &valid, Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+		{Name: "invalid", Hostname: &invalid, Protocol: gatewayv1.HTTPProtocolType, Port: 8080},
+	}
+
+	config, err := i.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v, want the invalid listener to be skipped", err)
+	}
+	if _, ok := config.Apps.HTTP.Servers["8080"]; ok {
+		t.Error("the listener with an invalid hostname was programmed")
+	}
+	summaries := i.ListenerSummaries()
+	if n := summaries["http"].Routes; n != 1 {
+		t.Errorf("%d routes were added to the valid listener, want 1", n)
+	}
+	if n := summaries["invalid"].Routes; n != 0 {
+		t.Errorf("%d routes were added to the invalid listener, want none", n)
+	}
+}
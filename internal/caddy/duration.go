@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	caddyv2 "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+)
+
+// gatewayDurationRegexp matches the duration format used by the Gateway API,
+// which is a subset of Go's duration format.
+// ref; https://gateway-api.sigs.k8s.io/geps/gep-2257/
+var gatewayDurationRegexp = regexp.MustCompile(`^([0-9]{1,5}(h|m|s|ms)){1,4}$`)
+
+// parseTimeout parses a Gateway API duration, returning zero if unset. A zero
+// duration is valid and, like in the Gateway API, usually means the timeout is
+// disabled.
+func parseTimeout(d *gatewayv1.Duration) (time.Duration, error) {
+	if d == nil {
+		return 0, nil
+	}
+	if !gatewayDurationRegexp.MatchString(string(*d)) {
+		return 0, fmt.Errorf("invalid timeout %q", *d)
+	}
+	timeout, err := time.ParseDuration(string(*d))
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", *d, err)
+	}
+	return timeout, nil
+}
+
+// parseDuration parses an implementation-specific duration, e.g. from an
+// annotation or parameter, using Caddy's duration format (which also
+// supports days). The duration must be within [minimum, maximum], a maximum
+// of zero is unbounded.
+func parseDuration(s string, minimum, maximum time.Duration) (caddyv2.Duration, error) {
+	v, err := caddyv2.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	if v < minimum {
+		return 0, fmt.Errorf("duration %q must be at least %s", s, minimum)
+	}
+	if maximum > 0 && v > maximum {
+		return 0, fmt.Errorf("duration %q must be at most %s", s, maximum)
+	}
+	return caddyv2.Duration(v), nil
+}
@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *gatewayv1.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "disabled", d: ptr.To[gatewayv1.Duration]("0s")},
+		{name: "seconds", d: ptr.To[gatewayv1.Duration]("10s"), want: 10 * time.Second},
+		{name: "multiple units", d: ptr.To[gatewayv1.Duration]("1h30m500ms"), want: time.Hour + 30*time.Minute + 500*time.Millisecond},
+		// Valid Go durations that the Gateway API doesn't allow.
+		{name: "fraction", d: ptr.To[gatewayv1.Duration]("1.5s"), wantErr: true},
+		{name: "microseconds", d: ptr.To[gatewayv1.Duration]("10us"), wantErr: true},
+		{name: "negative", d: ptr.To[gatewayv1.Duration]("-1s"), wantErr: true},
+		{name: "days", d: ptr.To[gatewayv1.Duration]("1d"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeout(tt.d)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTimeout() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("parseTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"context"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+)
+
+// getErrorPageHandlers returns the response handlers for an ExtensionRef
+// filter referencing an error page ConfigMap, or nil if the ExtensionRef
+// doesn't reference a ConfigMap.
+//
+// Like filters, error pages that don't exist or are invalid can't be skipped,
+// so instead of response handlers, a handler responding to requests with a 500
+// is returned.
+// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.HTTPRouteFilter
+func (i *Input) getErrorPageHandlers(ctx context.Context, namespace string, ref gatewayv1.LocalObjectReference) ([]caddyhttp.ResponseHandler, caddyhttp.Handler, error) {
+	if !gateway.IsLocalConfigMap(ref) {
+		return nil, nil, nil
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := i.Client.Get(
+		ctx,
+		client.ObjectKey{
+			Namespace: namespace,
+			Name:      string(ref.Name),
+		},
+		configMap,
+	); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, unresolvedFilterResponse(), nil
+		}
+		return nil, nil, err
+	}
+	codes, err := gateway.ValidateErrorPage(configMap)
+	if err != nil {
+		return nil, unresolvedFilterResponse(), nil
+	}
+
+	var handler caddyhttp.Handler
+	if v := configMap.Data[gateway.ErrorPageFallback]; v != "" {
+		upstream := i.getErrorPageFallback(namespace, v)
+		if upstream == nil {
+			return nil, unresolvedFilterResponse(), nil
+		}
+		handler = &reverseproxy.Handler{
+			Upstreams: reverseproxy.UpstreamPool{upstream},
+		}
+	} else {
+		contentType := configMap.Data[gateway.ErrorPageContentType]
+		if contentType == "" {
+			contentType = "text/html; charset=utf-8"
+		}
+		handler = &caddyhttp.StaticResponse{
+			StatusCode: "{http.reverse_proxy.status_code}",
+			Headers: http.Header{
+				"Content-Type":   {escapePlaceholders(contentType)},
+				"Caddy-Instance": {"{system.hostname}"},
+			},
+			Body: escapePlaceholders(configMap.Data[gateway.ErrorPageBody]),
+		}
+	}
+
+	return []caddyhttp.ResponseHandler{
+		{
+			Match: &caddyhttp.ResponseMatcher{StatusCode: codes},
+			Routes: []caddyhttp.Route{
+				{Handlers: []caddyhttp.Handler{handler}},
+			},
+		},
+	}, nil, nil
+}
+
+// getErrorPageFallback returns the upstream for an error page fallback
+// Service given as `name:port`, or nil if it can't be resolved.
+func (i *Input) getErrorPageFallback(namespace, v string) *reverseproxy.Upstream {
+	name, port, err := gateway.ParseErrorPageFallback(v)
+	if err != nil {
+		return nil
+	}
+	s := i.getService(namespace, name)
+	if s == nil {
+		return nil
+	}
+	sp, err := gateway.ResolveServicePort(s, port, corev1.ProtocolTCP)
+	if err != nil {
+		return nil
+	}
+	return &reverseproxy.Upstream{
+		Dial: getServiceDial(s, sp),
+	}
+}
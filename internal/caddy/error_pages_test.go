@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+)
+
+// testReader is a client.Reader for the given objects.
+type testReader []client.Object
+
+func (r testReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	for _, o := range r {
+		if reflect.TypeOf(o) == reflect.TypeOf(obj) && client.ObjectKeyFromObject(o) == key {
+			reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(o.DeepCopyObject()).Elem())
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (r testReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("listing is not supported")
+}
+
+func TestGetErrorPageHandlers(t *testing.T) {
+	ref := gatewayv1.LocalObjectReference{Kind: "ConfigMap", Name: "error-page"}
+	tests := []struct {
+		name       string
+		data       map[string]string
+		missing    bool
+		wantCodes  []int
+		wantProxy  bool
+		unresolved bool
+	}{
+		{name: "body", data: map[string]string{"body": "oops"}, wantCodes: []int{5}},
+		{name: "status codes", data: map[string]string{"body": "oops", "statusCodes": "502, 4"}, wantCodes: []int{502, 4}},
+		{name: "fallback", data: map[string]string{"fallback": "maintenance:80"}, wantCodes: []int{5}, wantProxy: true},
+		{name: "missing", missing: true, unresolved: true},
+		{name: "invalid status code", data: map[string]string{"body": "oops", "statusCodes": "5xx"}, unresolved: true},
+		{name: "unknown status code", data: map[string]string{"body": "oops", "statusCodes": "600"}, unresolved: true},
+		{name: "no body or fallback", data: map[string]string{"statusCodes": "502"}, unresolved: true},
+		{name: "missing fallback Service", data: map[string]string{"fallback": "missing:80"}, unresolved: true},
+		{name: "missing fallback port", data: map[string]string{"fallback": "maintenance:8080"}, unresolved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c testReader
+			if !tt.missing {
+				c = append(c, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "error-page"},
+					Data:       tt.data,
+				})
+			}
+			i := &Input{
+				Client: c,
+				Services: []corev1.Service{{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "maintenance"},
+					Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.1", Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+				}},
+			}
+			i.indexBackends()
+
+			rh, h, err := i.getErrorPageHandlers(context.Background(), "default", ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.unresolved {
+				resp, ok := h.(*caddyhttp.StaticResponse)
+				if !ok || resp.StatusCode != "500" || len(rh) != 0 {
+					t.Fatalf("got handler %#v and %d response handlers, want only a 500 response", h, len(rh))
+				}
+				return
+			}
+			if h != nil || len(rh) != 1 {
+				t.Fatalf("got handler %#v and %d response handlers, want a single response handler", h, len(rh))
+			}
+			if !slices.Equal(rh[0].Match.StatusCode, tt.wantCodes) {
+				t.Errorf("status codes = %v, want %v", rh[0].Match.StatusCode, tt.wantCodes)
+			}
+			switch page := rh[0].Routes[0].Handlers[0].(type) {
+			case *reverseproxy.Handler:
+				if !tt.wantProxy {
+					t.Errorf("page = %#v, want a static response", page)
+				}
+			case *caddyhttp.StaticResponse:
+				if tt.wantProxy {
+					t.Errorf("page = %#v, want a proxy", page)
+				}
+				if got := page.Headers.Get("Content-Type"); got != "text/html; charset=utf-8" {
+					t.Errorf("Content-Type = %q, want the default", got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetErrorPageHandlersOtherKind(t *testing.T) {
+	i := &Input{}
+	rh, h, err := i.getErrorPageHandlers(context.Background(), "default", gatewayv1.LocalObjectReference{
+		Group: "gateway.caddyserver.com",
+		Kind:  "CaddyHTTPFilter",
+		Name:  "filter",
+	})
+	if rh != nil || h != nil || err != nil {
+		t.Errorf("getErrorPageHandlers() = %v, %v, %v, want nothing for other kinds", rh, h, err)
+	}
+}
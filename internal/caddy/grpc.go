@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/headers"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+)
+
+// grpcNamePattern matches a gRPC service or method name that wasn't specified
+// by a match.
+const grpcNamePattern = `[^/]+`
+
+// getGRPCRoutes returns the routes for the GRPCRoutes attached to the listener.
+//
+// Every route only matches gRPC requests, so GRPCRoutes and HTTPRoutes can
+// share a hostname, with gRPC requests going to the GRPCRoutes.
+func (i *Input) getGRPCRoutes(s *caddyhttp.Server, l gatewayv1.Listener) ([]caddyhttp.Route, error) {
+	routes := []caddyhttp.Route{}
+	for idx := range i.GRPCRoutes {
+		gr := &i.GRPCRoutes[idx]
+		if !isRouteForListener(i.Gateway, l, "GRPCRoute", gr.Namespace, gr.Status.RouteStatus) {
+			continue
+		}
+
+		// ref; https://caddyserver.com/docs/json/apps/http/servers/routes/match/protocol/
+		matcher := caddyhttp.Match{Protocol: "grpc"}
+		if len(gr.Spec.Hostnames) > 0 {
+			matcher.Host = make(caddyhttp.MatchHost, len(gr.Spec.Hostnames))
+			for i, h := range gr.Spec.Hostnames {
+				matcher.Host[i] = string(h)
+			}
+		}
+
+		handlers := []caddyhttp.Handler{}
+		for _, rule := range gr.Spec.Rules {
+			ruleMatchers, err := i.getGRPCRuleMatchers(rule.Matches)
+			if err != nil {
+				return nil, fmt.Errorf("GRPCRoute %s/%s: %w", gr.Namespace, gr.Name, err)
+			}
+
+			ruleHandlers := []caddyhttp.Handler{}
+			for _, f := range rule.Filters {
+				switch f.Type {
+				case gatewayv1.GRPCRouteFilterRequestHeaderModifier:
+					v := f.RequestHeaderModifier
+					if v == nil {
+						break
+					}
+					ruleHandlers = append(ruleHandlers, headers.Handler{
+						Request: getHeaderReplacements(v.Add, v.Set, v.Remove),
+					})
+				case gatewayv1.GRPCRouteFilterResponseHeaderModifier:
+					v := f.ResponseHeaderModifier
+					if v == nil {
+						break
+					}
+					ruleHandlers = append(ruleHandlers, headers.Handler{
+						Response: &headers.RespHeaderOps{
+							HeaderOps: getHeaderReplacements(v.Add, v.Set, v.Remove),
+						},
+					})
+				}
+			}
+
+			var backends []weightedProxy
+			for _, bf := range rule.BackendRefs {
+				bor := bf.BackendObjectReference
+				if !gateway.IsService(bor) || bor.Port == nil {
+					continue
+				}
+				// A weight of zero means no traffic should be sent to the
+				// backend.
+				weight := 1
+				if bf.Weight != nil {
+					weight = min(int(*bf.Weight), gateway.MaxBackendWeight)
+				}
+				if weight <= 0 {
+					continue
+				}
+				// The route checks report backends that aren't allowed.
+				if !i.isBackendAllowed(gr.Namespace, "GRPCRoute", bor) {
+					continue
+				}
+				service := i.getService(gateway.NamespaceDerefOr(bor.Namespace, gr.Namespace), string(bor.Name))
+				if service == nil {
+					continue
+				}
+				sp, err := gateway.ResolveServicePort(service, int32(*bor.Port), corev1.ProtocolTCP)
+				if err != nil {
+					continue
+				}
+
+				proxy, err := i.getBackendProxy(service, sp)
+				if err != nil {
+					return nil, err
+				}
+				// gRPC requires HTTP/2, which is negotiated using ALPN when
+				// connecting to the backend over TLS.
+				if transport, ok := proxy.Transport.(*reverseproxy.HTTPTransport); ok {
+					if transport.TLS != nil {
+						transport.Versions = []string{"2"}
+					} else {
+						transport.Versions = []string{"h2c"}
+					}
+				}
+				// Buffering would stall streaming RPCs until the buffer is
+				// full or the stream ends.
+				proxy.RequestBuffers = 0
+				proxy.ResponseBuffers = 0
+				backends = append(backends, weightedProxy{
+					proxy:   proxy,
+					service: service,
+					port:    sp.Port,
+					weight:  weight,
+				})
+			}
+
+			if len(backends) == 0 {
+				// Requests to a rule without any backends that can be
+				// resolved (or only ones with a weight of zero) must be
+				// rejected.
+				// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.GRPCRouteRule
+				ruleHandlers = append(ruleHandlers, &caddyhttp.StaticResponse{
+					StatusCode: caddyhttp.WeakString(strconv.Itoa(http.StatusInternalServerError)),
+				})
+			} else {
+				proxy, err := mergeBackendProxies(backends, false)
+				if err != nil {
+					return nil, fmt.Errorf("GRPCRoute %s/%s: %w", gr.Namespace, gr.Name, err)
+				}
+				handler, err := addNamedProxy(s, backends[0].service, backends[0].port, proxy)
+				if err != nil {
+					return nil, err
+				}
+				ruleHandlers = append(ruleHandlers, handler)
+			}
+
+			handlers = append(handlers, &caddyhttp.Subroute{
+				Routes: []caddyhttp.Route{
+					{
+						MatcherSets: ruleMatchers,
+						Handlers:    ruleHandlers,
+					},
+				},
+			})
+		}
+
+		if len(handlers) == 0 {
+			continue
+		}
+
+		// Propagate the identity of the Gateway and route to backends.
+		if h := getIdentityHeaders(i.Gateway, gr); h != nil {
+			handlers = append([]caddyhttp.Handler{headers.Handler{
+				Request: &headers.HeaderOps{Set: h},
+			}}, handlers...)
+		}
+
+		routes = append(routes, caddyhttp.Route{
+			MatcherSets: []caddyhttp.Match{matcher},
+			Handlers:    handlers,
+		})
+		i.recordRoute("GRPCRoute", gr, l, len(handlers))
+	}
+	return routes, nil
+}
+
+// getGRPCRuleMatchers returns a matcher set for each match of a rule, Caddy
+// OR's matcher sets together. A rule without matches matches every request.
+func (i *Input) getGRPCRuleMatchers(matches []gatewayv1.GRPCRouteMatch) ([]caddyhttp.Match, error) {
+	var matchers []caddyhttp.Match
+	for _, m := range matches {
+		matcher := caddyhttp.Match{}
+		if m.Method != nil {
+			pattern, err := getGRPCMethodPattern(m.Method)
+			if err != nil {
+				return nil, err
+			}
+			matcher.PathRE = &caddyhttp.MatchPathRE{
+				MatchRegexp: caddyhttp.MatchRegexp{
+					Pattern: pattern,
+				},
+			}
+		}
+
+		hm := make([]gatewayv1.HTTPHeaderMatch, len(m.Headers))
+		for n, h := range m.Headers {
+			hm[n] = gatewayv1.HTTPHeaderMatch{
+				Type:  h.Type,
+				Name:  gatewayv1.HTTPHeaderName(h.Name),
+				Value: h.Value,
+			}
+			// Caddy's header matcher treats `*` as a wildcard and `{...}` as
+			// a placeholder, so match these values exactly with a regexp.
+			if (h.Type == nil || *h.Type == gatewayv1.HeaderMatchExact) && strings.ContainsAny(h.Value, "*{") {
+				t := gatewayv1.HeaderMatchRegularExpression
+				hm[n].Type = &t
+				hm[n].Value = "^" + regexp.QuoteMeta(h.Value) + "$"
+			}
+		}
+		if err := i.getHeaderMatcher(&matcher, hm); err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// getGRPCMethodPattern returns a regular expression matching the request path
+// of the gRPC method match, which is `/<service>/<method>`.
+//
+// A regular expression is used even for exact matches, as Caddy's path
+// matcher is case-insensitive while gRPC service and method names aren't.
+func getGRPCMethodPattern(m *gatewayv1.GRPCMethodMatch) (string, error) {
+	service, method := grpcNamePattern, grpcNamePattern
+	matchType := gatewayv1.GRPCMethodMatchExact
+	if m.Type != nil {
+		matchType = *m.Type
+	}
+	switch matchType {
+	case gatewayv1.GRPCMethodMatchExact:
+		if m.Service != nil && *m.Service != "" {
+			service = regexp.QuoteMeta(*m.Service)
+		}
+		if m.Method != nil && *m.Method != "" {
+			method = regexp.QuoteMeta(*m.Method)
+		}
+	case gatewayv1.GRPCMethodMatchRegularExpression:
+		if m.Service != nil && *m.Service != "" {
+			service = "(?:" + *m.Service + ")"
+		}
+		if m.Method != nil && *m.Method != "" {
+			method = "(?:" + *m.Method + ")"
+		}
+	default:
+		return "", fmt.Errorf("unsupported method match type %q", matchType)
+	}
+	pattern := "^/" + service + "/" + method + "$"
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", fmt.Errorf("invalid method match: %w", err)
+	}
+	return pattern, nil
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+)
+
+// grpcInput returns an Input for a Gateway with an HTTP listener and a
+// GRPCRoute with a single rule for the backends, along with Services named
+// `a` in the default namespace and `b` in the `other` namespace.
+func grpcInput(backendRefs ...gatewayv1.GRPCBackendRef) *Input {
+	return &Input{
+		Gateway: &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+			Spec: gatewayv1.GatewaySpec{
+				Listeners: []gatewayv1.Listener{{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80}},
+			},
+		},
+		Services: []corev1.Service{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"},
+				Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.1", Ports: []corev1.ServicePort{{Name: "grpc", Port: 50051}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "b"},
+				Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.2", Ports: []corev1.ServicePort{{Name: "grpc", Port: 50051}}},
+			},
+		},
+		GRPCRoutes: []gatewayv1.GRPCRoute{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "grpc"},
+			Spec: gatewayv1.GRPCRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+				},
+				Rules: []gatewayv1.GRPCRouteRule{{BackendRefs: backendRefs}},
+			},
+			Status: gatewayv1.GRPCRouteStatus{
+				RouteStatus: gatewayv1.RouteStatus{
+					Parents: []gatewayv1.RouteParentStatus{{
+						ParentRef:      gatewayv1.ParentReference{Name: "gateway"},
+						ControllerName: gateway.ControllerName,
+					}},
+				},
+			},
+		}},
+	}
+}
+
+// grpcBackend returns a backendRef to a Service on port 50051.
+func grpcBackend(namespace, name string, weight int32) gatewayv1.GRPCBackendRef {
+	ref := gatewayv1.GRPCBackendRef{
+		BackendRef: gatewayv1.BackendRef{
+			BackendObjectReference: gatewayv1.BackendObjectReference{
+				Name: gatewayv1.ObjectName(name),
+				Port: ptr.To[gatewayv1.PortNumber](50051),
+			},
+			Weight: ptr.To(weight),
+		},
+	}
+	if namespace != "" {
+		ref.Namespace = ptr.To(gatewayv1.Namespace(namespace))
+	}
+	return ref
+}
+
+// grpcRuleHandler returns the last handler of the only rule of the only
+// GRPCRoute, which handles requests matching the rule.
+func grpcRuleHandler(t *testing.T, i *Input, s *caddyhttp.Server) caddyhttp.Handler {
+	t.Helper()
+	i.indexBackends()
+	routes, err := i.getGRPCRoutes(s, i.Gateway.Spec.Listeners[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("got %d routes, want 1", len(routes))
+	}
+	handlers := routes[0].Handlers
+	subroute, ok := handlers[len(handlers)-1].(*caddyhttp.Subroute)
+	if !ok || len(subroute.Routes) != 1 {
+		t.Fatalf("rule handler = %#v, want a subroute", handlers[len(handlers)-1])
+	}
+	ruleHandlers := subroute.Routes[0].Handlers
+	return ruleHandlers[len(ruleHandlers)-1]
+}
+
+// grpcProxy returns the proxy invoked by a handler.
+func grpcProxy(t *testing.T, s *caddyhttp.Server, h caddyhttp.Handler) *reverseproxy.Handler {
+	t.Helper()
+	invoke, ok := h.(*caddyhttp.Invoke)
+	if !ok {
+		t.Fatalf("handler = %#v, want a proxy", h)
+	}
+	return s.NamedRoutes[invoke.Name].Handlers[0].(*reverseproxy.Handler)
+}
+
+func TestGRPCRouteWeightedBackends(t *testing.T) {
+	i := grpcInput(grpcBackend("", "a", 3), grpcBackend("", "a", 0))
+	i.Services = append(i.Services, corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "c"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.3", Ports: []corev1.ServicePort{{Name: "grpc", Port: 50051}}},
+	})
+	i.GRPCRoutes[0].Spec.Rules[0].BackendRefs = append(i.GRPCRoutes[0].Spec.Rules[0].BackendRefs, grpcBackend("", "c", 1))
+
+	s := &caddyhttp.Server{}
+	proxy := grpcProxy(t, s, grpcRuleHandler(t, i, s))
+	if len(proxy.Upstreams) != 2 {
+		t.Fatalf("got %d upstreams, want 2 as backends with a weight of zero are skipped", len(proxy.Upstreams))
+	}
+	wrr, ok := proxy.LoadBalancing.SelectionPolicy.(*reverseproxy.WeightedRoundRobinSelection)
+	if !ok || !slices.Equal(wrr.Weights, []int{3, 1}) {
+		t.Errorf("selection policy = %#v, want weights [3 1]", proxy.LoadBalancing.SelectionPolicy)
+	}
+	transport := proxy.Transport.(*reverseproxy.HTTPTransport)
+	if !slices.Equal(transport.Versions, []string{"h2c"}) {
+		t.Errorf("transport versions = %v, want [h2c]", transport.Versions)
+	}
+}
+
+func TestGRPCRouteUnresolvedBackends(t *testing.T) {
+	tests := []struct {
+		name        string
+		backendRefs []gatewayv1.GRPCBackendRef
+	}{
+		{name: "no backends"},
+		{name: "missing Service", backendRefs: []gatewayv1.GRPCBackendRef{grpcBackend("", "missing", 1)}},
+		{name: "zero weight", backendRefs: []gatewayv1.GRPCBackendRef{grpcBackend("", "a", 0)}},
+		{name: "cross-namespace without grant", backendRefs: []gatewayv1.GRPCBackendRef{grpcBackend("other", "b", 1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := grpcRuleHandler(t, grpcInput(tt.backendRefs...), &caddyhttp.Server{})
+			resp, ok := h.(*caddyhttp.StaticResponse)
+			if !ok || resp.StatusCode != "500" {
+				t.Errorf("handler = %#v, want a 500 response", h)
+			}
+		})
+	}
+}
+
+func TestGRPCRouteCrossNamespaceGrant(t *testing.T) {
+	i := grpcInput(grpcBackend("other", "b", 1))
+	i.Grants = []gatewayv1beta1.ReferenceGrant{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "grpc"},
+		Spec: gatewayv1beta1.ReferenceGrantSpec{
+			From: []gatewayv1beta1.ReferenceGrantFrom{{
+				Group:     gatewayv1.GroupName,
+				Kind:      "GRPCRoute",
+				Namespace: "default",
+			}},
+			To: []gatewayv1beta1.ReferenceGrantTo{{Kind: "Service"}},
+		},
+	}}
+
+	s := &caddyhttp.Server{}
+	proxy := grpcProxy(t, s, grpcRuleHandler(t, i, s))
+	if len(proxy.Upstreams) != 1 {
+		t.Errorf("got %d upstreams, want 1", len(proxy.Upstreams))
+	}
+}
@@ -4,27 +4,35 @@
 package caddy
 
 import (
+	"cmp"
 	"context"
-	"encoding/base64"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/textproto"
+	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
 
 	gateway "github.com/caddyserver/gateway/internal"
-	caddy "github.com/caddyserver/gateway/internal/caddyv2"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp/headers"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp/reverseproxy"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp/rewrite"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddytls"
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/headers"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/rewrite"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
 )
 
 func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddyhttp.Server, error) {
@@ -34,8 +42,9 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 	}
 
 	routes := []caddyhttp.Route{}
-	for _, hr := range i.HTTPRoutes {
-		if !isRouteForListener(i.Gateway, l, hr.Namespace, hr.Status.RouteStatus) {
+	for idx := range i.HTTPRoutes {
+		hr := &i.HTTPRoutes[idx]
+		if !isRouteForListener(i.Gateway, l, "HTTPRoute", hr.Namespace, hr.Status.RouteStatus) {
 			continue
 		}
 
@@ -58,34 +67,36 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 			matchers = append(matchers, matcher)
 		}
 
+		// Match a user provided CEL expression, matcher sets are OR'd together
+		// so the expression must be added to the hostname matcher if it exists.
+		if expr := getMatchExpression(hr, -1); expr != "" {
+			if len(matchers) == 0 {
+				matchers = append(matchers, caddyhttp.Match{})
+			}
+			matchers[0].Expression = &caddyhttp.MatchExpression{Expr: expr}
+		}
+
 		// Map rules to handlers
-		for _, rule := range hr.Spec.Rules {
-			matcher := &caddyhttp.Match{}
-			// TODO: should each unique matches register a different matcher?
-			for _, m := range rule.Matches {
-				if m.Path != nil {
-					if err := i.getPathMatcher(matcher, m.Path); err != nil {
-						return nil, err
-					}
-				}
-				if m.Headers != nil {
-					if err := i.getHeaderMatcher(matcher, m.Headers); err != nil {
-						return nil, err
-					}
-				}
-				if m.QueryParams != nil {
-					if err := i.getQueryMatcher(matcher, m.QueryParams); err != nil {
-						return nil, err
-					}
-				}
-				if m.Method != nil {
-					if err := i.getMethodMatcher(matcher, m.Method); err != nil {
-						return nil, err
-					}
+		for _, ri := range getRuleOrder(hr) {
+			rule := hr.Spec.Rules[ri]
+			expr := getMatchExpression(hr, ri)
+			if isWebSocketOnly(hr, ri) {
+				if expr != "" {
+					expr = "(" + expr + ") && " + webSocketMatchExpression
+				} else {
+					expr = webSocketMatchExpression
 				}
 			}
+			matcher, err := i.getRuleMatcher(rule.Matches, expr)
+			if err != nil {
+				return nil, err
+			}
 
 			ruleHandlers := []caddyhttp.Handler{}
+			var (
+				responseHandlers []caddyhttp.ResponseHandler
+				redirect         []caddyhttp.Handler
+			)
 			for _, f := range rule.Filters {
 				var handler caddyhttp.Handler
 				switch f.Type {
@@ -157,7 +168,7 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 
 					var hostname string
 					if v.Hostname != nil {
-						hostname = string(*v.Hostname)
+						hostname = escapePlaceholders(string(*v.Hostname))
 					} else {
 						// Keep the hostname the same (this is a Caddy placeholder).
 						hostname = "{http.request.host}"
@@ -179,7 +190,6 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 					}
 
 					if v.Path != nil {
-						// TODO: try to re-use logic between URLRewrite and this.
 						p := *v.Path
 						switch p.Type {
 						case gatewayv1.FullPathHTTPPathModifier:
@@ -190,9 +200,19 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 							if !strings.HasPrefix(path, "/") {
 								path = "/" + path
 							}
-							location.WriteString(path)
+							location.WriteString(escapePlaceholders(path))
 						case gatewayv1.PrefixMatchHTTPPathModifier:
-							// TODO: implement
+							if p.ReplacePrefixMatch == nil {
+								break
+							}
+							// The path is rewritten the same way as by
+							// URLRewrite, right before redirecting to it.
+							redirect = append(redirect, &rewrite.Rewrite{
+								PathRegexp: []*rewrite.RegexReplacer{
+									getPrefixRewrite(rule.Matches, *p.ReplacePrefixMatch),
+								},
+							})
+							location.WriteString("{http.request.uri}")
 						}
 					} else {
 						// Keep the path the same (this is a Caddy placeholder).
@@ -204,12 +224,16 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 						statusCode = *v.StatusCode
 					}
 					// handler was previously a subroute here
-					handler = &caddyhttp.StaticResponse{
+					//
+					// The redirect responds to the request, so it's added
+					// after the rule's other filters, otherwise header
+					// modifiers following it wouldn't apply to the redirect.
+					redirect = append(redirect, &caddyhttp.StaticResponse{
 						Headers: http.Header{
 							textproto.CanonicalMIMEHeaderKey("Location"): {location.String()},
 						},
 						StatusCode: caddyhttp.WeakString(strconv.Itoa(statusCode)),
-					}
+					})
 
 					// TODO: this is what caddy does for a `redir` directive,
 					// but I'm unsure if this is how we should handle it ourselves.
@@ -236,37 +260,14 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 							if p.ReplaceFullPath == nil {
 								break
 							}
-							rw.URI = *p.ReplaceFullPath
+							rw.URI = escapePlaceholders(*p.ReplaceFullPath)
 						case gatewayv1.PrefixMatchHTTPPathModifier:
 							if p.ReplacePrefixMatch == nil {
 								break
 							}
-							// TODO: try not to explode while implementing
-							// ref; https://gateway-api.sigs.k8s.io/guides/http-redirect-rewrite/?h=replacepre#rewrites
-							//
-							// I'm unsure how to map this to Caddy as it seems like
-							// we need to know the request path in order to replace the prefix.
-							// ref; https://caddyserver.com/docs/caddyfile/directives/uri#examples
-							//
-							// We may be able to take advantage of URI placeholders.
-							// ref; https://caddyserver.com/docs/json/apps/http/#docs
-
-							replacement := *p.ReplacePrefixMatch
-
-							// Caddy-specific: if the replacement is `/`, use the
-							// pre-existing strip_path_prefix option.
-							if replacement == "/" && len(matcher.Path) > 0 {
-								path := matcher.Path[0]
-								path = strings.TrimSuffix(path, "*")
-								rw.StripPathPrefix = path
+							rw.PathRegexp = []*rewrite.RegexReplacer{
+								getPrefixRewrite(rule.Matches, *p.ReplacePrefixMatch),
 							}
-
-							//rw.URISubstring = []rewrite.SubstrReplacer{
-							//	{
-							//		Find: "",
-							//		Replace: *p.ReplacePrefixMatch,
-							//	},
-							//}
 						}
 					}
 					handler = rw
@@ -275,17 +276,42 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 					if v == nil {
 						break
 					}
-					// This will require us to build a custom Caddy module if we
-					// want request mirroring.
+					// Caddy has no request mirroring, so this uses a custom
+					// Caddy module.
 					// ref; https://github.com/caddyserver/caddy/issues/4211
-					//
-					// TODO: implement
+					h, err := i.getMirrorHandler(s, hr, ri, v.BackendRef)
+					if err != nil {
+						return nil, err
+					}
+					if h != nil {
+						handler = h
+					}
 				case gatewayv1.HTTPRouteFilterExtensionRef:
 					v := f.ExtensionRef
 					if v == nil {
 						break
 					}
-					// Not necessary, this is implementation-specific and unused by us (yet)
+					// Implementation-specific: intercept error responses from
+					// the rule's backends using an error page ConfigMap.
+					rh, h, err := i.getErrorPageHandlers(context.Background(), hr.Namespace, *v)
+					if err != nil {
+						return nil, err
+					}
+					responseHandlers = append(responseHandlers, rh...)
+					if h != nil {
+						handler = h
+						break
+					}
+
+					// Implementation-specific: add the Caddy handler of a
+					// CaddyHTTPFilter.
+					h, err = i.getFilterHandler(context.Background(), hr.Namespace, *v)
+					if err != nil {
+						return nil, err
+					}
+					if h != nil {
+						handler = h
+					}
 				}
 
 				if handler == nil {
@@ -294,7 +320,17 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 				ruleHandlers = append(ruleHandlers, handler)
 			}
 
-			if len(rule.BackendRefs) > 0 {
+			if redirect != nil {
+				// Backends are never reached by redirected requests.
+				ruleHandlers = append(ruleHandlers, redirect...)
+			} else if len(rule.BackendRefs) > 0 {
+				// Implementation-specific: failover between the rule's
+				// backends in order, rather than splitting traffic.
+				failover := isFailover(hr, ri)
+				var (
+					backends  []weightedProxy
+					hasWeight bool
+				)
 				for _, bf := range rule.BackendRefs {
 					bor := bf.BackendObjectReference
 					if !gateway.IsService(bor) {
@@ -307,127 +343,80 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 					}
 					port := int32(*bor.Port)
 
-					// Get the service.
-					//
-					// TODO: is there a more efficient way to do this?
-					// We currently list all services and forward them to the input,
-					// then iterate over them.
-					//
-					// Should we just use the Kubernetes client instead?
-					var service corev1.Service
-					for _, s := range i.Services {
-						if s.Namespace != gateway.NamespaceDerefOr(bor.Namespace, hr.Namespace) {
-							continue
-						}
-						if s.Name != string(bor.Name) {
-							continue
-						}
-						service = s
-						break
+					// A weight of zero means no traffic should be sent to the
+					// backend, failover ignores weights.
+					weight := 1
+					if bf.Weight != nil {
+						// Out of range weights are rejected by routechecks,
+						// clamp them in case the route hasn't been reconciled
+						// yet.
+						weight = min(int(*bf.Weight), gateway.MaxBackendWeight)
 					}
-					if service.Name == "" {
-						// Invalid service reference.
+					if weight <= 0 && !failover {
 						continue
 					}
+					hasWeight = true
 
-					// Find a matching port on the backend service.
-					// TODO: if no matching port is found do we abort?
-					var sp corev1.ServicePort
-					for _, p := range service.Spec.Ports {
-						if p.Port != port {
-							continue
-						}
-						sp = p
-						break
+					// The route checks report backends that aren't allowed.
+					if !i.isBackendAllowed(hr.Namespace, "HTTPRoute", bor) {
+						continue
+					}
+					service := i.getService(gateway.NamespaceDerefOr(bor.Namespace, hr.Namespace), string(bor.Name))
+					if service == nil {
+						// Invalid service reference.
+						continue
 					}
 
-					var bTLSPolicy gatewayv1alpha3.BackendTLSPolicy
-					for _, btp := range i.BackendTLSPolicies {
-						match := false
-						for _, tf := range btp.Spec.TargetRefs {
-							if !gateway.IsLocalPolicyTargetService(tf.LocalPolicyTargetReference) {
-								continue
-							}
-							if string(tf.Name) != service.Name {
-								continue
-							}
-							match = true
-							break
-						}
-						if !match {
-							continue
-						}
-						bTLSPolicy = btp
-						break
+					// Find a matching port on the backend service, the route
+					// checks report ports that can't be resolved.
+					sp, err := gateway.ResolveServicePort(service, port, corev1.ProtocolTCP)
+					if err != nil {
+						continue
 					}
 
-					transport := &reverseproxy.HTTPTransport{}
-					// TODO: should we also detect appProtocol as a fallback?
-					// If a pod has a trusted certificate, we just need to tell
-					// Caddy to use TLS when connecting to the backend, just like
-					// if a BackendTLSPolicy with System trust is used.
-					if bTLSPolicy.Name != "" {
-						tls := &reverseproxy.TLSConfig{}
-						policy := bTLSPolicy.Spec.Validation
-						if hostname := string(policy.Hostname); hostname != "" {
-							tls.ServerName = hostname
-						}
-						// Check for any custom CAs to load.
-						if len(policy.CACertificateRefs) > 0 {
-							// Array of base64-encoded DER-encoded CA certificates.
-							var certs []string
-							for _, ref := range policy.CACertificateRefs {
-								pemCerts, err := i.getCAPool(context.Background(), ref)
-								if err != nil {
-									// TODO: log error and continue?
-									return nil, err
-								}
-
-								// Support multiple CA certificates from one reference.
-								// TODO: should we bother trying to de-dupe the certs array?
-								for len(pemCerts) > 0 {
-									var block *pem.Block
-									block, pemCerts = pem.Decode(pemCerts)
-									if block == nil {
-										break
-									}
-									if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
-										continue
-									}
-									certs = append(certs, base64.StdEncoding.EncodeToString(block.Bytes))
-								}
-							}
-							tls.CA = caddytls.InlineCAPool{
-								TrustedCACerts: certs,
-							}
-						}
-						// Caddy will default to using system trust for TLS if
-						// we don't override the pool.
-						transport.TLS = tls
-					} else if sp.AppProtocol != nil {
-						// ref; https://gateway-api.sigs.k8s.io/guides/backend-protocol/
-						switch *sp.AppProtocol {
-						case "kubernetes.io/h2c":
-							// Enable support for h2c (HTTP/2 over Cleartext).
-							transport.Versions = []string{"h2c"}
-						case "kubernetes.io/ws":
-							// This is only here as it is formally recognized as a possible value by
-							// the Gateway API spec.
-							//
-							// Caddy automatically proxies WebSockets without any additional
-							// configuration, hence why this case is empty.
-						}
+					proxy, err := i.getBackendProxy(service, sp)
+					if err != nil {
+						return nil, err
 					}
+					proxy.HandleResponse = responseHandlers
+					backends = append(backends, weightedProxy{
+						proxy:   proxy,
+						service: service,
+						port:    sp.Port,
+						weight:  weight,
+					})
+				}
 
-					// TODO: load_balancing, weights, etc.
-					ruleHandlers = append(ruleHandlers, &reverseproxy.Handler{
-						Transport: transport,
-						Upstreams: reverseproxy.UpstreamPool{
-							{
-								Dial: net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port))),
-							},
-						},
+				switch {
+				case !hasWeight || len(backends) == 0:
+					// Every backend has a weight of zero or can't be
+					// resolved, which must be responded to with a 500.
+					// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.HTTPBackendRef
+					ruleHandlers = append(ruleHandlers, &caddyhttp.StaticResponse{
+						StatusCode: caddyhttp.WeakString(strconv.Itoa(http.StatusInternalServerError)),
 					})
+				default:
+					proxy, err := mergeBackendProxies(backends, failover)
+					if err != nil {
+						return nil, fmt.Errorf("HTTPRoute %s/%s: %w", hr.Namespace, hr.Name, err)
+					}
+					if failover {
+						configureFailover(proxy, getFailoverHealthCheck(hr, ri))
+					}
+					timeouts := rule.Timeouts
+					if timeouts == nil && i.Parameters != nil {
+						timeouts = i.Parameters.DefaultTimeouts
+					}
+					if timeouts != nil {
+						if err := setProxyTimeouts(proxy, timeouts); err != nil {
+							return nil, fmt.Errorf("HTTPRoute %s/%s: %w", hr.Namespace, hr.Name, err)
+						}
+					}
+					handler, err := addNamedProxy(s, backends[0].service, backends[0].port, proxy)
+					if err != nil {
+						return nil, err
+					}
+					ruleHandlers = append(ruleHandlers, handler)
 				}
 			}
 
@@ -451,14 +440,29 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 			continue
 		}
 
+		// Propagate the identity of the Gateway and route to backends.
+		if h := getIdentityHeaders(i.Gateway, hr); h != nil && len(handlers) > 0 {
+			handlers = append([]caddyhttp.Handler{headers.Handler{
+				Request: &headers.HeaderOps{Set: h},
+			}}, handlers...)
+		}
+
 		// Add the route.
 		routes = append(routes, caddyhttp.Route{
 			MatcherSets: matchers,
 			Handlers:    handlers,
 			Terminal:    terminal,
 		})
+		i.recordRoute("HTTPRoute", hr, l, len(handlers))
 	}
 
+	// GRPCRoutes only match gRPC requests, so they are added first to take
+	// precedence over HTTPRoutes for the same hostnames.
+	grpcRoutes, err := i.getGRPCRoutes(s, l)
+	if err != nil {
+		return nil, err
+	}
+	s.Routes = append(s.Routes, grpcRoutes...)
 	s.Routes = append(s.Routes, routes...)
 
 	// TLS may be set at this point, but the mode will be Terminate.
@@ -470,21 +474,28 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 		return s, nil
 	}
 
+	alpn := getTLSALPN(l)
+
 	// Configure a TLS matcher.
 	if hostname != "" {
 		snis, err := json.Marshal([]string{hostname})
 		if err != nil {
 			return nil, err
 		}
-		s.TLSConnPolicies = append(s.TLSConnPolicies, &caddytls.ConnectionPolicy{
+		if err := addTLSConnPolicy(s, &caddytls.ConnectionPolicy{
 			Matchers: caddy.ModuleMap{
 				"sni": snis,
 			},
-		})
+			ALPN: alpn,
+		}); err != nil {
+			return nil, err
+		}
 	}
 
 	// TODO: support mapping additional TLS options via l.TLS.Options
 
+	defaultCert, _ := getTLSOption(l, TLSOptionDefaultCertificate)
+	defaultCertTag := "default-certificate/" + string(l.Name)
 	for _, ref := range l.TLS.CertificateRefs {
 		pair, err := i.getCertKeyPEMPair(context.Background(), ref)
 		if err != nil {
@@ -495,21 +506,549 @@ func (i *Input) getHTTPServer(s *caddyhttp.Server, l gatewayv1.Listener) (*caddy
 		if pair.CertificatePEM == "" || pair.KeyPEM == "" {
 			continue
 		}
+		if defaultCert != "" && i.isDefaultCertificate(ref, defaultCert) {
+			pair.Tags = append(pair.Tags, defaultCertTag)
+		}
 		i.loadPems = append(i.loadPems, pair)
+		i.listenerSummary(l).Certificates++
+	}
+
+	// Configure a catch-all policy for clients that don't send SNI, or send SNI
+	// that doesn't match any other policy. Without this, clients accessing the
+	// Gateway by IP (like health checks) will fail to complete a handshake.
+	//
+	// Listeners without a hostname match every client, so they also need a
+	// catch-all policy for ALPN to be restricted.
+	defaultSNI, hasDefaultSNI := getTLSOption(l, TLSOptionDefaultSNI)
+	fallbackSNI, hasFallbackSNI := getTLSOption(l, TLSOptionFallbackSNI)
+	if hasDefaultSNI || hasFallbackSNI || defaultCert != "" || (hostname == "" && len(alpn) > 0) {
+		p := &caddytls.ConnectionPolicy{
+			DefaultSNI:  defaultSNI,
+			FallbackSNI: fallbackSNI,
+			ALPN:        alpn,
+		}
+		if defaultCert != "" {
+			p.CertSelection = &caddytls.CustomCertSelectionPolicy{
+				AnyTag: []string{defaultCertTag},
+			}
+		}
+		// Listeners sharing the port share the catch-all policy, the
+		// listener is only reported if its options can't be merged into it.
+		if err := addTLSConnPolicy(s, p); err != nil {
+			i.listenerSummary(l).TLSConflict = err.Error()
+		}
 	}
 	return s, nil
 }
 
+// isDefaultCertificate returns true if the certificate reference is the one
+// named by the listener's TLSOptionDefaultCertificate option, given as either
+// `name` or `namespace/name`. Names without a namespace, like references
+// without one, are in the Gateway's namespace.
+func (i *Input) isDefaultCertificate(ref gatewayv1.SecretObjectReference, defaultCert string) bool {
+	namespace, name, ok := strings.Cut(defaultCert, "/")
+	if !ok {
+		namespace, name = i.Gateway.Namespace, defaultCert
+	}
+	refNamespace := i.Gateway.Namespace
+	if ref.Namespace != nil {
+		refNamespace = string(*ref.Namespace)
+	}
+	return refNamespace == namespace && string(ref.Name) == name
+}
+
+// getBackendProxy returns a reverse proxy handler for the port of a backend
+// Service, connecting to it over TLS if it is targeted by a BackendTLSPolicy
+// or uses a well-known HTTPS port.
+func (i *Input) getBackendProxy(service *corev1.Service, sp corev1.ServicePort) (*reverseproxy.Handler, error) {
+	var bTLSPolicy gatewayv1alpha3.BackendTLSPolicy
+	if btp := i.getBackendTLSPolicy(service, sp); btp != nil {
+		bTLSPolicy = *btp
+	}
+
+	transport := &reverseproxy.HTTPTransport{}
+	if bTLSPolicy.Name != "" {
+		tls := &reverseproxy.TLSConfig{}
+		policy := bTLSPolicy.Spec.Validation
+		if hostname := string(policy.Hostname); hostname != "" {
+			tls.ServerName = hostname
+		}
+		// Check for any custom CAs to load.
+		if len(policy.CACertificateRefs) > 0 {
+			// Array of base64-encoded DER-encoded CA certificates.
+			var certs []string
+			for _, ref := range policy.CACertificateRefs {
+				pemCerts, err := i.getCAPool(context.Background(), ref)
+				if err != nil {
+					// TODO: log error and continue?
+					return nil, err
+				}
+
+				// Support multiple CA certificates from one reference.
+				// TODO: should we bother trying to de-dupe the certs array?
+				certs = append(certs, pemToInlineCerts(pemCerts)...)
+			}
+			tls.CA = caddytls.InlineCAPool{
+				TrustedCACerts: certs,
+			}
+		}
+		// Implementation-specific: present a client certificate
+		// to backends that require mutual TLS.
+		if name := bTLSPolicy.Annotations[BackendTLSPolicyAnnotationClientCertificate]; name != "" {
+			certFile, keyFile, err := i.getClientCertificate(context.Background(), &bTLSPolicy, name)
+			if err != nil {
+				return nil, err
+			}
+			tls.ClientCertificateFile = certFile
+			tls.ClientCertificateKeyFile = keyFile
+		}
+		// Caddy will default to using system trust for TLS if
+		// we don't override the pool.
+		transport.TLS = tls
+	} else if !i.DisableBackendAutoTLS && isHTTPSServicePort(sp) {
+		// If a pod has a trusted certificate, we just need to tell
+		// Caddy to use TLS when connecting to the backend, just like
+		// if a BackendTLSPolicy with System trust is used.
+		//
+		// We dial the ClusterIP, so verify the certificate against
+		// the Service's DNS name instead.
+		transport.TLS = &reverseproxy.TLSConfig{
+			ServerName: service.Name + "." + service.Namespace + ".svc",
+		}
+		if service.Spec.Type == corev1.ServiceTypeExternalName {
+			transport.TLS.ServerName = service.Spec.ExternalName
+		}
+		// Trust the GatewayClass's default CAs, if any, rather
+		// than system trust.
+		if len(i.defaultBackendCAs) > 0 {
+			transport.TLS.CA = caddytls.InlineCAPool{
+				TrustedCACerts: i.defaultBackendCAs,
+			}
+		}
+	} else if sp.AppProtocol != nil {
+		// ref; https://gateway-api.sigs.k8s.io/guides/backend-protocol/
+		switch *sp.AppProtocol {
+		case "kubernetes.io/h2c":
+			// Enable support for h2c (HTTP/2 over Cleartext).
+			transport.Versions = []string{"h2c"}
+		case "kubernetes.io/ws":
+			// This is only here as it is formally recognized as a possible value by
+			// the Gateway API spec.
+			//
+			// Caddy automatically proxies WebSockets without any additional
+			// configuration, hence why this case is empty.
+		}
+	}
+
+	proxy := &reverseproxy.Handler{
+		Transport:       transport,
+		RequestBuffers:  i.bodyLimits.RequestBuffers,
+		ResponseBuffers: i.bodyLimits.ResponseBuffers,
+		Upstreams: reverseproxy.UpstreamPool{
+			{
+				Dial: getServiceDial(service, sp),
+			},
+		},
+	}
+	// Headless Services have no ClusterIP to load balance between their
+	// endpoints, so they are always proxied to directly.
+	if i.PodUpstreams || isHeadlessService(service) {
+		if upstreams := i.getEndpointUpstreams(service, sp); len(upstreams) > 0 {
+			proxy.Upstreams = upstreams
+			// Endpoints are only updated when the Gateway is
+			// reconciled, so quickly stop sending requests to
+			// pods that have gone away in the meantime.
+			proxy.HealthChecks = &reverseproxy.HealthChecks{
+				Passive: &reverseproxy.PassiveHealthChecks{
+					FailDuration: caddy.Duration(10 * time.Second),
+					MaxFails:     1,
+				},
+			}
+		}
+	}
+	return proxy, nil
+}
+
+// addNamedProxy registers the reverse proxy handler as a named route on the
+// server and returns a handler that invokes it.
+//
+// Identical handlers share a single named route, so when a Service is used by
+// many routes Caddy only provisions one reverse proxy for it, sharing health
+// checks and connection pools between all of them.
+func addNamedProxy(s *caddyhttp.Server, service *corev1.Service, port int32, h *reverseproxy.Handler) (caddyhttp.Handler, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	// Handlers for the same Service and port may still differ (e.g. TLS),
+	// so include a hash of the handler to keep them apart.
+	sum := sha256.Sum256(b)
+	name := "proxy/" + service.Namespace + "/" + service.Name + "/" + strconv.Itoa(int(port)) + "/" + hex.EncodeToString(sum[:8])
+	if s.NamedRoutes == nil {
+		s.NamedRoutes = map[string]*caddyhttp.Route{}
+	}
+	if _, ok := s.NamedRoutes[name]; !ok {
+		s.NamedRoutes[name] = &caddyhttp.Route{
+			Handlers: []caddyhttp.Handler{h},
+		}
+	}
+	return &caddyhttp.Invoke{Name: name}, nil
+}
+
+// maxUpstreamWeightScale is the largest factor the weights of a rule's
+// backends are scaled by to be shared between their upstreams.
+const maxUpstreamWeightScale = 1000
+
+// weightedProxy is a reverse proxy handler for a backendRef of a rule.
+type weightedProxy struct {
+	proxy   *reverseproxy.Handler
+	service *corev1.Service
+	port    int32
+	weight  int
+}
+
+// mergeBackendProxies merges the proxies for the backends of a rule into a
+// single proxy, as only one reverse proxy can handle a request.
+//
+// Unless failing over, traffic is split between the backends according to
+// their weights. A backend's weight is shared between its upstreams, which
+// there are many of when proxying directly to pods, so it isn't affected by
+// the number of pods behind the backend.
+//
+// Upstreams of a proxy share a transport, so the backends must use the same
+// TLS settings and protocol.
+func mergeBackendProxies(backends []weightedProxy, failover bool) (*reverseproxy.Handler, error) {
+	proxy := backends[0].proxy
+	if len(backends) == 1 {
+		return proxy, nil
+	}
+
+	for _, b := range backends[1:] {
+		if !reflect.DeepEqual(proxy.Transport, b.proxy.Transport) {
+			if failover {
+				return nil, errors.New("failover backends must use the same transport (TLS and protocol)")
+			}
+			return nil, errors.New("weighted backends must use the same transport (TLS and protocol)")
+		}
+	}
+
+	// Weights of upstreams are scaled by the least common multiple of the
+	// number of upstreams of each backend, so they can be shared evenly.
+	// Weights are only approximated when there are too many upstreams.
+	scale := 1
+	for _, b := range backends {
+		scale = lcm(scale, len(b.proxy.Upstreams))
+	}
+	scale = min(scale, maxUpstreamWeightScale)
+
+	var (
+		upstreams reverseproxy.UpstreamPool
+		weights   []int
+		divisor   int
+	)
+	for _, b := range backends {
+		upstreams = append(upstreams, b.proxy.Upstreams...)
+		w := max(1, b.weight*scale/len(b.proxy.Upstreams))
+		for range b.proxy.Upstreams {
+			weights = append(weights, w)
+		}
+		divisor = gcd(divisor, w)
+		// Upstreams of backends proxied to directly are passively health
+		// checked, keep doing so once merged.
+		if proxy.HealthChecks == nil {
+			proxy.HealthChecks = b.proxy.HealthChecks
+		}
+	}
+	proxy.Upstreams = upstreams
+	if failover {
+		return proxy, nil
+	}
+
+	// Reduce the weights to the smallest equivalent values, if they are all
+	// equal round-robin is enough.
+	equal := true
+	for j := range weights {
+		weights[j] /= divisor
+		equal = equal && weights[j] == weights[0]
+	}
+	if equal {
+		proxy.LoadBalancing = &reverseproxy.LoadBalancing{
+			SelectionPolicy: &reverseproxy.RoundRobinSelection{},
+		}
+	} else {
+		proxy.LoadBalancing = &reverseproxy.LoadBalancing{
+			SelectionPolicy: &reverseproxy.WeightedRoundRobinSelection{
+				Weights: weights,
+			},
+		}
+	}
+	return proxy, nil
+}
+
+// setProxyTimeouts applies the timeouts of an HTTPRoute rule to the proxy for
+// its backends. A zero timeout disables it.
+//
+// Caddy has no deadline for a whole request, so the request timeout bounds
+// every request to a backend instead, along with how long requests are
+// retried for when failing over.
+func setProxyTimeouts(proxy *reverseproxy.Handler, timeouts *gatewayv1.HTTPRouteTimeouts) error {
+	request, err := parseTimeout(timeouts.Request)
+	if err != nil {
+		return err
+	}
+	backendRequest, err := parseTimeout(timeouts.BackendRequest)
+	if err != nil {
+		return err
+	}
+
+	timeout := backendRequest
+	if request > 0 && (timeout == 0 || request < timeout) {
+		timeout = request
+	}
+	if tr, ok := proxy.Transport.(*reverseproxy.HTTPTransport); ok && timeout > 0 {
+		tr.ResponseHeaderTimeout = caddy.Duration(timeout)
+		tr.ReadTimeout = caddy.Duration(timeout)
+		tr.WriteTimeout = caddy.Duration(timeout)
+	}
+	if lb := proxy.LoadBalancing; lb != nil && request > 0 && time.Duration(lb.TryDuration) > request {
+		lb.TryDuration = caddy.Duration(request)
+	}
+	return nil
+}
+
+// configureFailover configures a proxy whose upstreams are ordered from the
+// primary backend to the last fallback, so requests are only sent to a
+// fallback while every backend before it is unhealthy.
+func configureFailover(proxy *reverseproxy.Handler, healthCheckURI string) {
+	proxy.LoadBalancing = &reverseproxy.LoadBalancing{
+		SelectionPolicy: &reverseproxy.FirstSelection{},
+		// Retry requests that failed to connect on the next backend.
+		TryDuration: caddy.Duration(5 * time.Second),
+	}
+	if proxy.HealthChecks == nil {
+		proxy.HealthChecks = &reverseproxy.HealthChecks{}
+	}
+	if proxy.HealthChecks.Passive == nil {
+		proxy.HealthChecks.Passive = &reverseproxy.PassiveHealthChecks{
+			FailDuration: caddy.Duration(10 * time.Second),
+			MaxFails:     1,
+		}
+	}
+	if healthCheckURI != "" {
+		proxy.HealthChecks.Active = &reverseproxy.ActiveHealthChecks{
+			URI:      healthCheckURI,
+			Interval: caddy.Duration(5 * time.Second),
+			Timeout:  caddy.Duration(2 * time.Second),
+		}
+	}
+}
+
+// getEndpointUpstreams returns an upstream for each ready endpoint of the
+// Service port, sorted so the generated config is stable.
+func (i *Input) getEndpointUpstreams(service *corev1.Service, sp corev1.ServicePort) reverseproxy.UpstreamPool {
+	var addrs []string
+	for _, slice := range i.endpointSlices[client.ObjectKeyFromObject(service)] {
+
+		// EndpointSlice ports use the name of the Service port they belong to.
+		var port *int32
+		for _, p := range slice.Ports {
+			if p.Port == nil || (p.Name != nil && *p.Name != sp.Name) || (p.Name == nil && sp.Name != "") {
+				continue
+			}
+			port = p.Port
+			break
+		}
+		if port == nil {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			// A nil ready condition must be interpreted as ready.
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, a := range ep.Addresses {
+				addrs = append(addrs, net.JoinHostPort(a, strconv.Itoa(int(*port))))
+			}
+		}
+	}
+	slices.Sort(addrs)
+	addrs = slices.Compact(addrs)
+
+	upstreams := make(reverseproxy.UpstreamPool, 0, len(addrs))
+	for _, a := range addrs {
+		upstreams = append(upstreams, &reverseproxy.Upstream{Dial: a})
+	}
+	return upstreams
+}
+
+// getServiceDial returns the address to dial to connect to the port of a
+// Service, its ClusterIP or, for headless and ExternalName Services, its DNS
+// name.
+func getServiceDial(service *corev1.Service, sp corev1.ServicePort) string {
+	port := strconv.Itoa(int(sp.Port))
+	switch {
+	case service.Spec.Type == corev1.ServiceTypeExternalName:
+		return net.JoinHostPort(service.Spec.ExternalName, port)
+	case isHeadlessService(service):
+		return net.JoinHostPort(service.Name+"."+service.Namespace+".svc", port)
+	}
+	return net.JoinHostPort(service.Spec.ClusterIP, port)
+}
+
+// isHeadlessService reports whether the Service has no ClusterIP.
+func isHeadlessService(service *corev1.Service) bool {
+	if service.Spec.Type == corev1.ServiceTypeExternalName {
+		return false
+	}
+	return service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+// isHTTPSServicePort reports whether the Service port is expected to serve
+// HTTPS. If an appProtocol is set it is used, otherwise ports named `https`
+// or using port 443 are assumed to be HTTPS.
+func isHTTPSServicePort(sp corev1.ServicePort) bool {
+	if sp.AppProtocol != nil {
+		return *sp.AppProtocol == "https"
+	}
+	return sp.Name == "https" || sp.Port == 443
+}
+
+// addTLSConnPolicy adds a TLS connection policy to the server.
+//
+// Caddy uses the first policy that matches a ClientHello, so policies with
+// matchers are always kept before the catch-all policy (one without any
+// matchers), otherwise listeners sharing the same port would have their
+// policies shadowed. There is only one catch-all policy per server, so a
+// catch-all policy is merged into the existing one, an error is returned if
+// they conflict.
+func addTLSConnPolicy(s *caddyhttp.Server, p *caddytls.ConnectionPolicy) error {
+	catchAll := slices.IndexFunc(s.TLSConnPolicies, func(p *caddytls.ConnectionPolicy) bool {
+		return len(p.Matchers) == 0
+	})
+	if len(p.Matchers) == 0 {
+		if catchAll == -1 {
+			s.TLSConnPolicies = append(s.TLSConnPolicies, p)
+			return nil
+		}
+		return mergeCatchAllPolicy(s.TLSConnPolicies[catchAll], p)
+	}
+	if catchAll == -1 {
+		s.TLSConnPolicies = append(s.TLSConnPolicies, p)
+		return nil
+	}
+	s.TLSConnPolicies = slices.Insert(s.TLSConnPolicies, catchAll, p)
+	return nil
+}
+
+// mergeCatchAllPolicy merges the options of a catch-all policy into an
+// existing one. Options only set by one of the policies are kept, if both set
+// an option to different values an error is returned and the existing policy
+// is left unchanged.
+func mergeCatchAllPolicy(existing, p *caddytls.ConnectionPolicy) error {
+	merged := *existing
+	mergeOption := func(name string, dst *string, v string) error {
+		if v == "" || v == *dst {
+			return nil
+		}
+		if *dst != "" {
+			return fmt.Errorf("%s %q conflicts with %q set by another listener on the same port", name, v, *dst)
+		}
+		*dst = v
+		return nil
+	}
+	if err := mergeOption("default SNI", &merged.DefaultSNI, p.DefaultSNI); err != nil {
+		return err
+	}
+	if err := mergeOption("fallback SNI", &merged.FallbackSNI, p.FallbackSNI); err != nil {
+		return err
+	}
+	if !slices.Equal(merged.ALPN, p.ALPN) {
+		return fmt.Errorf("ALPN protocols %v conflict with %v set by another listener on the same port", p.ALPN, merged.ALPN)
+	}
+	if p.CertSelection != nil {
+		if merged.CertSelection != nil && !reflect.DeepEqual(merged.CertSelection, p.CertSelection) {
+			return errors.New("default certificate conflicts with the one set by another listener on the same port")
+		}
+		merged.CertSelection = p.CertSelection
+	}
+	*existing = merged
+	return nil
+}
+
+// getPrefixRewrite returns a regular expression replacing the path prefix
+// matched by a rule with replacement, keeping the rest of the path. Matched
+// prefixes always end at a path element, so a trailing slash on either the
+// prefix or replacement doesn't change the result.
+// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.HTTPPathModifier
+func getPrefixRewrite(matches []gatewayv1.HTTPRouteMatch, replacement string) *rewrite.RegexReplacer {
+	var prefixes []string
+	for _, m := range matches {
+		prefix := "/"
+		if m.Path != nil {
+			if m.Path.Type != nil && *m.Path.Type != gatewayv1.PathMatchPathPrefix {
+				continue
+			}
+			if m.Path.Value != nil {
+				prefix = *m.Path.Value
+			}
+		}
+		prefixes = append(prefixes, regexp.QuoteMeta(strings.TrimSuffix(prefix, "/")))
+	}
+	if len(prefixes) == 0 {
+		// Rules without matches match every path.
+		prefixes = append(prefixes, "")
+	}
+	// Longer prefixes are tried first, so the longest matching prefix is
+	// replaced.
+	slices.SortFunc(prefixes, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+	prefixes = slices.Compact(prefixes)
+
+	replacement = escapePlaceholders(strings.ReplaceAll(strings.TrimSuffix(replacement, "/"), "$", "$$"))
+	if replacement == "" {
+		// Replacing a prefix with `/` must not leave the path empty, nor
+		// start it with two slashes.
+		return &rewrite.RegexReplacer{
+			Find:    "^(?:" + strings.Join(prefixes, "|") + ")/?(.*)$",
+			Replace: "/$1",
+		}
+	}
+	return &rewrite.RegexReplacer{
+		Find:    "^(?:" + strings.Join(prefixes, "|") + ")(/.*)?$",
+		Replace: replacement + "$1",
+	}
+}
+
+// placeholderEscaper escapes the braces Caddy uses to delimit placeholders.
+var placeholderEscaper = strings.NewReplacer("{", `\{`, "}", `\}`)
+
+// escapePlaceholders escapes s so Caddy uses it literally, rather than
+// replacing anything that looks like a placeholder. Every user-provided
+// string used in a field that Caddy replaces placeholders in must be escaped,
+// otherwise routes could read values like `{env.*}` or `{file.*}`.
+// ref; https://caddyserver.com/docs/conventions#placeholders
+func escapePlaceholders(s string) string {
+	return placeholderEscaper.Replace(s)
+}
+
 func getHeaderReplacements(add, set []gatewayv1.HTTPHeader, remove []string) *headers.HeaderOps {
 	ops := &headers.HeaderOps{
 		Delete: remove,
 	}
+	if len(add) > 0 {
+		ops.Add = http.Header{}
+	}
+	if len(set) > 0 {
+		ops.Set = http.Header{}
+	}
 	for _, h := range add {
-		ops.Add.Add(string(h.Name), h.Value)
+		ops.Add.Add(string(h.Name), escapePlaceholders(h.Value))
 	}
 	for _, h := range set {
 		// TODO: opts.Set.Add or opts.Set.Set?
-		ops.Set.Add(string(h.Name), h.Value)
+		ops.Set.Add(string(h.Name), escapePlaceholders(h.Value))
 	}
 	return ops
 }
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+)
+
+// getFilterHandler returns the handler of a CaddyHTTPFilter referenced by an
+// HTTPRoute ExtensionRef filter, or nil if the ExtensionRef doesn't reference
+// a CaddyHTTPFilter.
+//
+// Filters that don't exist, are invalid or use a handler module that isn't
+// allowed can't be skipped, so requests they would have handled are responded
+// to with a 500 instead.
+// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.HTTPRouteFilter
+func (i *Input) getFilterHandler(ctx context.Context, namespace string, ref gatewayv1.LocalObjectReference) (caddyhttp.Handler, error) {
+	if !gateway.IsLocalCaddyHTTPFilter(ref) {
+		return nil, nil
+	}
+	filter := &v1alpha1.CaddyHTTPFilter{}
+	if err := i.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: string(ref.Name)}, filter); err != nil {
+		if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return unresolvedFilterResponse(), nil
+		}
+		return nil, err
+	}
+	if err := gateway.ValidateCaddyHTTPFilter(filter, i.GeneratorOptions.AllowedFilterHandlers); err != nil {
+		return unresolvedFilterResponse(), nil
+	}
+	return caddyhttp.RawHandler(filter.Spec.Handler.Raw), nil
+}
+
+// unresolvedFilterResponse responds to requests handled by a filter that
+// can't be resolved.
+func unresolvedFilterResponse() caddyhttp.Handler {
+	return &caddyhttp.StaticResponse{
+		StatusCode: caddyhttp.WeakString(strconv.Itoa(http.StatusInternalServerError)),
+	}
+}
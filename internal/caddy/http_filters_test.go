@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+)
+
+func TestGetFilterHandler(t *testing.T) {
+	ref := gatewayv1.LocalObjectReference{
+		Group: gatewayv1.Group(v1alpha1.GroupVersion.Group),
+		Kind:  "CaddyHTTPFilter",
+		Name:  "filter",
+	}
+	filter := func(handler string) *v1alpha1.CaddyHTTPFilter {
+		return &v1alpha1.CaddyHTTPFilter{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "filter"},
+			Spec:       v1alpha1.CaddyHTTPFilterSpec{Handler: runtime.RawExtension{Raw: []byte(handler)}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter *v1alpha1.CaddyHTTPFilter
+		want   caddyhttp.Handler
+	}{
+		{
+			name:   "valid",
+			filter: filter(`{"handler":"encode","encodings":{"gzip":{}}}`),
+			want:   caddyhttp.RawHandler(`{"handler":"encode","encodings":{"gzip":{}}}`),
+		},
+		{
+			name: "missing",
+			want: unresolvedFilterResponse(),
+		},
+		{
+			name:   "no handler module",
+			filter: filter(`{"encodings":{"gzip":{}}}`),
+			want:   unresolvedFilterResponse(),
+		},
+		{
+			name:   "invalid JSON",
+			filter: filter(`{"handler":`),
+			want:   unresolvedFilterResponse(),
+		},
+		{
+			name:   "handler not allowed",
+			filter: filter(`{"handler":"file_server","root":"/var/run/secrets"}`),
+			want:   unresolvedFilterResponse(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r testReader
+			if tt.filter != nil {
+				r = append(r, tt.filter)
+			}
+			i := &Input{
+				Client:           r,
+				GeneratorOptions: GeneratorOptions{AllowedFilterHandlers: []string{"encode"}},
+			}
+			got, err := i.getFilterHandler(context.Background(), "default", ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantJSON, err := json.Marshal(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("getFilterHandler() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestGetFilterHandlerOtherKind(t *testing.T) {
+	i := &Input{}
+	h, err := i.getFilterHandler(context.Background(), "default", gatewayv1.LocalObjectReference{Kind: "ConfigMap", Name: "error-page"})
+	if h != nil || err != nil {
+		t.Errorf("getFilterHandler() = %v, %v, want nothing for other kinds", h, err)
+	}
+}
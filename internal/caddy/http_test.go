@@ -0,0 +1,463 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/headers"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/rewrite"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
+)
+
+func TestMergeBackendProxies(t *testing.T) {
+	backend := func(weight int, dials ...string) weightedProxy {
+		proxy := &reverseproxy.Handler{Transport: &reverseproxy.HTTPTransport{}}
+		for _, d := range dials {
+			proxy.Upstreams = append(proxy.Upstreams, &reverseproxy.Upstream{Dial: d})
+		}
+		return weightedProxy{proxy: proxy, weight: weight}
+	}
+	tests := []struct {
+		name     string
+		backends []weightedProxy
+		dials    []string
+		weights  []int
+	}{
+		{
+			name:     "single backend",
+			backends: []weightedProxy{backend(10, "a:80")},
+			dials:    []string{"a:80"},
+		},
+		{
+			name:     "equal weights",
+			backends: []weightedProxy{backend(5, "a:80"), backend(5, "b:80")},
+			dials:    []string{"a:80", "b:80"},
+		},
+		{
+			name:     "canary",
+			backends: []weightedProxy{backend(90, "a:80"), backend(10, "b:80")},
+			dials:    []string{"a:80", "b:80"},
+			weights:  []int{9, 1},
+		},
+		{
+			name:     "weight shared between upstreams",
+			backends: []weightedProxy{backend(1, "a:80", "a:81", "a:82"), backend(1, "b:80")},
+			dials:    []string{"a:80", "a:81", "a:82", "b:80"},
+			weights:  []int{1, 1, 1, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := mergeBackendProxies(tt.backends, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var dials []string
+			for _, u := range proxy.Upstreams {
+				dials = append(dials, u.Dial)
+			}
+			if !slices.Equal(dials, tt.dials) {
+				t.Errorf("upstreams = %v, want %v", dials, tt.dials)
+			}
+			var weights []int
+			if proxy.LoadBalancing != nil {
+				if p, ok := proxy.LoadBalancing.SelectionPolicy.(*reverseproxy.WeightedRoundRobinSelection); ok {
+					weights = p.Weights
+				}
+			}
+			if !slices.Equal(weights, tt.weights) {
+				t.Errorf("weights = %v, want %v", weights, tt.weights)
+			}
+		})
+	}
+}
+
+func TestMergeBackendProxiesTransportMismatch(t *testing.T) {
+	backends := []weightedProxy{
+		{
+			proxy: &reverseproxy.Handler{
+				Transport: &reverseproxy.HTTPTransport{},
+				Upstreams: reverseproxy.UpstreamPool{{Dial: "a:80"}},
+			},
+			weight: 1,
+		},
+		{
+			proxy: &reverseproxy.Handler{
+				Transport: &reverseproxy.HTTPTransport{TLS: &reverseproxy.TLSConfig{}},
+				Upstreams: reverseproxy.UpstreamPool{{Dial: "b:443"}},
+			},
+			weight: 1,
+		},
+	}
+	if _, err := mergeBackendProxies(backends, false); err == nil {
+		t.Error("expected an error for backends with different transports")
+	}
+}
+
+func TestGetServiceDial(t *testing.T) {
+	sp := corev1.ServicePort{Port: 8080}
+	tests := []struct {
+		name string
+		spec corev1.ServiceSpec
+		want string
+	}{
+		{
+			name: "cluster ip",
+			spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.0.0.1"},
+			want: "10.0.0.1:8080",
+		},
+		{
+			name: "ipv6 cluster ip",
+			spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "fd00::1"},
+			want: "[fd00::1]:8080",
+		},
+		{
+			name: "headless",
+			spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: corev1.ClusterIPNone},
+			want: "app.default.svc:8080",
+		},
+		{
+			name: "external name",
+			spec: corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "example.com"},
+			want: "example.com:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+				Spec:       tt.spec,
+			}
+			if got := getServiceDial(service, sp); got != tt.want {
+				t.Errorf("getServiceDial() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPrefixRewrite(t *testing.T) {
+	prefixMatch := func(prefix string) gatewayv1.HTTPRouteMatch {
+		return gatewayv1.HTTPRouteMatch{
+			Path: &gatewayv1.HTTPPathMatch{
+				Type:  ptr.To(gatewayv1.PathMatchPathPrefix),
+				Value: ptr.To(prefix),
+			},
+		}
+	}
+	tests := []struct {
+		name        string
+		matches     []gatewayv1.HTTPRouteMatch
+		replacement string
+		path        string
+		want        string
+	}{
+		{name: "prefix", matches: []gatewayv1.HTTPRouteMatch{prefixMatch("/api")}, replacement: "/v2/api", path: "/api/users", want: "/v2/api/users"},
+		{name: "exact prefix", matches: []gatewayv1.HTTPRouteMatch{prefixMatch("/api")}, replacement: "/v2/api", path: "/api", want: "/v2/api"},
+		{name: "trailing slash", matches: []gatewayv1.HTTPRouteMatch{prefixMatch("/foo/")}, replacement: "/xyz/", path: "/foo/", want: "/xyz/"},
+		{name: "trailing slash on replacement", matches: []gatewayv1.HTTPRouteMatch{prefixMatch("/foo")}, replacement: "/xyz/", path: "/foo/bar", want: "/xyz/bar"},
+		{name: "strip prefix", matches: []gatewayv1.HTTPRouteMatch{prefixMatch("/strip")}, replacement: "/", path: "/strip/three", want: "/three"},
+		{name: "strip whole path", matches: []gatewayv1.HTTPRouteMatch{prefixMatch("/strip")}, replacement: "/", path: "/strip", want: "/"},
+		{name: "root prefix", matches: nil, replacement: "/app", path: "/users", want: "/app/users"},
+		{
+			name:        "longest prefix",
+			matches:     []gatewayv1.HTTPRouteMatch{prefixMatch("/api"), prefixMatch("/api/v1")},
+			replacement: "/v2",
+			path:        "/api/v1/users",
+			want:        "/v2/users",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := getPrefixRewrite(tt.matches, tt.replacement)
+			if got := regexp.MustCompile(rw.Find).ReplaceAllString(tt.path, rw.Replace); got != tt.want {
+				t.Errorf("rewrote %q to %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectAfterHeaderModifiers(t *testing.T) {
+	i := benchmarkInput(1)
+	i.HTTPRoutes[0].Spec.Rules[0].Filters = []gatewayv1.HTTPRouteFilter{
+		{
+			Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+			RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+				StatusCode: ptr.To(301),
+			},
+		},
+		{
+			Type: gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+			ResponseHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+				Set: []gatewayv1.HTTPHeader{{Name: "X-Redirected", Value: "true"}},
+			},
+		},
+	}
+
+	s, err := i.getHTTPServer(&caddyhttp.Server{}, i.Gateway.Spec.Listeners[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Routes) != 1 {
+		t.Fatalf("got %d routes, want 1", len(s.Routes))
+	}
+	handlers := s.Routes[0].Handlers
+	subroute, ok := handlers[len(handlers)-1].(*caddyhttp.Subroute)
+	if !ok {
+		t.Fatalf("got %T, want a subroute for the rule", handlers[len(handlers)-1])
+	}
+	ruleHandlers := subroute.Routes[0].Handlers
+	if len(ruleHandlers) != 2 {
+		t.Fatalf("got %d rule handlers, want 2", len(ruleHandlers))
+	}
+	if _, ok := ruleHandlers[0].(headers.Handler); !ok {
+		t.Errorf("got %T as the first handler, want the header modifier", ruleHandlers[0])
+	}
+	if _, ok := ruleHandlers[1].(*caddyhttp.StaticResponse); !ok {
+		t.Errorf("got %T as the last handler, want the redirect", ruleHandlers[1])
+	}
+}
+
+func TestRedirectReplacePrefixMatch(t *testing.T) {
+	i := benchmarkInput(1)
+	rule := &i.HTTPRoutes[0].Spec.Rules[0]
+	rule.Matches[0].Path.Value = ptr.To("/old")
+	rule.Filters = []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterRequestRedirect,
+		RequestRedirect: &gatewayv1.HTTPRequestRedirectFilter{
+			Scheme: ptr.To("https"),
+			Path: &gatewayv1.HTTPPathModifier{
+				Type:               gatewayv1.PrefixMatchHTTPPathModifier,
+				ReplacePrefixMatch: ptr.To("/new"),
+			},
+		},
+	}}
+
+	s, err := i.getHTTPServer(&caddyhttp.Server{}, i.Gateway.Spec.Listeners[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := s.Routes[0].Handlers
+	subroute, ok := handlers[len(handlers)-1].(*caddyhttp.Subroute)
+	if !ok {
+		t.Fatalf("got %T, want a subroute for the rule", handlers[len(handlers)-1])
+	}
+	ruleHandlers := subroute.Routes[0].Handlers
+	if len(ruleHandlers) != 2 {
+		t.Fatalf("got %d rule handlers, want 2", len(ruleHandlers))
+	}
+	rw, ok := ruleHandlers[0].(*rewrite.Rewrite)
+	if !ok || len(rw.PathRegexp) != 1 {
+		t.Fatalf("got %+v as the first handler, want a rewrite of the path", ruleHandlers[0])
+	}
+	for path, want := range map[string]string{"/old": "/new", "/old/page": "/new/page"} {
+		if got := regexp.MustCompile(rw.PathRegexp[0].Find).ReplaceAllString(path, rw.PathRegexp[0].Replace); got != want {
+			t.Errorf("rewrote %q to %q, want %q", path, got, want)
+		}
+	}
+	redirect, ok := ruleHandlers[1].(*caddyhttp.StaticResponse)
+	if !ok {
+		t.Fatalf("got %T as the last handler, want the redirect", ruleHandlers[1])
+	}
+	if got, want := redirect.Headers.Get("Location"), "https://{http.request.host}{http.request.uri}"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+}
+
+func TestSetProxyTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts gatewayv1.HTTPRouteTimeouts
+		want     time.Duration
+	}{
+		{name: "request", timeouts: gatewayv1.HTTPRouteTimeouts{Request: ptr.To[gatewayv1.Duration]("10s")}, want: 10 * time.Second},
+		{name: "backend request", timeouts: gatewayv1.HTTPRouteTimeouts{BackendRequest: ptr.To[gatewayv1.Duration]("2s")}, want: 2 * time.Second},
+		{
+			name: "shortest",
+			timeouts: gatewayv1.HTTPRouteTimeouts{
+				Request:        ptr.To[gatewayv1.Duration]("10s"),
+				BackendRequest: ptr.To[gatewayv1.Duration]("2s"),
+			},
+			want: 2 * time.Second,
+		},
+		{
+			name: "disabled request",
+			timeouts: gatewayv1.HTTPRouteTimeouts{
+				Request:        ptr.To[gatewayv1.Duration]("0s"),
+				BackendRequest: ptr.To[gatewayv1.Duration]("2s"),
+			},
+			want: 2 * time.Second,
+		},
+		{name: "disabled", timeouts: gatewayv1.HTTPRouteTimeouts{Request: ptr.To[gatewayv1.Duration]("0s")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &reverseproxy.HTTPTransport{}
+			if err := setProxyTimeouts(&reverseproxy.Handler{Transport: tr}, &tt.timeouts); err != nil {
+				t.Fatal(err)
+			}
+			if got := time.Duration(tr.ResponseHeaderTimeout); got != tt.want {
+				t.Errorf("got a timeout of %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddTLSConnPolicy(t *testing.T) {
+	sni := &caddytls.ConnectionPolicy{Matchers: caddy.ModuleMap{"sni": []byte(`["a.example.com"]`)}}
+	tests := []struct {
+		name     string
+		policies []*caddytls.ConnectionPolicy
+		want     caddytls.ConnectionPolicy
+		wantErr  bool
+	}{
+		{
+			name: "merged",
+			policies: []*caddytls.ConnectionPolicy{
+				{DefaultSNI: "a.example.com"},
+				{FallbackSNI: "b.example.com", CertSelection: &caddytls.CustomCertSelectionPolicy{AnyTag: []string{"default"}}},
+			},
+			want: caddytls.ConnectionPolicy{
+				DefaultSNI:    "a.example.com",
+				FallbackSNI:   "b.example.com",
+				CertSelection: &caddytls.CustomCertSelectionPolicy{AnyTag: []string{"default"}},
+			},
+		},
+		{
+			name: "same options",
+			policies: []*caddytls.ConnectionPolicy{
+				{DefaultSNI: "a.example.com", ALPN: []string{"h2"}},
+				{DefaultSNI: "a.example.com", ALPN: []string{"h2"}},
+			},
+			want: caddytls.ConnectionPolicy{DefaultSNI: "a.example.com", ALPN: []string{"h2"}},
+		},
+		{
+			name: "conflicting default SNI",
+			policies: []*caddytls.ConnectionPolicy{
+				{DefaultSNI: "a.example.com"},
+				{DefaultSNI: "b.example.com", FallbackSNI: "b.example.com"},
+			},
+			want:    caddytls.ConnectionPolicy{DefaultSNI: "a.example.com"},
+			wantErr: true,
+		},
+		{
+			name: "conflicting ALPN",
+			policies: []*caddytls.ConnectionPolicy{
+				{ALPN: []string{"h2"}},
+				{ALPN: []string{"http/1.1"}},
+			},
+			want:    caddytls.ConnectionPolicy{ALPN: []string{"h2"}},
+			wantErr: true,
+		},
+		{
+			name: "conflicting default certificate",
+			policies: []*caddytls.ConnectionPolicy{
+				{CertSelection: &caddytls.CustomCertSelectionPolicy{AnyTag: []string{"a"}}},
+				{CertSelection: &caddytls.CustomCertSelectionPolicy{AnyTag: []string{"b"}}},
+			},
+			want:    caddytls.ConnectionPolicy{CertSelection: &caddytls.CustomCertSelectionPolicy{AnyTag: []string{"a"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &caddyhttp.Server{}
+			var err error
+			for _, p := range tt.policies {
+				if err = addTLSConnPolicy(s, p); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addTLSConnPolicy() error = %v, want an error: %t", err, tt.wantErr)
+			}
+			// Policies with matchers are kept before the catch-all policy.
+			if err := addTLSConnPolicy(s, sni); err != nil {
+				t.Fatalf("addTLSConnPolicy() error = %v", err)
+			}
+			if len(s.TLSConnPolicies) != 2 || s.TLSConnPolicies[0] != sni {
+				t.Fatalf("got policies %+v, want the SNI policy and a catch-all policy", s.TLSConnPolicies)
+			}
+			if got := *s.TLSConnPolicies[1]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got catch-all policy %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDefaultCertificate(t *testing.T) {
+	i := &Input{Gateway: &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gateway", Name: "gateway"}}}
+	tests := []struct {
+		name        string
+		ref         gatewayv1.SecretObjectReference
+		defaultCert string
+		want        bool
+	}{
+		{name: "name", ref: gatewayv1.SecretObjectReference{Name: "cert"}, defaultCert: "cert", want: true},
+		{name: "other name", ref: gatewayv1.SecretObjectReference{Name: "other"}, defaultCert: "cert"},
+		{name: "namespace and name", ref: gatewayv1.SecretObjectReference{Name: "cert"}, defaultCert: "gateway/cert", want: true},
+		{name: "other namespace", ref: gatewayv1.SecretObjectReference{Namespace: ptr.To[gatewayv1.Namespace]("certs"), Name: "cert"}, defaultCert: "certs/cert", want: true},
+		{name: "name in other namespace", ref: gatewayv1.SecretObjectReference{Namespace: ptr.To[gatewayv1.Namespace]("certs"), Name: "cert"}, defaultCert: "cert"},
+		{name: "namespace mismatch", ref: gatewayv1.SecretObjectReference{Name: "cert"}, defaultCert: "certs/cert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := i.isDefaultCertificate(tt.ref, tt.defaultCert); got != tt.want {
+				t.Errorf("isDefaultCertificate(%+v, %q) = %t, want %t", tt.ref, tt.defaultCert, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflictingTLSOptions(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cert"},
+		Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+	}
+	listener := func(name, hostname, defaultSNI string) gatewayv1.Listener {
+		h := gatewayv1.Hostname(hostname)
+		return gatewayv1.Listener{
+			Name:     gatewayv1.SectionName(name),
+			Hostname: &h,
+			Protocol: gatewayv1.HTTPSProtocolType,
+			Port:     443,
+			TLS: &gatewayv1.GatewayTLSConfig{
+				CertificateRefs: []gatewayv1.SecretObjectReference{{Name: "cert"}},
+				Options:         map[gatewayv1.AnnotationKey]gatewayv1.AnnotationValue{TLSOptionDefaultSNI: gatewayv1.AnnotationValue(defaultSNI)},
+			},
+		}
+	}
+	i := benchmarkInput(1)
+	i.Client = testReader{secret}
+	i.Gateway.Spec.Listeners = []gatewayv1.Listener{
+		listener("a", "a.example.com", "a.example.com"),
+		listener("b", "b.example.com", "b.example.com"),
+		listener("c", "c.example.com", "a.example.com"),
+	}
+	if _, err := i.Config(); err != nil {
+		t.Fatal(err)
+	}
+	summaries := i.ListenerSummaries()
+	if conflict := summaries["a"].TLSConflict; conflict != "" {
+		t.Errorf("listener a has a TLS conflict: %s", conflict)
+	}
+	if summaries["b"].TLSConflict == "" {
+		t.Error("listener b has no TLS conflict, want its default SNI to conflict with listener a")
+	}
+	if conflict := summaries["c"].TLSConflict; conflict != "" {
+		t.Errorf("listener c has a TLS conflict: %s", conflict)
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"math"
+
+	corev1 "k8s.io/api/core/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4/l4proxy"
+)
+
+// maxWeightedUpstreams is the maximum number of upstreams a layer4 proxy
+// handler will be configured with when splitting traffic by weight.
+const maxWeightedUpstreams = 100
+
+// getL4ProxyHandler returns a layer4 proxy handler for the given backend refs,
+// or nil if none of the backend refs are valid. If network is set, it is used
+// to prefix the dial address of each upstream, e.g. `udp`.
+//
+// The layer4 proxy doesn't support weighted upstreams, instead each upstream
+// is repeated proportionally to its weight and selected using round-robin.
+func (i *Input) getL4ProxyHandler(network, routeNamespace string, refs []gatewayv1.BackendRef) *l4proxy.Handler {
+	type weightedUpstream struct {
+		dial   string
+		weight int
+	}
+	var upstreams []weightedUpstream
+	protocol := corev1.ProtocolTCP
+	if network == "udp" {
+		protocol = corev1.ProtocolUDP
+	}
+	for _, bf := range refs {
+		bor := bf.BackendObjectReference
+		if !gateway.IsService(bor) {
+			continue
+		}
+
+		// Safeguard against nil-pointer dereference.
+		if bor.Port == nil {
+			continue
+		}
+
+		// A weight of zero means no traffic should be sent to the backend.
+		weight := 1
+		if bf.Weight != nil {
+			// Out of range weights are rejected by routechecks, clamp them
+			// in case the route hasn't been reconciled yet.
+			weight = min(int(*bf.Weight), gateway.MaxBackendWeight)
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		service := i.getService(gateway.NamespaceDerefOr(bor.Namespace, routeNamespace), string(bor.Name))
+		if service == nil {
+			// Invalid service reference.
+			continue
+		}
+
+		sp, err := gateway.ResolveServicePort(service, int32(*bor.Port), protocol)
+		if err != nil {
+			continue
+		}
+		dial := getServiceDial(service, sp)
+		if network != "" {
+			dial = network + "/" + dial
+		}
+		upstreams = append(upstreams, weightedUpstream{
+			dial:   dial,
+			weight: weight,
+		})
+	}
+
+	switch len(upstreams) {
+	case 0:
+		return nil
+	case 1:
+		return &l4proxy.Handler{
+			Upstreams: l4proxy.UpstreamPool{
+				&l4proxy.Upstream{Dial: []string{upstreams[0].dial}},
+			},
+		}
+	}
+
+	// Reduce the weights to the smallest equivalent values, then scale them
+	// down to approximate values if there would still be too many upstreams.
+	divisor, total := 0, 0
+	for _, u := range upstreams {
+		divisor = gcd(divisor, u.weight)
+	}
+	for j := range upstreams {
+		upstreams[j].weight /= divisor
+		total += upstreams[j].weight
+	}
+	if total > maxWeightedUpstreams {
+		for j := range upstreams {
+			w := float64(upstreams[j].weight) * maxWeightedUpstreams / float64(total)
+			upstreams[j].weight = max(1, int(math.Round(w)))
+		}
+	}
+
+	h := &l4proxy.Handler{
+		LoadBalancing: &l4proxy.LoadBalancing{
+			SelectionPolicy: &l4proxy.RoundRobinSelection{},
+		},
+	}
+	for _, u := range upstreams {
+		for range u.weight {
+			h.Upstreams = append(h.Upstreams, &l4proxy.Upstream{Dial: []string{u.dial}})
+		}
+	}
+	return h
+}
+
+// gcd returns the greatest common divisor of a and b.
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// lcm returns the least common multiple of a and b.
+func lcm(a, b int) int {
+	return a / gcd(a, b) * b
+}
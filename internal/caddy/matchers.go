@@ -4,9 +4,15 @@
 package caddy
 
 import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
 )
 
 // getPathMatcher .
@@ -48,25 +54,54 @@ func (i *Input) getPathMatcher(matcher *caddyhttp.Match, path *gatewayv1.HTTPPat
 	return nil
 }
 
-// getHeaderMatcher .
+// getHeaderMatcher adds the header matches to the matcher. Header names are
+// canonicalized, as Caddy's matchers and Go's http.Header are, and matches on
+// different headers are AND'd, as every matcher within a Caddy matcher set
+// must match.
+//
+// A header that appears more than once in a request matches if any of its
+// values match, as Caddy's header matchers do. This doesn't hold for rules
+// using a CEL expression (see getMatchCELExpression), where the values are
+// joined with commas first. Headers that are absent never match, as the
+// Gateway API doesn't allow matching an empty value.
+//
 // ref; https://caddyserver.com/docs/json/apps/http/servers/routes/match/header/
+// ref; https://caddyserver.com/docs/json/apps/http/servers/routes/match/header_regexp/
 func (i *Input) getHeaderMatcher(matcher *caddyhttp.Match, v []gatewayv1.HTTPHeaderMatch) error {
-	if v == nil {
-		return nil
+	for _, h := range uniqueHeaderMatches(v) {
+		if h.Value == "" {
+			return fmt.Errorf("header match %q must have a value", h.Name)
+		}
+		name := textproto.CanonicalMIMEHeaderKey(string(h.Name))
+		if h.Type != nil && *h.Type == gatewayv1.HeaderMatchRegularExpression {
+			if matcher.HeaderRE == nil {
+				matcher.HeaderRE = caddyhttp.MatchHeaderRE{}
+			}
+			matcher.HeaderRE[name] = &caddyhttp.MatchRegexp{Pattern: h.Value}
+			continue
+		}
+		if matcher.Header == nil {
+			matcher.Header = caddyhttp.MatchHeader{}
+		}
+		matcher.Header[name] = []string{h.Value}
 	}
-
-	// TODO: implement
 	return nil
 }
 
 // getQueryMatcher .
 // ref; https://caddyserver.com/docs/json/apps/http/servers/routes/match/query/
 func (i *Input) getQueryMatcher(matcher *caddyhttp.Match, v []gatewayv1.HTTPQueryParamMatch) error {
-	if v == nil {
-		return nil
+	for _, q := range uniqueQueryParamMatches(v) {
+		if q.Type != nil && *q.Type != gatewayv1.QueryParamMatchExact {
+			// Caddy has no query regexp matcher, these are handled by
+			// getMatchCELExpression instead.
+			return fmt.Errorf("unsupported query param match type %q", *q.Type)
+		}
+		if matcher.Query == nil {
+			matcher.Query = caddyhttp.MatchQuery{}
+		}
+		matcher.Query[string(q.Name)] = []string{q.Value}
 	}
-
-	// TODO: implement
 	return nil
 }
 
@@ -79,3 +114,182 @@ func (i *Input) getMethodMatcher(matcher *caddyhttp.Match, m *gatewayv1.HTTPMeth
 	matcher.Method = caddyhttp.MatchMethod{string(*m)}
 	return nil
 }
+
+// uniqueHeaderMatches returns the header matches with duplicate names removed,
+// only the first match for a name is considered as required by the spec.
+func uniqueHeaderMatches(v []gatewayv1.HTTPHeaderMatch) []gatewayv1.HTTPHeaderMatch {
+	seen := map[string]struct{}{}
+	var unique []gatewayv1.HTTPHeaderMatch
+	for _, h := range v {
+		name := textproto.CanonicalMIMEHeaderKey(string(h.Name))
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		unique = append(unique, h)
+	}
+	return unique
+}
+
+// uniqueQueryParamMatches returns the query param matches with duplicate names
+// removed, only the first match for a name is considered as required by the
+// spec.
+func uniqueQueryParamMatches(v []gatewayv1.HTTPQueryParamMatch) []gatewayv1.HTTPQueryParamMatch {
+	seen := map[gatewayv1.HTTPHeaderName]struct{}{}
+	var unique []gatewayv1.HTTPQueryParamMatch
+	for _, q := range v {
+		if _, ok := seen[q.Name]; ok {
+			continue
+		}
+		seen[q.Name] = struct{}{}
+		unique = append(unique, q)
+	}
+	return unique
+}
+
+// getRuleMatcher returns the matcher for the matches of a rule, expr is an
+// optional CEL expression that must also match.
+//
+// Caddy's matchers within a matcher set are AND'd while the matches of a rule
+// must be OR'd, Caddy's header and query matchers treat `*` in values as a
+// wildcard and `{...}` as a placeholder, and have no support for query
+// regexps. So when a rule can't be represented by Caddy's native matchers, a
+// single CEL expression covering all the matches is used instead. Native
+// matchers are preferred otherwise, as they are cheaper to evaluate.
+func (i *Input) getRuleMatcher(matches []gatewayv1.HTTPRouteMatch, expr string) (*caddyhttp.Match, error) {
+	matcher := &caddyhttp.Match{}
+	if len(matches) > 1 || (len(matches) == 1 && !isNativeMatch(matches[0])) {
+		terms := make([]string, len(matches))
+		for n, m := range matches {
+			term, err := getMatchCELExpression(m)
+			if err != nil {
+				return nil, err
+			}
+			terms[n] = "(" + term + ")"
+		}
+		cel := strings.Join(terms, " || ")
+		if expr != "" {
+			cel = "(" + expr + ") && (" + cel + ")"
+		}
+		matcher.Expression = &caddyhttp.MatchExpression{Expr: cel}
+		return matcher, nil
+	}
+
+	if expr != "" {
+		matcher.Expression = &caddyhttp.MatchExpression{Expr: expr}
+	}
+	for _, m := range matches {
+		if err := i.getPathMatcher(matcher, m.Path); err != nil {
+			return nil, err
+		}
+		if err := i.getHeaderMatcher(matcher, m.Headers); err != nil {
+			return nil, err
+		}
+		if err := i.getQueryMatcher(matcher, m.QueryParams); err != nil {
+			return nil, err
+		}
+		if err := i.getMethodMatcher(matcher, m.Method); err != nil {
+			return nil, err
+		}
+	}
+	return matcher, nil
+}
+
+// isNativeMatch returns true if the match can be represented exactly using
+// Caddy's native matchers.
+func isNativeMatch(m gatewayv1.HTTPRouteMatch) bool {
+	for _, h := range uniqueHeaderMatches(m.Headers) {
+		if (h.Type == nil || *h.Type == gatewayv1.HeaderMatchExact) && strings.ContainsAny(h.Value, "*{") {
+			return false
+		}
+	}
+	for _, q := range uniqueQueryParamMatches(m.QueryParams) {
+		if q.Type != nil && *q.Type != gatewayv1.QueryParamMatchExact {
+			return false
+		}
+		if strings.ContainsAny(q.Value, "*{") {
+			return false
+		}
+	}
+	return true
+}
+
+// placeholderNameRegexp matches names that can be used within a placeholder
+// in a CEL expression.
+// ref; https://github.com/caddyserver/caddy/blob/v2.8.4/modules/caddyhttp/celmatcher.go
+var placeholderNameRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+// celQuote returns a CEL string literal for s. Caddy replaces placeholders
+// anywhere in an expression, including within string literals, so braces are
+// escaped to prevent values being treated as placeholders.
+func celQuote(s string) string {
+	return strings.ReplaceAll(strconv.Quote(s), "{", `\u007b`)
+}
+
+// webSocketMatchExpression is a CEL expression matching WebSocket upgrade
+// requests, which have a `Connection` header containing `Upgrade` and an
+// `Upgrade` header of `websocket`. Both are case-insensitive.
+// ref; https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+var webSocketMatchExpression = "header_regexp(" + celQuote("Connection") + ", " + celQuote(`(?i)\bupgrade\b`) + ") && " +
+	"header_regexp(" + celQuote("Upgrade") + ", " + celQuote(`(?i)^websocket$`) + ")"
+
+// getMatchCELExpression returns a CEL expression equivalent to the match.
+// Exact header matches compare against the `{http.request.header.*}`
+// placeholder, which joins the values of a repeated header with commas, so they
+// only match a header that appears once.
+// ref; https://caddyserver.com/docs/caddyfile/matchers#expression
+func getMatchCELExpression(m gatewayv1.HTTPRouteMatch) (string, error) {
+	var terms []string
+	if m.Path != nil && m.Path.Value != nil && *m.Path.Value != "" {
+		value := *m.Path.Value
+		matchType := gatewayv1.PathMatchPathPrefix
+		if m.Path.Type != nil {
+			matchType = *m.Path.Type
+		}
+		switch matchType {
+		case gatewayv1.PathMatchExact:
+			terms = append(terms, "path("+celQuote(value)+")")
+		case gatewayv1.PathMatchPathPrefix:
+			// Keep in sync with getPathMatcher.
+			if value != "/" {
+				terms = append(terms, "path("+celQuote(value+"*")+")")
+			}
+		case gatewayv1.PathMatchRegularExpression:
+			terms = append(terms, "path_regexp("+celQuote(value)+")")
+		}
+	}
+	if m.Method != nil {
+		terms = append(terms, "method("+celQuote(string(*m.Method))+")")
+	}
+	for _, h := range uniqueHeaderMatches(m.Headers) {
+		if h.Value == "" {
+			// An empty placeholder would match an absent header.
+			return "", fmt.Errorf("header match %q must have a value", h.Name)
+		}
+		name := textproto.CanonicalMIMEHeaderKey(string(h.Name))
+		if h.Type != nil && *h.Type == gatewayv1.HeaderMatchRegularExpression {
+			terms = append(terms, "header_regexp("+celQuote(name)+", "+celQuote(h.Value)+")")
+			continue
+		}
+		if !placeholderNameRegexp.MatchString(name) {
+			return "", fmt.Errorf("unsupported header name %q", name)
+		}
+		terms = append(terms, "{http.request.header."+name+"} == "+celQuote(h.Value))
+	}
+	for _, q := range uniqueQueryParamMatches(m.QueryParams) {
+		name := string(q.Name)
+		if !placeholderNameRegexp.MatchString(name) {
+			return "", fmt.Errorf("unsupported query param name %q", name)
+		}
+		placeholder := "{http.request.uri.query." + name + "}"
+		if q.Type != nil && *q.Type == gatewayv1.QueryParamMatchRegularExpression {
+			terms = append(terms, placeholder+".matches("+celQuote(q.Value)+")")
+			continue
+		}
+		terms = append(terms, placeholder+" == "+celQuote(q.Value))
+	}
+	if len(terms) == 0 {
+		return "true", nil
+	}
+	return strings.Join(terms, " && "), nil
+}
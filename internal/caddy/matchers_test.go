@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+)
+
+func TestGetHeaderMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []gatewayv1.HTTPHeaderMatch
+		want    *caddyhttp.Match
+		wantErr bool
+	}{
+		{
+			name:    "exact",
+			headers: []gatewayv1.HTTPHeaderMatch{{Name: "x-version", Value: "v1"}},
+			want:    &caddyhttp.Match{Header: caddyhttp.MatchHeader{"X-Version": {"v1"}}},
+		},
+		{
+			name: "regular expression",
+			headers: []gatewayv1.HTTPHeaderMatch{{
+				Type:  ptr.To(gatewayv1.HeaderMatchRegularExpression),
+				Name:  "X-Version",
+				Value: "^v[12]$",
+			}},
+			want: &caddyhttp.Match{HeaderRE: caddyhttp.MatchHeaderRE{"X-Version": {Pattern: "^v[12]$"}}},
+		},
+		{
+			name: "different headers",
+			headers: []gatewayv1.HTTPHeaderMatch{
+				{Name: "X-Version", Value: "v1"},
+				{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "X-Env", Value: "prod|staging"},
+			},
+			want: &caddyhttp.Match{
+				Header:   caddyhttp.MatchHeader{"X-Version": {"v1"}},
+				HeaderRE: caddyhttp.MatchHeaderRE{"X-Env": {Pattern: "prod|staging"}},
+			},
+		},
+		{
+			name: "names differing in case",
+			headers: []gatewayv1.HTTPHeaderMatch{
+				{Name: "X-Version", Value: "v1"},
+				{Name: "x-version", Value: "v2"},
+			},
+			want: &caddyhttp.Match{Header: caddyhttp.MatchHeader{"X-Version": {"v1"}}},
+		},
+		{
+			name:    "empty value",
+			headers: []gatewayv1.HTTPHeaderMatch{{Name: "X-Version"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &caddyhttp.Match{}
+			err := (&Input{}).getHeaderMatcher(got, tt.headers)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("getHeaderMatcher() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetQueryMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []gatewayv1.HTTPQueryParamMatch
+		want    *caddyhttp.Match
+		wantErr bool
+	}{
+		{
+			name:   "exact",
+			params: []gatewayv1.HTTPQueryParamMatch{{Name: "version", Value: "v1"}},
+			want:   &caddyhttp.Match{Query: caddyhttp.MatchQuery{"version": {"v1"}}},
+		},
+		{
+			name: "repeated name",
+			params: []gatewayv1.HTTPQueryParamMatch{
+				{Name: "version", Value: "v1"},
+				{Name: "version", Value: "v2"},
+				{Name: "env", Value: "prod"},
+			},
+			want: &caddyhttp.Match{Query: caddyhttp.MatchQuery{"version": {"v1"}, "env": {"prod"}}},
+		},
+		{
+			name: "regular expression",
+			params: []gatewayv1.HTTPQueryParamMatch{{
+				Type:  ptr.To(gatewayv1.QueryParamMatchRegularExpression),
+				Name:  "version",
+				Value: "v[12]",
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &caddyhttp.Match{}
+			err := (&Input{}).getQueryMatcher(got, tt.params)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("getQueryMatcher() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetRuleMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		matches []gatewayv1.HTTPRouteMatch
+		want    *caddyhttp.Match
+	}{
+		{
+			name: "native",
+			matches: []gatewayv1.HTTPRouteMatch{{
+				Path:        &gatewayv1.HTTPPathMatch{Type: ptr.To(gatewayv1.PathMatchExact), Value: ptr.To("/api")},
+				Method:      ptr.To(gatewayv1.HTTPMethodGet),
+				Headers:     []gatewayv1.HTTPHeaderMatch{{Name: "X-Version", Value: "v1"}},
+				QueryParams: []gatewayv1.HTTPQueryParamMatch{{Name: "env", Value: "prod"}},
+			}},
+			want: &caddyhttp.Match{
+				Path:   caddyhttp.MatchPath{"/api"},
+				Method: caddyhttp.MatchMethod{"GET"},
+				Header: caddyhttp.MatchHeader{"X-Version": {"v1"}},
+				Query:  caddyhttp.MatchQuery{"env": {"prod"}},
+			},
+		},
+		{
+			// Caddy's header matcher treats `*` as a wildcard.
+			name: "wildcard in a header value",
+			matches: []gatewayv1.HTTPRouteMatch{{
+				Headers: []gatewayv1.HTTPHeaderMatch{{Name: "X-Version", Value: "v*"}},
+			}},
+			want: &caddyhttp.Match{Expression: &caddyhttp.MatchExpression{
+				Expr: `({http.request.header.X-Version} == "v*")`,
+			}},
+		},
+		{
+			name: "query regular expression",
+			matches: []gatewayv1.HTTPRouteMatch{{
+				QueryParams: []gatewayv1.HTTPQueryParamMatch{{
+					Type:  ptr.To(gatewayv1.QueryParamMatchRegularExpression),
+					Name:  "env",
+					Value: "prod|staging",
+				}},
+			}},
+			want: &caddyhttp.Match{Expression: &caddyhttp.MatchExpression{
+				Expr: `({http.request.uri.query.env}.matches("prod|staging"))`,
+			}},
+		},
+		{
+			// The matches of a rule are OR'd, while matchers in a Caddy
+			// matcher set are AND'd.
+			name: "multiple matches",
+			matches: []gatewayv1.HTTPRouteMatch{
+				{Path: &gatewayv1.HTTPPathMatch{Value: ptr.To("/api")}, Method: ptr.To(gatewayv1.HTTPMethodPost)},
+				{Headers: []gatewayv1.HTTPHeaderMatch{{Name: "x-version", Value: "v1"}}},
+			},
+			want: &caddyhttp.Match{Expression: &caddyhttp.MatchExpression{
+				Expr: `(path("/api*") && method("POST")) || ({http.request.header.X-Version} == "v1")`,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Input{}).getRuleMatcher(tt.matches, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("getRuleMatcher() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestGetRuleMatcherEmptyHeaderValue checks that empty header values are
+// rejected. Caddy's header matcher gives empty values a special meaning and
+// comparing a placeholder with an empty value in CEL matches requests without
+// the header, while the Gateway API requires a header to be present to match.
+func TestGetRuleMatcherEmptyHeaderValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		matches []gatewayv1.HTTPRouteMatch
+	}{
+		{
+			name:    "native",
+			matches: []gatewayv1.HTTPRouteMatch{{Headers: []gatewayv1.HTTPHeaderMatch{{Name: "X-Version"}}}},
+		},
+		{
+			name: "cel",
+			matches: []gatewayv1.HTTPRouteMatch{
+				{Headers: []gatewayv1.HTTPHeaderMatch{{Name: "X-Version"}}},
+				{Method: ptr.To(gatewayv1.HTTPMethodGet)},
+			},
+		},
+		{
+			name: "regular expression",
+			matches: []gatewayv1.HTTPRouteMatch{{
+				Headers: []gatewayv1.HTTPHeaderMatch{{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "X-Version"}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := (&Input{}).getRuleMatcher(tt.matches, ""); err == nil {
+				t.Errorf("getRuleMatcher() = %+v, want an error", m)
+			}
+		})
+	}
+}
+
+// BenchmarkGetRuleMatcher compares generating native matchers with generating
+// a CEL expression for the same match.
+func BenchmarkGetRuleMatcher(b *testing.B) {
+	match := gatewayv1.HTTPRouteMatch{
+		Path:   &gatewayv1.HTTPPathMatch{Value: ptr.To("/api")},
+		Method: ptr.To(gatewayv1.HTTPMethodGet),
+		Headers: []gatewayv1.HTTPHeaderMatch{
+			{Name: "X-Version", Value: "v1"},
+			{Type: ptr.To(gatewayv1.HeaderMatchRegularExpression), Name: "X-Env", Value: "prod|staging"},
+		},
+		QueryParams: []gatewayv1.HTTPQueryParamMatch{{Name: "debug", Value: "true"}},
+	}
+	benchmarks := []struct {
+		name    string
+		matches []gatewayv1.HTTPRouteMatch
+	}{
+		{name: "native", matches: []gatewayv1.HTTPRouteMatch{match}},
+		// Multiple matches can only be represented by a CEL expression.
+		{name: "cel", matches: []gatewayv1.HTTPRouteMatch{match, match}},
+	}
+	i := &Input{}
+	for _, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				if _, err := i.getRuleMatcher(bb.matches, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/mirror"
+)
+
+// getMirrorHandler returns a handler that mirrors requests to the backend of
+// a RequestMirror filter, or nil if the backend can't be resolved, isn't
+// allowed by a ReferenceGrant or the rule has an invalid mirror percentage.
+//
+// The mirror handler isn't part of Caddy, see modules/mirror.
+func (i *Input) getMirrorHandler(s *caddyhttp.Server, hr *gatewayv1.HTTPRoute, ruleIndex int, bor gatewayv1.BackendObjectReference) (caddyhttp.Handler, error) {
+	if !gateway.IsService(bor) || bor.Port == nil {
+		return nil, nil
+	}
+	if !i.isBackendAllowed(hr.Namespace, "HTTPRoute", bor) {
+		return nil, nil
+	}
+	service := i.getService(gateway.NamespaceDerefOr(bor.Namespace, hr.Namespace), string(bor.Name))
+	if service == nil {
+		return nil, nil
+	}
+	sp, err := gateway.ResolveServicePort(service, int32(*bor.Port), corev1.ProtocolTCP)
+	if err != nil {
+		return nil, nil
+	}
+	// Invalid percentages are rejected by the webhook, don't mirror more
+	// requests than intended if one slipped through.
+	percent, err := getMirrorPercent(hr, ruleIndex)
+	if err != nil {
+		return nil, nil
+	}
+
+	proxy, err := i.getBackendProxy(service, sp)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := addNamedProxy(s, service, sp.Port, proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &mirror.Handler{
+		Percent: percent,
+		Routes: []caddyhttp.Route{
+			{Handlers: []caddyhttp.Handler{handler}},
+		},
+	}, nil
+}
@@ -0,0 +1,464 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
+)
+
+// Implementation-specific listener TLS options, these are read from a
+// Listener's `tls.options` field.
+// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.GatewayTLSConfig
+const (
+	// TLSOptionDefaultSNI is the ServerName to use when a client does not
+	// send SNI, for example when the Gateway is accessed by IP address.
+	TLSOptionDefaultSNI = gatewayv1.AnnotationKey(gateway.ControllerDomain + "/default-sni")
+
+	// TLSOptionFallbackSNI is the ServerName to use when the ServerName sent
+	// by a client doesn't match any loaded certificates.
+	TLSOptionFallbackSNI = gatewayv1.AnnotationKey(gateway.ControllerDomain + "/fallback-sni")
+
+	// TLSOptionDefaultCertificate is the name, or `namespace/name`, of one of
+	// the Listener's certificateRefs that should be served to clients that
+	// either don't send SNI, or send SNI that doesn't match any other policy.
+	// Names without a namespace refer to the Gateway's namespace.
+	TLSOptionDefaultCertificate = gatewayv1.AnnotationKey(gateway.ControllerDomain + "/default-certificate")
+
+	// TLSOptionALPN is a comma-separated list of protocols to offer during
+	// Application-Layer Protocol Negotiation, in order of preference. Setting
+	// this to `h2` prevents clients from negotiating HTTP/1.1, which is useful
+	// for Listeners that only serve gRPC.
+	TLSOptionALPN = gatewayv1.AnnotationKey(gateway.ControllerDomain + "/alpn")
+)
+
+// getTLSOption returns the value of the given TLS option on the listener, if
+// it is set.
+func getTLSOption(l gatewayv1.Listener, key gatewayv1.AnnotationKey) (string, bool) {
+	if l.TLS == nil || l.TLS.Options == nil {
+		return "", false
+	}
+	v, ok := l.TLS.Options[key]
+	if !ok || v == "" {
+		return "", false
+	}
+	return string(v), true
+}
+
+// getTLSALPN returns the ALPN protocols configured on the listener, if any.
+func getTLSALPN(l gatewayv1.Listener) []string {
+	v, ok := getTLSOption(l, TLSOptionALPN)
+	if !ok {
+		return nil
+	}
+	return splitList(v)
+}
+
+// splitList splits a comma-separated list, ignoring any empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Implementation-specific BackendTLSPolicy annotations.
+const (
+	// BackendTLSPolicyAnnotationClientCertificate is the name of a Secret
+	// containing a client certificate (`tls.crt` and `tls.key`) to present to
+	// backends that require mutual TLS.
+	//
+	// The Secret must exist in the same namespace as the Gateway, a
+	// BackendTLSPolicy in another namespace must be allowed to reference it by
+	// a ReferenceGrant. Caddy is only able to load client certificates from
+	// disk, so the Secret is mounted under ClientCertificatesPath on Caddy pods
+	// provisioned by the controller, which are restarted when it changes. It
+	// must be mounted by hand on any other Caddy instances.
+	BackendTLSPolicyAnnotationClientCertificate = string(gateway.ControllerDomain + "/client-certificate")
+
+	// ClientCertificatesPath is the directory that client certificate Secrets
+	// are expected to be mounted on Caddy pods. Each Secret must be mounted in a
+	// sub-directory with the same name as the Secret.
+	ClientCertificatesPath = "/var/run/secrets/client-certificates"
+)
+
+// Implementation-specific HTTPRoute annotations.
+const (
+	// HTTPRouteAnnotationMatchExpression is a raw CEL expression that requests
+	// must match in addition to the route's hostnames. This is an escape hatch
+	// for matches that can't be expressed using the Gateway API, any Caddy
+	// placeholders may be used within the expression.
+	//
+	// To only apply an expression to a single rule, suffix the annotation with
+	// the index of the rule, e.g. `caddyserver.com/match-expression.0`.
+	//
+	// ref; https://caddyserver.com/docs/json/apps/http/servers/routes/match/expression/
+	HTTPRouteAnnotationMatchExpression = string(gateway.ControllerDomain + "/match-expression")
+
+	// HTTPRouteAnnotationFailover changes how requests are sent to the
+	// backendRefs of a rule when set to `true`. Rather than splitting traffic
+	// using their weights, all requests are sent to the first backend and
+	// only fail over to the next backend while every backend before it is
+	// unhealthy, for active/passive setups.
+	//
+	// Like HTTPRouteAnnotationMatchExpression, the annotation may be suffixed
+	// with the index of a rule to only apply to that rule.
+	HTTPRouteAnnotationFailover = string(gateway.ControllerDomain + "/failover")
+
+	// HTTPRouteAnnotationFailoverHealthCheck is a path on the backends of
+	// failover rules to actively health check, so traffic is moved off of a
+	// backend before requests to it fail. Supports rule suffixes too.
+	HTTPRouteAnnotationFailoverHealthCheck = string(gateway.ControllerDomain + "/failover-health-check")
+
+	// HTTPRouteAnnotationWebSocketOnly restricts a rule to WebSocket upgrade
+	// requests when set to `true`, so WebSocket traffic can be sent to
+	// different backends than the rest of an application's requests. These
+	// rules are evaluated before the other rules of the route. Supports rule
+	// suffixes too.
+	HTTPRouteAnnotationWebSocketOnly = string(gateway.ControllerDomain + "/websocket-only")
+
+	// HTTPRouteAnnotationMirrorPercent is the percentage of requests to copy
+	// to the backend of a RequestMirror filter, between 0 and 100 (e.g.
+	// `12.5`). Every request is mirrored by default. Supports rule suffixes
+	// too.
+	HTTPRouteAnnotationMirrorPercent = string(gateway.ControllerDomain + "/mirror-percent")
+)
+
+// getMatchExpression returns the CEL match expression for the route, or for
+// a specific rule if ruleIndex is not negative.
+func getMatchExpression(hr *gatewayv1.HTTPRoute, ruleIndex int) string {
+	key := HTTPRouteAnnotationMatchExpression
+	if ruleIndex >= 0 {
+		key += "." + strconv.Itoa(ruleIndex)
+	}
+	return hr.Annotations[key]
+}
+
+// getRuleAnnotation returns the value of an annotation for a specific rule,
+// falling back to the value for the whole route.
+func getRuleAnnotation(hr *gatewayv1.HTTPRoute, key string, ruleIndex int) string {
+	if v, ok := hr.Annotations[key+"."+strconv.Itoa(ruleIndex)]; ok {
+		return v
+	}
+	return hr.Annotations[key]
+}
+
+// isFailover returns true if the rule's backends should be failed over
+// between, rather than load balanced.
+func isFailover(hr *gatewayv1.HTTPRoute, ruleIndex int) bool {
+	return getRuleAnnotation(hr, HTTPRouteAnnotationFailover, ruleIndex) == "true"
+}
+
+// getFailoverHealthCheck returns the path to actively health check the
+// backends of a failover rule with, if any.
+func getFailoverHealthCheck(hr *gatewayv1.HTTPRoute, ruleIndex int) string {
+	return getRuleAnnotation(hr, HTTPRouteAnnotationFailoverHealthCheck, ruleIndex)
+}
+
+// isWebSocketOnly returns true if the rule should only match WebSocket upgrade
+// requests.
+func isWebSocketOnly(hr *gatewayv1.HTTPRoute, ruleIndex int) bool {
+	return getRuleAnnotation(hr, HTTPRouteAnnotationWebSocketOnly, ruleIndex) == "true"
+}
+
+// getRuleOrder returns the indexes of the route's rules in the order they
+// should be evaluated, WebSocket-only rules are more specific than the other
+// rules so come first.
+func getRuleOrder(hr *gatewayv1.HTTPRoute) []int {
+	order := make([]int, 0, len(hr.Spec.Rules))
+	for ri := range hr.Spec.Rules {
+		if isWebSocketOnly(hr, ri) {
+			order = append(order, ri)
+		}
+	}
+	for ri := range hr.Spec.Rules {
+		if !isWebSocketOnly(hr, ri) {
+			order = append(order, ri)
+		}
+	}
+	return order
+}
+
+// getMirrorPercent returns the percentage of requests the RequestMirror
+// filters of a rule mirror, nil means every request.
+func getMirrorPercent(hr *gatewayv1.HTTPRoute, ruleIndex int) (*float64, error) {
+	v := getRuleAnnotation(hr, HTTPRouteAnnotationMirrorPercent, ruleIndex)
+	if v == "" {
+		return nil, nil
+	}
+	percent, err := strconv.ParseFloat(v, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("invalid %s annotation: %q is not a percentage between 0 and 100", HTTPRouteAnnotationMirrorPercent, v)
+	}
+	return &percent, nil
+}
+
+// ValidateHTTPRouteAnnotations returns an error if any of the implementation
+// specific annotations of an HTTPRoute are invalid.
+func ValidateHTTPRouteAnnotations(hr *gatewayv1.HTTPRoute) error {
+	if _, err := getMirrorPercent(hr, -1); err != nil {
+		return err
+	}
+	for ri := range hr.Spec.Rules {
+		if _, err := getMirrorPercent(hr, ri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Implementation-specific TLSRoute annotations.
+const (
+	// TLSRouteAnnotationMatchALPN is a comma-separated list of protocols, the
+	// route only matches clients that offer at least one of them during
+	// Application-Layer Protocol Negotiation, e.g. `h2`.
+	TLSRouteAnnotationMatchALPN = string(gateway.ControllerDomain + "/match-alpn")
+
+	// TLSRouteAnnotationMatchRemoteIP is a comma-separated list of IPs or CIDR
+	// ranges, the route only matches connections from them.
+	TLSRouteAnnotationMatchRemoteIP = string(gateway.ControllerDomain + "/match-remote-ip")
+)
+
+// getTLSRouteMatcher returns the TLS matcher for the annotations of a
+// TLSRoute, which is empty if it has none.
+func getTLSRouteMatcher(tr *gatewayv1alpha2.TLSRoute) (layer4.MatchTLS, error) {
+	m := layer4.MatchTLS{
+		ALPN: splitList(tr.Annotations[TLSRouteAnnotationMatchALPN]),
+	}
+	if ranges := splitList(tr.Annotations[TLSRouteAnnotationMatchRemoteIP]); len(ranges) > 0 {
+		for _, r := range ranges {
+			if _, err := netip.ParsePrefix(r); err == nil {
+				continue
+			}
+			if _, err := netip.ParseAddr(r); err != nil {
+				return layer4.MatchTLS{}, fmt.Errorf("invalid %s annotation: %q is not an IP or CIDR range", TLSRouteAnnotationMatchRemoteIP, r)
+			}
+		}
+		m.RemoteIP = &layer4.MatchTLSRemoteIP{Ranges: ranges}
+	}
+	return m, nil
+}
+
+// ValidateTLSRouteAnnotations returns an error if any of the implementation
+// specific annotations of a TLSRoute are invalid, such routes are never
+// programmed.
+func ValidateTLSRouteAnnotations(tr *gatewayv1alpha2.TLSRoute) error {
+	_, err := getTLSRouteMatcher(tr)
+	return err
+}
+
+// Implementation-specific Gateway annotations.
+const (
+	// GatewayAnnotationGatewayHeader is the name of a request header to set to
+	// the `namespace/name` of the Gateway on requests proxied to backends.
+	// Invalid header names are ignored, see ValidateIdentityHeaders.
+	GatewayAnnotationGatewayHeader = string(gateway.ControllerDomain + "/gateway-header")
+
+	// GatewayAnnotationRouteHeader is the name of a request header to set to
+	// the `namespace/name` of the matched route on requests proxied to
+	// backends. Invalid header names are ignored, see ValidateIdentityHeaders.
+	GatewayAnnotationRouteHeader = string(gateway.ControllerDomain + "/route-header")
+
+	// GatewayAnnotationHealthCheckPath is a path that every HTTP listener of
+	// the Gateway responds to with a 200 status, or a 503 status while the
+	// Caddy instance is being drained. External load balancers should use this
+	// path for their health checks, so they stop sending traffic to instances
+	// before they are removed.
+	GatewayAnnotationHealthCheckPath = string(gateway.ControllerDomain + "/health-check-path")
+
+	// GatewayAnnotationStrictSNIHost requires the Host header of requests to
+	// HTTPS listeners to match the ServerName (SNI) sent by the client, when
+	// set to `true`. Requests that don't match are rejected, preventing a
+	// client from reaching one hostname's routes using another hostname's
+	// certificate, which is important for Gateways shared by multiple tenants.
+	GatewayAnnotationStrictSNIHost = string(gateway.ControllerDomain + "/strict-sni-host")
+
+	// GatewayAnnotationAbortUnknownHosts aborts requests to HTTPS listeners
+	// whose Host header doesn't match the hostname of any HTTPS listener on
+	// the same port, when set to `true`. The connection is closed without a
+	// response, reducing junk traffic (e.g. scanners) reaching backends when
+	// a Gateway's address is shared. Has no effect on ports with an HTTPS
+	// listener that doesn't set a hostname, as it matches every host.
+	GatewayAnnotationAbortUnknownHosts = string(gateway.ControllerDomain + "/abort-unknown-hosts")
+
+	// GatewayAnnotationH2CListeners is a comma-separated list of the names of
+	// HTTP listeners that should accept HTTP/2 over cleartext (h2c) alongside
+	// HTTP/1.1, e.g. for gRPC clients that don't use TLS. Listeners sharing a
+	// port share a Caddy server, so h2c applies to every listener on the port.
+	GatewayAnnotationH2CListeners = string(gateway.ControllerDomain + "/h2c-listeners")
+
+	// GatewayAnnotationMaxRequestBodySize is the maximum size of request
+	// bodies accepted by the Gateway's HTTP listeners, as a quantity (e.g.
+	// `10Mi`). Requests with larger bodies are rejected with a 413 status.
+	GatewayAnnotationMaxRequestBodySize = string(gateway.ControllerDomain + "/max-request-body-size")
+
+	// GatewayAnnotationRequestBuffers is the size, as a quantity, of request
+	// bodies to buffer in memory before they are proxied to backends. This
+	// should be avoided unless backends are intolerant of slow uploads or
+	// chunked encoding.
+	GatewayAnnotationRequestBuffers = string(gateway.ControllerDomain + "/request-buffers")
+
+	// GatewayAnnotationResponseBuffers is the size, as a quantity, of
+	// response bodies to buffer in memory before they are sent to clients.
+	GatewayAnnotationResponseBuffers = string(gateway.ControllerDomain + "/response-buffers")
+)
+
+// bodyLimits are the limits on request and response bodies configured on a
+// Gateway, all sizes are in bytes and zero means unlimited (or unbuffered).
+type bodyLimits struct {
+	MaxRequestBodySize int64
+	RequestBuffers     int64
+	ResponseBuffers    int64
+}
+
+// getBodyLimits parses the body limit annotations of a Gateway.
+func getBodyLimits(gw *gatewayv1.Gateway) (bodyLimits, error) {
+	var (
+		limits bodyLimits
+		err    error
+	)
+	if limits.MaxRequestBodySize, err = getSizeAnnotation(gw, GatewayAnnotationMaxRequestBodySize); err != nil {
+		return limits, err
+	}
+	if limits.RequestBuffers, err = getSizeAnnotation(gw, GatewayAnnotationRequestBuffers); err != nil {
+		return limits, err
+	}
+	if limits.ResponseBuffers, err = getSizeAnnotation(gw, GatewayAnnotationResponseBuffers); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+// getSizeAnnotation parses an annotation containing a size in bytes as a
+// Kubernetes quantity, returning zero if the annotation is not set.
+func getSizeAnnotation(gw *gatewayv1.Gateway, key string) (int64, error) {
+	v, ok := gw.Annotations[key]
+	if !ok || v == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s annotation %q: %w", key, v, err)
+	}
+	size, ok := q.AsInt64()
+	if !ok || size < 0 {
+		return 0, fmt.Errorf("invalid %s annotation %q: must be a positive number of bytes", key, v)
+	}
+	return size, nil
+}
+
+// getAbortUnknownHostsRoute returns a route that aborts requests to the HTTPS
+// listeners on the given port whose Host header doesn't match the hostname of
+// any of them, if the Gateway enables GatewayAnnotationAbortUnknownHosts.
+func getAbortUnknownHostsRoute(gw *gatewayv1.Gateway, port gatewayv1.PortNumber) (caddyhttp.Route, bool) {
+	if gw.Annotations[GatewayAnnotationAbortUnknownHosts] != "true" {
+		return caddyhttp.Route{}, false
+	}
+	var hosts caddyhttp.MatchHost
+	for _, l := range gw.Spec.Listeners {
+		if l.Port != port || l.Protocol != gatewayv1.HTTPSProtocolType {
+			continue
+		}
+		if l.Hostname == nil || *l.Hostname == "" {
+			return caddyhttp.Route{}, false
+		}
+		hosts = append(hosts, string(*l.Hostname))
+	}
+	if len(hosts) == 0 {
+		return caddyhttp.Route{}, false
+	}
+	return caddyhttp.Route{
+		MatcherSets: []caddyhttp.Match{
+			{Not: &caddyhttp.MatchNot{MatcherSets: []caddyhttp.Match{{Host: hosts}}}},
+		},
+		Handlers: []caddyhttp.Handler{
+			&caddyhttp.StaticResponse{Abort: true},
+		},
+		Terminal: true,
+	}, true
+}
+
+// isH2CListener returns true if the Gateway enables h2c for the listener.
+func isH2CListener(gw *gatewayv1.Gateway, l gatewayv1.Listener) bool {
+	for _, name := range strings.Split(gw.Annotations[GatewayAnnotationH2CListeners], ",") {
+		if strings.TrimSpace(name) == string(l.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStrictSNIHost returns true if the Gateway requires the Host header of
+// HTTPS requests to match the client's SNI.
+func isStrictSNIHost(gw *gatewayv1.Gateway) bool {
+	return gw.Annotations[GatewayAnnotationStrictSNIHost] == "true"
+}
+
+// getIdentityHeaders returns the request headers used to propagate the
+// identity of the Gateway and route to backends, if any are configured.
+func getIdentityHeaders(gw *gatewayv1.Gateway, route client.Object) http.Header {
+	h := http.Header{}
+	if name, err := getIdentityHeaderName(gw, GatewayAnnotationGatewayHeader); err == nil && name != "" {
+		h.Set(name, client.ObjectKeyFromObject(gw).String())
+	}
+	if name, err := getIdentityHeaderName(gw, GatewayAnnotationRouteHeader); err == nil && name != "" {
+		h.Set(name, client.ObjectKeyFromObject(route).String())
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+// getIdentityHeaderName returns the header name set by an identity header
+// annotation, or an empty name if the annotation is not set.
+func getIdentityHeaderName(gw *gatewayv1.Gateway, key string) (string, error) {
+	name := gw.Annotations[key]
+	if name == "" {
+		return "", nil
+	}
+	if errs := validation.IsHTTPHeaderName(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid %s annotation %q: %s", key, name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// HasIdentityHeaders returns true if any identity header annotation is set on
+// the Gateway, whether or not it is valid.
+func HasIdentityHeaders(gw *gatewayv1.Gateway) bool {
+	return gw.Annotations[GatewayAnnotationGatewayHeader] != "" || gw.Annotations[GatewayAnnotationRouteHeader] != ""
+}
+
+// ValidateIdentityHeaders checks that the identity header annotations of the
+// Gateway are valid HTTP header names. Invalid headers are not set on
+// requests, rather than failing to generate the Gateway's config.
+func ValidateIdentityHeaders(gw *gatewayv1.Gateway) error {
+	var errs []string
+	for _, key := range []string{GatewayAnnotationGatewayHeader, GatewayAnnotationRouteHeader} {
+		if _, err := getIdentityHeaderName(gw, key); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
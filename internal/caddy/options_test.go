@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestGetMirrorPercent(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		ruleIndex   int
+		want        *float64
+		wantErr     bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:        "route",
+			annotations: map[string]string{HTTPRouteAnnotationMirrorPercent: "12.5"},
+			want:        ptr.To(12.5),
+		},
+		{
+			name: "rule overrides route",
+			annotations: map[string]string{
+				HTTPRouteAnnotationMirrorPercent:        "12.5",
+				HTTPRouteAnnotationMirrorPercent + ".1": "50",
+			},
+			ruleIndex: 1,
+			want:      ptr.To[float64](50),
+		},
+		{
+			name:        "other rule",
+			annotations: map[string]string{HTTPRouteAnnotationMirrorPercent + ".1": "50"},
+		},
+		{
+			name:        "zero",
+			annotations: map[string]string{HTTPRouteAnnotationMirrorPercent: "0"},
+			want:        ptr.To[float64](0),
+		},
+		{
+			name:        "invalid",
+			annotations: map[string]string{HTTPRouteAnnotationMirrorPercent: "half"},
+			wantErr:     true,
+		},
+		{
+			name:        "out of range",
+			annotations: map[string]string{HTTPRouteAnnotationMirrorPercent: "101"},
+			wantErr:     true,
+		},
+		{
+			name:        "negative",
+			annotations: map[string]string{HTTPRouteAnnotationMirrorPercent + ".0": "-1"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hr := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getMirrorPercent(hr, tt.ruleIndex)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMirrorPercent() error = %v, want error: %t", err, tt.wantErr)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Errorf("getMirrorPercent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityHeaders(t *testing.T) {
+	route := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "route"}}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        http.Header
+		wantErr     bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name: "valid",
+			annotations: map[string]string{
+				GatewayAnnotationGatewayHeader: "X-Gateway",
+				GatewayAnnotationRouteHeader:   "X-Route",
+			},
+			want: http.Header{"X-Gateway": {"default/gateway"}, "X-Route": {"app/route"}},
+		},
+		{
+			name: "invalid gateway header",
+			annotations: map[string]string{
+				GatewayAnnotationGatewayHeader: "X Gateway",
+				GatewayAnnotationRouteHeader:   "X-Route",
+			},
+			want:    http.Header{"X-Route": {"app/route"}},
+			wantErr: true,
+		},
+		{
+			name:        "invalid route header",
+			annotations: map[string]string{GatewayAnnotationRouteHeader: "X-Route:"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "gateway",
+				Annotations: tt.annotations,
+			}}
+			if err := ValidateIdentityHeaders(gw); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateIdentityHeaders() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got := getIdentityHeaders(gw, route); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getIdentityHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
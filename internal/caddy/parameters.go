@@ -0,0 +1,249 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	caddyv2 "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
+)
+
+// Keys supported in the ConfigMap referenced by a GatewayClass's
+// `parametersRef`, these apply to every Gateway using the GatewayClass.
+// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.GatewayClassSpec
+const (
+	// ParameterOCSPStapling enables stapling OCSP responses to certificates
+	// loaded from listener certificateRefs. Defaults to `false`, as stapling
+	// requires Caddy to be able to reach the certificate's OCSP responder.
+	ParameterOCSPStapling = "ocspStapling"
+
+	// ParameterSessionTickets enables TLS session resumption using session
+	// tickets. Defaults to `true`.
+	ParameterSessionTickets = "sessionTickets"
+
+	// ParameterSessionTicketRotationInterval is how often session ticket keys
+	// are rotated, e.g. `12h`.
+	ParameterSessionTicketRotationInterval = "sessionTicketRotationInterval"
+
+	// ParameterSessionTicketMaxKeys is the maximum number of session ticket
+	// keys to keep in rotation.
+	ParameterSessionTicketMaxKeys = "sessionTicketMaxKeys"
+
+	// ParameterCertCacheCapacity is the maximum number of certificates to keep
+	// in Caddy's certificate cache.
+	ParameterCertCacheCapacity = "certCacheCapacity"
+
+	// ParameterBackendCACertificates is the `namespace/name` of a ConfigMap
+	// containing CA certificates (`ca.crt`) to trust when connecting to
+	// backends over TLS, unless a BackendTLSPolicy targets the backend.
+	ParameterBackendCACertificates = "backendCACertificates"
+
+	// ParameterBackendClusterTrustBundle is the name of a ClusterTrustBundle
+	// to trust when connecting to backends over TLS, like
+	// ParameterBackendCACertificates. Requires the ClusterTrustBundle API to
+	// be enabled.
+	ParameterBackendClusterTrustBundle = "backendClusterTrustBundle"
+
+	// ParameterGracePeriod is how long Caddy waits for active connections to
+	// close when reloading its config, e.g. `30s`. Overrides
+	// GeneratorOptions.GracePeriod.
+	ParameterGracePeriod = "gracePeriod"
+
+	// ParameterCatchAllStatusCode is the status code of the response to
+	// requests that don't match any route, e.g. `404`. Overrides
+	// GeneratorOptions.CatchAllStatusCode.
+	ParameterCatchAllStatusCode = "catchAllStatusCode"
+)
+
+// Parameters are options set by a GatewayClass that apply to every Gateway
+// using it.
+type Parameters struct {
+	OCSPStapling bool
+
+	DisableSessionTickets         bool
+	SessionTicketRotationInterval caddyv2.Duration
+	SessionTicketMaxKeys          int
+
+	CertCacheCapacity int
+
+	BackendCACertificates     client.ObjectKey
+	BackendClusterTrustBundle string
+
+	GracePeriod        caddyv2.Duration
+	CatchAllStatusCode int
+
+	// AdminPort overrides the port of GeneratorOptions.AdminListen, unless
+	// it is a Unix socket.
+	AdminPort int32
+
+	// LogLevel is the minimum level of Caddy's default log.
+	LogLevel string
+
+	// DefaultTimeouts apply to HTTPRoute rules without any timeouts.
+	DefaultTimeouts *gatewayv1.HTTPRouteTimeouts
+
+	// Image, Replicas, Autoscaling and Resources are used by the controller
+	// to provision the Caddy instances of Gateways, they don't affect the
+	// generated config.
+	Image       string
+	Replicas    *int32
+	Autoscaling *v1alpha1.CaddyGatewayAutoscaling
+	Resources   *corev1.ResourceRequirements
+}
+
+// logLevels are the levels Caddy's logs may be set to.
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// ParametersFromConfig returns the Parameters set by the spec of a
+// CaddyGatewayConfig. Fields the CRD's schema validates are checked again, as
+// the CRD may have been installed without it.
+func ParametersFromConfig(spec v1alpha1.CaddyGatewayConfigSpec) (*Parameters, error) {
+	p := &Parameters{
+		Image:       spec.Image,
+		Replicas:    spec.Replicas,
+		Autoscaling: spec.Autoscaling,
+		Resources:   spec.Resources,
+		LogLevel:    spec.LogLevel,
+	}
+	if spec.Replicas != nil && *spec.Replicas < 0 {
+		return nil, fmt.Errorf("invalid replicas: %d is negative", *spec.Replicas)
+	}
+	if a := spec.Autoscaling; a != nil {
+		if spec.Replicas != nil {
+			return nil, fmt.Errorf("replicas can't be set together with autoscaling")
+		}
+		if err := validateAutoscaling(a); err != nil {
+			return nil, fmt.Errorf("invalid autoscaling: %w", err)
+		}
+	}
+	if spec.AdminPort != nil {
+		if *spec.AdminPort < 1 || *spec.AdminPort > 65535 {
+			return nil, fmt.Errorf("invalid adminPort: %d is not a valid port", *spec.AdminPort)
+		}
+		p.AdminPort = *spec.AdminPort
+	}
+	if spec.LogLevel != "" && !slices.Contains(logLevels, spec.LogLevel) {
+		return nil, fmt.Errorf("invalid logLevel %q, must be one of %s", spec.LogLevel, strings.Join(logLevels, ", "))
+	}
+	if t := spec.Timeouts; t != nil {
+		for _, d := range []*gatewayv1.Duration{t.Request, t.BackendRequest} {
+			if _, err := parseTimeout(d); err != nil {
+				return nil, fmt.Errorf("invalid timeouts: %w", err)
+			}
+		}
+		p.DefaultTimeouts = t
+	}
+	return p, nil
+}
+
+// validateAutoscaling checks the fields of a CaddyGatewayAutoscaling.
+func validateAutoscaling(a *v1alpha1.CaddyGatewayAutoscaling) error {
+	minReplicas := ptr.Deref(a.MinReplicas, 1)
+	switch {
+	case minReplicas < 1:
+		return fmt.Errorf("minReplicas must be at least 1")
+	case a.MaxReplicas < minReplicas:
+		return fmt.Errorf("maxReplicas %d is less than minReplicas %d", a.MaxReplicas, minReplicas)
+	case a.TargetCPUUtilizationPercentage != nil && *a.TargetCPUUtilizationPercentage < 1:
+		return fmt.Errorf("targetCPUUtilizationPercentage must be at least 1")
+	case a.TargetRequestsPerSecond != nil && a.TargetRequestsPerSecond.Sign() <= 0:
+		return fmt.Errorf("targetRequestsPerSecond must be positive")
+	}
+	return nil
+}
+
+// GeneratorOptions returns the options with any overrides set by the
+// parameters, p may be nil.
+func (p *Parameters) GeneratorOptions(o GeneratorOptions) GeneratorOptions {
+	if p == nil {
+		return o
+	}
+	if p.GracePeriod > 0 {
+		o.GracePeriod = time.Duration(p.GracePeriod)
+	}
+	if p.CatchAllStatusCode != 0 {
+		o.CatchAllStatusCode = p.CatchAllStatusCode
+	}
+	if p.AdminPort != 0 {
+		listen := cmp.Or(o.AdminListen, DefaultAdminListen)
+		if host, _, err := net.SplitHostPort(listen); err == nil {
+			o.AdminListen = net.JoinHostPort(host, strconv.Itoa(int(p.AdminPort)))
+		}
+	}
+	return o
+}
+
+// ParseParameters parses Parameters from the data of a GatewayClass's
+// parameters ConfigMap. Unknown keys are rejected to catch typos.
+func ParseParameters(data map[string]string) (*Parameters, error) {
+	p := &Parameters{}
+	for k, v := range data {
+		var err error
+		switch k {
+		case ParameterOCSPStapling:
+			p.OCSPStapling, err = strconv.ParseBool(v)
+		case ParameterSessionTickets:
+			var enabled bool
+			enabled, err = strconv.ParseBool(v)
+			p.DisableSessionTickets = !enabled
+		case ParameterSessionTicketRotationInterval:
+			p.SessionTicketRotationInterval, err = parseDuration(v, time.Minute, 0)
+		case ParameterSessionTicketMaxKeys:
+			p.SessionTicketMaxKeys, err = strconv.Atoi(v)
+		case ParameterCertCacheCapacity:
+			p.CertCacheCapacity, err = strconv.Atoi(v)
+		case ParameterBackendCACertificates:
+			namespace, name, ok := strings.Cut(v, "/")
+			if !ok || namespace == "" || name == "" {
+				err = fmt.Errorf("%q is not in the format namespace/name", v)
+			}
+			p.BackendCACertificates = client.ObjectKey{Namespace: namespace, Name: name}
+		case ParameterBackendClusterTrustBundle:
+			p.BackendClusterTrustBundle = v
+		case ParameterGracePeriod:
+			p.GracePeriod, err = parseDuration(v, time.Second, 0)
+		case ParameterCatchAllStatusCode:
+			p.CatchAllStatusCode, err = strconv.Atoi(v)
+			if err == nil && (p.CatchAllStatusCode < 100 || p.CatchAllStatusCode > 599) {
+				err = fmt.Errorf("%d is not a valid status code", p.CatchAllStatusCode)
+			}
+		default:
+			return nil, fmt.Errorf("unknown parameter %q", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter %q: %w", k, err)
+		}
+	}
+	return p, nil
+}
+
+// configureTLS applies the parameters to Caddy's TLS app.
+func (p *Parameters) configureTLS(t *caddytls.TLS) {
+	t.DisableOCSPStapling = !p.OCSPStapling
+	if p.DisableSessionTickets || p.SessionTicketRotationInterval > 0 || p.SessionTicketMaxKeys > 0 {
+		t.SessionTickets = &caddytls.SessionTicketService{
+			RotationInterval: p.SessionTicketRotationInterval,
+			MaxKeys:          p.SessionTicketMaxKeys,
+			Disabled:         p.DisableSessionTickets,
+		}
+	}
+	if p.CertCacheCapacity > 0 {
+		t.Cache = &caddytls.CertCacheOptions{
+			Capacity: p.CertCacheCapacity,
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+)
+
+func TestParametersFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    v1alpha1.CaddyGatewayConfigSpec
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			spec: v1alpha1.CaddyGatewayConfigSpec{
+				Image:     "caddy:2",
+				Replicas:  ptr.To[int32](3),
+				AdminPort: ptr.To[int32](2020),
+				LogLevel:  "DEBUG",
+				Timeouts:  &gatewayv1.HTTPRouteTimeouts{Request: ptr.To[gatewayv1.Duration]("10s")},
+			},
+		},
+		{name: "negative replicas", spec: v1alpha1.CaddyGatewayConfigSpec{Replicas: ptr.To[int32](-1)}, wantErr: true},
+		{
+			name: "autoscaling",
+			spec: v1alpha1.CaddyGatewayConfigSpec{Autoscaling: &v1alpha1.CaddyGatewayAutoscaling{
+				MinReplicas:                    ptr.To[int32](2),
+				MaxReplicas:                    10,
+				TargetCPUUtilizationPercentage: ptr.To[int32](70),
+				TargetRequestsPerSecond:        ptr.To(resource.MustParse("500")),
+			}},
+		},
+		{
+			name: "replicas and autoscaling",
+			spec: v1alpha1.CaddyGatewayConfigSpec{
+				Replicas:    ptr.To[int32](3),
+				Autoscaling: &v1alpha1.CaddyGatewayAutoscaling{MaxReplicas: 10},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "maxReplicas below minReplicas",
+			spec:    v1alpha1.CaddyGatewayConfigSpec{Autoscaling: &v1alpha1.CaddyGatewayAutoscaling{MinReplicas: ptr.To[int32](3), MaxReplicas: 2}},
+			wantErr: true,
+		},
+		{
+			name:    "unset maxReplicas",
+			spec:    v1alpha1.CaddyGatewayConfigSpec{Autoscaling: &v1alpha1.CaddyGatewayAutoscaling{}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid requests per second",
+			spec:    v1alpha1.CaddyGatewayConfigSpec{Autoscaling: &v1alpha1.CaddyGatewayAutoscaling{MaxReplicas: 2, TargetRequestsPerSecond: ptr.To(resource.MustParse("0"))}},
+			wantErr: true,
+		},
+		{name: "invalid admin port", spec: v1alpha1.CaddyGatewayConfigSpec{AdminPort: ptr.To[int32](70000)}, wantErr: true},
+		{name: "invalid log level", spec: v1alpha1.CaddyGatewayConfigSpec{LogLevel: "debug"}, wantErr: true},
+		{
+			name:    "invalid timeout",
+			spec:    v1alpha1.CaddyGatewayConfigSpec{Timeouts: &gatewayv1.HTTPRouteTimeouts{BackendRequest: ptr.To[gatewayv1.Duration]("10")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParametersFromConfig(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParametersGeneratorOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		params *Parameters
+		listen string
+		want   string
+	}{
+		{name: "no parameters", listen: ":2019", want: ":2019"},
+		{name: "default listen", params: &Parameters{AdminPort: 2020}, want: ":2020"},
+		{name: "keeps host", params: &Parameters{AdminPort: 2020}, listen: "127.0.0.1:2019", want: "127.0.0.1:2020"},
+		{name: "unix socket", params: &Parameters{AdminPort: 2020}, listen: "unix//run/caddy.sock", want: "unix//run/caddy.sock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.params.GeneratorOptions(GeneratorOptions{AdminListen: tt.listen}).AdminListen
+			if got != tt.want {
+				t.Errorf("got admin listen %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
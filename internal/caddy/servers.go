@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ServerID returns the ID used to tag a server generated for a Gateway, this
+// allows servers owned by a Gateway to be told apart from servers owned by
+// other Gateways when they are loaded into the same Caddy instance.
+//
+// Kubernetes object names cannot contain underscores and Caddy IDs cannot
+// contain slashes (they are used as a path segment by the admin API), so
+// underscores are used as the separator.
+func ServerID(gw types.NamespacedName, app, key string) string {
+	return serverIDPrefix(gw) + app + "_" + strings.ReplaceAll(key, "/", "_")
+}
+
+// serverIDPrefix returns the prefix shared by the IDs of all servers owned by
+// the given Gateway.
+func serverIDPrefix(gw types.NamespacedName) string {
+	return "gateway_" + gw.Namespace + "_" + gw.Name + "_"
+}
+
+// IsServerOwnedBy reports whether the server ID belongs to the given Gateway.
+func IsServerOwnedBy(id string, gw types.NamespacedName) bool {
+	return strings.HasPrefix(id, serverIDPrefix(gw))
+}
+
+// StaleServerIDs returns the IDs of all servers in the running config that are
+// owned by the given Gateway, but are no longer present in the generated config.
+// This happens when a listener is removed from a Gateway.
+//
+// Servers owned by other Gateways, or servers without an ID are never
+// considered stale. The returned IDs are sorted.
+func StaleServerIDs(running, generated *Config, gw types.NamespacedName) []string {
+	current := map[string]struct{}{}
+	for _, id := range serverIDs(generated) {
+		current[id] = struct{}{}
+	}
+
+	var stale []string
+	for _, id := range serverIDs(running) {
+		if !IsServerOwnedBy(id, gw) {
+			continue
+		}
+		if _, ok := current[id]; ok {
+			continue
+		}
+		stale = append(stale, id)
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// serverIDs returns the IDs of all servers in the config.
+func serverIDs(c *Config) []string {
+	if c == nil || c.Apps == nil {
+		return nil
+	}
+	var ids []string
+	if c.Apps.HTTP != nil {
+		for _, s := range c.Apps.HTTP.Servers {
+			if s != nil && s.ID != "" {
+				ids = append(ids, s.ID)
+			}
+		}
+	}
+	if c.Apps.Layer4 != nil {
+		for _, s := range c.Apps.Layer4.Servers {
+			if s != nil && s.ID != "" {
+				ids = append(ids, s.ID)
+			}
+		}
+	}
+	return ids
+}
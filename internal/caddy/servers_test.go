@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
+)
+
+func TestServerID(t *testing.T) {
+	gw := types.NamespacedName{Namespace: "default", Name: "gateway"}
+	if got, want := ServerID(gw, "layer4", "tcp/443"), "gateway_default_gateway_layer4_tcp_443"; got != want {
+		t.Errorf("ServerID() = %q, want %q", got, want)
+	}
+}
+
+func TestIsServerOwnedBy(t *testing.T) {
+	gw := types.NamespacedName{Namespace: "default", Name: "gateway"}
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "owned", id: ServerID(gw, "http", "443"), want: true},
+		{name: "other name", id: ServerID(types.NamespacedName{Namespace: "default", Name: "other"}, "http", "443")},
+		// A Gateway whose name has the other's as a prefix.
+		{name: "prefixed name", id: ServerID(types.NamespacedName{Namespace: "default", Name: "gateway-2"}, "http", "443")},
+		{name: "other namespace", id: ServerID(types.NamespacedName{Namespace: "other", Name: "gateway"}, "http", "443")},
+		{name: "untagged", id: "srv0"},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsServerOwnedBy(tt.id, gw); got != tt.want {
+				t.Errorf("IsServerOwnedBy(%q) = %t, want %t", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaleServerIDs(t *testing.T) {
+	gw := types.NamespacedName{Namespace: "default", Name: "gateway"}
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+
+	// running is the config loaded into a Caddy instance shared by two
+	// Gateways, before the HTTPS and TCP listeners were removed from gw.
+	running := &Config{
+		Apps: &Apps{
+			HTTP: &caddyhttp.App{
+				Servers: map[string]*caddyhttp.Server{
+					"gw-80":    {ID: ServerID(gw, "http", "80")},
+					"gw-443":   {ID: ServerID(gw, "http", "443")},
+					"other-80": {ID: ServerID(other, "http", "80")},
+					"untagged": {},
+				},
+			},
+			Layer4: &layer4.App{
+				Servers: map[string]*layer4.Server{
+					"gw-tcp": {ID: ServerID(gw, "layer4", "tcp/5000")},
+				},
+			},
+		},
+	}
+	generated := &Config{
+		Apps: &Apps{
+			HTTP: &caddyhttp.App{
+				Servers: map[string]*caddyhttp.Server{
+					"gw-80": {ID: ServerID(gw, "http", "80")},
+				},
+			},
+		},
+	}
+
+	stale := StaleServerIDs(running, generated, gw)
+	want := []string{ServerID(gw, "http", "443"), ServerID(gw, "layer4", "tcp/5000")}
+	if !slices.Equal(stale, want) {
+		t.Fatalf("StaleServerIDs() = %v, want %v", stale, want)
+	}
+
+	// Only the listeners removed from gw are removed from the running config.
+	running.RemoveServers(stale)
+	if running.Apps.Layer4 != nil {
+		t.Errorf("layer4 app = %+v, want none", running.Apps.Layer4)
+	}
+	var remaining []string
+	for key := range running.Apps.HTTP.Servers {
+		remaining = append(remaining, key)
+	}
+	slices.Sort(remaining)
+	if want := []string{"gw-80", "other-80", "untagged"}; !slices.Equal(remaining, want) {
+		t.Errorf("remaining servers = %v, want %v", remaining, want)
+	}
+
+	if stale := StaleServerIDs(nil, generated, gw); stale != nil {
+		t.Errorf("StaleServerIDs() without a running config = %v, want none", stale)
+	}
+	if stale := StaleServerIDs(running, running, gw); stale != nil {
+		t.Errorf("StaleServerIDs() of an unchanged config = %v, want none", stale)
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// RouteSummary is a summary of the config generated for a route, allowing
+// users to confirm their route actually produced config.
+type RouteSummary struct {
+	// Listeners are the names of the listeners the route was added to.
+	Listeners []gatewayv1.SectionName `json:"listeners"`
+
+	// Handlers is the number of Caddy handlers generated for the route's
+	// rules, across all of its listeners.
+	Handlers int `json:"handlers"`
+}
+
+// ListenerSummary is a summary of the config generated for a listener.
+type ListenerSummary struct {
+	// Routes is the number of routes added to the listener.
+	Routes int
+
+	// Certificates is the number of certificates loaded for the listener.
+	Certificates int
+
+	// TLSConflict describes why the listener's TLS options for clients that
+	// don't match any hostname couldn't be programmed, as they conflict with
+	// another listener on the same port.
+	TLSConflict string
+}
+
+type routeSummaryKey struct {
+	Kind gatewayv1.Kind
+	Key  client.ObjectKey
+}
+
+// recordRoute records that config was generated for a route on a listener.
+func (i *Input) recordRoute(kind gatewayv1.Kind, route client.Object, l gatewayv1.Listener, handlers int) {
+	if i.routeSummaries == nil {
+		i.routeSummaries = map[routeSummaryKey]*RouteSummary{}
+	}
+	key := routeSummaryKey{Kind: kind, Key: client.ObjectKeyFromObject(route)}
+	s, ok := i.routeSummaries[key]
+	if !ok {
+		s = &RouteSummary{}
+		i.routeSummaries[key] = s
+	}
+	s.Listeners = append(s.Listeners, l.Name)
+	s.Handlers += handlers
+	i.listenerSummary(l).Routes++
+}
+
+// listenerSummary returns the summary of the listener to record to.
+func (i *Input) listenerSummary(l gatewayv1.Listener) *ListenerSummary {
+	if i.listenerSummaries == nil {
+		i.listenerSummaries = map[gatewayv1.SectionName]*ListenerSummary{}
+	}
+	s, ok := i.listenerSummaries[l.Name]
+	if !ok {
+		s = &ListenerSummary{}
+		i.listenerSummaries[l.Name] = s
+	}
+	return s
+}
+
+// ListenerSummaries returns the summary of the config generated for each of
+// the Gateway's listeners, by name.
+//
+// This is only valid after Config has been called.
+func (i *Input) ListenerSummaries() map[gatewayv1.SectionName]ListenerSummary {
+	summaries := make(map[gatewayv1.SectionName]ListenerSummary, len(i.Gateway.Spec.Listeners))
+	for _, l := range i.Gateway.Spec.Listeners {
+		if s, ok := i.listenerSummaries[l.Name]; ok {
+			summaries[l.Name] = *s
+		} else {
+			summaries[l.Name] = ListenerSummary{}
+		}
+	}
+	return summaries
+}
+
+// RouteSummary returns the summary of the config generated for a route, or
+// nil if no config was generated for it.
+//
+// This is only valid after Config has been called.
+func (i *Input) RouteSummary(kind gatewayv1.Kind, route client.Object) *RouteSummary {
+	return i.routeSummaries[routeSummaryKey{Kind: kind, Key: client.ObjectKeyFromObject(route)}]
+}
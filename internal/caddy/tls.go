@@ -5,14 +5,20 @@ package caddy
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"path"
 
+	certificatesv1alpha1 "k8s.io/api/certificates/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	gateway "github.com/caddyserver/gateway/internal"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddytls"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
 )
 
 // getCertKeyPEMPair .
@@ -22,7 +28,11 @@ func (i *Input) getCertKeyPEMPair(ctx context.Context, ref gatewayv1.SecretObjec
 		return caddytls.CertKeyPEMPair{}, nil
 	}
 
-	// TODO: validate ReferenceGrant (or ensure that it has already been validated)
+	// Certificates in other namespaces must be allowed by a ReferenceGrant.
+	if !gateway.IsSecretReferenceAllowed(i.Gateway.Namespace, ref, i.Grants) {
+		return caddytls.CertKeyPEMPair{}, nil
+	}
+
 	secret := &corev1.Secret{}
 	if err := i.Client.Get(
 		ctx,
@@ -90,7 +100,156 @@ func (i *Input) getCAPool(ctx context.Context, ref gatewayv1beta1.LocalObjectRef
 			return nil, nil
 		}
 		return certs, nil
+	case gateway.IsLocalClusterTrustBundle(ref):
+		// Implementation-specific: support ClusterTrustBundles
+		bundle := &certificatesv1alpha1.ClusterTrustBundle{}
+		if err := i.Client.Get(ctx, client.ObjectKey{Name: string(ref.Name)}, bundle); err != nil {
+			return nil, err
+		}
+		return []byte(bundle.Spec.TrustBundle), nil
 	default:
 		return nil, nil
 	}
 }
+
+// getClientCertificate returns the paths that the given client certificate
+// Secret is expected to be mounted at on Caddy pods.
+//
+// The Secret is read from the Gateway's namespace, a BackendTLSPolicy in any
+// other namespace must be allowed to reference it by a ReferenceGrant. An
+// error is returned if it isn't, or if the Secret doesn't exist or is missing
+// a certificate or key.
+func (i *Input) getClientCertificate(ctx context.Context, policy *gatewayv1alpha3.BackendTLSPolicy, name string) (string, string, error) {
+	if !gateway.IsClientCertificateReferenceAllowed(policy.Namespace, i.Gateway.Namespace, name, i.Grants) {
+		return "", "", fmt.Errorf("client certificate secret %s/%s is not allowed by any ReferenceGrant", i.Gateway.Namespace, name)
+	}
+
+	secret := &corev1.Secret{}
+	if err := i.Client.Get(
+		ctx,
+		client.ObjectKey{
+			Namespace: i.Gateway.Namespace,
+			Name:      name,
+		},
+		secret,
+	); err != nil {
+		return "", "", err
+	}
+	if _, ok := secret.Data["tls.crt"]; !ok {
+		return "", "", fmt.Errorf("client certificate secret %q is missing tls.crt", name)
+	}
+	if _, ok := secret.Data["tls.key"]; !ok {
+		return "", "", fmt.Errorf("client certificate secret %q is missing tls.key", name)
+	}
+
+	// Caddy is only able to load client certificates from disk, so the
+	// Secrets are mounted on provisioned Caddy pods.
+	if i.clientCertificates == nil {
+		i.clientCertificates = map[string]*corev1.Secret{}
+	}
+	i.clientCertificates[name] = secret
+
+	dir := path.Join(ClientCertificatesPath, name)
+	return path.Join(dir, "tls.crt"), path.Join(dir, "tls.key"), nil
+}
+
+// pemToInlineCerts returns the base64-encoded DER of every certificate in the
+// PEM data, as used by an InlineCAPool.
+func pemToInlineCerts(data []byte) []string {
+	var certs []string
+	for len(data) > 0 {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		certs = append(certs, base64.StdEncoding.EncodeToString(block.Bytes))
+	}
+	return certs
+}
+
+// getDefaultBackendCAs returns the CA certificates the GatewayClass's
+// parameters configure for backends without a BackendTLSPolicy.
+func (i *Input) getDefaultBackendCAs(ctx context.Context) ([]string, error) {
+	if i.Parameters == nil {
+		return nil, nil
+	}
+	var certs []string
+	if key := i.Parameters.BackendCACertificates; key.Name != "" {
+		configMap := &corev1.ConfigMap{}
+		if err := i.Client.Get(ctx, key, configMap); err != nil {
+			return nil, fmt.Errorf("unable to get backend CA certificates: %w", err)
+		}
+		certs = append(certs, pemToInlineCerts([]byte(configMap.Data["ca.crt"]))...)
+	}
+	if name := i.Parameters.BackendClusterTrustBundle; name != "" {
+		bundle := &certificatesv1alpha1.ClusterTrustBundle{}
+		if err := i.Client.Get(ctx, client.ObjectKey{Name: name}, bundle); err != nil {
+			return nil, fmt.Errorf("unable to get backend ClusterTrustBundle: %w", err)
+		}
+		certs = append(certs, pemToInlineCerts([]byte(bundle.Spec.TrustBundle))...)
+	}
+	return certs, nil
+}
+
+// getBackendTLSPolicy returns the BackendTLSPolicy that applies to the port of
+// a Service, if any.
+//
+// A policy targeting the port by its name (sectionName) takes precedence over
+// a policy targeting the whole Service, conflicts between policies that are
+// equally specific are resolved by taking the oldest policy, then the policy
+// appearing first in alphabetical order by name.
+// ref; https://gateway-api.sigs.k8s.io/geps/gep-713/#conflict-resolution
+func (i *Input) getBackendTLSPolicy(service *corev1.Service, sp corev1.ServicePort) *gatewayv1alpha3.BackendTLSPolicy {
+	var (
+		best         *gatewayv1alpha3.BackendTLSPolicy
+		bestSpecific bool
+	)
+	for idx := range i.BackendTLSPolicies {
+		btp := &i.BackendTLSPolicies[idx]
+		if btp.Namespace != service.Namespace {
+			continue
+		}
+		matched, specific := false, false
+		for _, tf := range btp.Spec.TargetRefs {
+			if !gateway.IsLocalPolicyTargetService(tf.LocalPolicyTargetReference) {
+				continue
+			}
+			if string(tf.Name) != service.Name {
+				continue
+			}
+			if tf.SectionName == nil {
+				matched = true
+				continue
+			}
+			if string(*tf.SectionName) == sp.Name {
+				matched, specific = true, true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if best != nil {
+			if bestSpecific && !specific {
+				continue
+			}
+			if bestSpecific == specific && !isOlderPolicy(btp, best) {
+				continue
+			}
+		}
+		best, bestSpecific = btp, specific
+	}
+	return best
+}
+
+// isOlderPolicy returns true if a takes precedence over b when they conflict.
+func isOlderPolicy(a, b *gatewayv1alpha3.BackendTLSPolicy) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
@@ -4,42 +4,56 @@
 package caddy
 
 import (
-	"net"
-	"strconv"
+	"slices"
+	"strings"
 
-	gateway "github.com/caddyserver/gateway/internal"
-	"github.com/caddyserver/gateway/internal/layer4"
-	"github.com/caddyserver/gateway/internal/layer4/l4proxy"
-	"github.com/caddyserver/gateway/internal/layer4/l4tls"
-	corev1 "k8s.io/api/core/v1"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4/l4tls"
 )
 
+// maxWildcardSNILabels is the maximum number of labels a wildcard hostname of
+// a TLSRoute matches in place of its wildcard.
+const maxWildcardSNILabels = 8
+
 // getTLSServer .
 // TODO: document
 func (i *Input) getTLSServer(s *layer4.Server, l gatewayv1.Listener) (*layer4.Server, error) {
-	routes := []*layer4.Route{}
+	// Routes with additional matchers (e.g. ALPN) are more specific than
+	// routes only matching on SNI, so must be tried first.
+	var specific, routes []*layer4.Route
 	for _, tr := range i.TLSRoutes {
-		if !isRouteForListener(i.Gateway, l, tr.Namespace, tr.Status.RouteStatus) {
+		if !isRouteForListener(i.Gateway, l, "TLSRoute", tr.Namespace, tr.Status.RouteStatus) {
+			continue
+		}
+
+		// Only match the hostnames of the route that intersect with the
+		// hostname of the listener.
+		routeHostnames := make([]string, len(tr.Spec.Hostnames))
+		for i, h := range tr.Spec.Hostnames {
+			routeHostnames[i] = string(h)
+		}
+		hostnames := gateway.ComputeHosts(routeHostnames, (*string)(l.Hostname))
+		if len(hostnames) == 0 {
+			continue
+		}
+
+		// Routes with invalid annotations are skipped rather than being
+		// programmed with broader matchers than intended.
+		match, err := getTLSRouteMatcher(&tr)
+		if err != nil {
 			continue
 		}
+		isSpecific := !match.IsEmpty()
+		match.SNI = getSNIMatcher(hostnames)
 
 		matchers := []layer4.Match{}
-		// Match hostnames if any are specified.
-		if len(tr.Spec.Hostnames) > 0 {
-			// TODO: validate hostnames against listener hostnames, including
-			// a prefix match for wildcards.
-			//
-			// See godoc for HTTPRoute.Spec.Hostnames for more details.
-			matcher := layer4.Match{
-				TLS: &layer4.MatchTLS{
-					SNI: make(layer4.MatchSNI, len(tr.Spec.Hostnames)),
-				},
-			}
-			for i, h := range tr.Spec.Hostnames {
-				matcher.TLS.SNI[i] = string(h)
-			}
-			matchers = append(matchers, matcher)
+		if !match.IsEmpty() {
+			matchers = append(matchers, layer4.Match{
+				TLS: &match,
+			})
 		}
 
 		var handlers []layer4.Handler
@@ -49,63 +63,57 @@ func (i *Input) getTLSServer(s *layer4.Server, l gatewayv1.Listener) (*layer4.Se
 		}
 
 		for _, rule := range tr.Spec.Rules {
-			// We only support a single backend ref as we don't support weights for layer4 proxy.
-			if len(rule.BackendRefs) != 1 {
+			h := i.getL4ProxyHandler("", tr.Namespace, rule.BackendRefs)
+			if h == nil {
 				continue
 			}
-
-			bf := rule.BackendRefs[0]
-			bor := bf.BackendObjectReference
-			if !gateway.IsService(bor) {
-				continue
-			}
-
-			// Safeguard against nil-pointer dereference.
-			if bor.Port == nil {
-				continue
-			}
-
-			// Get the service.
-			//
-			// TODO: is there a more efficient way to do this?
-			// We currently list all services and forward them to the input,
-			// then iterate over them.
-			//
-			// Should we just use the Kubernetes client instead?
-			var service corev1.Service
-			for _, s := range i.Services {
-				if s.Namespace != gateway.NamespaceDerefOr(bor.Namespace, tr.Namespace) {
-					continue
-				}
-				if s.Name != string(bor.Name) {
-					continue
-				}
-				service = s
-				break
-			}
-			if service.Name == "" {
-				// Invalid service reference.
-				continue
-			}
-
-			// Add a handler that proxies to the backend service.
-			handlers = append(handlers, &l4proxy.Handler{
-				Upstreams: l4proxy.UpstreamPool{
-					&l4proxy.Upstream{
-						Dial: []string{net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(*bor.Port)))},
-					},
-				},
-			})
+			handlers = append(handlers, h)
 		}
 
 		// Add the route.
-		routes = append(routes, &layer4.Route{
+		route := &layer4.Route{
 			MatcherSets: matchers,
 			Handlers:    handlers,
-		})
+		}
+		if isSpecific {
+			specific = append(specific, route)
+		} else {
+			routes = append(routes, route)
+		}
+		i.recordRoute("TLSRoute", &tr, l, len(handlers))
 	}
 
 	// Update the routes on the server.
+	s.Routes = append(s.Routes, specific...)
 	s.Routes = append(s.Routes, routes...)
 	return s, nil
 }
+
+// getSNIMatcher returns an SNI matcher for the hostnames of a TLSRoute. A
+// hostname of `*` matches every SNI, so no matcher is returned.
+//
+// Gateway API wildcards match any number of labels, `*.example.com` matches
+// both `foo.example.com` and `foo.bar.example.com`, but Caddy's wildcards
+// only ever match a single label. Wildcard hostnames are expanded to match up
+// to maxWildcardSNILabels labels, e.g. `*.example.com`, `*.*.example.com` and
+// so on.
+func getSNIMatcher(hostnames []string) layer4.MatchSNI {
+	var sni layer4.MatchSNI
+	for _, h := range hostnames {
+		if h == "*" {
+			return nil
+		}
+		suffix, ok := strings.CutPrefix(h, "*.")
+		if !ok {
+			sni = append(sni, h)
+			continue
+		}
+		wildcard := "*."
+		for range maxWildcardSNILabels {
+			sni = append(sni, wildcard+suffix)
+			wildcard += "*."
+		}
+	}
+	slices.Sort(sni)
+	return slices.Compact(sni)
+}
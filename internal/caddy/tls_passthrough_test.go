@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// matchWildcard mirrors how Caddy's `sni` matcher (certmagic.MatchWildcard)
+// matches a server name against a name that may contain wildcards, where each
+// wildcard only ever matches a single label.
+func matchWildcard(subject, wildcard string) bool {
+	if subject == wildcard {
+		return true
+	}
+	if !strings.Contains(wildcard, "*") {
+		return false
+	}
+	labels := strings.Split(subject, ".")
+	for i := range labels {
+		if labels[i] == "" {
+			continue
+		}
+		labels[i] = "*"
+		if strings.Join(labels, ".") == wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGetSNIMatcher(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostnames []string
+		match     []string
+		noMatch   []string
+	}{
+		{
+			name:      "exact",
+			hostnames: []string{"example.com"},
+			match:     []string{"example.com"},
+			noMatch:   []string{"foo.example.com", "example.org"},
+		},
+		{
+			name:      "wildcard",
+			hostnames: []string{"*.example.com"},
+			match: []string{
+				"foo.example.com",
+				"foo.bar.example.com",
+				"a.b.c.d.e.f.g.h.example.com",
+			},
+			noMatch: []string{
+				"example.com",
+				"fooexample.com",
+				"foo.example.org",
+				"a.b.c.d.e.f.g.h.i.example.com",
+			},
+		},
+		{
+			name:      "mixed",
+			hostnames: []string{"example.com", "*.example.org"},
+			match:     []string{"example.com", "foo.example.org"},
+			noMatch:   []string{"foo.example.com", "example.org"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sni := getSNIMatcher(tt.hostnames)
+			matches := func(name string) bool {
+				return slices.ContainsFunc(sni, func(s string) bool {
+					return matchWildcard(name, s)
+				})
+			}
+			for _, name := range tt.match {
+				if !matches(name) {
+					t.Errorf("expected %q to match %v", name, sni)
+				}
+			}
+			for _, name := range tt.noMatch {
+				if matches(name) {
+					t.Errorf("expected %q not to match %v", name, sni)
+				}
+			}
+		})
+	}
+}
+
+func TestGetSNIMatcherMatchAll(t *testing.T) {
+	if sni := getSNIMatcher([]string{"example.com", "*"}); sni != nil {
+		t.Errorf("expected no matcher, got %v", sni)
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+func TestGetClientCertificate(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gateway", Name: "client"},
+		Data: map[string][]byte{
+			"tls.crt": []byte("cert"),
+			"tls.key": []byte("key"),
+		},
+	}
+	keyless := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gateway", Name: "keyless"},
+		Data:       map[string][]byte{"tls.crt": []byte("cert")},
+	}
+	grant := gatewayv1beta1.ReferenceGrant{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gateway", Name: "client"},
+		Spec: gatewayv1beta1.ReferenceGrantSpec{
+			From: []gatewayv1beta1.ReferenceGrantFrom{{
+				Group:     gatewayv1.GroupName,
+				Kind:      "BackendTLSPolicy",
+				Namespace: "app",
+			}},
+			To: []gatewayv1beta1.ReferenceGrantTo{{Kind: "Secret"}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		secret    string
+		grants    []gatewayv1beta1.ReferenceGrant
+		wantErr   bool
+	}{
+		{name: "same namespace", namespace: "gateway", secret: "client"},
+		{name: "other namespace", namespace: "app", secret: "client", wantErr: true},
+		{name: "other namespace with grant", namespace: "app", secret: "client", grants: []gatewayv1beta1.ReferenceGrant{grant}},
+		{name: "grant from another namespace", namespace: "other", secret: "client", grants: []gatewayv1beta1.ReferenceGrant{grant}, wantErr: true},
+		{name: "missing", namespace: "gateway", secret: "missing", wantErr: true},
+		{name: "missing key", namespace: "gateway", secret: "keyless", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Input{
+				Gateway: &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gateway", Name: "gateway"}},
+				Grants:  tt.grants,
+				Client:  testReader{secret, keyless},
+			}
+			policy := &gatewayv1alpha3.BackendTLSPolicy{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Name: "policy"},
+			}
+			certFile, keyFile, err := i.getClientCertificate(context.Background(), policy, tt.secret)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("getClientCertificate() = %q, %q, want an error", certFile, keyFile)
+				}
+				if len(i.ClientCertificates()) != 0 {
+					t.Errorf("ClientCertificates() = %v, want none", i.ClientCertificates())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getClientCertificate() error = %v", err)
+			}
+			if want := ClientCertificatesPath + "/client/tls.crt"; certFile != want {
+				t.Errorf("certificate file = %q, want %q", certFile, want)
+			}
+			if want := ClientCertificatesPath + "/client/tls.key"; keyFile != want {
+				t.Errorf("key file = %q, want %q", keyFile, want)
+			}
+			if certs := i.ClientCertificates(); len(certs) != 1 || certs[0].Name != "client" {
+				t.Errorf("ClientCertificates() = %v, want the client Secret", certs)
+			}
+		})
+	}
+}
@@ -4,80 +4,46 @@
 package caddy
 
 import (
-	"net"
-	"strconv"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	gateway "github.com/caddyserver/gateway/internal"
-	"github.com/caddyserver/gateway/internal/layer4"
-	"github.com/caddyserver/gateway/internal/layer4/l4proxy"
-	corev1 "k8s.io/api/core/v1"
-	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
 )
 
+// getUDPServer adds the UDPRoute attached to the listener to the server.
+//
+// UDP packets have nothing to match routes on, so only a single UDPRoute may
+// be attached to each listener. If multiple are, only the oldest is used, the
+// others are rejected by the UDPRoute controller.
 func (i *Input) getUDPServer(s *layer4.Server, l gatewayv1.Listener) (*layer4.Server, error) {
-	routes := []*layer4.Route{}
-	for _, tr := range i.UDPRoutes {
-		if !isRouteForListener(i.Gateway, l, tr.Namespace, tr.Status.RouteStatus) {
+	var route *gatewayv1alpha2.UDPRoute
+	for idx := range i.UDPRoutes {
+		tr := &i.UDPRoutes[idx]
+		if !isRouteForListener(i.Gateway, l, "UDPRoute", tr.Namespace, tr.Status.RouteStatus) {
 			continue
 		}
-
-		handlers := []layer4.Handler{}
-		for _, rule := range tr.Spec.Rules {
-			// We only support a single backend ref as we don't support weights for layer4 proxy.
-			if len(rule.BackendRefs) != 1 {
-				continue
-			}
-
-			bf := rule.BackendRefs[0]
-			bor := bf.BackendObjectReference
-			if !gateway.IsService(bor) {
-				continue
-			}
-
-			// Safeguard against nil-pointer dereference.
-			if bor.Port == nil {
-				continue
-			}
-
-			// Get the service.
-			//
-			// TODO: is there a more efficient way to do this?
-			// We currently list all services and forward them to the input,
-			// then iterate over them.
-			//
-			// Should we just use the Kubernetes client instead?
-			var service corev1.Service
-			for _, s := range i.Services {
-				if s.Namespace != gateway.NamespaceDerefOr(bor.Namespace, tr.Namespace) {
-					continue
-				}
-				if s.Name != string(bor.Name) {
-					continue
-				}
-				service = s
-				break
-			}
-			if service.Name == "" {
-				// Invalid service reference.
-				continue
-			}
-
-			handlers = append(handlers, &l4proxy.Handler{
-				Upstreams: l4proxy.UpstreamPool{
-					&l4proxy.Upstream{
-						Dial: []string{"udp/" + net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(*bor.Port)))},
-					},
-				},
-			})
+		if route == nil || gateway.IsOlderRoute(tr, route) {
+			route = tr
 		}
+	}
+	if route == nil {
+		return s, nil
+	}
 
-		// Add the route.
-		routes = append(routes, &layer4.Route{
-			Handlers: handlers,
-		})
+	handlers := []layer4.Handler{}
+	for _, rule := range route.Spec.Rules {
+		h := i.getL4ProxyHandler("udp", route.Namespace, rule.BackendRefs)
+		if h == nil {
+			continue
+		}
+		handlers = append(handlers, h)
 	}
 
-	// Update the routes on the server.
-	s.Routes = append(s.Routes, routes...)
+	// Add the route.
+	s.Routes = append(s.Routes, &layer4.Route{
+		Handlers: handlers,
+	})
+	i.recordRoute("UDPRoute", route, l, len(handlers))
 	return s, nil
 }
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultAdminTLSDir is where the client certificate and CA used for mTLS
+// connections to Caddy instances are mounted by default.
+const defaultAdminTLSDir = "/var/run/secrets/tls"
+
+// AdminTLSOptions configure where the client certificate and CA used for mTLS
+// connections to Caddy instances are loaded from.
+type AdminTLSOptions struct {
+	// CAPath is the CA trusted to verify Caddy instances, defaults to
+	// `/var/run/secrets/tls/ca.crt`.
+	CAPath string
+
+	// CertPath and KeyPath are the client certificate presented to Caddy
+	// instances, default to `/var/run/secrets/tls/tls.crt` and
+	// `/var/run/secrets/tls/tls.key`. The files are watched for rotation.
+	CertPath string
+	KeyPath  string
+
+	// Secret is a Secret containing the CA (`ca.crt`) and the client
+	// certificate (`tls.crt` and `tls.key`), used instead of the files if
+	// set. This allows running the Controller outside the cluster.
+	//
+	// The client certificate is reloaded whenever the Secret changes, while
+	// the CA is only loaded on startup, the same as CAPath.
+	Secret types.NamespacedName
+}
+
+func (o AdminTLSOptions) caPath() string {
+	if o.CAPath == "" {
+		return defaultAdminTLSDir + "/ca.crt"
+	}
+	return o.CAPath
+}
+
+func (o AdminTLSOptions) certPath() string {
+	if o.CertPath == "" {
+		return defaultAdminTLSDir + "/" + corev1.TLSCertKey
+	}
+	return o.CertPath
+}
+
+func (o AdminTLSOptions) keyPath() string {
+	if o.KeyPath == "" {
+		return defaultAdminTLSDir + "/" + corev1.TLSPrivateKeyKey
+	}
+	return o.KeyPath
+}
+
+// secretKeyPair loads a client certificate from a Secret. The Secret is read
+// through the cache, so it's watched for changes, and only parsed again once
+// it has changed.
+type secretKeyPair struct {
+	client client.Reader
+	key    types.NamespacedName
+
+	mu              sync.Mutex
+	resourceVersion string
+	cert            *tls.Certificate
+}
+
+func (s *secretKeyPair) get(ctx context.Context) (*tls.Certificate, error) {
+	secret := &corev1.Secret{}
+	if err := s.client.Get(ctx, s.key, secret); err != nil {
+		return nil, fmt.Errorf("unable to get admin TLS secret %s: %w", s.key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cert != nil && s.resourceVersion == secret.ResourceVersion {
+		return s.cert, nil
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("unable to load admin TLS secret %s: %w", s.key, err)
+	}
+	s.cert, s.resourceVersion = &cert, secret.ResourceVersion
+	return s.cert, nil
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+// GatewayAnnotationAgentManaged is an annotation on a Gateway used to indicate
+// its Caddy instances are programmed by agents running alongside them, see
+// AgentOptions. The controller doesn't provision Caddy for the Gateway or
+// program its instances, it only updates the status of the Gateway.
+const GatewayAnnotationAgentManaged = string(gateway.ControllerDomain) + "/agent-managed"
+
+// isAgentManaged returns true if the Gateway's Caddy instances are programmed
+// by agents.
+func isAgentManaged(gw *gatewayv1.Gateway) bool {
+	return gw.Annotations[GatewayAnnotationAgentManaged] == "true"
+}
+
+// agentManagedPublisher is used by the controller for Gateways programmed by
+// agents, it doesn't publish the config anywhere. Like other publishers that
+// don't program instances directly, ready instances are assumed to be running
+// the config.
+type agentManagedPublisher struct{}
+
+func (agentManagedPublisher) publish(context.Context, *publication) (ctrl.Result, error) {
+	return ctrl.Result{}, nil
+}
+
+// AgentOptions configures the Gateway controller to run as an agent alongside
+// a single Caddy instance (usually as a sidecar in a DaemonSet), rather than
+// programming every Caddy instance over the pod network.
+//
+// In agent mode, configuration is pushed to Caddy's admin endpoint over a
+// local Unix socket and the agent never updates the status of any resources,
+// that responsibility is left to the controller.
+type AgentOptions struct {
+	// Gateway is the Gateway served by the local Caddy instance, all other
+	// Gateways are ignored.
+	Gateway types.NamespacedName
+
+	// AdminSocket is the path to the Unix socket Caddy's admin endpoint is
+	// listening on.
+	AdminSocket string
+}
+
+// AdminListen returns the Caddy network address for the admin endpoint.
+func (o *AgentOptions) AdminListen() string {
+	return "unix/" + o.AdminSocket
+}
+
+// client returns an HTTP client that dials the admin Unix socket.
+func (o *AgentOptions) client() *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", o.AdminSocket)
+	}
+	return &http.Client{Transport: tr}
+}
+
+// load pushes the given config to the local Caddy instance.
+func (o *AgentOptions) load(ctx context.Context, b []byte) error {
+	// Caddy only allows a few specific Host values when the admin endpoint is
+	// listening on a Unix socket, `127.0.0.1` being one of them.
+	return loadCaddyConfig(ctx, o.client(), "http://127.0.0.1/load", b)
+}
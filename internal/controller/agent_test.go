@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+// testGateway returns a Gateway with an HTTP listener and its accepted
+// GatewayClass.
+func testGateway() (*gatewayv1.Gateway, *gatewayv1.GatewayClass) {
+	gwc := &gatewayv1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "caddy"},
+		Spec:       gatewayv1.GatewayClassSpec{ControllerName: gateway.ControllerName},
+		Status: gatewayv1.GatewayClassStatus{
+			Conditions: []metav1.Condition{{
+				Type:   string(gatewayv1.GatewayClassConditionStatusAccepted),
+				Status: metav1.ConditionTrue,
+			}},
+		},
+	}
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			GatewayClassName: "caddy",
+			Listeners: []gatewayv1.Listener{{
+				Name:     "http",
+				Protocol: gatewayv1.HTTPProtocolType,
+				Port:     80,
+			}},
+		},
+	}
+	return gw, gwc
+}
+
+func TestReconcileAgent(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loads atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/load" {
+			loads.Add(1)
+		}
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	gw, gwc := testGateway()
+	c := newTestClientWith(gw, gwc)
+	r := &GatewayReconciler{
+		Client: c,
+		Agent: &AgentOptions{
+			Gateway:     client.ObjectKeyFromObject(gw),
+			AdminSocket: socket,
+		},
+		// Agents must never provision Caddy, even if configured to.
+		Provision: ProvisionOptions{Image: "caddy:default"},
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(gw)}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("local Caddy instance was programmed %d times, want once", n)
+	}
+	if len(c.objs) != 2 {
+		t.Errorf("agent created %d objects, want none", len(c.objs)-2)
+	}
+
+	// Other Gateways are ignored.
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: other}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("local Caddy instance was programmed %d times, want once", n)
+	}
+}
+
+// recordingPublisher is a publisher recording the configs it was asked to
+// publish.
+type recordingPublisher struct {
+	published int
+}
+
+func (p *recordingPublisher) publish(context.Context, *publication) (ctrl.Result, error) {
+	p.published++
+	return ctrl.Result{}, nil
+}
+
+func TestPublisherForAgentManaged(t *testing.T) {
+	pub := &recordingPublisher{}
+	r := &GatewayReconciler{publisher: pub}
+
+	gw, _ := testGateway()
+	if got := r.publisherFor(gw); got != publisher(pub) {
+		t.Errorf("publisherFor() = %T, want the configured publisher", got)
+	}
+
+	gw.Annotations = map[string]string{GatewayAnnotationAgentManaged: "true"}
+	p := &publication{gw: gw}
+	if _, err := r.publisherFor(gw).publish(context.Background(), p); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+	if pub.published != 0 {
+		t.Error("config of an agent managed Gateway was published by the controller")
+	}
+	// Ready instances are assumed to run the config, as agents program them.
+	if p.direct {
+		t.Error("publication of an agent managed Gateway is direct")
+	}
+}
+
+func TestReconcileAgentManaged(t *testing.T) {
+	gw, gwc := testGateway()
+	gw.Annotations = map[string]string{GatewayAnnotationAgentManaged: "true"}
+	c := newTestClientWith(gw, gwc)
+	pub := &recordingPublisher{}
+	r := &GatewayReconciler{
+		Client:    c,
+		Scheme:    newTestScheme(t),
+		Provision: ProvisionOptions{Image: "caddy:default"},
+		publisher: pub,
+	}
+	// The reconcile fails until a Service is deployed along with the agents,
+	// but nothing must be provisioned or published in the meantime.
+	_, _ = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(gw)})
+	if len(c.objs) != 2 {
+		for _, o := range c.objs[2:] {
+			t.Errorf("provisioned %T %s for an agent managed Gateway", o, client.ObjectKeyFromObject(o))
+		}
+	}
+	if pub.published != 0 {
+		t.Error("config of an agent managed Gateway was published by the controller")
+	}
+}
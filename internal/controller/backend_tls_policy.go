@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+
+	certificatesv1alpha1 "k8s.io/api/certificates/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// indexBackendTLSPolicyCACertificates is used to index BackendTLSPolicies by
+// the ConfigMaps, Secrets and ClusterTrustBundles they reference as CA
+// certificates.
+func indexBackendTLSPolicyCACertificates(o client.Object) []string {
+	policy, ok := o.(*gatewayv1alpha3.BackendTLSPolicy)
+	if !ok {
+		return nil
+	}
+	var refs []string
+	for _, ref := range policy.Spec.Validation.CACertificateRefs {
+		if gateway.IsLocalClusterTrustBundle(ref) {
+			// ClusterTrustBundles are cluster-scoped.
+			refs = append(refs, caCertificateIndexKey(string(ref.Kind), types.NamespacedName{Name: string(ref.Name)}))
+			continue
+		}
+		if !gateway.IsLocalConfigMap(ref) && !gateway.IsLocalSecret(ref) {
+			continue
+		}
+		refs = append(refs, caCertificateIndexKey(string(ref.Kind), types.NamespacedName{
+			Namespace: policy.Namespace,
+			Name:      string(ref.Name),
+		}))
+	}
+	return refs
+}
+
+// caCertificateIndexKey returns the key BackendTLSPolicies are indexed by for
+// a CA certificate reference. The kind is part of the key, as a ConfigMap and
+// a Secret may share the same name.
+func caCertificateIndexKey(kind string, key types.NamespacedName) string {
+	if key.Namespace == "" {
+		return kind + "/" + key.Name
+	}
+	return kind + "/" + key.String()
+}
+
+// caCertificateIndexKeyFor returns the key BackendTLSPolicies referencing the
+// given object as a CA certificate are indexed by, or an empty string if the
+// object can't be referenced as one.
+func caCertificateIndexKeyFor(obj client.Object) string {
+	var kind string
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		kind = "ConfigMap"
+	case *corev1.Secret:
+		kind = "Secret"
+	case *certificatesv1alpha1.ClusterTrustBundle:
+		kind = "ClusterTrustBundle"
+	default:
+		return ""
+	}
+	return caCertificateIndexKey(kind, client.ObjectKeyFromObject(obj))
+}
+
+// indexBackendTLSPolicyClientCertificate is used to index BackendTLSPolicies
+// by the name of the client certificate Secret they reference. The Secret
+// lives in the namespace of the Gateway, so only the name is indexed.
+func indexBackendTLSPolicyClientCertificate(o client.Object) []string {
+	policy, ok := o.(*gatewayv1alpha3.BackendTLSPolicy)
+	if !ok {
+		return nil
+	}
+	name := policy.Annotations[caddy.BackendTLSPolicyAnnotationClientCertificate]
+	if name == "" {
+		return nil
+	}
+	return []string{name}
+}
+
+// getReconcileRequestsForClientCertificate returns a reconcile request for
+// each Gateway that uses the given Secret as a backend client certificate.
+func getReconcileRequestsForClientCertificate(ctx context.Context, c client.Client, obj client.Object) []reconcile.Request {
+	var reqs []reconcile.Request
+	for _, policy := range getBackendTLSPoliciesForClientCertificate(ctx, c, obj) {
+		for _, req := range getReconcileRequestsForBackendTLSPolicy(ctx, c, &policy) {
+			// Client certificates are always read from the Gateway's namespace.
+			if req.Namespace != obj.GetNamespace() {
+				continue
+			}
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// getBackendTLSPoliciesForClientCertificate returns all BackendTLSPolicies
+// that reference a Secret with the name of the given one as a client
+// certificate. They only use it if it is in the namespace of their Gateway.
+func getBackendTLSPoliciesForClientCertificate(ctx context.Context, c client.Client, obj client.Object) []gatewayv1alpha3.BackendTLSPolicy {
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(obj))
+
+	list := &gatewayv1alpha3.BackendTLSPolicyList{}
+	if err := c.List(ctx, list, &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(backendTLSPolicyClientCertIndex, obj.GetName()),
+	}); err != nil {
+		log.Error(err, "Unable to list BackendTLSPolicies")
+		return nil
+	}
+	return list.Items
+}
+
+// getBackendTLSPoliciesForCACertificate returns all BackendTLSPolicies that
+// reference the given ConfigMap, Secret or ClusterTrustBundle as a CA
+// certificate.
+func getBackendTLSPoliciesForCACertificate(ctx context.Context, c client.Client, obj client.Object) []gatewayv1alpha3.BackendTLSPolicy {
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(obj))
+
+	key := caCertificateIndexKeyFor(obj)
+	if key == "" {
+		return nil
+	}
+	list := &gatewayv1alpha3.BackendTLSPolicyList{}
+	if err := c.List(ctx, list, &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(backendTLSPolicyCAIndex, key),
+	}); err != nil {
+		log.Error(err, "Unable to list BackendTLSPolicies")
+		return nil
+	}
+	return list.Items
+}
+
+// getReconcileRequestsForBackendTLSPolicy returns a reconcile request for each
+// Gateway that has an HTTPRoute or GRPCRoute attached that references a
+// Service targeted by the given BackendTLSPolicy.
+func getReconcileRequestsForBackendTLSPolicy(ctx context.Context, c client.Client, policy *gatewayv1alpha3.BackendTLSPolicy) []reconcile.Request {
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(policy))
+
+	seen := map[types.NamespacedName]struct{}{}
+	var reqs []reconcile.Request
+	for _, ref := range policy.Spec.TargetRefs {
+		if !gateway.IsLocalPolicyTargetService(ref.LocalPolicyTargetReference) {
+			continue
+		}
+
+		serviceReqs, err := getReconcileRequestsForBackendService(ctx, c, types.NamespacedName{
+			Namespace: policy.Namespace,
+			Name:      string(ref.Name),
+		})
+		if err != nil {
+			log.Error(err, "Unable to list routes")
+			return nil
+		}
+		for _, req := range serviceReqs {
+			if _, ok := seen[req.NamespacedName]; ok {
+				continue
+			}
+			seen[req.NamespacedName] = struct{}{}
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// backendCAUpdates tracks Gateways that are reconciled because a CA
+// certificate trusted by one of their BackendTLSPolicies changed, e.g. because
+// it was rotated. If nothing but the CA certificates of the config's backend
+// transports changed since the Gateway was last fully reconciled, the new
+// config is pushed without provisioning, validating or updating the status of
+// anything else, as the result would be the same.
+type backendCAUpdates struct {
+	mu      sync.Mutex
+	pending map[types.NamespacedName]struct{}
+	// reconciled holds the fingerprint each Gateway was last fully
+	// reconciled with, see backendCAFingerprint.
+	reconciled map[types.NamespacedName][sha256.Size]byte
+}
+
+// changed records that a CA certificate used by the Gateway changed.
+func (u *backendCAUpdates) changed(gw types.NamespacedName) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.pending == nil {
+		u.pending = map[types.NamespacedName]struct{}{}
+	}
+	u.pending[gw] = struct{}{}
+}
+
+// onlyCAsChanged returns true if the Gateway is reconciled because a CA
+// certificate changed and the fingerprint of its config matches the one it was
+// last fully reconciled with. The pending change is consumed either way.
+func (u *backendCAUpdates) onlyCAsChanged(gw types.NamespacedName, fingerprint [sha256.Size]byte) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	_, pending := u.pending[gw]
+	delete(u.pending, gw)
+	last, ok := u.reconciled[gw]
+	return pending && ok && last == fingerprint
+}
+
+// fullyReconciled records the fingerprint a Gateway was fully reconciled with.
+func (u *backendCAUpdates) fullyReconciled(gw types.NamespacedName, fingerprint [sha256.Size]byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.reconciled == nil {
+		u.reconciled = map[types.NamespacedName][sha256.Size]byte{}
+	}
+	u.reconciled[gw] = fingerprint
+}
+
+// forget removes everything tracked about the Gateway.
+func (u *backendCAUpdates) forget(gw types.NamespacedName) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.pending, gw)
+	delete(u.reconciled, gw)
+}
+
+// backendCAFingerprint hashes everything a full reconcile of the Gateway
+// depends on, except the CA certificates trusted by its backend transports:
+// the generated config without them, the generations of the Gateway and its
+// GatewayClass, the Gateway's labels and annotations and the GatewayClass's
+// parameters.
+func backendCAFingerprint(gw *gatewayv1.Gateway, gwc *gatewayv1.GatewayClass, i *caddy.Input, b []byte) ([sha256.Size]byte, error) {
+	var config any
+	if err := json.Unmarshal(b, &config); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	stripBackendCAs(config)
+	v, err := json.Marshal(struct {
+		Config                 any
+		Generation             int64
+		Labels, Annotations    map[string]string
+		GatewayClassGeneration int64
+		Parameters             *caddy.Parameters
+	}{
+		Config:                 config,
+		Generation:             gw.Generation,
+		Labels:                 gw.Labels,
+		Annotations:            gw.Annotations,
+		GatewayClassGeneration: gwc.Generation,
+		Parameters:             i.Parameters,
+	})
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(v), nil
+}
+
+// stripBackendCAs removes the CA pool of every reverse proxy transport's TLS
+// config from a decoded Caddy config.
+func stripBackendCAs(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		if transport, ok := v["transport"].(map[string]any); ok {
+			if tls, ok := transport["tls"].(map[string]any); ok {
+				delete(tls, "ca")
+			}
+		}
+		for _, v := range v {
+			stripBackendCAs(v)
+		}
+	case []any:
+		for _, v := range v {
+			stripBackendCAs(v)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	certificatesv1alpha1 "k8s.io/api/certificates/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+func TestIndexBackendTLSPolicyCACertificates(t *testing.T) {
+	policy := &gatewayv1alpha3.BackendTLSPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "policy"},
+		Spec: gatewayv1alpha3.BackendTLSPolicySpec{
+			Validation: gatewayv1alpha3.BackendTLSPolicyValidation{
+				CACertificateRefs: []gatewayv1.LocalObjectReference{
+					{Kind: "ConfigMap", Name: "ca"},
+					{Kind: "Secret", Name: "ca"},
+					{Group: "certificates.k8s.io", Kind: "ClusterTrustBundle", Name: "bundle"},
+					{Group: "example.com", Kind: "Other", Name: "ca"},
+				},
+			},
+		},
+	}
+	got := indexBackendTLSPolicyCACertificates(policy)
+	want := []string{"ConfigMap/app/ca", "Secret/app/ca", "ClusterTrustBundle/bundle"}
+	if !slices.Equal(got, want) {
+		t.Errorf("indexBackendTLSPolicyCACertificates() = %v, want %v", got, want)
+	}
+
+	// Each referenced object must be looked up with the key it was indexed
+	// by, and only that key.
+	for i, obj := range []client.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "ca"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "ca"}},
+		&certificatesv1alpha1.ClusterTrustBundle{ObjectMeta: metav1.ObjectMeta{Name: "bundle"}},
+	} {
+		if key := caCertificateIndexKeyFor(obj); key != want[i] {
+			t.Errorf("caCertificateIndexKeyFor(%T) = %q, want %q", obj, key, want[i])
+		}
+	}
+	if key := caCertificateIndexKeyFor(&corev1.Service{}); key != "" {
+		t.Errorf("caCertificateIndexKeyFor(Service) = %q, want none", key)
+	}
+}
+
+func TestBackendCAFingerprint(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway", Generation: 1}}
+	gwc := &gatewayv1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "caddy", Generation: 1}}
+	i := &caddy.Input{}
+	config := func(ca, dial string) []byte {
+		return []byte(`{"apps":{"http":{"servers":{"srv":{"routes":[{"handle":[{"handler":"reverse_proxy",` +
+			`"transport":{"protocol":"http","tls":{"server_name":"app","ca":{"provider":"inline","trusted_ca_certs":["` + ca + `"]}}},` +
+			`"upstreams":[{"dial":"` + dial + `"}]}]}]}}}}}`)
+	}
+	fingerprint := func(gw *gatewayv1.Gateway, gwc *gatewayv1.GatewayClass, b []byte) [32]byte {
+		t.Helper()
+		v, err := backendCAFingerprint(gw, gwc, i, b)
+		if err != nil {
+			t.Fatalf("backendCAFingerprint() error = %v", err)
+		}
+		return v
+	}
+
+	base := fingerprint(gw, gwc, config("old", "10.0.0.1:443"))
+	if got := fingerprint(gw, gwc, config("new", "10.0.0.1:443")); got != base {
+		t.Error("fingerprint changed with only the backend CAs")
+	}
+	if got := fingerprint(gw, gwc, config("old", "10.0.0.2:443")); got == base {
+		t.Error("fingerprint didn't change with the upstreams")
+	}
+
+	changed := gw.DeepCopy()
+	changed.Generation = 2
+	if got := fingerprint(changed, gwc, config("old", "10.0.0.1:443")); got == base {
+		t.Error("fingerprint didn't change with the Gateway's generation")
+	}
+	changed = gw.DeepCopy()
+	changed.Annotations = map[string]string{"example.com/key": "value"}
+	if got := fingerprint(changed, gwc, config("old", "10.0.0.1:443")); got == base {
+		t.Error("fingerprint didn't change with the Gateway's annotations")
+	}
+	changedClass := gwc.DeepCopy()
+	changedClass.Generation = 2
+	if got := fingerprint(gw, changedClass, config("old", "10.0.0.1:443")); got == base {
+		t.Error("fingerprint didn't change with the GatewayClass's generation")
+	}
+}
+
+func TestBackendCAUpdates(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "gateway"}
+	fingerprint := [32]byte{1}
+
+	var u backendCAUpdates
+	u.changed(key)
+	if u.onlyCAsChanged(key, fingerprint) {
+		t.Error("onlyCAsChanged() = true before the Gateway was fully reconciled")
+	}
+
+	u.fullyReconciled(key, fingerprint)
+	if u.onlyCAsChanged(key, fingerprint) {
+		t.Error("onlyCAsChanged() = true without a changed CA")
+	}
+
+	u.changed(key)
+	if u.onlyCAsChanged(key, [32]byte{2}) {
+		t.Error("onlyCAsChanged() = true with a different fingerprint")
+	}
+	// The change was consumed by the full reconcile it caused.
+	if u.onlyCAsChanged(key, fingerprint) {
+		t.Error("onlyCAsChanged() = true after the change was consumed")
+	}
+
+	u.changed(key)
+	if !u.onlyCAsChanged(key, fingerprint) {
+		t.Error("onlyCAsChanged() = false with a changed CA and the same fingerprint")
+	}
+
+	u.changed(key)
+	u.forget(key)
+	if u.onlyCAsChanged(key, fingerprint) {
+		t.Error("onlyCAsChanged() = true after the Gateway was forgotten")
+	}
+}
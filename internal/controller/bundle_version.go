@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+const (
+	// bundleVersionAnnotation is set on every CRD of the Gateway API to the
+	// version of the bundle it was installed from.
+	// ref; https://gateway-api.sigs.k8s.io/concepts/versioning/#version-indicators
+	bundleVersionAnnotation = "gateway.networking.k8s.io/bundle-version"
+
+	// channelAnnotation is set on every CRD of the Gateway API to the channel
+	// (standard or experimental) it was installed from.
+	channelAnnotation = "gateway.networking.k8s.io/channel"
+)
+
+// minimumBundleVersion is the oldest Gateway API CRD bundle we support.
+var minimumBundleVersion = version.MustParseSemantic("v1.0.0")
+
+// featureMinimumBundleVersions are the bundle versions that introduced the
+// fields (or conformance tests) needed by features we support, these features
+// are only advertised when the installed CRDs are new enough. Features that
+// are missing have been supported since minimumBundleVersion.
+var featureMinimumBundleVersions = map[gatewayv1.SupportedFeature]*version.Version{
+	"GRPCRoute":                         version.MustParseSemantic("v1.1.0"),
+	"HTTPRouteBackendProtocolH2C":       version.MustParseSemantic("v1.1.0"),
+	"HTTPRouteBackendProtocolWebSocket": version.MustParseSemantic("v1.1.0"),
+	"HTTPRouteRequestMultipleMirrors":   version.MustParseSemantic("v1.1.0"),
+}
+
+// gatewayAPIInfo describes the Gateway API CRDs installed in the cluster.
+type gatewayAPIInfo struct {
+	// BundleVersion is the version of the installed CRD bundle, this is nil
+	// if it couldn't be detected.
+	BundleVersion *version.Version
+	Channel       string
+}
+
+// supportsFeature returns true if the installed CRDs are new enough to use
+// the given feature. Features are assumed to be supported if the bundle
+// version couldn't be detected.
+func (i gatewayAPIInfo) supportsFeature(f gatewayv1.SupportedFeature) bool {
+	minimum, ok := featureMinimumBundleVersions[f]
+	if !ok || i.BundleVersion == nil {
+		return true
+	}
+	return i.BundleVersion.AtLeast(minimum)
+}
+
+// getGatewayAPIInfo reads the bundle version and channel of the installed
+// Gateway API CRDs from the GatewayClass CRD, as it's always installed.
+//
+// Only the metadata of the CRD is read, using an uncached reader, as the
+// Controller is only allowed to get CRDs.
+func getGatewayAPIInfo(ctx context.Context, c client.Reader) (gatewayAPIInfo, error) {
+	crd := &metav1.PartialObjectMetadata{}
+	crd.SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	crd.APIVersion = "apiextensions.k8s.io/v1"
+	if err := c.Get(ctx, client.ObjectKey{Name: "gatewayclasses." + gatewayv1.GroupName}, crd); err != nil {
+		if apierrors.IsNotFound(err) {
+			return gatewayAPIInfo{}, nil
+		}
+		return gatewayAPIInfo{}, err
+	}
+	info := gatewayAPIInfo{Channel: crd.Annotations[channelAnnotation]}
+	if v, ok := crd.Annotations[bundleVersionAnnotation]; ok {
+		bv, err := version.ParseSemantic(v)
+		if err != nil {
+			return info, fmt.Errorf("invalid %s annotation %q: %w", bundleVersionAnnotation, v, err)
+		}
+		info.BundleVersion = bv
+	}
+	return info, nil
+}
@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// caddyRequestTimeout is how long to wait for Caddy to load a config. Caddy
+	// doesn't respond until the config has been loaded, which includes waiting
+	// for the HTTP servers to gracefully shutdown.
+	caddyRequestTimeout = 30 * time.Second
+
+	// caddyMaxAttempts is the maximum number of attempts made to program a
+	// Caddy instance within a single reconcile.
+	caddyMaxAttempts = 3
+
+	// caddyRetryBackoff is the delay before the first retry, it is doubled
+	// after each failed attempt.
+	caddyRetryBackoff = 500 * time.Millisecond
+
+	// caddyBreakerThreshold is the number of consecutive reconciles that must
+	// fail to program a Caddy instance before it is skipped.
+	caddyBreakerThreshold = 3
+
+	// caddyBreakerCooldown is how long a Caddy instance is skipped for once it
+	// has been deemed unreachable.
+	caddyBreakerCooldown = time.Minute
+
+	// caddyBusyRequeue is how long to wait before reconciling a Gateway again
+	// when some of its Caddy instances were busy, see isCaddyBusy.
+	caddyBusyRequeue = 5 * time.Second
+
+	// caddyFailureRequeue is how long to wait before reconciling a Gateway
+	// again when some of its Caddy instances couldn't be programmed, it is
+	// doubled for each consecutive reconcile that fails, up to
+	// caddyMaxFailureRequeue.
+	caddyFailureRequeue    = 5 * time.Second
+	caddyMaxFailureRequeue = 5 * time.Minute
+)
+
+// caddyStatusError is returned when Caddy responds to a request with a status
+// other than 200.
+type caddyStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *caddyStatusError) Error() string {
+	return fmt.Sprintf("caddy responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// isCaddyBusy returns true if a request failed because Caddy was busy, rather
+// than because it is unreachable or rejected the request. This is usually
+// because Caddy was still loading another config, either responding with a
+// conflict or too many requests, or not responding before the request timed
+// out. These requests are retried like any other 5xx, even if their status is
+// a 4xx.
+func isCaddyBusy(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var se *caddyStatusError
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// loadCaddyConfig pushes a config to the Caddy admin endpoint at url, retrying
+// with an exponential backoff on failures that may be transient.
+//
+// Configs that Caddy rejects (4xx status codes) are never retried, as they
+// won't succeed without the config changing, unless Caddy was busy.
+func loadCaddyConfig(ctx context.Context, c *http.Client, url string, b []byte) error {
+	return doCaddyRequestWithRetry(ctx, c, http.MethodPost, url, b)
+}
+
+// loadCaddyTLSApp replaces just the TLS app of the config running on the Caddy
+// instance with the admin endpoint at baseURL, using the same retry behaviour
+// as loadCaddyConfig.
+//
+// Caddy still runs the resulting config like any other config change, but the
+// request only contains the certificates rather than every route of the
+// Gateway, which matters when thousands of instances are being programmed.
+func loadCaddyTLSApp(ctx context.Context, c *http.Client, baseURL string, b []byte) error {
+	return doCaddyRequestWithRetry(ctx, c, http.MethodPost, baseURL+"/config/apps/tls", b)
+}
+
+func doCaddyRequestWithRetry(ctx context.Context, c *http.Client, method, url string, b []byte) error {
+	backoff := caddyRetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = doCaddyRequest(ctx, c, method, url, b)
+		if err == nil {
+			return nil
+		}
+		if se, ok := err.(*caddyStatusError); ok && se.StatusCode < http.StatusInternalServerError && !isCaddyBusy(ctx, err) {
+			return err
+		}
+		if attempt >= caddyMaxAttempts {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+func doCaddyRequest(ctx context.Context, c *http.Client, method, url string, b []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, caddyRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4*1024))
+		return &caddyStatusError{StatusCode: res.StatusCode, Body: string(body)}
+	}
+	return nil
+}
+
+// getCaddyConfig returns the config currently being served by the Caddy admin
+// endpoint at url.
+func getCaddyConfig(ctx context.Context, c *http.Client, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, caddyRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4*1024))
+		return nil, &caddyStatusError{StatusCode: res.StatusCode, Body: string(body)}
+	}
+	return io.ReadAll(res.Body)
+}
+
+// splitTLSApp splits a generated config into the config without the TLS app
+// and the TLS app itself, which is nil if the config doesn't have one.
+//
+// The TLS app usually only changes when certificates are renewed, so when it is
+// the only part of the config that changed it can be pushed on its own.
+func splitTLSApp(b []byte) (base, tls []byte, err error) {
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, nil, err
+	}
+	var apps map[string]json.RawMessage
+	if raw, ok := config["apps"]; ok {
+		if err := json.Unmarshal(raw, &apps); err != nil {
+			return nil, nil, err
+		}
+	}
+	tls, ok := apps["tls"]
+	if !ok {
+		return b, nil, nil
+	}
+	delete(apps, "tls")
+	if config["apps"], err = json.Marshal(apps); err != nil {
+		return nil, nil, err
+	}
+	if base, err = json.Marshal(config); err != nil {
+		return nil, nil, err
+	}
+	return base, tls, nil
+}
+
+// isCaddyUnreachable returns true if a request failed because of a transport
+// error, a timeout or a 5xx response. Any other response, such as Caddy
+// rejecting a config with a 4xx, shows that the instance is reachable.
+func isCaddyUnreachable(err error) bool {
+	var se *caddyStatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError || se.StatusCode == http.StatusRequestTimeout
+	}
+	return err != nil
+}
+
+// caddyBreaker is a circuit breaker for Caddy instances, it is used to stop
+// persistently unreachable instances from slowing down every reconcile.
+//
+// Once an instance has failed caddyBreakerThreshold reconciles in a row, it is
+// skipped until caddyBreakerCooldown has passed, after which a single attempt
+// is allowed through to test if the instance has recovered.
+type caddyBreaker struct {
+	mu        sync.Mutex
+	instances map[programmedKey]*caddyBreakerState
+}
+
+type caddyBreakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether an attempt should be made to program the instance.
+func (b *caddyBreaker) allow(key programmedKey) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.instances[key]
+	if !ok || s.failures < caddyBreakerThreshold {
+		return true
+	}
+	if time.Now().Before(s.openUntil) {
+		return false
+	}
+	// Allow a single attempt through, if it fails the breaker will re-open.
+	s.openUntil = time.Now().Add(caddyBreakerCooldown)
+	return true
+}
+
+// success records that the instance was programmed successfully.
+func (b *caddyBreaker) success(key programmedKey) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.instances, key)
+}
+
+// failure records that the instance could not be programmed because of err.
+// Only errors showing that the instance may be unreachable count towards
+// opening the breaker, see isCaddyUnreachable.
+func (b *caddyBreaker) failure(key programmedKey, err error) {
+	if !isCaddyUnreachable(err) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.instances == nil {
+		b.instances = map[programmedKey]*caddyBreakerState{}
+	}
+	s, ok := b.instances[key]
+	if !ok {
+		s = &caddyBreakerState{}
+		b.instances[key] = s
+	}
+	s.failures++
+	if s.failures >= caddyBreakerThreshold {
+		s.openUntil = time.Now().Add(caddyBreakerCooldown)
+	}
+}
+
+// retain removes the state of every instance of the Gateway that isn't in
+// instances, such as pods that were replaced. A nil instances removes every
+// instance of the Gateway.
+func (b *caddyBreaker) retain(gw types.NamespacedName, instances map[programmedKey]struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.instances {
+		if key.Gateway != gw {
+			continue
+		}
+		if _, ok := instances[key]; !ok {
+			delete(b.instances, key)
+		}
+	}
+}
+
+// programmingRetries tracks the consecutive reconciles of each Gateway that
+// failed to program some of its Caddy instances, so they are retried with a
+// backoff.
+type programmingRetries struct {
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+// failure records that a reconcile of the Gateway failed to program some of
+// its instances, returning how long to wait before retrying.
+func (p *programmingRetries) failure(gw types.NamespacedName) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures == nil {
+		p.failures = map[types.NamespacedName]int{}
+	}
+	n := p.failures[gw]
+	p.failures[gw] = n + 1
+	// Stop doubling once past the maximum, so the delay can't overflow.
+	delay := caddyFailureRequeue << min(n, 10)
+	return min(delay, caddyMaxFailureRequeue)
+}
+
+// success records that every instance of the Gateway was programmed.
+func (p *programmingRetries) success(gw types.NamespacedName) {
+	p.forget(gw)
+}
+
+// forget removes the failures of the Gateway, e.g. once it is deleted.
+func (p *programmingRetries) forget(gw types.NamespacedName) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.failures, gw)
+}
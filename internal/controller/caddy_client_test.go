@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIsCaddyUnreachable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: true},
+		{name: "timeout", err: context.DeadlineExceeded, want: true},
+		{name: "request timeout", err: &caddyStatusError{StatusCode: http.StatusRequestTimeout}, want: true},
+		{name: "internal server error", err: &caddyStatusError{StatusCode: http.StatusInternalServerError}, want: true},
+		{name: "service unavailable", err: &caddyStatusError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "bad request", err: &caddyStatusError{StatusCode: http.StatusBadRequest}},
+		{name: "conflict", err: &caddyStatusError{StatusCode: http.StatusConflict}},
+		{name: "wrapped bad request", err: fmt.Errorf("loading config: %w", &caddyStatusError{StatusCode: http.StatusBadRequest})},
+		{name: "no error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCaddyUnreachable(tt.err); got != tt.want {
+				t.Errorf("isCaddyUnreachable(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaddyBreaker(t *testing.T) {
+	key := programmedKey{Gateway: types.NamespacedName{Namespace: "default", Name: "gateway"}, Pod: "a"}
+
+	t.Run("rejected config", func(t *testing.T) {
+		var b caddyBreaker
+		for range caddyBreakerThreshold {
+			b.failure(key, &caddyStatusError{StatusCode: http.StatusBadRequest, Body: "invalid config"})
+		}
+		if !b.allow(key) {
+			t.Error("breaker opened for an instance that rejected its config")
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		var b caddyBreaker
+		for range caddyBreakerThreshold {
+			b.failure(key, errors.New("connection refused"))
+		}
+		if b.allow(key) {
+			t.Error("breaker is closed for an unreachable instance")
+		}
+		b.success(key)
+		if !b.allow(key) {
+			t.Error("breaker is open after the instance was programmed")
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		var b caddyBreaker
+		for range caddyBreakerThreshold {
+			b.failure(key, &caddyStatusError{StatusCode: http.StatusInternalServerError})
+		}
+		if b.allow(key) {
+			t.Error("breaker is closed for an instance responding with 5xx")
+		}
+	})
+}
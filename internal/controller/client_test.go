@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// testClient is an in-memory client.Client for tests, supporting the subset
+// of the client used by the reconcilers. Calling any other method panics.
+type testClient struct {
+	client.Client
+
+	objs []client.Object
+}
+
+var _ client.Client = (*testClient)(nil)
+
+func newTestClientWith(objs ...client.Object) *testClient {
+	return &testClient{objs: objs}
+}
+
+// newTestScheme returns a scheme with the types owners are set on, for
+// reconcilers setting controller references.
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := gatewayv1.Install(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func (c *testClient) find(obj client.Object, key client.ObjectKey) int {
+	for n, o := range c.objs {
+		if reflect.TypeOf(o) == reflect.TypeOf(obj) && client.ObjectKeyFromObject(o) == key {
+			return n
+		}
+	}
+	return -1
+}
+
+func (c *testClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	n := c.find(obj, key)
+	if n < 0 {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(c.objs[n].DeepCopyObject()).Elem())
+	return nil
+}
+
+func (c *testClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	o := &client.ListOptions{}
+	o.ApplyOptions(opts)
+	itemType := reflect.ValueOf(list).Elem().FieldByName("Items").Type().Elem()
+	var items []runtime.Object
+	for _, obj := range c.objs {
+		if reflect.TypeOf(obj).Elem() != itemType {
+			continue
+		}
+		if o.Namespace != "" && obj.GetNamespace() != o.Namespace {
+			continue
+		}
+		if o.LabelSelector != nil && !o.LabelSelector.Matches(labelSet(obj.GetLabels())) {
+			continue
+		}
+		items = append(items, obj.DeepCopyObject())
+	}
+	return meta.SetList(list, items)
+}
+
+func (c *testClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	if c.find(obj, client.ObjectKeyFromObject(obj)) >= 0 {
+		return apierrors.NewAlreadyExists(schema.GroupResource{}, obj.GetName())
+	}
+	c.objs = append(c.objs, obj.DeepCopyObject().(client.Object))
+	return nil
+}
+
+func (c *testClient) Update(_ context.Context, obj client.Object, _ ...client.UpdateOption) error {
+	n := c.find(obj, client.ObjectKeyFromObject(obj))
+	if n < 0 {
+		return apierrors.NewNotFound(schema.GroupResource{}, obj.GetName())
+	}
+	c.objs[n] = obj.DeepCopyObject().(client.Object)
+	return nil
+}
+
+func (c *testClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	n := c.find(obj, client.ObjectKeyFromObject(obj))
+	if n < 0 {
+		return apierrors.NewNotFound(schema.GroupResource{}, obj.GetName())
+	}
+	c.objs = append(c.objs[:n], c.objs[n+1:]...)
+	return nil
+}
+
+// Status returns a writer updating whole objects, as the test client doesn't
+// distinguish between an object and its status.
+func (c *testClient) Status() client.SubResourceWriter {
+	return testStatusWriter{c: c}
+}
+
+type testStatusWriter struct {
+	client.SubResourceWriter
+
+	c *testClient
+}
+
+func (w testStatusWriter) Update(ctx context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+	return w.c.Update(ctx, obj)
+}
+
+// labelSet adapts an object's labels to labels.Labels.
+type labelSet map[string]string
+
+func (l labelSet) Has(key string) bool {
+	_, ok := l[key]
+	return ok
+}
+
+func (l labelSet) Get(key string) string {
+	return l[key]
+}
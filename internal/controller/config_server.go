@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// configServerPathPrefix is the path configs are served under, followed by
+// the namespace and name of the Gateway.
+const configServerPathPrefix = "/config/"
+
+// PullOptions configures the server Caddy instances pull their configs from
+// when using ConfigPublisherPull.
+type PullOptions struct {
+	// Listen is the address the config server listens on.
+	Listen string
+
+	// URL is the base URL Caddy instances reach the config server at, such as
+	// `https://caddy-gateway.caddy-system.svc:2022`. The server's certificate
+	// must be valid for its host.
+	URL string
+
+	// Interval is how often Caddy instances pull their config.
+	Interval time.Duration
+}
+
+// configURL returns the URL the config of a Gateway is served at.
+func (o *PullOptions) configURL(gw types.NamespacedName) string {
+	return strings.TrimSuffix(o.URL, "/") + configServerPathPrefix +
+		url.PathEscape(gw.Namespace) + "/" + url.PathEscape(gw.Name)
+}
+
+// configServer serves the latest config generated for each Gateway to the
+// Caddy instances pulling them, authenticating Caddy using mTLS. Caddy may
+// only pull the config of the Gateway its client certificate was issued for.
+//
+// Configs are kept in memory and persisted to a Secret owned by the Gateway,
+// so after the controller restarts they are served from the Secret until the
+// Gateway has been reconciled by the new leader.
+type configServer struct {
+	listen    string
+	tlsConfig *tls.Config
+
+	// persisted writes configs to the Secrets reader loads them from.
+	persisted *secretPublisher
+	reader    client.Reader
+
+	mu      sync.RWMutex
+	configs map[types.NamespacedName][]byte
+}
+
+var (
+	_ publisher        = (*configServer)(nil)
+	_ manager.Runnable = (*configServer)(nil)
+)
+
+func (s *configServer) publish(ctx context.Context, p *publication) (ctrl.Result, error) {
+	if s.persisted != nil {
+		if _, err := s.persisted.publish(ctx, p); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to persist config: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.configs == nil {
+		s.configs = map[types.NamespacedName][]byte{}
+	}
+	s.configs[client.ObjectKeyFromObject(p.gw)] = p.config
+	return ctrl.Result{}, nil
+}
+
+// forget stops serving the config of a Gateway. Its persisted config is
+// deleted along with the Gateway.
+func (s *configServer) forget(gw types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.configs, gw)
+}
+
+// config returns the config of a Gateway, loading its persisted config if it
+// hasn't been published since the controller started.
+func (s *configServer) config(ctx context.Context, gw types.NamespacedName) ([]byte, error) {
+	s.mu.RLock()
+	b, ok := s.configs[gw]
+	s.mu.RUnlock()
+	if ok || s.reader == nil {
+		return b, nil
+	}
+
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{
+		Namespace: gw.Namespace,
+		Name:      publishedConfigName(&gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: gw.Name}}),
+	}
+	if err := s.reader.Get(ctx, key, secret); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	// Only serve configs persisted by us for the Gateway.
+	if secret.Labels[owningGatewayLabel] != gw.Name {
+		return nil, nil
+	}
+	return secret.Data[publishedConfigKey], nil
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	namespace, name, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, configServerPathPrefix), "/")
+	if !ok || !strings.HasPrefix(req.URL.Path, configServerPathPrefix) || namespace == "" || name == "" {
+		http.NotFound(w, req)
+		return
+	}
+	gw := types.NamespacedName{Namespace: namespace, Name: name}
+	if !pullAuthorized(req.TLS, gw) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	b, err := s.config(req.Context(), gw)
+	if err != nil {
+		log.FromContext(req.Context()).Error(err, "Failed to load persisted config", logKeyGateway, gw)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	if b == nil {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// pullAuthorized returns true if the verified client certificate of a
+// connection was issued for the Caddy instances of the Gateway, i.e. its
+// common name is `<gateway>-caddy.<namespace>`, or it has the DNS name
+// `<gateway>-caddy.<namespace>.svc`.
+func pullAuthorized(state *tls.ConnectionState, gw types.NamespacedName) bool {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return false
+	}
+	cert := state.VerifiedChains[0][0]
+	identity := provisionedName(&gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Name: gw.Name}}) + "." + gw.Namespace
+	return cert.Subject.CommonName == identity || slices.Contains(cert.DNSNames, identity+".svc")
+}
+
+// Start runs the config server until ctx is cancelled.
+func (s *configServer) Start(ctx context.Context) error {
+	tlsConfig := s.tlsConfig.Clone()
+	tlsConfig.ClientCAs = tlsConfig.RootCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	srv := &http.Server{
+		Addr:              s.listen,
+		Handler:           s,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.FromContext(ctx).Info("Serving configs to Caddy", "address", s.listen)
+		// The certificate is provided by tlsConfig.
+		errCh <- srv.ListenAndServeTLS("", "")
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
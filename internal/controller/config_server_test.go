@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// pullRequest returns a request for the config of a Gateway, made with a
+// client certificate for the Caddy instances of the authenticated Gateway.
+func pullRequest(gw, authenticated types.NamespacedName) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, configServerPathPrefix+gw.Namespace+"/"+gw.Name, nil)
+	if authenticated.Name != "" {
+		cert := &x509.Certificate{
+			Subject: pkix.Name{CommonName: authenticated.Name + "-caddy." + authenticated.Namespace},
+		}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return req
+}
+
+func TestConfigServer(t *testing.T) {
+	gw := types.NamespacedName{Namespace: "default", Name: "gateway"}
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+	// persisted returns the persisted config of the Gateway, labelled with
+	// the name of the Gateway that owns it.
+	persisted := func(owner string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "gateway-caddy-config",
+				Labels:    map[string]string{owningGatewayLabel: owner},
+			},
+			Data: map[string][]byte{publishedConfigKey: []byte(`{"persisted":true}`)},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		published     bool
+		objs          []client.Object
+		authenticated types.NamespacedName
+		wantStatus    int
+		wantBody      string
+	}{
+		{name: "published", published: true, authenticated: gw, wantStatus: http.StatusOK, wantBody: `{"published":true}`},
+		{name: "persisted", objs: []client.Object{persisted("gateway")}, authenticated: gw, wantStatus: http.StatusOK, wantBody: `{"persisted":true}`},
+		{name: "published takes priority", published: true, objs: []client.Object{persisted("gateway")}, authenticated: gw, wantStatus: http.StatusOK, wantBody: `{"published":true}`},
+		{name: "not published", authenticated: gw, wantStatus: http.StatusNotFound},
+		{name: "not persisted by us", objs: []client.Object{persisted("other")}, authenticated: gw, wantStatus: http.StatusNotFound},
+		{name: "other Gateway", published: true, authenticated: other, wantStatus: http.StatusForbidden},
+		{name: "no client certificate", published: true, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &configServer{reader: newTestClientWith(tt.objs...)}
+			if tt.published {
+				s.configs = map[types.NamespacedName][]byte{gw: []byte(`{"published":true}`)}
+			}
+
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, pullRequest(gw, tt.authenticated))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestConfigServerPublishPersists(t *testing.T) {
+	c := newTestClientWith()
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway", UID: "uid"}}
+	s := &configServer{
+		persisted: &secretPublisher{r: &GatewayReconciler{Client: c, Scheme: newTestScheme(t)}},
+		reader:    c,
+	}
+	if _, err := s.publish(context.Background(), &publication{gw: gw, config: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new leader serves the persisted config.
+	restarted := &configServer{reader: c}
+	b, err := restarted.config(context.Background(), client.ObjectKeyFromObject(gw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{}` {
+		t.Errorf("config = %s, want the persisted config", b)
+	}
+}
+
+func TestPullAuthorized(t *testing.T) {
+	gw := types.NamespacedName{Namespace: "default", Name: "gateway"}
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want bool
+	}{
+		{name: "common name", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "gateway-caddy.default"}}, want: true},
+		{name: "DNS name", cert: &x509.Certificate{DNSNames: []string{"gateway-caddy.default.svc"}}, want: true},
+		{name: "other namespace", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "gateway-caddy.other"}}},
+		{name: "other Gateway", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "other-caddy.default"}}},
+		{name: "unverified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &tls.ConnectionState{}
+			if tt.cert != nil {
+				state.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+			if got := pullAuthorized(state, gw); got != tt.want {
+				t.Errorf("pullAuthorized() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
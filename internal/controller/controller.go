@@ -5,18 +5,26 @@ package controller
 
 import (
 	"context"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
-	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	gateway "github.com/caddyserver/gateway/internal"
 )
@@ -28,6 +36,10 @@ import (
 // Add RBAC permissions to get ConfigMaps, we use it for BackendTLSPolicies.
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
 
+// Add RBAC permissions to watch Namespaces, their labels are used to check
+// which routes may attach to listeners with a namespace selector.
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
 // Add RBAC permissions to get Secrets, this is a necessary evil as we need to
 // be able to configure TLS on gateways.
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
@@ -35,10 +47,110 @@ import (
 const (
 	owningGatewayLabel = "gateway.caddyserver.com/owning-gateway"
 
-	backendServiceIndex = "backendServiceIndex"
-	gatewayIndex        = "gatewayIndex"
+	backendServiceIndex             = "backendServiceIndex"
+	backendTLSPolicyCAIndex         = "backendTLSPolicyCAIndex"
+	backendTLSPolicyClientCertIndex = "backendTLSPolicyClientCertIndex"
+	gatewayIndex                    = "gatewayIndex"
 )
 
+// statusUpdateTimeout is how long a status update is allowed to take once the
+// context of the reconcile has been cancelled.
+const statusUpdateTimeout = 10 * time.Second
+
+// statusContext returns a context used to persist a status that has already
+// been computed. The returned context isn't cancelled with ctx, so statuses are
+// still written when a reconcile is interrupted by the manager shutting down,
+// rather than leaving stale conditions behind.
+func statusContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), statusUpdateTimeout)
+}
+
+// updateStatusWithRetry writes the status of obj, retrying on conflicts. After
+// a conflict the latest version of obj is read and merge is called to apply
+// the computed status to it, so changes written by others in the meantime
+// aren't lost.
+func updateStatusWithRetry[T client.Object](ctx context.Context, c client.Client, obj T, merge func(latest T)) error {
+	key := client.ObjectKeyFromObject(obj)
+	current := obj
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		err := c.Status().Update(ctx, current)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+		latest := obj.DeepCopyObject().(T)
+		if err := c.Get(ctx, key, latest); err != nil {
+			return err
+		}
+		merge(latest)
+		current = latest
+		return err
+	})
+}
+
+// mergeConditions sets the desired conditions on top of the latest
+// conditions, keeping the transition times of conditions that haven't
+// changed. Conditions that are no longer desired are removed.
+func mergeConditions(latest []metav1.Condition, desired []metav1.Condition) []metav1.Condition {
+	merged := slices.DeleteFunc(slices.Clone(latest), func(c metav1.Condition) bool {
+		return meta.FindStatusCondition(desired, c.Type) == nil
+	})
+	for _, c := range desired {
+		meta.SetStatusCondition(&merged, c)
+	}
+	return merged
+}
+
+// mergeRouteParentStatuses returns the latest parent statuses of a route with
+// the statuses of the managed parents replaced by the desired statuses.
+//
+// Statuses set by other controllers are kept, as are statuses set by other
+// instances of this controller for parents that are still referenced by the
+// route (parentRefs) but aren't managed by this instance, e.g. Gateways of
+// another GatewayClass. Only statuses of parents the route no longer
+// references are dropped.
+func mergeRouteParentStatuses(latest, desired []gatewayv1.RouteParentStatus, parentRefs, managed []gatewayv1.ParentReference) []gatewayv1.RouteParentStatus {
+	isOurs := func(p gatewayv1.RouteParentStatus) bool {
+		return gateway.MatchesControllerName(p.ControllerName)
+	}
+	contains := func(refs []gatewayv1.ParentReference, ref gatewayv1.ParentReference) bool {
+		return slices.ContainsFunc(refs, func(r gatewayv1.ParentReference) bool {
+			return reflect.DeepEqual(r, ref)
+		})
+	}
+	merged := make([]gatewayv1.RouteParentStatus, 0, len(latest)+len(desired))
+	used := make([]bool, len(desired))
+	for _, l := range latest {
+		if !isOurs(l) {
+			merged = append(merged, l)
+			continue
+		}
+		if !contains(managed, l.ParentRef) {
+			if contains(parentRefs, l.ParentRef) {
+				// Managed by another instance of this controller.
+				merged = append(merged, l)
+			}
+			continue
+		}
+		n := slices.IndexFunc(desired, func(d gatewayv1.RouteParentStatus) bool {
+			return isOurs(d) && reflect.DeepEqual(d.ParentRef, l.ParentRef)
+		})
+		if n < 0 {
+			// We no longer have a status for this parent.
+			continue
+		}
+		used[n] = true
+		p := *desired[n].DeepCopy()
+		p.Conditions = mergeConditions(l.Conditions, desired[n].Conditions)
+		merged = append(merged, p)
+	}
+	for n, d := range desired {
+		if !used[n] && isOurs(d) && contains(managed, d.ParentRef) {
+			merged = append(merged, *d.DeepCopy())
+		}
+	}
+	return merged
+}
+
 func hasMatchingController(ctx context.Context, c client.Reader) func(object client.Object) bool {
 	return func(obj client.Object) bool {
 		gw, ok := obj.(*gatewayv1.Gateway)
@@ -46,19 +158,48 @@ func hasMatchingController(ctx context.Context, c client.Reader) func(object cli
 			return false
 		}
 
-		log := log.FromContext(ctx, "resource", obj.GetName())
+		log := log.FromContext(ctx, logKeyGateway, client.ObjectKeyFromObject(obj))
 
 		gwc := &gatewayv1.GatewayClass{}
 		key := types.NamespacedName{Name: string(gw.Spec.GatewayClassName)}
 		if err := c.Get(ctx, key, gwc); err != nil {
-			log.Error(err, "Unable to get GatewayClass")
+			log.Error(err, "Unable to get GatewayClass", logKeyGatewayClass, key.Name)
 			return false
 		}
 
 		// Check if the GatewayClass is using our controller.
 		// ref; https://gateway-api.sigs.k8s.io/api-types/gatewayclass/#gatewayclass-controller-selection
-		return gateway.MatchesControllerName(gwc.Spec.ControllerName)
+		return gateway.IsManagedGatewayClass(gwc)
+	}
+}
+
+// managedParentRefs returns the parentRefs of a route that this controller is
+// responsible for reporting the status of. References to Gateways that don't
+// exist are kept, so their status can be reported, while references to
+// Gateways managed by other controllers (or other instances of this
+// controller) are dropped.
+func managedParentRefs(ctx context.Context, c client.Reader, routeNamespace string, refs []gatewayv1.ParentReference) []gatewayv1.ParentReference {
+	var managed []gatewayv1.ParentReference
+	for _, ref := range refs {
+		if !gateway.IsGateway(ref) {
+			managed = append(managed, ref)
+			continue
+		}
+		gw := &gatewayv1.Gateway{}
+		if err := c.Get(ctx, types.NamespacedName{
+			Namespace: gateway.NamespaceDerefOr(ref.Namespace, routeNamespace),
+			Name:      string(ref.Name),
+		}, gw); err != nil {
+			if apierrors.IsNotFound(err) {
+				managed = append(managed, ref)
+			}
+			continue
+		}
+		if hasMatchingController(ctx, c)(gw) {
+			managed = append(managed, ref)
+		}
 	}
+	return managed
 }
 
 // onlyStatusChanged returns true if and only if there is status change for underlying objects.
@@ -124,11 +265,39 @@ func onlyStatusChanged() predicate.Predicate {
 	}
 }
 
+// caddyAnnotationsChanged returns true if any of the annotations under our
+// controller's domain (e.g. `caddyserver.com/match-expression`) changed, as
+// they change the generated config without changing the object's status.
+func caddyAnnotationsChanged() predicate.Predicate {
+	prefix := string(gateway.ControllerDomain) + "/"
+	caddyAnnotations := func(o client.Object) map[string]string {
+		a := maps.Clone(o.GetAnnotations())
+		maps.DeleteFunc(a, func(k, _ string) bool {
+			return !strings.HasPrefix(k, prefix)
+		})
+		return a
+	}
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return false
+			}
+			return !maps.Equal(caddyAnnotations(e.ObjectOld), caddyAnnotations(e.ObjectNew))
+		},
+	}
+}
+
+// routeChanged returns true if the status of a route or its annotations
+// changed, see onlyStatusChanged and caddyAnnotationsChanged.
+func routeChanged() predicate.Predicate {
+	return predicate.Or(onlyStatusChanged(), caddyAnnotationsChanged())
+}
+
+// getGatewaysForSecret returns the Gateways with a listener referencing the
+// Secret as a certificate. References from other namespaces are only included
+// if they are allowed by a ReferenceGrant.
 func getGatewaysForSecret(ctx context.Context, c client.Client, obj client.Object) []*gatewayv1.Gateway {
-	log := log.FromContext(
-		ctx,
-		"resource", obj.GetName(),
-	)
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(obj))
 
 	gwList := &gatewayv1.GatewayList{}
 	if err := c.List(ctx, gwList); err != nil {
@@ -136,9 +305,14 @@ func getGatewaysForSecret(ctx context.Context, c client.Client, obj client.Objec
 		return nil
 	}
 
+	// Grants are only listed once a cross-namespace reference is found.
+	var grants []gatewayv1beta1.ReferenceGrant
+	grantsListed := false
+
 	var gateways []*gatewayv1.Gateway
-	for _, gw := range gwList.Items {
-		gwCopy := gw
+	for idx := range gwList.Items {
+		gw := &gwList.Items[idx]
+	listeners:
 		for _, l := range gw.Spec.Listeners {
 			if l.TLS == nil {
 				continue
@@ -148,23 +322,81 @@ func getGatewaysForSecret(ctx context.Context, c client.Client, obj client.Objec
 				if !gateway.IsSecret(cert) {
 					continue
 				}
-				// TODO: why would we want to put the same gateway into an
-				// array multiple times?
 				ns := gateway.NamespaceDerefOr(cert.Namespace, gw.GetNamespace())
-				if string(cert.Name) == obj.GetName() && ns == obj.GetNamespace() {
-					gateways = append(gateways, &gwCopy)
+				if string(cert.Name) != obj.GetName() || ns != obj.GetNamespace() {
+					continue
+				}
+				if ns != gw.GetNamespace() {
+					if !grantsListed {
+						grantList := &gatewayv1beta1.ReferenceGrantList{}
+						if err := c.List(ctx, grantList, client.InNamespace(ns)); err != nil {
+							log.Error(err, "Unable to list ReferenceGrants")
+							return nil
+						}
+						grants, grantsListed = grantList.Items, true
+					}
+					if !gateway.IsSecretReferenceAllowed(gw.GetNamespace(), cert, grants) {
+						continue
+					}
 				}
+				gateways = append(gateways, gw)
+				break listeners
+			}
+		}
+	}
+	return gateways
+}
+
+// getGatewaysForReferenceGrant returns the Gateways with a listener
+// referencing a certificate in the namespace of the ReferenceGrant, from a
+// namespace the grant allows Gateways to reference Secrets from.
+func getGatewaysForReferenceGrant(ctx context.Context, c client.Client, grant *gatewayv1beta1.ReferenceGrant) []types.NamespacedName {
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(grant))
+
+	var namespaces []string
+	for _, from := range grant.Spec.From {
+		if from.Group == gatewayv1.GroupName && from.Kind == "Gateway" && string(from.Namespace) != grant.Namespace {
+			namespaces = append(namespaces, string(from.Namespace))
+		}
+	}
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	var gateways []types.NamespacedName
+	for _, ns := range namespaces {
+		gwList := &gatewayv1.GatewayList{}
+		if err := c.List(ctx, gwList, client.InNamespace(ns)); err != nil {
+			log.Error(err, "Unable to list Gateways")
+			return nil
+		}
+		for _, gw := range gwList.Items {
+			if gatewayReferencesCertificatesIn(&gw, grant.Namespace) {
+				gateways = append(gateways, client.ObjectKeyFromObject(&gw))
 			}
 		}
 	}
 	return gateways
 }
 
+// gatewayReferencesCertificatesIn returns true if a listener of the Gateway
+// references a certificate in the namespace.
+func gatewayReferencesCertificatesIn(gw *gatewayv1.Gateway, namespace string) bool {
+	for _, l := range gw.Spec.Listeners {
+		if l.TLS == nil {
+			continue
+		}
+		for _, cert := range l.TLS.CertificateRefs {
+			if gateway.IsSecret(cert) && gateway.NamespaceDerefOr(cert.Namespace, gw.Namespace) == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getGatewaysForNamespace(ctx context.Context, c client.Client, ns client.Object) []types.NamespacedName {
-	log := log.FromContext(
-		ctx,
-		"namespace", ns.GetName(),
-	)
+	log := log.FromContext(ctx, logKeyResource, ns.GetName())
 
 	gwList := &gatewayv1.GatewayList{}
 	if err := c.List(ctx, gwList); err != nil {
@@ -193,19 +425,11 @@ func getGatewaysForNamespace(ctx context.Context, c client.Client, ns client.Obj
 					})
 				}
 			case gatewayv1.NamespacesFromSelector:
-				nsList := &corev1.NamespaceList{}
-				err := c.List(ctx, nsList, client.MatchingLabels(l.AllowedRoutes.Namespaces.Selector.MatchLabels))
-				if err != nil {
-					log.Error(err, "Unable to list Namespaces")
-					return nil
-				}
-				for _, item := range nsList.Items {
-					if item.GetName() == ns.GetName() {
-						gateways = append(gateways, client.ObjectKey{
-							Namespace: gw.GetNamespace(),
-							Name:      gw.GetName(),
-						})
-					}
+				if gateway.NamespaceMatchesSelector(l.AllowedRoutes.Namespaces.Selector, ns.GetLabels()) {
+					gateways = append(gateways, client.ObjectKey{
+						Namespace: gw.GetNamespace(),
+						Name:      gw.GetName(),
+					})
 				}
 			}
 		}
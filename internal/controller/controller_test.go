@@ -0,0 +1,335 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+func TestMergeRouteParentStatuses(t *testing.T) {
+	ours := func(gw string, reason gatewayv1.RouteConditionReason) gatewayv1.RouteParentStatus {
+		return gatewayv1.RouteParentStatus{
+			ParentRef:      gatewayv1.ParentReference{Name: gatewayv1.ObjectName(gw)},
+			ControllerName: gateway.ControllerName,
+			Conditions: []metav1.Condition{{
+				Type:   string(gatewayv1.RouteConditionAccepted),
+				Status: metav1.ConditionTrue,
+				Reason: string(reason),
+			}},
+		}
+	}
+	theirs := gatewayv1.RouteParentStatus{
+		ParentRef:      gatewayv1.ParentReference{Name: "other"},
+		ControllerName: "example.com/gateway-controller",
+	}
+	refs := func(names ...string) []gatewayv1.ParentReference {
+		var refs []gatewayv1.ParentReference
+		for _, name := range names {
+			refs = append(refs, gatewayv1.ParentReference{Name: gatewayv1.ObjectName(name)})
+		}
+		return refs
+	}
+
+	tests := []struct {
+		name       string
+		latest     []gatewayv1.RouteParentStatus
+		desired    []gatewayv1.RouteParentStatus
+		parentRefs []gatewayv1.ParentReference
+		managed    []gatewayv1.ParentReference
+		want       []gatewayv1.RouteParentStatus
+	}{
+		{
+			name:       "adds desired statuses",
+			desired:    []gatewayv1.RouteParentStatus{ours("a", "New")},
+			parentRefs: refs("a"),
+			managed:    refs("a"),
+			want:       []gatewayv1.RouteParentStatus{ours("a", "New")},
+		},
+		{
+			name:       "replaces managed statuses",
+			latest:     []gatewayv1.RouteParentStatus{ours("a", "Old")},
+			desired:    []gatewayv1.RouteParentStatus{ours("a", "New")},
+			parentRefs: refs("a"),
+			managed:    refs("a"),
+			want:       []gatewayv1.RouteParentStatus{ours("a", "New")},
+		},
+		{
+			name:       "keeps statuses of other controllers",
+			latest:     []gatewayv1.RouteParentStatus{theirs, ours("a", "Old")},
+			desired:    []gatewayv1.RouteParentStatus{ours("a", "New")},
+			parentRefs: refs("other", "a"),
+			managed:    refs("a"),
+			want:       []gatewayv1.RouteParentStatus{theirs, ours("a", "New")},
+		},
+		{
+			name:       "keeps statuses of other instances",
+			latest:     []gatewayv1.RouteParentStatus{ours("a", "Old"), ours("b", "OtherInstance")},
+			desired:    []gatewayv1.RouteParentStatus{ours("a", "New"), ours("b", "Stale")},
+			parentRefs: refs("a", "b"),
+			managed:    refs("a"),
+			want:       []gatewayv1.RouteParentStatus{ours("a", "New"), ours("b", "OtherInstance")},
+		},
+		{
+			name:       "doesn't add statuses of other instances",
+			desired:    []gatewayv1.RouteParentStatus{ours("a", "New"), ours("b", "Stale")},
+			parentRefs: refs("a", "b"),
+			managed:    refs("a"),
+			want:       []gatewayv1.RouteParentStatus{ours("a", "New")},
+		},
+		{
+			name:       "drops statuses of removed parents",
+			latest:     []gatewayv1.RouteParentStatus{ours("a", "Old"), ours("b", "Old")},
+			desired:    []gatewayv1.RouteParentStatus{ours("a", "New")},
+			parentRefs: refs("a"),
+			managed:    refs("a"),
+			want:       []gatewayv1.RouteParentStatus{ours("a", "New")},
+		},
+		{
+			name:       "drops managed statuses that are no longer desired",
+			latest:     []gatewayv1.RouteParentStatus{ours("a", "Old"), ours("b", "Old")},
+			desired:    []gatewayv1.RouteParentStatus{ours("a", "New")},
+			parentRefs: refs("a", "b"),
+			managed:    refs("a", "b"),
+			want:       []gatewayv1.RouteParentStatus{ours("a", "New")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeRouteParentStatuses(tt.latest, tt.desired, tt.parentRefs, tt.managed)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mergeRouteParentStatuses() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// conflictingClient fails the first status updates with a conflict, as if the
+// object was modified in the meantime.
+type conflictingClient struct {
+	*testClient
+
+	conflicts int
+}
+
+func (c *conflictingClient) Status() client.SubResourceWriter {
+	return conflictingStatusWriter{c: c}
+}
+
+type conflictingStatusWriter struct {
+	client.SubResourceWriter
+
+	c *conflictingClient
+}
+
+func (w conflictingStatusWriter) Update(ctx context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+	if w.c.conflicts > 0 {
+		w.c.conflicts--
+		return apierrors.NewConflict(schema.GroupResource{}, obj.GetName(), nil)
+	}
+	return w.c.testClient.Update(ctx, obj)
+}
+
+func TestUpdateStatusWithRetry(t *testing.T) {
+	condition := func(t string, reason string) metav1.Condition {
+		return metav1.Condition{Type: t, Status: metav1.ConditionTrue, Reason: reason}
+	}
+
+	tests := []struct {
+		name      string
+		conflicts int
+		// latest are the conditions written by someone else in the meantime.
+		latest     []metav1.Condition
+		want       []metav1.Condition
+		wantMerges int
+		wantErr    bool
+	}{
+		{
+			name:   "no conflict",
+			latest: []metav1.Condition{condition("Other", "Other")},
+			want:   []metav1.Condition{condition("Accepted", "Accepted")},
+		},
+		{
+			name:       "merged after a conflict",
+			conflicts:  2,
+			latest:     []metav1.Condition{condition("Other", "Other")},
+			want:       []metav1.Condition{condition("Other", "Other"), condition("Accepted", "Accepted")},
+			wantMerges: 2,
+		},
+		{
+			name:       "gives up after too many conflicts",
+			conflicts:  100,
+			wantMerges: 4,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := &gatewayv1.GatewayClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "caddy"},
+				Status:     gatewayv1.GatewayClassStatus{Conditions: tt.latest},
+			}
+			c := &conflictingClient{testClient: newTestClientWith(stored), conflicts: tt.conflicts}
+
+			desired := condition("Accepted", "Accepted")
+			gwc := stored.DeepCopy()
+			gwc.Status.Conditions = []metav1.Condition{desired}
+			merges := 0
+			err := updateStatusWithRetry(context.Background(), c, gwc, func(latest *gatewayv1.GatewayClass) {
+				merges++
+				meta.SetStatusCondition(&latest.Status.Conditions, desired)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateStatusWithRetry() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if merges != tt.wantMerges {
+				t.Errorf("merged %d times, want %d", merges, tt.wantMerges)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := &gatewayv1.GatewayClass{}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(stored), got); err != nil {
+				t.Fatal(err)
+			}
+			opts := cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")
+			if diff := cmp.Diff(tt.want, got.Status.Conditions, opts); diff != "" {
+				t.Errorf("conditions mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergeConditions(t *testing.T) {
+	transitioned := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	condition := func(t string, status metav1.ConditionStatus, at metav1.Time) metav1.Condition {
+		return metav1.Condition{Type: t, Status: status, Reason: t, LastTransitionTime: at}
+	}
+
+	tests := []struct {
+		name    string
+		latest  []metav1.Condition
+		desired []metav1.Condition
+		want    []metav1.Condition
+	}{
+		{
+			name:    "adds conditions",
+			desired: []metav1.Condition{condition("Accepted", metav1.ConditionTrue, now)},
+			want:    []metav1.Condition{condition("Accepted", metav1.ConditionTrue, now)},
+		},
+		{
+			name:    "keeps the transition time of unchanged conditions",
+			latest:  []metav1.Condition{condition("Accepted", metav1.ConditionTrue, transitioned)},
+			desired: []metav1.Condition{condition("Accepted", metav1.ConditionTrue, now)},
+			want:    []metav1.Condition{condition("Accepted", metav1.ConditionTrue, transitioned)},
+		},
+		{
+			name:    "updates changed conditions",
+			latest:  []metav1.Condition{condition("Accepted", metav1.ConditionTrue, transitioned)},
+			desired: []metav1.Condition{condition("Accepted", metav1.ConditionFalse, now)},
+			want:    []metav1.Condition{condition("Accepted", metav1.ConditionFalse, now)},
+		},
+		{
+			name: "removes stale conditions",
+			latest: []metav1.Condition{
+				condition("Accepted", metav1.ConditionTrue, transitioned),
+				condition("Promoted", metav1.ConditionTrue, transitioned),
+			},
+			desired: []metav1.Condition{condition("Accepted", metav1.ConditionTrue, now)},
+			want:    []metav1.Condition{condition("Accepted", metav1.ConditionTrue, transitioned)},
+		},
+		{
+			name:   "removes every condition",
+			latest: []metav1.Condition{condition("Accepted", metav1.ConditionTrue, transitioned)},
+			want:   []metav1.Condition{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest := append([]metav1.Condition(nil), tt.latest...)
+			got := mergeConditions(latest, tt.desired)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mergeConditions() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.latest, latest); diff != "" {
+				t.Errorf("mergeConditions() modified the latest conditions (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRouteChanged(t *testing.T) {
+	route := func(annotations map[string]string, reason string) *gatewayv1.HTTPRoute {
+		hr := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		if reason != "" {
+			hr.Status.Parents = []gatewayv1.RouteParentStatus{{
+				Conditions: []metav1.Condition{{Type: "Accepted", Reason: reason}},
+			}}
+		}
+		return hr
+	}
+
+	tests := []struct {
+		name     string
+		old, new *gatewayv1.HTTPRoute
+		want     bool
+	}{
+		{
+			name: "unchanged",
+			old:  route(map[string]string{"caddyserver.com/failover": "true"}, "Accepted"),
+			new:  route(map[string]string{"caddyserver.com/failover": "true"}, "Accepted"),
+		},
+		{
+			name: "status changed",
+			old:  route(nil, ""),
+			new:  route(nil, "Accepted"),
+			want: true,
+		},
+		{
+			name: "annotation added",
+			old:  route(nil, ""),
+			new:  route(map[string]string{"caddyserver.com/match-expression": "{method} == 'GET'"}, ""),
+			want: true,
+		},
+		{
+			name: "annotation changed",
+			old:  route(map[string]string{"caddyserver.com/mirror-percent": "10"}, ""),
+			new:  route(map[string]string{"caddyserver.com/mirror-percent": "20"}, ""),
+			want: true,
+		},
+		{
+			name: "annotation removed",
+			old:  route(map[string]string{"caddyserver.com/websocket-only": "true"}, ""),
+			new:  route(map[string]string{}, ""),
+			want: true,
+		},
+		{
+			name: "other annotation changed",
+			old:  route(map[string]string{"example.com/owner": "a"}, ""),
+			new:  route(map[string]string{"example.com/owner": "b"}, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeChanged().Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new}); got != tt.want {
+				t.Errorf("routeChanged() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+
+// getReconcileRequestsForEndpointSlice returns a reconcile request for each
+// Gateway that has an HTTPRoute or GRPCRoute attached that references the
+// Service the given EndpointSlice belongs to.
+func getReconcileRequestsForEndpointSlice(ctx context.Context, c client.Client, obj client.Object) []reconcile.Request {
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(obj))
+
+	name := obj.GetLabels()[discoveryv1.LabelServiceName]
+	if name == "" {
+		return nil
+	}
+
+	reqs, err := getReconcileRequestsForBackendService(ctx, c, types.NamespacedName{
+		Namespace: obj.GetNamespace(),
+		Name:      name,
+	})
+	if err != nil {
+		log.Error(err, "Unable to list routes")
+		return nil
+	}
+	return reqs
+}
@@ -4,22 +4,24 @@
 package controller
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"io"
-	"net"
-	"net/http"
 	"os"
-	"sync"
+	"slices"
+	"strings"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/matthewpi/certwatcher"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	certificatesv1alpha1 "k8s.io/api/certificates/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,6 +31,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -38,6 +41,7 @@ import (
 	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
+	"github.com/caddyserver/gateway/api/v1alpha1"
 	gateway "github.com/caddyserver/gateway/internal"
 	"github.com/caddyserver/gateway/internal/caddy"
 )
@@ -47,7 +51,12 @@ import (
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways/status,verbs=patch;update
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=referencegrants,verbs=get;list;watch
 
-// +kubebuilder:rbac:groups=core,resources=endpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=gateway.caddyserver.com,resources=caddyhttpfilters,verbs=get;list;watch
+
+// caddyHTTPFilterGVK is the kind of CaddyHTTPFilter, which may not be
+// installed.
+var caddyHTTPFilterGVK = v1alpha1.GroupVersion.WithKind("CaddyHTTPFilter")
 
 type GatewayReconciler struct {
 	client.Client
@@ -55,44 +64,244 @@ type GatewayReconciler struct {
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
 
+	// Agent runs the reconciler in agent mode, see AgentOptions for details.
+	Agent *AgentOptions
+
+	// DisableBackendAutoTLS disables connecting to HTTPS backends over TLS
+	// unless they are targeted by a BackendTLSPolicy.
+	DisableBackendAutoTLS bool
+
+	// PodUpstreams proxies directly to the ready endpoints of backend Services,
+	// rather than to their ClusterIP.
+	PodUpstreams bool
+
+	// TargetedProgramming only programs Caddy instances that aren't already
+	// running the generated config, rather than every instance on every
+	// reconcile. This significantly reduces the load on large clusters, the
+	// controller enables it by default.
+	TargetedProgramming bool
+
+	// MaxConcurrentReconciles is the maximum number of Gateways reconciled at
+	// once, defaults to 1.
+	MaxConcurrentReconciles int
+
+	// ProgrammingConcurrency is the maximum number of Caddy instances
+	// programmed at once across every Gateway, shared fairly between the
+	// Gateways being reconciled. Zero or less is unlimited.
+	ProgrammingConcurrency int
+
+	// ConfigPublisher is how generated configs are delivered to Caddy,
+	// defaults to ConfigPublisherAdminAPI.
+	ConfigPublisher ConfigPublisher
+
+	// ConfigDir is the directory configs are written to by
+	// ConfigPublisherFile.
+	ConfigDir string
+
+	// Pull configures the server used by ConfigPublisherPull.
+	Pull PullOptions
+
+	// GeneratorOptions are the options configs are generated with, unless
+	// overridden by a GatewayClass's parameters.
+	GeneratorOptions caddy.GeneratorOptions
+
+	// ProgrammingPort is the port Caddy instances are programmed on by
+	// ConfigPublisherAdminAPI, defaults to 2021.
+	ProgrammingPort int
+
+	// AdminTLS configures the client certificate and CA used for mTLS
+	// connections to Caddy instances, see AdminTLSOptions for details.
+	AdminTLS AdminTLSOptions
+
+	// Rollout configures programming Caddy instances in verified batches,
+	// see RolloutOptions for details.
+	Rollout RolloutOptions
+
+	// PodMonitors configures PodMonitors for the Caddy instances of every
+	// Gateway, see PodMonitorOptions for details.
+	PodMonitors PodMonitorOptions
+
+	// Provision creates the Caddy instances of every Gateway, see
+	// ProvisionOptions for details.
+	Provision ProvisionOptions
+
+	// ValidationImage is a Caddy image used to validate generated configs
+	// with `caddy validate` in a Job, before they are pushed to any Caddy
+	// instance. Validation is disabled if empty.
+	ValidationImage string
+
+	// apiReader is an uncached reader, used for objects that are rarely read
+	// and not worth caching across the cluster.
+	apiReader client.Reader
+
 	rootCAs     *x509.CertPool
 	certwatcher *certwatcher.TLSConfig
 
 	tlsConfig *tls.Config
+
+	breaker    caddyBreaker
+	retries    programmingRetries
+	programmed programmedState
+	limiter    *programmingLimiter
+	validated  validatedConfigs
+	publisher  publisher
+	rollouts   haltedRollouts
+	verified   verifiedConfigs
+	backendCAs backendCAUpdates
 }
 
 var _ reconcile.Reconciler = (*GatewayReconciler)(nil)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.apiReader = mgr.GetAPIReader()
 	ctrlPredicate := builder.WithPredicates(
 		predicate.NewPredicateFuncs(
 			hasMatchingController(context.Background(), r.Client),
 		),
 	)
 
-	r.rootCAs = x509.NewCertPool()
-	v, err := os.ReadFile("/var/run/secrets/tls/ca.crt")
-	if err != nil {
-		return fmt.Errorf("error reading ca_path: %w", err)
+	if r.Agent != nil {
+		// Only reconcile the Gateway served by the local Caddy instance.
+		ctrlPredicate = builder.WithPredicates(
+			predicate.NewPredicateFuncs(
+				hasMatchingController(context.Background(), r.Client),
+			),
+			predicate.NewPredicateFuncs(func(o client.Object) bool {
+				if _, ok := o.(*gatewayv1.Gateway); !ok {
+					return true
+				}
+				return client.ObjectKeyFromObject(o) == r.Agent.Gateway
+			}),
+		)
+	} else {
+		var err error
+		if r.publisher, err = r.newPublisher(); err != nil {
+			return err
+		}
 	}
-	if ok := r.rootCAs.AppendCertsFromPEM(v); !ok {
-		return errors.New("failed to load ca certificates")
+	switch r.publisher.(type) {
+	case *adminAPIPublisher, *configServer:
+		// mTLS is only used to push or serve configs over the pod network,
+		// agents use a local Unix socket and other publishers never connect
+		// to Caddy.
+		if err := r.setupTLS(mgr.GetAPIReader()); err != nil {
+			return err
+		}
+		r.limiter = newProgrammingLimiter(r.ProgrammingConcurrency)
 	}
-	r.certwatcher = &certwatcher.TLSConfig{
-		CertPath: "/var/run/secrets/tls/tls.crt",
-		KeyPath:  "/var/run/secrets/tls/tls.key",
-		Config: &tls.Config{
-			RootCAs: r.rootCAs,
-		},
-		DontStaple: true,
+	// Agents never provision Caddy, so the provisioning options are ignored.
+	provisioning := r.Provision.enabled() && r.Agent == nil
+	if _, ok := r.publisher.(*configServer); provisioning && !ok {
+		return errors.New("provisioning Caddy requires Caddy to pull configs from the controller")
 	}
-	r.tlsConfig, err = r.certwatcher.GetTLSConfig(context.Background())
-	if err != nil {
+	if provisioning && r.Provision.IssuerSecret.Name == "" {
+		return errors.New("an issuer secret is required to provision Caddy")
+	}
+	if s, ok := r.publisher.(*configServer); ok {
+		s.tlsConfig = r.tlsConfig
+		if err := mgr.Add(s); err != nil {
+			return err
+		}
+	}
+
+	// Index BackendTLSPolicies by the CA certificates they reference, this
+	// allows us to quickly find any Gateways that need to be re-programmed
+	// whenever a CA bundle is rotated.
+	if err := mgr.GetFieldIndexer().IndexField(
+		context.Background(),
+		&gatewayv1alpha3.BackendTLSPolicy{},
+		backendTLSPolicyCAIndex,
+		indexBackendTLSPolicyCACertificates,
+	); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(
+		context.Background(),
+		&gatewayv1alpha3.BackendTLSPolicy{},
+		backendTLSPolicyClientCertIndex,
+		indexBackendTLSPolicyClientCertificate,
+	); err != nil {
 		return err
 	}
+	// HTTPRoutes and GRPCRoutes are indexed by their route controllers, which
+	// don't run in agent mode.
+	if r.Agent != nil {
+		if err := mgr.GetFieldIndexer().IndexField(
+			context.Background(),
+			&gatewayv1.HTTPRoute{},
+			backendServiceIndex,
+			indexHTTPRouteBackendServices(mgr),
+		); err != nil {
+			return err
+		}
+		if err := mgr.GetFieldIndexer().IndexField(
+			context.Background(),
+			&gatewayv1.GRPCRoute{},
+			backendServiceIndex,
+			indexGRPCRouteBackendServices(mgr),
+		); err != nil {
+			return err
+		}
+	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	// Unless PodUpstreams is set, only the EndpointSlices of headless Services
+	// are used to proxy to backends.
+	b := ctrl.NewControllerManagedBy(mgr).
+		Watches(
+			&discoveryv1.EndpointSlice{},
+			r.enqueueRequestForEndpointSlice(),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+				_, headless := object.GetLabels()[corev1.IsHeadlessService]
+				return r.PodUpstreams || headless
+			})),
+		)
+	if r.ValidationImage != "" {
+		b = b.Owns(&batchv1.Job{})
+	}
+	if _, ok := r.publisher.(*secretPublisher); ok {
+		b = b.Owns(&corev1.Secret{})
+	}
+	if provisioning {
+		// Only changes to what the controller provisions matter, not the
+		// status updates made as Caddy instances are rolled out.
+		provisionedPredicate := builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		))
+		b = b.
+			Owns(&appsv1.Deployment{}, provisionedPredicate).
+			Owns(&appsv1.DaemonSet{}, provisionedPredicate).
+			Owns(&autoscalingv2.HorizontalPodAutoscaler{}, provisionedPredicate)
+	}
+	// ClusterTrustBundles are an alpha API, so are only watched if served.
+	ctbGVK := certificatesv1alpha1.SchemeGroupVersion.WithKind("ClusterTrustBundle")
+	if _, err := mgr.GetRESTMapper().RESTMapping(ctbGVK.GroupKind(), ctbGVK.Version); err == nil {
+		b = b.
+			Watches(
+				&certificatesv1alpha1.ClusterTrustBundle{},
+				r.enqueueRequestForBackendCACertificate(),
+				builder.WithPredicates(predicate.NewPredicateFuncs(r.usedInBackendTLSPolicy)),
+			).
+			Watches(
+				&certificatesv1alpha1.ClusterTrustBundle{},
+				r.enqueueRequestForGatewayClassParameters(),
+			)
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+	if _, err := mgr.GetRESTMapper().RESTMapping(caddyGatewayConfigGVK.GroupKind(), caddyGatewayConfigGVK.Version); err == nil {
+		b = b.Watches(&v1alpha1.CaddyGatewayConfig{}, r.enqueueRequestForGatewayClassParameters())
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+	if _, err := mgr.GetRESTMapper().RESTMapping(caddyHTTPFilterGVK.GroupKind(), caddyHTTPFilterGVK.Version); err == nil {
+		b = b.Watches(&v1alpha1.CaddyHTTPFilter{}, r.enqueueRequestForExtensionRef())
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+	return b.
 		For(&gatewayv1.Gateway{}, ctrlPredicate).
 		Watches(
 			&gatewayv1.GatewayClass{},
@@ -102,26 +311,27 @@ func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(
 			&gatewayv1.GRPCRoute{},
 			r.enqueueRequestForOwningGRPCRoute(),
+			builder.WithPredicates(routeChanged()),
 		).
 		Watches(
 			&gatewayv1.HTTPRoute{},
 			r.enqueueRequestForOwningHTTPRoute(),
-			builder.WithPredicates(onlyStatusChanged()),
+			builder.WithPredicates(routeChanged()),
 		).
 		Watches(
 			&gatewayv1alpha2.TCPRoute{},
 			r.enqueueRequestForOwningTCPRoute(),
-			builder.WithPredicates(onlyStatusChanged()),
+			builder.WithPredicates(routeChanged()),
 		).
 		Watches(
 			&gatewayv1alpha2.TLSRoute{},
 			r.enqueueRequestForOwningTLSRoute(),
-			builder.WithPredicates(onlyStatusChanged()),
+			builder.WithPredicates(routeChanged()),
 		).
 		Watches(
 			&gatewayv1alpha2.UDPRoute{},
 			r.enqueueRequestForOwningUDPRoute(),
-			builder.WithPredicates(onlyStatusChanged()),
+			builder.WithPredicates(routeChanged()),
 		).
 		Watches(&gatewayv1alpha3.BackendTLSPolicy{}, r.enqueueRequestForTLSPolicy()).
 		Watches(
@@ -129,9 +339,43 @@ func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			r.enqueueRequestForTLSSecret(),
 			builder.WithPredicates(predicate.NewPredicateFuncs(r.usedInGateway)),
 		).
+		Watches(
+			&gatewayv1beta1.ReferenceGrant{},
+			r.enqueueRequestForReferenceGrant(),
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			r.enqueueRequestForBackendCACertificate(),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.usedInBackendTLSPolicy)),
+		).
+		Watches(
+			&corev1.Secret{},
+			r.enqueueRequestForBackendCACertificate(),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.usedInBackendTLSPolicy)),
+		).
+		Watches(
+			&corev1.Secret{},
+			r.enqueueRequestForClientCertificate(),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.usedAsClientCertificate)),
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			r.enqueueRequestForGatewayClassParameters(),
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			r.enqueueRequestForExtensionRef(),
+		).
+		// Only the labels of Namespaces are needed, so only their metadata is
+		// cached.
 		Watches(
 			&corev1.Namespace{},
 			r.enqueueRequestForAllowedNamespace(),
+			builder.OnlyMetadata,
+		).
+		Watches(
+			&corev1.Service{},
+			r.enqueueRequestForPromotingService(),
 		).
 		Watches(
 			&corev1.Service{},
@@ -144,7 +388,7 @@ func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			),
 		).
 		Watches(
-			&corev1.Endpoints{},
+			&discoveryv1.EndpointSlice{},
 			r.enqueueRequestForOwningResource(),
 			builder.WithPredicates(
 				predicate.NewPredicateFuncs(func(object client.Object) bool {
@@ -153,30 +397,93 @@ func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				}),
 			),
 		).
+		// Only the annotations of Pods are needed, so only their metadata is
+		// cached.
+		Watches(
+			&corev1.Pod{},
+			r.enqueueRequestForDrainingPod(),
+			builder.WithPredicates(drainAnnotationChanged()),
+			builder.OnlyMetadata,
+		).
 		Owns(&corev1.Service{}).
-		Owns(&corev1.Endpoints{}).
+		WithOptions(crcontroller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		}).
 		Complete(r)
 }
 
+// setupTLS loads the client certificate and CA used for mTLS connections to
+// Caddy instances, see AdminTLSOptions. reader is used to load the CA from
+// AdminTLS.Secret, as the cache may not have been started yet.
+func (r *GatewayReconciler) setupTLS(reader client.Reader) error {
+	r.rootCAs = x509.NewCertPool()
+	if r.AdminTLS.Secret.Name != "" {
+		secret := &corev1.Secret{}
+		if err := reader.Get(context.Background(), r.AdminTLS.Secret, secret); err != nil {
+			return fmt.Errorf("error reading admin TLS secret: %w", err)
+		}
+		if ok := r.rootCAs.AppendCertsFromPEM(secret.Data["ca.crt"]); !ok {
+			return errors.New("failed to load ca certificates")
+		}
+		keyPair := &secretKeyPair{client: r.Client, key: r.AdminTLS.Secret}
+		r.tlsConfig = &tls.Config{
+			RootCAs: r.rootCAs,
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return keyPair.get(hello.Context())
+			},
+			GetClientCertificate: func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return keyPair.get(cri.Context())
+			},
+		}
+		return nil
+	}
+
+	v, err := os.ReadFile(r.AdminTLS.caPath())
+	if err != nil {
+		return fmt.Errorf("error reading ca_path: %w", err)
+	}
+	if ok := r.rootCAs.AppendCertsFromPEM(v); !ok {
+		return errors.New("failed to load ca certificates")
+	}
+	r.certwatcher = &certwatcher.TLSConfig{
+		CertPath: r.AdminTLS.certPath(),
+		KeyPath:  r.AdminTLS.keyPath(),
+		Config: &tls.Config{
+			RootCAs: r.rootCAs,
+		},
+		DontStaple: true,
+	}
+	r.tlsConfig, err = r.certwatcher.GetTLSConfig(context.Background())
+	return err
+}
+
 // Reconcile reconciles Gateway resources.
 // ref; https://gateway-api.sigs.k8s.io/guides/implementers/#gateway
 func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
+	if r.Agent != nil && req.NamespacedName != r.Agent.Gateway {
+		return ctrl.Result{}, nil
+	}
+
 	// Get the Gateway we are reconciling.
 	original := &gatewayv1.Gateway{}
 	if err := r.Get(ctx, req.NamespacedName, original); err != nil {
 		if apierrors.IsNotFound(err) {
-			log.V(3).Info("Gateway not found, ignoring reconcile request")
+			log.V(logLevelTrace).Info("Gateway not found, ignoring reconcile request")
+			if s, ok := r.publisher.(*configServer); ok {
+				s.forget(req.NamespacedName)
+			}
+			r.forget(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "Failed to get Gateway")
 		return ctrl.Result{}, err
 	}
-	log = log.WithValues("Gateway.Namespace", original.Namespace, "Gateway.Name", original.Name)
 
 	// Ignore the gateway if it is being deleted.
 	if original.GetDeletionTimestamp() != nil {
+		r.forget(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
@@ -185,7 +492,7 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	// Get the Gateway Class referenced by the Gateway.
 	gwc := &gatewayv1.GatewayClass{}
 	if err := r.Get(ctx, client.ObjectKey{Name: string(gw.Spec.GatewayClassName)}, gwc); err != nil {
-		log.V(2).Error(err, "Unable to get GatewayClass", "GatewayClass.Name", gw.Spec.GatewayClassName)
+		log.Error(err, "Unable to get GatewayClass", logKeyGatewayClass, gw.Spec.GatewayClassName)
 		var message string
 		if apierrors.IsNotFound(err) {
 			message = "GatewayClass does not exist"
@@ -203,65 +510,42 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 	// Check if the GatewayClass is using our controller.
 	// ref; https://gateway-api.sigs.k8s.io/api-types/gatewayclass/#gatewayclass-controller-selection
-	if !gateway.MatchesControllerName(gwc.Spec.ControllerName) {
-		log.V(2).Info("Ignoring Gateway as it requests another controller")
+	if !gateway.IsManagedGatewayClass(gwc) {
+		log.V(logLevelTrace).Info("Ignoring Gateway as it requests another controller")
 		return ctrl.Result{}, nil
 	}
 
 	// Check if the GatewayClass is Accepted, if not don't cannot continue.
 	if c := meta.FindStatusCondition(gwc.Status.Conditions, string(gatewayv1.GatewayClassConditionStatusAccepted)); c == nil || c.Status != metav1.ConditionTrue {
-		log.V(2).Info("Ignoring Gateway as it's GatewayClass isn't Accepted", "GatewayClass.Name", gwc.Name)
+		log.V(logLevelTrace).Info("Ignoring Gateway as it's GatewayClass isn't Accepted", logKeyGatewayClass, gwc.Name)
 		return ctrl.Result{}, nil
 	}
-	log.Info("Reconciling")
-
-	httpRouteList := &gatewayv1.HTTPRouteList{}
-	if err := r.Client.List(ctx, httpRouteList); err != nil {
-		log.Error(err, "Unable to list HTTPRoutes")
-		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
-	}
-
-	grpcRouteList := &gatewayv1.GRPCRouteList{}
-	if err := r.Client.List(ctx, grpcRouteList); err != nil {
-		log.Error(err, "Unable to list GRPCRoutes")
-		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
-	}
+	log.V(logLevelDebug).Info("Reconciling")
 
-	tcpRouteList := &gatewayv1alpha2.TCPRouteList{}
-	if err := r.Client.List(ctx, tcpRouteList); err != nil {
-		log.Error(err, "Unable to list TCPRoutes")
-		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
-	}
-
-	tlsRouteList := &gatewayv1alpha2.TLSRouteList{}
-	if err := r.Client.List(ctx, tlsRouteList); err != nil {
-		log.Error(err, "Unable to list TLSRoutes")
-		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
-	}
-
-	udpRouteList := &gatewayv1alpha2.UDPRouteList{}
-	if err := r.Client.List(ctx, udpRouteList); err != nil {
-		log.Error(err, "Unable to list UDPRoutes")
-		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
-	}
-
-	grantList := &gatewayv1beta1.ReferenceGrantList{}
-	if err := r.Client.List(ctx, grantList); err != nil {
-		log.Error(err, "Unable to list ReferenceGrants")
-		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
-	}
-
-	backendTLSPolicyList := &gatewayv1alpha3.BackendTLSPolicyList{}
-	if err := r.Client.List(ctx, backendTLSPolicyList); err != nil {
-		log.Error(err, "Unable to list BackendTLSPolicies")
+	i, err := r.newInput(ctx, original, gwc)
+	if err != nil {
 		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
 	}
 
-	// TODO: only list services from accepted routes.
-	serviceList := &corev1.ServiceList{}
-	if err := r.Client.List(ctx, serviceList); err != nil {
-		log.Error(err, "Unable to list Services")
-		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
+	if isHostNetwork(gw) {
+		conflicts, err := r.checkHostNetworkPorts(ctx, gw)
+		if err != nil {
+			return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
+		}
+		if len(conflicts) > 0 {
+			log.Info("Listeners conflict with ports on the host network", "conflicts", conflicts)
+			meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+				Type:    string(gatewayv1.GatewayConditionAccepted),
+				Status:  metav1.ConditionFalse,
+				Reason:  string(gatewayv1.GatewayReasonListenersNotValid),
+				Message: "Port conflicts on host network: " + strings.Join(conflicts, "; "),
+			})
+			// Don't return an error, the conflicts won't go away by retrying.
+			if err := r.updateStatus(ctx, original, gw); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
+			}
+			return ctrl.Result{RequeueAfter: hostNetworkConflictRequeue}, nil
+		}
 	}
 
 	// TODO: https://github.com/cilium/cilium/blob/main/operator/pkg/gateway-api/gateway_reconcile.go#L355
@@ -278,87 +562,180 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	//	Message: "",
 	//})
 
-	i := &caddy.Input{
-		Gateway:      original,
-		GatewayClass: gwc,
-
-		HTTPRoutes: r.filterHTTPRoutesByGateway(ctx, gw, httpRouteList.Items),
-		GRPCRoutes: r.filterGRPCRoutesByGateway(ctx, gw, grpcRouteList.Items),
-		TCPRoutes:  r.filterTCPRoutesByGateway(ctx, gw, tcpRouteList.Items),
-		TLSRoutes:  r.filterTLSRoutesByGateway(ctx, gw, tlsRouteList.Items),
-		UDPRoutes:  r.filterUDPRoutesByGateway(ctx, gw, udpRouteList.Items),
-
-		Grants:             grantList.Items,
-		BackendTLSPolicies: backendTLSPolicyList.Items,
-
-		Services: serviceList.Items,
-
-		Client: r.Client,
+	// The config is generated before provisioning, as the client
+	// certificates it uses are mounted on the Caddy instances.
+	if r.Agent != nil {
+		i.AdminListen = r.Agent.AdminListen()
+	} else if r.ConfigPublisher == ConfigPublisherPull {
+		i.ConfigPullURL = r.Pull.configURL(req.NamespacedName)
+		i.ConfigPullInterval = r.Pull.Interval
 	}
 	b, err := i.Config()
 	if err != nil {
 		log.Error(err, "Error generating Gateway config")
 		return ctrl.Result{}, err
 	}
+	recordConfigMetrics(req.NamespacedName, i, b)
 
-	caddyEps, err := r.getEndpoints(ctx, gw)
+	// Agents only program their local Caddy instance, provisioning Caddy and
+	// updating statuses is left to the controller.
+	if r.Agent != nil {
+		return r.programAgent(ctx, i, b)
+	}
+
+	fingerprint, err := backendCAFingerprint(gw, gwc, i, b)
 	if err != nil {
+		log.Error(err, "Error hashing Gateway config")
 		return ctrl.Result{}, err
 	}
-	if len(caddyEps.Subsets) < 1 {
-		return ctrl.Result{}, errors.New("no endpoint subsets found for gateway service")
+	if r.backendCAs.onlyCAsChanged(req.NamespacedName, fingerprint) {
+		return r.publishBackendCAs(ctx, original, gw, i, b)
 	}
 
-	// Configure Caddy in parallel, so when someone runs Caddy as a DaemonSet on
-	// a 5,000 node cluster, we bring the gateway controller to its knees.
-	var wg sync.WaitGroup
-	for _, a := range caddyEps.Subsets[0].Addresses {
-		if a.TargetRef == nil {
-			// TODO: log error
-			continue
+	// Agents run alongside Caddy instances deployed by the user, so there is
+	// nothing to provision.
+	if r.Provision.enabled() && !isAgentManaged(gw) {
+		if err := r.provision(ctx, gw, i.Parameters, i.ClientCertificates()); err != nil {
+			log.Error(err, "Unable to provision Caddy")
+			meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+				Type:    string(gatewayv1.GatewayConditionProgrammed),
+				Status:  metav1.ConditionFalse,
+				Reason:  string(gatewayv1.GatewayReasonPending),
+				Message: "Unable to provision Caddy: " + err.Error(),
+			})
+			return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
 		}
-		wg.Add(1)
-		go func(a corev1.EndpointAddress) {
-			defer wg.Done()
+	}
 
-			target := client.ObjectKey{
-				Namespace: a.TargetRef.Namespace,
-				Name:      a.TargetRef.Name,
-			}
+	if err := r.setCertificatesStatus(ctx, gw, i.Grants); err != nil {
+		log.Error(err, "Unable to check listener certificates")
+		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
+	}
+	r.setIdentityHeadersStatus(gw)
 
-			tlsConfig := r.tlsConfig.Clone()
-			tlsConfig.ServerName = target.Name + "." + target.Namespace
-			tr := http.DefaultTransport.(*http.Transport).Clone()
-			tr.TLSClientConfig = tlsConfig
-			httpClient := &http.Client{Transport: tr}
-
-			log.V(1).Info("Programming Caddy instance", "ip", a.IP, "target", target)
-			// TODO: configurable scheme and port
-			url := "https://" + net.JoinHostPort(a.IP, "2021") + "/load"
-			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(b))
-			if err != nil {
-				log.Error(err, "Error programming Caddy instance", "ip", a.IP, "target", target)
-				return
-			}
-			req.Header.Set("Content-Type", "application/json")
-			res, err := httpClient.Do(req)
-			if err != nil {
-				log.Error(err, "Error programming Caddy instance", "ip", a.IP, "target", target)
-				return
+	if err := r.setListenerStatus(ctx, gw, i); err != nil {
+		log.Error(err, "Unable to set listener status")
+		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
+	}
+
+	// Never push a config without any servers, Caddy instances keep serving
+	// their current config until at least one listener is valid again.
+	if !i.HasServers() {
+		log.Info("Gateway has no valid listeners, not programming Caddy")
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionAccepted),
+			Status:  metav1.ConditionFalse,
+			Reason:  string(gatewayv1.GatewayReasonListenersNotValid),
+			Message: "None of the Gateway's listeners are valid",
+		})
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionProgrammed),
+			Status:  metav1.ConditionFalse,
+			Reason:  string(gatewayv1.GatewayReasonInvalid),
+			Message: "Gateway has no valid listeners to program",
+		})
+		// Don't retry, the Gateway must change for a listener to be valid.
+		if err := r.updateStatus(ctx, original, gw); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if r.ValidationImage != "" {
+		done, err := r.validateConfig(ctx, gw, b)
+		var verr *configValidationError
+		switch {
+		case errors.As(err, &verr):
+			log.Error(err, "Generated config failed validation")
+			meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+				Type:    string(gatewayv1.GatewayConditionProgrammed),
+				Status:  metav1.ConditionFalse,
+				Reason:  string(gatewayv1.GatewayReasonInvalid),
+				Message: "Generated config failed validation: " + verr.Message,
+			})
+			// Don't retry, the config must change for validation to pass.
+			if err := r.updateStatus(ctx, original, gw); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
 			}
-			defer func() {
-				_, _ = io.Copy(io.Discard, res.Body)
-				res.Body.Close()
-			}()
-			if res.StatusCode != http.StatusOK {
-				b, _ := io.ReadAll(io.LimitReader(res.Body, 4*1024))
-				log.Error(errors.New(string(b)), "Error programming Caddy instance", "status_code", res.StatusCode, "ip", a.IP, "target", target)
-				return
+			return ctrl.Result{}, nil
+		case err != nil:
+			return ctrl.Result{}, err
+		case !done:
+			meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+				Type:    string(gatewayv1.GatewayConditionProgrammed),
+				Status:  metav1.ConditionFalse,
+				Reason:  string(gatewayv1.GatewayReasonPending),
+				Message: "Waiting for the generated config to be validated",
+			})
+			if err := r.updateStatus(ctx, original, gw); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
 			}
-			log.V(1).Info("Successfully programmed Caddy instance", "ip", a.IP, "target", target)
-		}(a)
+			return ctrl.Result{RequeueAfter: validationPollInterval}, nil
+		}
+	}
+
+	p := &publication{original: original, gw: gw, input: i, config: b}
+	result, err := r.publisherFor(gw).publish(ctx, p)
+	original = p.original
+	if p.halted != nil {
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionProgrammed),
+			Status:  metav1.ConditionFalse,
+			Reason:  p.halted.reason(),
+			Message: p.halted.Error() + ", change the Gateway's config to try again",
+		})
+		if err := r.updateStatus(ctx, original, gw); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		log.Error(err, "Error publishing Gateway config", "publisher", r.ConfigPublisher)
+		return ctrl.Result{}, err
+	}
+
+	svcType, err := r.reconcileServiceExposure(ctx, gw)
+	if err != nil {
+		log.Error(err, "Unable to configure Service")
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionProgrammed),
+			Status:  metav1.ConditionFalse,
+			Reason:  string(gatewayv1.GatewayReasonInvalid),
+			Message: "Unable to configure Service: " + err.Error(),
+		})
+		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
+	}
+	exposure := metav1.Condition{
+		Type:    GatewayConditionExposure,
+		Status:  metav1.ConditionTrue,
+		Reason:  string(svcType),
+		Message: "Gateway is exposed using a " + string(svcType) + " Service",
+	}
+	if isHostNetwork(gw) {
+		exposure.Reason = GatewayExposureHostNetwork
+		exposure.Message = "Gateway is exposed on the host network of the nodes running Caddy"
+	}
+	meta.SetStatusCondition(&gw.Status.Conditions, exposure)
+
+	if err := r.reconcilePromotion(ctx, gw, p); err != nil {
+		log.Error(err, "Unable to promote Gateway")
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    GatewayConditionPromoted,
+			Status:  metav1.ConditionFalse,
+			Reason:  string(gatewayv1.GatewayReasonInvalid),
+			Message: "Unable to promote Gateway: " + err.Error(),
+		})
+		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
+	}
+
+	// Metrics aren't needed for the Gateway to serve traffic, so failing to
+	// configure their collection doesn't fail the reconcile.
+	if r.PodMonitors.Enabled {
+		if err := r.reconcilePodMonitor(ctx, gw, i.Parameters); err != nil {
+			log.Error(err, "Unable to configure PodMonitor")
+			r.Recorder.Event(gw, corev1.EventTypeWarning, "PodMonitorFailed", err.Error())
+		}
 	}
-	wg.Wait()
 
 	if reason, err := r.setAddressStatus(ctx, gw); err != nil {
 		log.Error(err, "Address is not ready")
@@ -370,23 +747,97 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		})
 		return r.handleReconcileErrorWithStatus(ctx, err, original, gw)
 	}
-	meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
-		Type:    string(gatewayv1.GatewayConditionProgrammed),
-		Status:  metav1.ConditionTrue,
-		Reason:  string(gatewayv1.GatewayReasonProgrammed),
-		Message: "Gateway has been programmed",
-	})
+	r.setRouteSummaries(ctx, gw, i)
+
+	meta.SetStatusCondition(&gw.Status.Conditions, p.programmedCondition())
 	if err := r.updateStatus(ctx, original, gw); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
 	}
 
+	r.backendCAs.fullyReconciled(req.NamespacedName, fingerprint)
+
 	log.Info("Successfully reconciled Gateway")
+	return result, nil
+}
+
+// publishBackendCAs publishes a config that only differs from the one the
+// Gateway was last fully reconciled with by the CA certificates trusted for
+// its backends, see backendCAUpdates. Only the Programmed condition is
+// updated, everything else is unchanged since the last full reconcile.
+func (r *GatewayReconciler) publishBackendCAs(ctx context.Context, original, gw *gatewayv1.Gateway, i *caddy.Input, b []byte) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	p := &publication{original: original, gw: gw, input: i, config: b}
+	result, err := r.publisherFor(gw).publish(ctx, p)
+	original = p.original
+	if p.halted != nil {
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionProgrammed),
+			Status:  metav1.ConditionFalse,
+			Reason:  p.halted.reason(),
+			Message: p.halted.Error() + ", change the Gateway's config to try again",
+		})
+		if err := r.updateStatus(ctx, original, gw); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		log.Error(err, "Error publishing Gateway config", "publisher", r.ConfigPublisher)
+		return ctrl.Result{}, err
+	}
+
+	meta.SetStatusCondition(&gw.Status.Conditions, p.programmedCondition())
+	if err := r.updateStatus(ctx, original, gw); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update Gateway status: %w", err)
+	}
+
+	log.Info("Successfully updated backend CA certificates")
+	return result, nil
+}
+
+// programAgent programs the local Caddy instance of an agent with the config
+// generated for its Gateway.
+func (r *GatewayReconciler) programAgent(ctx context.Context, i *caddy.Input, b []byte) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// Never push a config without any servers, like the controller.
+	if !i.HasServers() {
+		log.Info("Gateway has no valid listeners, not programming Caddy")
+		return ctrl.Result{}, nil
+	}
+	if err := r.Agent.load(ctx, b); err != nil {
+		log.Error(err, "Error programming Caddy instance", "socket", r.Agent.AdminSocket)
+		return ctrl.Result{}, err
+	}
+	log.Info("Successfully programmed Caddy instance", "socket", r.Agent.AdminSocket)
 	return ctrl.Result{}, nil
 }
 
+// publisherFor returns the publisher for the config of a Gateway, configs of
+// Gateways programmed by agents aren't published by the controller.
+func (r *GatewayReconciler) publisherFor(gw *gatewayv1.Gateway) publisher {
+	if isAgentManaged(gw) {
+		return agentManagedPublisher{}
+	}
+	return r.publisher
+}
+
+// forget removes everything tracked about a Gateway once it is deleted, so the
+// state kept for each Gateway doesn't grow without bound.
+func (r *GatewayReconciler) forget(gw types.NamespacedName) {
+	forgetConfigMetrics(gw)
+	r.rollouts.clear(gw)
+	r.verified.forget(gw)
+	r.retries.forget(gw)
+	r.breaker.retain(gw, nil)
+	r.programmed.retain(gw, nil)
+	r.backendCAs.forget(gw)
+}
+
 func (r *GatewayReconciler) getService(ctx context.Context, gw *gatewayv1.Gateway) (*corev1.Service, error) {
 	svcList := &corev1.ServiceList{}
-	if err := r.Client.List(ctx, svcList, client.MatchingLabels{
+	if err := r.Client.List(ctx, svcList, client.InNamespace(gw.Namespace), client.MatchingLabels{
 		owningGatewayLabel: gw.Name,
 	}); err != nil {
 		return nil, err
@@ -397,17 +848,181 @@ func (r *GatewayReconciler) getService(ctx context.Context, gw *gatewayv1.Gatewa
 	return &svcList.Items[0], nil
 }
 
-func (r *GatewayReconciler) getEndpoints(ctx context.Context, gw *gatewayv1.Gateway) (*corev1.Endpoints, error) {
-	epsList := &corev1.EndpointsList{}
-	if err := r.Client.List(ctx, epsList, client.MatchingLabels{
+// newInput lists every resource needed to generate the config for a Gateway
+// and returns the Input for it.
+func (r *GatewayReconciler) newInput(ctx context.Context, gw *gatewayv1.Gateway, gwc *gatewayv1.GatewayClass) (*caddy.Input, error) {
+	log := log.FromContext(ctx)
+
+	httpRouteList := &gatewayv1.HTTPRouteList{}
+	if err := r.Client.List(ctx, httpRouteList); err != nil {
+		log.Error(err, "Unable to list HTTPRoutes")
+		return nil, err
+	}
+
+	grpcRouteList := &gatewayv1.GRPCRouteList{}
+	if err := r.Client.List(ctx, grpcRouteList); err != nil {
+		log.Error(err, "Unable to list GRPCRoutes")
+		return nil, err
+	}
+
+	tcpRouteList := &gatewayv1alpha2.TCPRouteList{}
+	if err := r.Client.List(ctx, tcpRouteList); err != nil {
+		log.Error(err, "Unable to list TCPRoutes")
+		return nil, err
+	}
+
+	tlsRouteList := &gatewayv1alpha2.TLSRouteList{}
+	if err := r.Client.List(ctx, tlsRouteList); err != nil {
+		log.Error(err, "Unable to list TLSRoutes")
+		return nil, err
+	}
+
+	udpRouteList := &gatewayv1alpha2.UDPRouteList{}
+	if err := r.Client.List(ctx, udpRouteList); err != nil {
+		log.Error(err, "Unable to list UDPRoutes")
+		return nil, err
+	}
+
+	grantList := &gatewayv1beta1.ReferenceGrantList{}
+	if err := r.Client.List(ctx, grantList); err != nil {
+		log.Error(err, "Unable to list ReferenceGrants")
+		return nil, err
+	}
+
+	backendTLSPolicyList := &gatewayv1alpha3.BackendTLSPolicyList{}
+	if err := r.Client.List(ctx, backendTLSPolicyList); err != nil {
+		log.Error(err, "Unable to list BackendTLSPolicies")
+		return nil, err
+	}
+
+	// TODO: only list services from accepted routes.
+	serviceList := &corev1.ServiceList{}
+	if err := r.Client.List(ctx, serviceList); err != nil {
+		log.Error(err, "Unable to list Services")
+		return nil, err
+	}
+
+	endpointSliceList := &discoveryv1.EndpointSliceList{}
+	if err := r.Client.List(ctx, endpointSliceList); err != nil {
+		log.Error(err, "Unable to list EndpointSlices")
+		return nil, err
+	}
+
+	params, err := getGatewayClassParameters(ctx, r.Client, gwc)
+	if err != nil {
+		log.Error(err, "Unable to get GatewayClass parameters", logKeyGatewayClass, gwc.Name)
+		return nil, err
+	}
+
+	i := &caddy.Input{
+		Gateway:      gw,
+		GatewayClass: gwc,
+		Parameters:   params,
+
+		HTTPRoutes: r.filterHTTPRoutesByGateway(ctx, gw, httpRouteList.Items),
+		GRPCRoutes: r.filterGRPCRoutesByGateway(ctx, gw, grpcRouteList.Items),
+		TCPRoutes:  r.filterTCPRoutesByGateway(ctx, gw, tcpRouteList.Items),
+		TLSRoutes:  r.filterTLSRoutesByGateway(ctx, gw, tlsRouteList.Items),
+		UDPRoutes:  r.filterUDPRoutesByGateway(ctx, gw, udpRouteList.Items),
+
+		Grants:             grantList.Items,
+		BackendTLSPolicies: backendTLSPolicyList.Items,
+
+		Services: serviceList.Items,
+
+		Client: r.Client,
+
+		GeneratorOptions: r.GeneratorOptions,
+
+		DisableBackendAutoTLS: r.DisableBackendAutoTLS,
+		PodUpstreams:          r.PodUpstreams,
+		EndpointSlices:        endpointSliceList.Items,
+	}
+	return i, nil
+}
+
+// getEndpointSlices returns the EndpointSlices of a Gateway's Service, which
+// carry the Service's owning Gateway label. Large Services are split across
+// many EndpointSlices, so all of them are returned, IPv4 slices first.
+func (r *GatewayReconciler) getEndpointSlices(ctx context.Context, gw *gatewayv1.Gateway) ([]discoveryv1.EndpointSlice, error) {
+	sliceList := &discoveryv1.EndpointSliceList{}
+	if err := r.Client.List(ctx, sliceList, client.InNamespace(gw.Namespace), client.MatchingLabels{
 		owningGatewayLabel: gw.Name,
 	}); err != nil {
 		return nil, err
 	}
-	if len(epsList.Items) == 0 {
-		return nil, fmt.Errorf("no endpoints found")
+	if len(sliceList.Items) == 0 {
+		return nil, fmt.Errorf("no endpoint slices found")
+	}
+	slices.SortFunc(sliceList.Items, func(a, b discoveryv1.EndpointSlice) int {
+		if c := strings.Compare(string(a.AddressType), string(b.AddressType)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return sliceList.Items, nil
+}
+
+// endpointReady returns true if an endpoint is ready, an unknown readiness
+// is treated as ready.
+func endpointReady(ep discoveryv1.Endpoint) bool {
+	return ep.Conditions.Ready == nil || *ep.Conditions.Ready
+}
+
+// caddyInstance is a Caddy pod backing the EndpointSlices of a Gateway.
+type caddyInstance struct {
+	// IP is the address Caddy is programmed on.
+	IP string
+
+	// NodeName is the node the pod runs on, if known.
+	NodeName *string
+
+	// TargetRef references the pod.
+	TargetRef *corev1.ObjectReference
+
+	// Ready is false if the pod hasn't passed its readiness checks yet.
+	Ready bool
+}
+
+// getCaddyInstances returns the Caddy pods from every EndpointSlice of a
+// Gateway, including pods that aren't ready yet so they are programmed before
+// they start receiving traffic. Pods that are terminating are skipped.
+//
+// Dual-stack pods are listed in a slice for each address family, so are only
+// returned once.
+func getCaddyInstances(endpointSlices []discoveryv1.EndpointSlice) []caddyInstance {
+	var instances []caddyInstance
+	seen := map[types.UID]struct{}{}
+	add := func(ready bool) {
+		for _, slice := range endpointSlices {
+			if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+				continue
+			}
+			for _, ep := range slice.Endpoints {
+				if ep.TargetRef == nil || len(ep.Addresses) == 0 || endpointReady(ep) != ready {
+					continue
+				}
+				if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+					continue
+				}
+				if _, ok := seen[ep.TargetRef.UID]; ok {
+					continue
+				}
+				seen[ep.TargetRef.UID] = struct{}{}
+				instances = append(instances, caddyInstance{
+					IP:        ep.Addresses[0],
+					NodeName:  ep.NodeName,
+					TargetRef: ep.TargetRef,
+					Ready:     ready,
+				})
+			}
+		}
 	}
-	return &epsList.Items[0], nil
+	// Ready endpoints are added first, so pods listed as ready in any slice
+	// are treated as ready.
+	add(true)
+	add(false)
+	return instances
 }
 
 func GatewayAddressTypePtr(addr gatewayv1.AddressType) *gatewayv1.AddressType {
@@ -415,21 +1030,47 @@ func GatewayAddressTypePtr(addr gatewayv1.AddressType) *gatewayv1.AddressType {
 }
 
 func (r *GatewayReconciler) setAddressStatus(ctx context.Context, gw *gatewayv1.Gateway) (gatewayv1.GatewayConditionReason, error) {
-	svcList := &corev1.ServiceList{}
-	if err := r.Client.List(ctx, svcList, client.MatchingLabels{
-		owningGatewayLabel: gw.Name,
-	}); err != nil {
+	svc, err := r.getService(ctx, gw)
+	if err != nil {
 		return gatewayv1.GatewayReasonNoResources, err
 	}
-	if len(svcList.Items) == 0 {
-		return gatewayv1.GatewayReasonNoResources, fmt.Errorf("no service found")
+
+	if isHostNetwork(gw) {
+		addresses, err := r.getHostNetworkAddresses(ctx, gw)
+		if err != nil {
+			return gatewayv1.GatewayReasonNoResources, err
+		}
+		if len(addresses) == 0 {
+			return gatewayv1.GatewayReasonAddressNotAssigned, fmt.Errorf("no caddy instances are ready")
+		}
+		gw.Status.Addresses = normalizeAddresses(addresses)
+		return "", nil
 	}
-	svc := svcList.Items[0]
+
+	var addresses []gatewayv1.GatewayStatusAddress
+	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		// Gateways that aren't exposed using a load balancer are only
+		// reachable internally, so use the cluster IPs instead.
+		for _, ip := range svc.Spec.ClusterIPs {
+			if ip == "" || ip == corev1.ClusterIPNone {
+				continue
+			}
+			addresses = append(addresses, gatewayv1.GatewayStatusAddress{
+				Type:  GatewayAddressTypePtr(gatewayv1.IPAddressType),
+				Value: ip,
+			})
+		}
+		if len(addresses) == 0 {
+			return gatewayv1.GatewayReasonAddressNotAssigned, fmt.Errorf("service has no cluster ip")
+		}
+		gw.Status.Addresses = normalizeAddresses(addresses)
+		return "", nil
+	}
+
 	if len(svc.Status.LoadBalancer.Ingress) == 0 {
 		return gatewayv1.GatewayReasonAddressNotAssigned, fmt.Errorf("load balancer status is not ready")
 	}
 
-	var addresses []gatewayv1.GatewayStatusAddress
 	for _, s := range svc.Status.LoadBalancer.Ingress {
 		if len(s.IP) != 0 {
 			addresses = append(addresses, gatewayv1.GatewayStatusAddress{
@@ -444,10 +1085,34 @@ func (r *GatewayReconciler) setAddressStatus(ctx context.Context, gw *gatewayv1.
 			})
 		}
 	}
-	gw.Status.Addresses = addresses
+	gw.Status.Addresses = normalizeAddresses(addresses)
 	return "", nil
 }
 
+// normalizeAddresses de-duplicates and sorts the addresses so the Gateway's
+// status doesn't change unless the set of addresses does.
+func normalizeAddresses(addresses []gatewayv1.GatewayStatusAddress) []gatewayv1.GatewayStatusAddress {
+	slices.SortFunc(addresses, compareAddresses)
+	return slices.CompactFunc(addresses, func(a, b gatewayv1.GatewayStatusAddress) bool {
+		return compareAddresses(a, b) == 0
+	})
+}
+
+// compareAddresses orders addresses by type and then value.
+func compareAddresses(a, b gatewayv1.GatewayStatusAddress) int {
+	var aType, bType gatewayv1.AddressType
+	if a.Type != nil {
+		aType = *a.Type
+	}
+	if b.Type != nil {
+		bType = *b.Type
+	}
+	if c := strings.Compare(string(aType), string(bType)); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Value, b.Value)
+}
+
 // enqueueRequestForOwningGatewayClass returns an event handler for all Gateway objects
 // belonging to the given GatewayClass.
 func (r *GatewayReconciler) enqueueRequestForOwningGatewayClass() handler.EventHandler {
@@ -472,10 +1137,10 @@ func (r *GatewayReconciler) enqueueRequestForOwningGatewayClass() handler.EventH
 				},
 			})
 
-			log.WithValues(
-				"namespace", gw.GetNamespace(),
-				"resource", gw.GetName(),
-			).Info("Queueing gateway")
+			log.V(logLevelEnqueue).Info("Enqueued Gateway for GatewayClass",
+				logKeyResource, a.GetName(),
+				logKeyGateway, client.ObjectKeyFromObject(&gw),
+			)
 		}
 		return reqs
 	})
@@ -485,32 +1150,73 @@ func (r *GatewayReconciler) enqueueRequestForOwningGatewayClass() handler.EventH
 // owningGatewayLabel
 func (r *GatewayReconciler) enqueueRequestForOwningResource() handler.EventHandler {
 	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, a client.Object) []reconcile.Request {
-		log := log.FromContext(ctx).WithValues(
-			"controller", "gateway",
-			"resource", a.GetName(),
-		)
+		log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(a))
 
 		key, found := a.GetLabels()[owningGatewayLabel]
 		if !found {
 			return nil
 		}
 
-		log.WithValues(
-			"namespace", a.GetNamespace(),
-			"gateway", key,
-		).Info("Enqueued gateway for owning service")
-
-		return []reconcile.Request{
-			{
-				NamespacedName: types.NamespacedName{
-					Namespace: a.GetNamespace(),
-					Name:      key,
-				},
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: a.GetNamespace(),
+				Name:      key,
 			},
 		}
+		log.V(logLevelEnqueue).Info("Enqueued Gateway for owned resource", logKeyGateway, req.NamespacedName)
+		return []reconcile.Request{req}
 	})
 }
 
+// enqueueRequestForExtensionRef returns an event handler for any changes to
+// ConfigMaps or CaddyHTTPFilters referenced by HTTPRoute ExtensionRef filters,
+// enqueueing the Gateways of the routes referencing them.
+func (r *GatewayReconciler) enqueueRequestForExtensionRef() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(o))
+
+		routeList := &gatewayv1.HTTPRouteList{}
+		if err := r.Client.List(ctx, routeList, client.InNamespace(o.GetNamespace())); err != nil {
+			log.Error(err, "Unable to list HTTPRoutes")
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		for _, hr := range routeList.Items {
+			if !referencesExtension(&hr, o) {
+				continue
+			}
+			reqs = append(reqs, getReconcileRequestsForRoute(ctx, r.Client, &hr, hr.Spec.CommonRouteSpec)...)
+		}
+		return reqs
+	})
+}
+
+// referencesExtension returns true if any of the route's ExtensionRef filters
+// reference the ConfigMap or CaddyHTTPFilter.
+func referencesExtension(hr *gatewayv1.HTTPRoute, o client.Object) bool {
+	var isKind func(gatewayv1.LocalObjectReference) bool
+	switch o.(type) {
+	case *corev1.ConfigMap:
+		isKind = gateway.IsLocalConfigMap
+	case *v1alpha1.CaddyHTTPFilter:
+		isKind = gateway.IsLocalCaddyHTTPFilter
+	default:
+		return false
+	}
+	for _, rule := range hr.Spec.Rules {
+		for _, f := range rule.Filters {
+			if f.Type != gatewayv1.HTTPRouteFilterExtensionRef || f.ExtensionRef == nil {
+				continue
+			}
+			if isKind(*f.ExtensionRef) && string(f.ExtensionRef.Name) == o.GetName() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // enqueueRequestForOwningHTTPRoute returns an event handler for any changes with HTTP Routes
 // belonging to the given Gateway
 func (r *GatewayReconciler) enqueueRequestForOwningHTTPRoute() handler.EventHandler {
@@ -572,7 +1278,7 @@ func (r *GatewayReconciler) enqueueRequestForOwningUDPRoute() handler.EventHandl
 }
 
 func getReconcileRequestsForRoute(ctx context.Context, c client.Client, object metav1.Object, route gatewayv1.CommonRouteSpec) []reconcile.Request {
-	log := log.FromContext(ctx, "resource", types.NamespacedName{
+	log := log.FromContext(ctx, logKeyRoute, types.NamespacedName{
 		Namespace: object.GetNamespace(),
 		Name:      object.GetName(),
 	})
@@ -583,50 +1289,42 @@ func getReconcileRequestsForRoute(ctx context.Context, c client.Client, object m
 			continue
 		}
 
-		ns := gateway.NamespaceDerefOr(parent.Namespace, object.GetNamespace())
-		gw := &gatewayv1.Gateway{}
-		if err := c.Get(ctx, types.NamespacedName{
-			Namespace: ns,
+		key := types.NamespacedName{
+			Namespace: gateway.NamespaceDerefOr(parent.Namespace, object.GetNamespace()),
 			Name:      string(parent.Name),
-		}, gw); err != nil {
+		}
+		gw := &gatewayv1.Gateway{}
+		if err := c.Get(ctx, key, gw); err != nil {
 			if !apierrors.IsNotFound(err) {
-				log.Error(err, "Failed to get Gateway")
+				log.Error(err, "Failed to get Gateway", logKeyGateway, key)
 			}
 			continue
 		}
 
 		if !hasMatchingController(ctx, c)(gw) {
-			log.V(3).Info("Gateway does not have a matching controller, skipping")
+			log.V(logLevelTrace).Info("Gateway does not have a matching controller, skipping", logKeyGateway, key)
 			continue
 		}
 
-		log.Info(
-			"Enqueued Gateway for Route",
-			"namespace", ns,
-			"resource", parent.Namespace,
-			"route", object.GetName(),
-		)
+		log.V(logLevelEnqueue).Info("Enqueued Gateway for Route", logKeyGateway, key)
 
-		reqs = append(reqs, reconcile.Request{
-			NamespacedName: types.NamespacedName{
-				Namespace: ns,
-				Name:      string(parent.Name),
-			},
-		})
+		reqs = append(reqs, reconcile.Request{NamespacedName: key})
 	}
 	return reqs
 }
 
-// enqueueRequestForTLSPolicy .
-// TODO: document
+// enqueueRequestForTLSPolicy returns an event handler for any changes with
+// BackendTLSPolicies, enqueueing the Gateways of HTTPRoutes that reference a
+// Service targeted by the policy.
 func (r *GatewayReconciler) enqueueRequestForTLSPolicy() handler.EventHandler {
 	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
-		_, ok := o.(*gatewayv1alpha3.BackendTLSPolicy)
+		policy, ok := o.(*gatewayv1alpha3.BackendTLSPolicy)
 		if !ok {
 			return nil
 		}
-		// TODO: implement the rest of the logic
-		return nil
+		// Updates are mapped using both the old and new policy, so Gateways
+		// using a Service that is no longer targeted are also reprogrammed.
+		return getReconcileRequestsForBackendTLSPolicy(ctx, r.Client, policy)
 	})
 }
 
@@ -647,6 +1345,79 @@ func (r *GatewayReconciler) enqueueRequestForTLSSecret() handler.EventHandler {
 	})
 }
 
+// enqueueRequestForReferenceGrant returns an event handler for any changes
+// with ReferenceGrants, enqueuing Gateways with certificates in the grant's
+// namespace so they are reprogrammed when access to them is granted or
+// revoked.
+func (r *GatewayReconciler) enqueueRequestForReferenceGrant() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		grant, ok := o.(*gatewayv1beta1.ReferenceGrant)
+		if !ok {
+			return nil
+		}
+		gateways := getGatewaysForReferenceGrant(ctx, r.Client, grant)
+		reqs := make([]reconcile.Request, len(gateways))
+		for i, gw := range gateways {
+			reqs[i] = reconcile.Request{NamespacedName: gw}
+		}
+		return reqs
+	})
+}
+
+// enqueueRequestForEndpointSlice returns an event handler for any changes with
+// EndpointSlices belonging to a Service referenced by an HTTPRoute.
+func (r *GatewayReconciler) enqueueRequestForEndpointSlice() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		return getReconcileRequestsForEndpointSlice(ctx, r.Client, o)
+	})
+}
+
+// enqueueRequestForBackendCACertificate returns an event handler for any
+// changes with ConfigMaps, Secrets or ClusterTrustBundles referenced as CA
+// certificates by a BackendTLSPolicy. If only the CA certificates changed, the
+// Gateways are only sent their new config, see backendCAUpdates.
+func (r *GatewayReconciler) enqueueRequestForBackendCACertificate() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		seen := map[types.NamespacedName]struct{}{}
+		var reqs []reconcile.Request
+		for _, policy := range getBackendTLSPoliciesForCACertificate(ctx, r.Client, o) {
+			for _, req := range getReconcileRequestsForBackendTLSPolicy(ctx, r.Client, &policy) {
+				if _, ok := seen[req.NamespacedName]; ok {
+					continue
+				}
+				seen[req.NamespacedName] = struct{}{}
+				r.backendCAs.changed(req.NamespacedName)
+				reqs = append(reqs, req)
+			}
+		}
+		return reqs
+	})
+}
+
+// enqueueRequestForClientCertificate returns an event handler for any changes
+// with Secrets used as backend client certificates.
+func (r *GatewayReconciler) enqueueRequestForClientCertificate() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		return getReconcileRequestsForClientCertificate(ctx, r.Client, o)
+	})
+}
+
+// enqueueRequestForGatewayClassParameters returns an event handler for any
+// changes with ConfigMaps or CaddyGatewayConfigs referenced as the parameters
+// of a GatewayClass.
+func (r *GatewayReconciler) enqueueRequestForGatewayClassParameters() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		gateways := getGatewaysForParameters(ctx, r.Client, o)
+		reqs := make([]reconcile.Request, len(gateways))
+		for i, gw := range gateways {
+			reqs[i] = reconcile.Request{
+				NamespacedName: gw,
+			}
+		}
+		return reqs
+	})
+}
+
 // enqueueRequestForAllowedNamespace returns an event handler for any changes
 // with allowed namespaces
 func (r *GatewayReconciler) enqueueRequestForAllowedNamespace() handler.EventHandler {
@@ -665,12 +1436,31 @@ func (r *GatewayReconciler) enqueueRequestForAllowedNamespace() handler.EventHan
 // updateStatus .
 // TODO: document
 func (r *GatewayReconciler) updateStatus(ctx context.Context, original, new *gatewayv1.Gateway) error {
+	if r.Agent != nil {
+		// Agents never update status, the controller is responsible for it.
+		return nil
+	}
 	oldStatus := original.Status.DeepCopy()
 	newStatus := new.Status.DeepCopy()
-	if cmp.Equal(oldStatus, newStatus, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+	if cmp.Equal(
+		oldStatus,
+		newStatus,
+		cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime"),
+		// Addresses are compared as a set, so status written before they were
+		// sorted doesn't trigger an update.
+		cmpopts.SortSlices(func(a, b gatewayv1.GatewayStatusAddress) bool {
+			return compareAddresses(a, b) < 0
+		}),
+	) {
 		return nil
 	}
-	return r.Client.Status().Update(ctx, new)
+	ctx, cancel := statusContext(ctx)
+	defer cancel()
+	return updateStatusWithRetry(ctx, r.Client, new, func(latest *gatewayv1.Gateway) {
+		conditions := mergeConditions(latest.Status.Conditions, new.Status.Conditions)
+		latest.Status = *new.Status.DeepCopy()
+		latest.Status.Conditions = conditions
+	})
 }
 
 // handleReconcileErrorWithStatus .
@@ -687,7 +1477,7 @@ func (r *GatewayReconciler) handleReconcileErrorWithStatus(ctx context.Context,
 func (r *GatewayReconciler) filterHTTPRoutesByGateway(ctx context.Context, gw *gatewayv1.Gateway, routes []gatewayv1.HTTPRoute) []gatewayv1.HTTPRoute {
 	var filtered []gatewayv1.HTTPRoute
 	for _, route := range routes {
-		if !isAttachable(ctx, gw, &route, route.Status.Parents) {
+		if !gateway.IsRouteAttachable(gw, &route, route.Status.Parents) {
 			continue
 		}
 		if !isAllowed(ctx, r.Client, gw, &route) {
@@ -706,7 +1496,7 @@ func (r *GatewayReconciler) filterHTTPRoutesByGateway(ctx context.Context, gw *g
 func (r *GatewayReconciler) filterGRPCRoutesByGateway(ctx context.Context, gw *gatewayv1.Gateway, routes []gatewayv1.GRPCRoute) []gatewayv1.GRPCRoute {
 	var filtered []gatewayv1.GRPCRoute
 	for _, route := range routes {
-		if !isAttachable(ctx, gw, &route, route.Status.Parents) {
+		if !gateway.IsRouteAttachable(gw, &route, route.Status.Parents) {
 			continue
 		}
 		if !isAllowed(ctx, r.Client, gw, &route) {
@@ -725,7 +1515,7 @@ func (r *GatewayReconciler) filterGRPCRoutesByGateway(ctx context.Context, gw *g
 func (r *GatewayReconciler) filterTCPRoutesByGateway(ctx context.Context, gw *gatewayv1.Gateway, routes []gatewayv1alpha2.TCPRoute) []gatewayv1alpha2.TCPRoute {
 	var filtered []gatewayv1alpha2.TCPRoute
 	for _, route := range routes {
-		if !isAttachable(ctx, gw, &route, route.Status.Parents) {
+		if !gateway.IsRouteAttachable(gw, &route, route.Status.Parents) {
 			continue
 		}
 		if !isAllowed(ctx, r.Client, gw, &route) {
@@ -741,7 +1531,7 @@ func (r *GatewayReconciler) filterTCPRoutesByGateway(ctx context.Context, gw *ga
 func (r *GatewayReconciler) filterTLSRoutesByGateway(ctx context.Context, gw *gatewayv1.Gateway, routes []gatewayv1alpha2.TLSRoute) []gatewayv1alpha2.TLSRoute {
 	var filtered []gatewayv1alpha2.TLSRoute
 	for _, route := range routes {
-		if !isAttachable(ctx, gw, &route, route.Status.Parents) {
+		if !gateway.IsRouteAttachable(gw, &route, route.Status.Parents) {
 			continue
 		}
 		if !isAllowed(ctx, r.Client, gw, &route) {
@@ -760,7 +1550,7 @@ func (r *GatewayReconciler) filterTLSRoutesByGateway(ctx context.Context, gw *ga
 func (r *GatewayReconciler) filterUDPRoutesByGateway(ctx context.Context, gw *gatewayv1.Gateway, routes []gatewayv1alpha2.UDPRoute) []gatewayv1alpha2.UDPRoute {
 	var filtered []gatewayv1alpha2.UDPRoute
 	for _, route := range routes {
-		if !isAttachable(ctx, gw, &route, route.Status.Parents) {
+		if !gateway.IsRouteAttachable(gw, &route, route.Status.Parents) {
 			continue
 		}
 		if !isAllowed(ctx, r.Client, gw, &route) {
@@ -774,3 +1564,11 @@ func (r *GatewayReconciler) filterUDPRoutesByGateway(ctx context.Context, gw *ga
 func (r *GatewayReconciler) usedInGateway(obj client.Object) bool {
 	return len(getGatewaysForSecret(context.Background(), r.Client, obj)) > 0
 }
+
+func (r *GatewayReconciler) usedInBackendTLSPolicy(obj client.Object) bool {
+	return len(getBackendTLSPoliciesForCACertificate(context.Background(), r.Client, obj)) > 0
+}
+
+func (r *GatewayReconciler) usedAsClientCertificate(obj client.Object) bool {
+	return len(getBackendTLSPoliciesForClientCertificate(context.Background(), r.Client, obj)) > 0
+}
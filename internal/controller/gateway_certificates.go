@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+const (
+	// GatewayConditionCertificates is a condition on a Gateway used to report
+	// whether the certificates referenced by each TLS listener cover the
+	// listener's hostname.
+	//
+	// Clients will fail to complete a TLS handshake with listeners that have a
+	// mismatched certificate, but as the certificate is still served, the
+	// Gateway is not considered invalid.
+	GatewayConditionCertificates = string(gateway.ControllerDomain) + "/Certificates"
+
+	// GatewayReasonHostnameMismatch is used with GatewayConditionCertificates
+	// when at least one listener's hostname is not covered by its certificates.
+	GatewayReasonHostnameMismatch = "HostnameMismatch"
+
+	// GatewayReasonCertificatesMatch is used with GatewayConditionCertificates
+	// when all listeners' hostnames are covered by their certificates.
+	GatewayReasonCertificatesMatch = "CertificatesMatch"
+)
+
+// setCertificatesStatus checks the certificates of every TLS listener with a
+// hostname against the hostname, setting GatewayConditionCertificates and
+// recording an event if any of them don't match. Only certificates the Gateway
+// is allowed to reference by the grants are checked.
+func (r *GatewayReconciler) setCertificatesStatus(ctx context.Context, gw *gatewayv1.Gateway, grants []gatewayv1beta1.ReferenceGrant) error {
+	var (
+		checked    bool
+		mismatches []string
+	)
+	for _, l := range gw.Spec.Listeners {
+		if l.Hostname == nil || l.TLS == nil || len(l.TLS.CertificateRefs) == 0 {
+			continue
+		}
+		if l.TLS.Mode != nil && *l.TLS.Mode != gatewayv1.TLSModeTerminate {
+			continue
+		}
+		certs, err := r.getListenerCertificates(ctx, gw, l, grants)
+		if err != nil {
+			return err
+		}
+		if len(certs) == 0 {
+			continue
+		}
+		checked = true
+		if !certificatesCoverHostname(certs, string(*l.Hostname)) {
+			mismatches = append(mismatches, fmt.Sprintf("listener %s: no certificate is valid for %s", l.Name, *l.Hostname))
+		}
+	}
+	if !checked {
+		meta.RemoveStatusCondition(&gw.Status.Conditions, GatewayConditionCertificates)
+		return nil
+	}
+
+	if len(mismatches) == 0 {
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    GatewayConditionCertificates,
+			Status:  metav1.ConditionTrue,
+			Reason:  GatewayReasonCertificatesMatch,
+			Message: "All listener hostnames are covered by their certificates",
+		})
+		return nil
+	}
+
+	message := strings.Join(mismatches, "; ")
+	// Only record an event when the message changes, to avoid spamming one on
+	// every reconcile.
+	prev := meta.FindStatusCondition(gw.Status.Conditions, GatewayConditionCertificates)
+	if (prev == nil || prev.Message != message) && r.Recorder != nil {
+		r.Recorder.Event(gw, corev1.EventTypeWarning, GatewayReasonHostnameMismatch, message)
+	}
+	meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+		Type:    GatewayConditionCertificates,
+		Status:  metav1.ConditionFalse,
+		Reason:  GatewayReasonHostnameMismatch,
+		Message: message,
+	})
+	return nil
+}
+
+// getListenerCertificates returns the leaf certificates referenced by the
+// listener. Missing Secrets, Secrets without a valid certificate and Secrets
+// the Gateway isn't allowed to reference are skipped, as they are reported
+// elsewhere.
+func (r *GatewayReconciler) getListenerCertificates(ctx context.Context, gw *gatewayv1.Gateway, l gatewayv1.Listener, grants []gatewayv1beta1.ReferenceGrant) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, ref := range l.TLS.CertificateRefs {
+		if !gateway.IsSecret(ref) {
+			continue
+		}
+		// Secrets in other namespaces are only read if a ReferenceGrant
+		// allows it, like when they are loaded into Caddy.
+		if !gateway.IsSecretReferenceAllowed(gw.Namespace, ref, grants) {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{
+			Namespace: gateway.NamespaceDerefOr(ref.Namespace, gw.Namespace),
+			Name:      string(ref.Name),
+		}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+		if block == nil || block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// certificatesCoverHostname returns true if any of the certificates are valid
+// for the hostname.
+//
+// A wildcard hostname is only covered by a certificate with the same wildcard
+// SAN, as a certificate for a single name can't serve every name the listener
+// accepts.
+func certificatesCoverHostname(certs []*x509.Certificate, hostname string) bool {
+	for _, cert := range certs {
+		if strings.HasPrefix(hostname, "*.") {
+			for _, name := range cert.DNSNames {
+				if strings.EqualFold(name, hostname) {
+					return true
+				}
+			}
+			continue
+		}
+		if cert.VerifyHostname(hostname) == nil {
+			return true
+		}
+	}
+	return false
+}
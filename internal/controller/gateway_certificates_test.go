@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// newTestCertificate returns a self-signed certificate for the DNS names.
+func newTestCertificate(t *testing.T, names ...string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertificatesCoverHostname(t *testing.T) {
+	exact := newTestCertificate(t, "app.example.com")
+	wildcard := newTestCertificate(t, "*.example.com")
+	tests := []struct {
+		name     string
+		certs    []*x509.Certificate
+		hostname string
+		want     bool
+	}{
+		{name: "exact", certs: []*x509.Certificate{exact}, hostname: "app.example.com", want: true},
+		{name: "case insensitive", certs: []*x509.Certificate{exact}, hostname: "App.Example.com", want: true},
+		{name: "other name", certs: []*x509.Certificate{exact}, hostname: "api.example.com"},
+		{name: "covered by wildcard", certs: []*x509.Certificate{wildcard}, hostname: "app.example.com", want: true},
+		{name: "wildcard only covers one label", certs: []*x509.Certificate{wildcard}, hostname: "a.app.example.com"},
+		{name: "wildcard hostname", certs: []*x509.Certificate{wildcard}, hostname: "*.example.com", want: true},
+		{name: "wildcard hostname with single name", certs: []*x509.Certificate{exact}, hostname: "*.example.com"},
+		{name: "any certificate", certs: []*x509.Certificate{exact, wildcard}, hostname: "api.example.com", want: true},
+		{name: "no certificates", hostname: "app.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := certificatesCoverHostname(tt.certs, tt.hostname); got != tt.want {
+				t.Errorf("certificatesCoverHostname(%q) = %t, want %t", tt.hostname, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetListenerCertificatesReferenceGrant(t *testing.T) {
+	cert := newTestCertificate(t, "app.example.com")
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "certs", Name: "cert"},
+		Data: map[string][]byte{
+			corev1.TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		},
+	}
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"}}
+	l := gatewayv1.Listener{
+		Name: "https",
+		TLS: &gatewayv1.GatewayTLSConfig{
+			CertificateRefs: []gatewayv1.SecretObjectReference{{
+				Namespace: ptr.To[gatewayv1.Namespace]("certs"),
+				Name:      "cert",
+			}},
+		},
+	}
+	grant := gatewayv1beta1.ReferenceGrant{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "certs", Name: "gateways"},
+		Spec: gatewayv1beta1.ReferenceGrantSpec{
+			From: []gatewayv1beta1.ReferenceGrantFrom{{
+				Group:     gatewayv1.GroupName,
+				Kind:      "Gateway",
+				Namespace: "default",
+			}},
+			To: []gatewayv1beta1.ReferenceGrantTo{{Kind: "Secret"}},
+		},
+	}
+	r := &GatewayReconciler{Client: newTestClientWith(secret)}
+
+	certs, err := r.getListenerCertificates(context.Background(), gw, l, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 0 {
+		t.Errorf("got %d certificates without a ReferenceGrant, want none", len(certs))
+	}
+
+	certs, err = r.getListenerCertificates(context.Background(), gw, l, []gatewayv1beta1.ReferenceGrant{grant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || !certs[0].Equal(cert) {
+		t.Errorf("got certificates %v with a ReferenceGrant, want the referenced one", certs)
+	}
+}
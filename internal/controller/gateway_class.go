@@ -6,30 +6,44 @@ package controller
 import (
 	"context"
 	"slices"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
 
+	"github.com/caddyserver/gateway/api/v1alpha1"
 	gateway "github.com/caddyserver/gateway/internal"
 )
 
-// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gatewayclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gatewayclasses,verbs=get;list;update;watch
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gatewayclasses/status,verbs=patch;update
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gatewayclasses/finalizers,verbs=update
 
 type GatewayClassReconciler struct {
 	client.Client
 
+	// APIReader is an uncached reader used to read the metadata of the
+	// Gateway API CRDs, as we are only allowed to get them.
+	APIReader client.Reader
+
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
 }
@@ -38,21 +52,131 @@ var _ reconcile.Reconciler = (*GatewayClassReconciler)(nil)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *GatewayClassReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr)
+	// CaddyGatewayConfigs are only watched if their CRD is installed.
+	if _, err := mgr.GetRESTMapper().RESTMapping(caddyGatewayConfigGVK.GroupKind(), caddyGatewayConfigGVK.Version); err == nil {
+		b = b.Watches(&v1alpha1.CaddyGatewayConfig{}, r.enqueueRequestForParameters())
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+	return b.
 		For(&gatewayv1.GatewayClass{}, builder.WithPredicates(predicate.NewPredicateFuncs(objectMatchesControllerName()))).
+		Watches(&corev1.ConfigMap{}, r.enqueueRequestForParameters()).
+		Watches(
+			&gatewayv1.Gateway{},
+			r.enqueueRequestForGateway(),
+			builder.WithPredicates(predicate.Funcs{
+				// Only the existence of Gateways matters for the finalizer.
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					oldGw, ok := e.ObjectOld.(*gatewayv1.Gateway)
+					if !ok {
+						return false
+					}
+					newGw, ok := e.ObjectNew.(*gatewayv1.Gateway)
+					if !ok {
+						return false
+					}
+					return oldGw.Spec.GatewayClassName != newGw.Spec.GatewayClassName
+				},
+			}),
+		).
 		Complete(r)
 }
 
+// enqueueRequestForGateway returns an event handler for any changes with
+// Gateways, enqueuing their GatewayClass so its finalizer is kept up to date.
+func (r *GatewayClassReconciler) enqueueRequestForGateway() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []reconcile.Request {
+		gw, ok := o.(*gatewayv1.Gateway)
+		if !ok {
+			return nil
+		}
+		return []reconcile.Request{{
+			NamespacedName: types.NamespacedName{Name: string(gw.Spec.GatewayClassName)},
+		}}
+	})
+}
+
+// enqueueRequestForParameters returns an event handler for any changes with
+// ConfigMaps or CaddyGatewayConfigs referenced as the parameters of a
+// GatewayClass.
+func (r *GatewayClassReconciler) enqueueRequestForParameters() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		names := getGatewayClassesForParameters(ctx, r.Client, o)
+		reqs := make([]reconcile.Request, len(names))
+		for i, name := range names {
+			reqs[i] = reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: name},
+			}
+		}
+		return reqs
+	})
+}
+
+// optionalKinds are kinds from the experimental channel of the Gateway API,
+// these are supported but may not be installed.
+var optionalKinds = []schema.GroupVersionKind{
+	gatewayv1alpha2.SchemeGroupVersion.WithKind("TCPRoute"),
+	gatewayv1alpha2.SchemeGroupVersion.WithKind("TLSRoute"),
+	gatewayv1alpha2.SchemeGroupVersion.WithKind("UDPRoute"),
+	gatewayv1alpha3.SchemeGroupVersion.WithKind("BackendTLSPolicy"),
+}
+
+// getMissingOptionalKinds returns the names of all optional kinds that are
+// not served by the API server.
+func (r *GatewayClassReconciler) getMissingOptionalKinds() ([]string, error) {
+	var missing []string
+	for _, gvk := range optionalKinds {
+		if _, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if !meta.IsNoMatchError(err) {
+				return nil, err
+			}
+			missing = append(missing, gvk.Kind)
+		}
+	}
+	return missing, nil
+}
+
 func objectMatchesControllerName() func(object client.Object) bool {
 	return func(object client.Object) bool {
 		gwc, ok := object.(*gatewayv1.GatewayClass)
 		if !ok {
 			return false
 		}
-		return gateway.MatchesControllerName(gwc.Spec.ControllerName)
+		return gateway.IsManagedGatewayClass(gwc)
 	}
 }
 
+// gatewaysExist returns true if any Gateways use the GatewayClass.
+func (r *GatewayClassReconciler) gatewaysExist(ctx context.Context, gwc *gatewayv1.GatewayClass) (bool, error) {
+	gwList := &gatewayv1.GatewayList{}
+	if err := r.List(ctx, gwList); err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(gwList.Items, func(gw gatewayv1.Gateway) bool {
+		return string(gw.Spec.GatewayClassName) == gwc.Name
+	}), nil
+}
+
+// updateFinalizer adds the GatewaysExist finalizer to the GatewayClass while
+// any Gateways use it, and removes it once they have all been deleted.
+func (r *GatewayClassReconciler) updateFinalizer(ctx context.Context, gwc *gatewayv1.GatewayClass, gatewaysExist bool) error {
+	var changed bool
+	if gatewaysExist {
+		// Finalizers can't be added to resources that are being deleted.
+		if gwc.GetDeletionTimestamp() != nil {
+			return nil
+		}
+		changed = controllerutil.AddFinalizer(gwc, gatewayv1.GatewayClassFinalizerGatewaysExist)
+	} else {
+		changed = controllerutil.RemoveFinalizer(gwc, gatewayv1.GatewayClassFinalizerGatewaysExist)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Update(ctx, gwc)
+}
+
 // Reconcile reconciles GatewayClass resources.
 // ref; https://gateway-api.sigs.k8s.io/guides/implementers/#gatewayclass
 func (r *GatewayClassReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -62,83 +186,106 @@ func (r *GatewayClassReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	gwc := &gatewayv1.GatewayClass{}
 	if err := r.Get(ctx, req.NamespacedName, gwc); err != nil {
 		if apierrors.IsNotFound(err) {
-			log.Info("GatewayClass not found, ignoring reconcile request")
+			log.V(logLevelTrace).Info("GatewayClass not found, ignoring reconcile request")
 			return ctrl.Result{}, nil
 		}
 		log.Error(err, "Failed to get GatewayClass")
 		return ctrl.Result{}, err
 	}
-	log = log.WithValues("GatewayClass.Name", gwc.Name)
+
+	// Check if the GatewayClass is using our controller.
+	// ref; https://gateway-api.sigs.k8s.io/api-types/gatewayclass/#gatewayclass-controller-selection
+	if !gateway.IsManagedGatewayClass(gwc) {
+		log.V(logLevelTrace).Info("Ignoring GatewayClass as it requests another controller")
+		return ctrl.Result{}, nil
+	}
+	log.V(logLevelDebug).Info("Reconciling")
+
+	// Block the deletion of the GatewayClass while any Gateways use it.
+	// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.GatewayClass
+	gatewaysExist, err := r.gatewaysExist(ctx, gwc)
+	if err != nil {
+		log.Error(err, "Unable to list Gateways")
+		return ctrl.Result{}, err
+	}
+	if err := r.updateFinalizer(ctx, gwc, gatewaysExist); err != nil {
+		log.Error(err, "Failed to update finalizer")
+		return ctrl.Result{}, err
+	}
 
 	// Check if the GatewayClass is being deleted.
 	if gwc.GetDeletionTimestamp() != nil {
+		if gatewaysExist {
+			log.V(logLevelDebug).Info("Waiting for Gateways using the GatewayClass to be deleted")
+		}
 		return ctrl.Result{}, nil
 	}
 
-	// Check if the GatewayClass is using our controller.
-	// ref; https://gateway-api.sigs.k8s.io/api-types/gatewayclass/#gatewayclass-controller-selection
-	if !gateway.MatchesControllerName(gwc.Spec.ControllerName) {
-		log.V(2).Info("Ignoring GatewayClass as it requests another controller")
-		return ctrl.Result{}, nil
+	// Let cluster admins know about any features that are unavailable due to
+	// optional CRDs not being installed.
+	var message string
+	missing, err := r.getMissingOptionalKinds()
+	if err != nil {
+		log.Error(err, "Unable to check for optional CRDs")
+		return ctrl.Result{}, err
+	}
+	if len(missing) > 0 {
+		message = "Support for " + strings.Join(missing, ", ") + " is disabled as the CRDs are not installed, " +
+			"install the experimental channel of the Gateway API to enable them."
+	}
+	// Only record an event when the message changes, to avoid spamming one on
+	// every reconcile.
+	prev := meta.FindStatusCondition(gwc.Status.Conditions, string(gatewayv1.GatewayClassConditionStatusAccepted))
+	if message != "" && (prev == nil || prev.Message != message) && r.Recorder != nil {
+		r.Recorder.Event(gwc, corev1.EventTypeWarning, "MissingOptionalCRDs", message)
 	}
-	log.Info("Reconciling")
-
-	// TODO: the finalizer set below says "gateways exist",
-	// should we only set it if a gateway was created on the gateway class?
-	// If the resource ever gets deleted then we can always remove it, but
-	// if no gateways exist there isn't really anything for us to cleanup.
-	//
-	//if !controllerutil.ContainsFinalizer(gwc, gatewayv1.GatewayClassFinalizerGatewaysExist) {
-	//	if ok := controllerutil.AddFinalizer(gwc, gatewayv1.GatewayClassFinalizerGatewaysExist); !ok {
-	//		log.Error(nil, "Failed to add finalizer")
-	//		return ctrl.Result{Requeue: true}, nil
-	//	}
-	//	if err := r.Update(ctx, gwc); err != nil {
-	//		log.Error(err, "Failed to update finalizer")
-	//		return ctrl.Result{}, err
-	//	}
-	//	// TODO: requeue?
-	//}
-
-	meta.SetStatusCondition(&gwc.Status.Conditions, metav1.Condition{
-		Type:   string(gatewayv1.GatewayClassConditionStatusAccepted),
-		Status: metav1.ConditionTrue,
-		Reason: string(gatewayv1.GatewayClassReasonAccepted),
-		// Reason:  string(gatewayv1.GatewayClassReasonInvalidParameters),
-		Message: "",
-	})
 
-	// TODO: validate CRD versions.
-	meta.SetStatusCondition(&gwc.Status.Conditions, metav1.Condition{
-		Type:   string(gatewayv1.GatewayClassConditionStatusSupportedVersion),
-		Status: metav1.ConditionTrue,
-		Reason: string(gatewayv1.GatewayClassReasonSupportedVersion),
-		// Reason:  string(gatewayv1.GatewayClassReasonUnsupportedVersion),
-		Message: "Gateway API CRD bundle version v1.0.0 is supported.",
-	})
+	accepted := metav1.Condition{
+		Type:    string(gatewayv1.GatewayClassConditionStatusAccepted),
+		Status:  metav1.ConditionTrue,
+		Reason:  string(gatewayv1.GatewayClassReasonAccepted),
+		Message: message,
+	}
+	if _, err := getGatewayClassParameters(ctx, r.Client, gwc); err != nil {
+		log.V(logLevelDebug).Info("GatewayClass has invalid parameters", "error", err)
+		accepted.Status = metav1.ConditionFalse
+		accepted.Reason = string(gatewayv1.GatewayClassReasonInvalidParameters)
+		accepted.Message = err.Error()
+	}
+	meta.SetStatusCondition(&gwc.Status.Conditions, accepted)
 
-	supportedFeatures := []gatewayv1.SupportedFeature{
-		"Gateway",
-		// "GatewayPort8080",
-		// "GatewayStaticAddresses",
-		"HTTPRoute",
-		// "HTTPRouteDestinationPortMatching",
-		// TODO: enable once we support URLRewrite Hostname
-		// "HTTPRouteHostRewrite",
-		"HTTPRouteMethodMatching",
-		"HTTPRoutePathRedirect",
-		// TODO: enable once we support URLRewrite Path
-		// "HTTPRoutePathRewrite",
-		"HTTPRoutePortRedirect",
-		"HTTPRouteQueryParamMatching",
-		// "HTTPRouteRequestMirror",
-		// "HTTPRouteRequestMultipleMirrors",
-		"HTTPRouteResponseHeaderModification",
-		"HTTPRouteSchemeRedirect",
-		// "Mesh",
-		"ReferenceGrant",
-		// "TLSRoute",
+	// Check that the installed Gateway API CRDs are a version we support.
+	info, err := getGatewayAPIInfo(ctx, r.APIReader)
+	if err != nil {
+		log.Error(err, "Unable to get Gateway API CRD bundle version")
+		return ctrl.Result{}, err
+	}
+	supportedVersion := metav1.Condition{
+		Type:    string(gatewayv1.GatewayClassConditionStatusSupportedVersion),
+		Status:  metav1.ConditionTrue,
+		Reason:  string(gatewayv1.GatewayClassReasonSupportedVersion),
+		Message: "Gateway API CRD bundle version v" + minimumBundleVersion.String() + " or newer is supported.",
 	}
+	if info.BundleVersion != nil {
+		if info.BundleVersion.LessThan(minimumBundleVersion) {
+			supportedVersion.Status = metav1.ConditionFalse
+			supportedVersion.Reason = string(gatewayv1.GatewayClassReasonUnsupportedVersion)
+			supportedVersion.Message = "Gateway API CRD bundle version v" + info.BundleVersion.String() +
+				" is unsupported, v" + minimumBundleVersion.String() + " or newer is required."
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = string(gatewayv1.GatewayClassReasonUnsupportedVersion)
+			accepted.Message = supportedVersion.Message
+			meta.SetStatusCondition(&gwc.Status.Conditions, accepted)
+		} else {
+			supportedVersion.Message = "Gateway API CRD bundle version v" + info.BundleVersion.String() + " is supported."
+		}
+	}
+	meta.SetStatusCondition(&gwc.Status.Conditions, supportedVersion)
+
+	// Only advertise features the installed CRDs are new enough for.
+	supportedFeatures := slices.DeleteFunc(slices.Clone(supportedFeatures), func(f gatewayv1.SupportedFeature) bool {
+		return !info.supportsFeature(f)
+	})
 
 	// The Gateway API spec requires that the supported features array be sorted
 	// in "ascending alphabetical order".
@@ -146,10 +293,46 @@ func (r *GatewayClassReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	gwc.Status.SupportedFeatures = supportedFeatures
 
 	// Save changes to the GatewayClass's status.
-	if err := r.Status().Update(ctx, gwc); err != nil {
+	statusCtx, cancel := statusContext(ctx)
+	defer cancel()
+	if err := updateStatusWithRetry(statusCtx, r.Client, gwc, func(latest *gatewayv1.GatewayClass) {
+		latest.Status.Conditions = mergeConditions(latest.Status.Conditions, gwc.Status.Conditions)
+		latest.Status.SupportedFeatures = gwc.Status.SupportedFeatures
+	}); err != nil {
 		log.Error(err, "Failed to update status")
 		return ctrl.Result{}, err
 	}
 
 	return ctrl.Result{}, nil
 }
+
+// supportedFeatures are the features of the Gateway API we support, see
+// featureMinimumBundleVersions for the features that depend on the installed
+// CRDs.
+var supportedFeatures = []gatewayv1.SupportedFeature{
+	"Gateway",
+	// "GatewayPort8080",
+	"GRPCRoute",
+	// "GatewayStaticAddresses",
+	"HTTPRoute",
+	"HTTPRouteBackendProtocolH2C",
+	"HTTPRouteBackendProtocolWebSocket",
+	"HTTPRouteBackendTimeout",
+	// "HTTPRouteDestinationPortMatching",
+	"HTTPRouteParentRefPort",
+	// TODO: enable once we support URLRewrite Hostname
+	// "HTTPRouteHostRewrite",
+	"HTTPRouteMethodMatching",
+	"HTTPRoutePathRedirect",
+	"HTTPRoutePathRewrite",
+	"HTTPRoutePortRedirect",
+	"HTTPRouteQueryParamMatching",
+	"HTTPRouteRequestMirror",
+	"HTTPRouteRequestMultipleMirrors",
+	"HTTPRouteRequestTimeout",
+	"HTTPRouteResponseHeaderModification",
+	"HTTPRouteSchemeRedirect",
+	// "Mesh",
+	"ReferenceGrant",
+	// "TLSRoute",
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+// PodAnnotationDrain is an annotation on a Caddy pod used to drain it, e.g.
+// before draining the node it runs on.
+//
+// A draining pod is programmed with a config that fails the health checks
+// configured with the `caddyserver.com/health-check-path` Gateway
+// annotation, while continuing to serve any other traffic, so external load
+// balancers stop sending new connections to it before it is removed.
+const PodAnnotationDrain = string(gateway.ControllerDomain) + "/drain"
+
+// isDraining returns true if the pod has been annotated to be drained.
+func isDraining(pod metav1.Object) bool {
+	return pod.GetAnnotations()[PodAnnotationDrain] == "true"
+}
+
+// getDrainingPods returns the UIDs of the Caddy instances that have been
+// annotated to be drained.
+func (r *GatewayReconciler) getDrainingPods(ctx context.Context, instances []caddyInstance) (map[types.UID]struct{}, error) {
+	draining := map[types.UID]struct{}{}
+	for _, a := range instances {
+		if a.TargetRef == nil || a.TargetRef.Kind != "Pod" {
+			continue
+		}
+		// Only the metadata of pods is cached.
+		pod := &metav1.PartialObjectMetadata{}
+		pod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+		if err := r.Client.Get(ctx, client.ObjectKey{
+			Namespace: a.TargetRef.Namespace,
+			Name:      a.TargetRef.Name,
+		}, pod); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if isDraining(pod) {
+			draining[pod.UID] = struct{}{}
+		}
+	}
+	return draining, nil
+}
+
+// drainAnnotationChanged only allows updates that change whether a pod is
+// being drained. New and deleted pods are already handled by watching the
+// Gateway's EndpointSlices.
+func drainAnnotationChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return false
+			}
+			return e.ObjectOld.GetAnnotations()[PodAnnotationDrain] != e.ObjectNew.GetAnnotations()[PodAnnotationDrain]
+		},
+	}
+}
+
+// enqueueRequestForDrainingPod enqueues the Gateway served by a pod when it
+// is annotated to be drained, or the annotation is removed.
+func (r *GatewayReconciler) enqueueRequestForDrainingPod() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(o))
+
+		sliceList := &discoveryv1.EndpointSliceList{}
+		// The EndpointSlices of a Gateway are in the Gateway's namespace,
+		// which isn't necessarily the namespace Caddy runs in.
+		if err := r.Client.List(ctx, sliceList, client.HasLabels{owningGatewayLabel}); err != nil {
+			log.Error(err, "Unable to list EndpointSlices")
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		seen := map[types.NamespacedName]struct{}{}
+		for _, slice := range sliceList.Items {
+			if !endpointSliceContainsPod(&slice, o.GetUID()) {
+				continue
+			}
+			req := reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Namespace: slice.Namespace,
+					Name:      slice.Labels[owningGatewayLabel],
+				},
+			}
+			if _, ok := seen[req.NamespacedName]; ok {
+				continue
+			}
+			seen[req.NamespacedName] = struct{}{}
+			log.V(logLevelEnqueue).Info("Enqueued Gateway for draining pod", logKeyGateway, req.NamespacedName)
+			reqs = append(reqs, req)
+		}
+		return reqs
+	})
+}
+
+func endpointSliceContainsPod(slice *discoveryv1.EndpointSlice, uid types.UID) bool {
+	for _, ep := range slice.Endpoints {
+		if ep.TargetRef != nil && ep.TargetRef.UID == uid {
+			return true
+		}
+	}
+	return false
+}
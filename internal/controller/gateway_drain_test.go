@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestGetDrainingPods(t *testing.T) {
+	// pod returns the cached metadata of a Caddy pod.
+	pod := func(name string, draining string) *metav1.PartialObjectMetadata {
+		p := &metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				UID:       types.UID(name),
+			},
+		}
+		p.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+		if draining != "" {
+			p.Annotations = map[string]string{PodAnnotationDrain: draining}
+		}
+		return p
+	}
+	// instance returns a Caddy instance referencing the object `name`.
+	instance := func(kind, name string) caddyInstance {
+		return caddyInstance{
+			IP:        "10.0.0.1",
+			TargetRef: &corev1.ObjectReference{Kind: kind, Namespace: "default", Name: name},
+		}
+	}
+
+	r := &GatewayReconciler{Client: newTestClientWith(
+		pod("draining", "true"),
+		pod("serving", ""),
+		pod("not-true", "false"),
+	)}
+	got, err := r.getDrainingPods(context.Background(), []caddyInstance{
+		instance("Pod", "draining"),
+		instance("Pod", "serving"),
+		instance("Pod", "not-true"),
+		// Pods that were deleted since the EndpointSlice was updated.
+		instance("Pod", "deleted"),
+		// Only pods can be drained.
+		instance("Node", "draining"),
+		{IP: "10.0.0.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[types.UID]struct{}{"draining": {}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getDrainingPods() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+const (
+	// GatewayAnnotationHostNetwork is an annotation on a Gateway used to
+	// indicate the Gateway's Caddy instances run with `hostNetwork: true`,
+	// usually as a DaemonSet on bare-metal clusters.
+	//
+	// Host network Gateways are exposed directly on the nodes running Caddy,
+	// so no load balancer is requested, the addresses of the nodes are
+	// reported as the Gateway's addresses and listener ports are validated
+	// to not conflict with ports already in use on the nodes.
+	GatewayAnnotationHostNetwork = string(gateway.ControllerDomain) + "/host-network"
+
+	// GatewayExposureHostNetwork is the reason of the GatewayConditionExposure
+	// condition for host network Gateways.
+	GatewayExposureHostNetwork = "HostNetwork"
+
+	// hostNetworkConflictRequeue is how often a host network Gateway with
+	// conflicting listeners is checked again, as the Gateways it conflicts
+	// with may be deleted or moved to other nodes without it being
+	// reconciled.
+	hostNetworkConflictRequeue = time.Minute
+
+	// nodePortRangeStart and nodePortRangeEnd are the bounds of the default
+	// Service NodePort range, which kube-proxy binds on every node.
+	nodePortRangeStart = 30000
+	nodePortRangeEnd   = 32767
+)
+
+// reservedHostPorts are ports commonly bound on nodes by Kubernetes and Caddy
+// itself, listeners on host network Gateways may not use them.
+var reservedHostPorts = map[gatewayv1.PortNumber]string{
+	2019:  "Caddy admin API",
+	2021:  "Caddy admin API",
+	2379:  "etcd",
+	2380:  "etcd",
+	6443:  "Kubernetes API server",
+	10250: "kubelet",
+	10256: "kube-proxy",
+}
+
+// isHostNetwork returns true if the Gateway's Caddy instances run on the host
+// network.
+func isHostNetwork(gw *gatewayv1.Gateway) bool {
+	return gw.Annotations[GatewayAnnotationHostNetwork] == "true"
+}
+
+// listenerNetwork returns the transport protocol a listener binds on the host.
+func listenerNetwork(l gatewayv1.Listener) string {
+	if l.Protocol == gatewayv1.UDPProtocolType {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// checkHostNetworkPorts describes every listener on a host network Gateway
+// whose port conflicts with a port reserved on the nodes, or with a listener
+// of an older host network Gateway that shares a node with it. Only the newer
+// of two conflicting Gateways is rejected, so the older keeps its ports.
+func (r *GatewayReconciler) checkHostNetworkPorts(ctx context.Context, gw *gatewayv1.Gateway) ([]string, error) {
+	var conflicts []string
+	for _, l := range gw.Spec.Listeners {
+		if name, ok := reservedHostPorts[l.Port]; ok {
+			conflicts = append(conflicts, fmt.Sprintf("listener %s: port %d is used by the %s", l.Name, l.Port, name))
+			continue
+		}
+		if l.Port >= nodePortRangeStart && l.Port <= nodePortRangeEnd {
+			conflicts = append(conflicts, fmt.Sprintf("listener %s: port %d is within the NodePort range", l.Name, l.Port))
+		}
+	}
+
+	if nodes := r.getGatewayNodes(ctx, gw); len(nodes) > 0 {
+		gwList := &gatewayv1.GatewayList{}
+		if err := r.Client.List(ctx, gwList); err != nil {
+			return nil, err
+		}
+		for _, other := range gwList.Items {
+			if !isHostNetwork(&other) || !isOlderGateway(&other, gw) {
+				continue
+			}
+			if !sharesNode(nodes, r.getGatewayNodes(ctx, &other)) {
+				continue
+			}
+			for _, l := range gw.Spec.Listeners {
+				for _, ol := range other.Spec.Listeners {
+					if l.Port != ol.Port || listenerNetwork(l) != listenerNetwork(ol) {
+						continue
+					}
+					conflicts = append(conflicts, fmt.Sprintf(
+						"listener %s: port %d is used by listener %s of Gateway %s",
+						l.Name, l.Port, ol.Name, client.ObjectKeyFromObject(&other),
+					))
+				}
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+// isOlderGateway returns true if a was created before b, breaking ties by
+// their namespaces and names. A Gateway is never older than itself.
+func isOlderGateway(a, b *gatewayv1.Gateway) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return cmp.Or(strings.Compare(a.Namespace, b.Namespace), strings.Compare(a.Name, b.Name)) < 0
+}
+
+// getGatewayNodes returns the names of the nodes running the Gateway's Caddy
+// instances, if any have been deployed.
+func (r *GatewayReconciler) getGatewayNodes(ctx context.Context, gw *gatewayv1.Gateway) map[string]struct{} {
+	endpointSlices, err := r.getEndpointSlices(ctx, gw)
+	if err != nil {
+		return nil
+	}
+	nodes := map[string]struct{}{}
+	for _, slice := range endpointSlices {
+		for _, ep := range slice.Endpoints {
+			if ep.NodeName != nil {
+				nodes[*ep.NodeName] = struct{}{}
+			}
+		}
+	}
+	return nodes
+}
+
+func sharesNode(a, b map[string]struct{}) bool {
+	for n := range a {
+		if _, ok := b[n]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getHostNetworkAddresses returns the addresses of the nodes running the
+// Gateway's Caddy instances. As the instances use the host network, the
+// addresses of their endpoints are the addresses of the nodes.
+func (r *GatewayReconciler) getHostNetworkAddresses(ctx context.Context, gw *gatewayv1.Gateway) ([]gatewayv1.GatewayStatusAddress, error) {
+	endpointSlices, err := r.getEndpointSlices(ctx, gw)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []gatewayv1.GatewayStatusAddress
+	for _, slice := range endpointSlices {
+		if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			if !endpointReady(ep) {
+				continue
+			}
+			for _, ip := range ep.Addresses {
+				addresses = append(addresses, gatewayv1.GatewayStatusAddress{
+					Type:  GatewayAddressTypePtr(gatewayv1.IPAddressType),
+					Value: ip,
+				})
+			}
+		}
+	}
+	return addresses, nil
+}
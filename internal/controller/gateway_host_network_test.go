@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestCheckHostNetworkPorts(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// hostGateway returns a host network Gateway with an HTTP listener on the
+	// port, and an EndpointSlice placing its Caddy instance on the node.
+	hostGateway := func(name string, age time.Duration, port gatewayv1.PortNumber, node string) []client.Object {
+		return []client.Object{
+			&gatewayv1.Gateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:         "default",
+					Name:              name,
+					CreationTimestamp: metav1.NewTime(created.Add(-age)),
+					Annotations:       map[string]string{GatewayAnnotationHostNetwork: "true"},
+				},
+				Spec: gatewayv1.GatewaySpec{
+					Listeners: []gatewayv1.Listener{{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: port}},
+				},
+			},
+			&discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      name,
+					Labels:    map[string]string{owningGatewayLabel: name},
+				},
+				AddressType: discoveryv1.AddressTypeIPv4,
+				Endpoints: []discoveryv1.Endpoint{{
+					Addresses: []string{"192.0.2.1"},
+					NodeName:  ptr.To(node),
+				}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		gateway   []client.Object
+		others    [][]client.Object
+		conflicts int
+	}{
+		{
+			name:    "no conflicts",
+			gateway: hostGateway("a", 0, 80, "node-1"),
+			others:  [][]client.Object{hostGateway("b", time.Hour, 8080, "node-1")},
+		},
+		{
+			name:      "reserved port",
+			gateway:   hostGateway("a", 0, 10250, "node-1"),
+			conflicts: 1,
+		},
+		{
+			name:      "NodePort range",
+			gateway:   hostGateway("a", 0, 30080, "node-1"),
+			conflicts: 1,
+		},
+		{
+			name:      "older Gateway on the same node",
+			gateway:   hostGateway("a", 0, 80, "node-1"),
+			others:    [][]client.Object{hostGateway("b", time.Hour, 80, "node-1")},
+			conflicts: 1,
+		},
+		{
+			name:    "newer Gateway on the same node",
+			gateway: hostGateway("a", time.Hour, 80, "node-1"),
+			others:  [][]client.Object{hostGateway("b", 0, 80, "node-1")},
+		},
+		{
+			name:    "same age, later name",
+			gateway: hostGateway("a", 0, 80, "node-1"),
+			others:  [][]client.Object{hostGateway("b", 0, 80, "node-1")},
+		},
+		{
+			name:      "same age, earlier name",
+			gateway:   hostGateway("b", 0, 80, "node-1"),
+			others:    [][]client.Object{hostGateway("a", 0, 80, "node-1")},
+			conflicts: 1,
+		},
+		{
+			name:    "other node",
+			gateway: hostGateway("a", 0, 80, "node-1"),
+			others:  [][]client.Object{hostGateway("b", time.Hour, 80, "node-2")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := tt.gateway
+			for _, other := range tt.others {
+				objs = append(objs, other...)
+			}
+			r := &GatewayReconciler{Client: newTestClientWith(objs...)}
+			conflicts, err := r.checkHostNetworkPorts(context.Background(), tt.gateway[0].(*gatewayv1.Gateway))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(conflicts) != tt.conflicts {
+				t.Errorf("checkHostNetworkPorts() = %q, want %d conflicts", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+const (
+	// GatewayConditionIdentityHeaders is a condition on a Gateway used to
+	// report whether the headers named by its identity header annotations
+	// (e.g. `caddyserver.com/gateway-header`) are valid.
+	//
+	// Invalid headers are not set on requests, but as the rest of the config
+	// is still served, the Gateway is not considered invalid.
+	GatewayConditionIdentityHeaders = string(gateway.ControllerDomain) + "/IdentityHeaders"
+
+	// GatewayReasonInvalidHeaderName is used with
+	// GatewayConditionIdentityHeaders when at least one identity header
+	// annotation is not a valid HTTP header name.
+	GatewayReasonInvalidHeaderName = "InvalidHeaderName"
+
+	// GatewayReasonHeadersValid is used with GatewayConditionIdentityHeaders
+	// when all identity header annotations are valid HTTP header names.
+	GatewayReasonHeadersValid = "HeadersValid"
+)
+
+// setIdentityHeadersStatus checks the identity header annotations of the
+// Gateway, setting GatewayConditionIdentityHeaders and recording an event if
+// any of them are invalid. The condition is removed if none are set.
+func (r *GatewayReconciler) setIdentityHeadersStatus(gw *gatewayv1.Gateway) {
+	if !caddy.HasIdentityHeaders(gw) {
+		meta.RemoveStatusCondition(&gw.Status.Conditions, GatewayConditionIdentityHeaders)
+		return
+	}
+
+	err := caddy.ValidateIdentityHeaders(gw)
+	if err == nil {
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    GatewayConditionIdentityHeaders,
+			Status:  metav1.ConditionTrue,
+			Reason:  GatewayReasonHeadersValid,
+			Message: "Identity headers are set on requests proxied to backends",
+		})
+		return
+	}
+
+	message := "Invalid identity headers are not set on requests: " + err.Error()
+	// Only record an event when the message changes, to avoid spamming one on
+	// every reconcile.
+	prev := meta.FindStatusCondition(gw.Status.Conditions, GatewayConditionIdentityHeaders)
+	if (prev == nil || prev.Message != message) && r.Recorder != nil {
+		r.Recorder.Event(gw, corev1.EventTypeWarning, GatewayReasonInvalidHeaderName, message)
+	}
+	meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+		Type:    GatewayConditionIdentityHeaders,
+		Status:  metav1.ConditionFalse,
+		Reason:  GatewayReasonInvalidHeaderName,
+		Message: message,
+	})
+}
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+func TestSetIdentityHeadersStatus(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GatewayReconciler{Recorder: recorder}
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "gateway",
+		Annotations: map[string]string{caddy.GatewayAnnotationGatewayHeader: "X Gateway"},
+	}}
+
+	// The event is only recorded once, while the message doesn't change.
+	for range 2 {
+		r.setIdentityHeadersStatus(gw)
+	}
+	c := meta.FindStatusCondition(gw.Status.Conditions, GatewayConditionIdentityHeaders)
+	if c == nil || c.Status != metav1.ConditionFalse || c.Reason != GatewayReasonInvalidHeaderName {
+		t.Errorf("IdentityHeaders condition = %+v, want %s", c, GatewayReasonInvalidHeaderName)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("recorded %d events, want 1", len(recorder.Events))
+	}
+
+	gw.Annotations[caddy.GatewayAnnotationGatewayHeader] = "X-Gateway"
+	r.setIdentityHeadersStatus(gw)
+	if !meta.IsStatusConditionTrue(gw.Status.Conditions, GatewayConditionIdentityHeaders) {
+		t.Errorf("IdentityHeaders condition is not true with a valid header: %+v", gw.Status.Conditions)
+	}
+
+	gw.Annotations = nil
+	r.setIdentityHeadersStatus(gw)
+	if c := meta.FindStatusCondition(gw.Status.Conditions, GatewayConditionIdentityHeaders); c != nil {
+		t.Errorf("IdentityHeaders condition = %+v without any identity headers, want none", c)
+	}
+}
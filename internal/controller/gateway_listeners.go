@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// ListenerReasonInvalidHostname is used with the Accepted condition of a
+// listener when its hostname is not a valid hostname.
+const ListenerReasonInvalidHostname gatewayv1.ListenerConditionReason = "InvalidHostname"
+
+// setListenerStatus sets the status of every listener of the Gateway, using
+// the config generated for it to count the routes attached to each listener.
+// Conditions of listeners that are still present are updated in place, so
+// their transition times are kept.
+func (r *GatewayReconciler) setListenerStatus(ctx context.Context, gw *gatewayv1.Gateway, i *caddy.Input) error {
+	summaries := i.ListenerSummaries()
+	conflicts := gateway.ConflictedListeners(gw.Spec.Listeners)
+
+	statuses := make([]gatewayv1.ListenerStatus, 0, len(gw.Spec.Listeners))
+	for _, l := range gw.Spec.Listeners {
+		status := gatewayv1.ListenerStatus{
+			Name:           l.Name,
+			SupportedKinds: []gatewayv1.RouteGroupKind{},
+			AttachedRoutes: int32(summaries[l.Name].Routes),
+		}
+		if n := slices.IndexFunc(gw.Status.Listeners, func(s gatewayv1.ListenerStatus) bool {
+			return s.Name == l.Name
+		}); n >= 0 {
+			status.Conditions = slices.Clone(gw.Status.Listeners[n].Conditions)
+		}
+		setCondition := func(t gatewayv1.ListenerConditionType, s metav1.ConditionStatus, reason gatewayv1.ListenerConditionReason, message string) {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               string(t),
+				Status:             s,
+				Reason:             string(reason),
+				Message:            message,
+				ObservedGeneration: gw.Generation,
+			})
+		}
+
+		kinds, invalidKinds := gateway.ListenerRouteKinds(l)
+		status.SupportedKinds = append(status.SupportedKinds, kinds...)
+
+		valid := true
+		var hostnameErr error
+		if l.Hostname != nil {
+			hostnameErr = gateway.ValidateHostname(string(*l.Hostname))
+		}
+		if len(gateway.SupportedRouteKinds(l.Protocol)) == 0 {
+			valid = false
+			setCondition(gatewayv1.ListenerConditionAccepted, metav1.ConditionFalse, gatewayv1.ListenerReasonUnsupportedProtocol,
+				fmt.Sprintf("Protocol %s is not supported", l.Protocol))
+		} else if hostnameErr != nil {
+			valid = false
+			setCondition(gatewayv1.ListenerConditionAccepted, metav1.ConditionFalse, ListenerReasonInvalidHostname,
+				"Invalid hostname: "+hostnameErr.Error())
+		} else {
+			setCondition(gatewayv1.ListenerConditionAccepted, metav1.ConditionTrue, gatewayv1.ListenerReasonAccepted,
+				"Listener is valid")
+		}
+
+		if invalidKinds {
+			valid = false
+			setCondition(gatewayv1.ListenerConditionResolvedRefs, metav1.ConditionFalse, gatewayv1.ListenerReasonInvalidRouteKinds,
+				"Listener allows route kinds that are not supported by its protocol")
+		} else {
+			reason, message, err := r.checkListenerCertificateRefs(ctx, gw, l, i)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				valid = false
+				setCondition(gatewayv1.ListenerConditionResolvedRefs, metav1.ConditionFalse, reason, message)
+			} else {
+				setCondition(gatewayv1.ListenerConditionResolvedRefs, metav1.ConditionTrue, gatewayv1.ListenerReasonResolvedRefs,
+					"All references are resolved")
+			}
+		}
+
+		if reason, ok := conflicts[l.Name]; ok {
+			valid = false
+			setCondition(gatewayv1.ListenerConditionConflicted, metav1.ConditionTrue, reason,
+				fmt.Sprintf("Listener conflicts with another listener on port %d", l.Port))
+		} else {
+			setCondition(gatewayv1.ListenerConditionConflicted, metav1.ConditionFalse, gatewayv1.ListenerReasonNoConflicts,
+				"Listener does not conflict with any other listener")
+		}
+
+		invalid := "Listener is invalid"
+		if conflict := summaries[l.Name].TLSConflict; conflict != "" {
+			valid = false
+			invalid = "Listener's TLS options were not programmed: " + conflict
+		}
+
+		if valid {
+			setCondition(gatewayv1.ListenerConditionProgrammed, metav1.ConditionTrue, gatewayv1.ListenerReasonProgrammed,
+				"Listener has been programmed")
+		} else {
+			setCondition(gatewayv1.ListenerConditionProgrammed, metav1.ConditionFalse, gatewayv1.ListenerReasonInvalid,
+				invalid)
+		}
+		statuses = append(statuses, status)
+	}
+	gw.Status.Listeners = statuses
+	return nil
+}
+
+// checkListenerCertificateRefs returns the reason and message of the
+// listener's ResolvedRefs condition if any of its certificate references
+// can't be resolved, or an empty reason if all of them can.
+func (r *GatewayReconciler) checkListenerCertificateRefs(ctx context.Context, gw *gatewayv1.Gateway, l gatewayv1.Listener, i *caddy.Input) (gatewayv1.ListenerConditionReason, string, error) {
+	if l.TLS == nil || (l.TLS.Mode != nil && *l.TLS.Mode != gatewayv1.TLSModeTerminate) {
+		return "", "", nil
+	}
+	for _, ref := range l.TLS.CertificateRefs {
+		if !gateway.IsSecret(ref) {
+			return gatewayv1.ListenerReasonInvalidCertificateRef, fmt.Sprintf("Certificate reference %s is not a Secret", ref.Name), nil
+		}
+		if !gateway.IsSecretReferenceAllowed(gw.Namespace, ref, i.Grants) {
+			return gatewayv1.ListenerReasonRefNotPermitted, fmt.Sprintf("Certificate reference %s is not permitted by any ReferenceGrant", ref.Name), nil
+		}
+		key := client.ObjectKey{
+			Namespace: gateway.NamespaceDerefOr(ref.Namespace, gw.Namespace),
+			Name:      string(ref.Name),
+		}
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, key, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return gatewayv1.ListenerReasonInvalidCertificateRef, fmt.Sprintf("Secret %s does not exist", key), nil
+			}
+			return "", "", err
+		}
+		if len(secret.Data[corev1.TLSCertKey]) == 0 || len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+			return gatewayv1.ListenerReasonInvalidCertificateRef, fmt.Sprintf("Secret %s does not contain a certificate and key", key), nil
+		}
+	}
+	return "", "", nil
+}
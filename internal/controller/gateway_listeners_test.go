@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+func TestSetListenerStatusInvalidHostname(t *testing.T) {
+	valid := gatewayv1.Hostname("*.example.com")
+	invalid := gatewayv1.Hostname("-app-.example.com")
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{
+				{Name: "http", Hostname: &valid, Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+				{Name: "invalid", Hostname: &invalid, Protocol: gatewayv1.HTTPProtocolType, Port: 8080},
+			},
+		},
+	}
+	r := &GatewayReconciler{Client: newTestClientWith()}
+	if err := r.setListenerStatus(context.Background(), gw, &caddy.Input{Gateway: gw}); err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := func(name gatewayv1.SectionName) []metav1.Condition {
+		for _, s := range gw.Status.Listeners {
+			if s.Name == name {
+				return s.Conditions
+			}
+		}
+		t.Fatalf("no status for listener %s", name)
+		return nil
+	}
+	for _, c := range []gatewayv1.ListenerConditionType{gatewayv1.ListenerConditionAccepted, gatewayv1.ListenerConditionProgrammed} {
+		if !meta.IsStatusConditionTrue(conditions("http"), string(c)) {
+			t.Errorf("listener http is not %s", c)
+		}
+		if !meta.IsStatusConditionFalse(conditions("invalid"), string(c)) {
+			t.Errorf("listener with an invalid hostname is not %s=False", c)
+		}
+	}
+	accepted := meta.FindStatusCondition(conditions("invalid"), string(gatewayv1.ListenerConditionAccepted))
+	if accepted.Reason != string(ListenerReasonInvalidHostname) {
+		t.Errorf("Accepted reason = %s, want %s", accepted.Reason, ListenerReasonInvalidHostname)
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=podmonitors,verbs=create;get;update
+
+// podMonitorGVK is the kind of the Prometheus Operator's PodMonitor, which is
+// used without a dependency on the operator's API.
+var podMonitorGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "PodMonitor",
+}
+
+// PodMonitorOptions configure the PodMonitors created for Gateways, so the
+// metrics of their Caddy instances are collected by the Prometheus Operator.
+type PodMonitorOptions struct {
+	// Enabled creates a PodMonitor for every Gateway.
+	Enabled bool
+
+	// TLSSecret is the name of a Secret in the namespace of each Gateway,
+	// containing a client certificate (`tls.crt` and `tls.key`) and CA
+	// (`ca.crt`) to scrape Caddy instances with over mTLS on the programming
+	// port. If empty, Caddy's admin endpoint is scraped over plain HTTP.
+	TLSSecret string
+
+	// ServerName is the name the certificates of Caddy instances are
+	// verified against when scraped over mTLS, defaulting to
+	// `<gateway>-caddy.<namespace>`. A PodMonitor has a single server name
+	// for every pod, so unlike when the controller programs Caddy (which
+	// verifies each instance as `<pod>.<namespace>`), every instance's
+	// certificate must also carry this name.
+	ServerName string
+}
+
+// reconcilePodMonitor creates or updates the PodMonitor for the Caddy
+// instances of a Gateway, selecting them the same way as the Gateway's
+// Service. The PodMonitor is owned by the Gateway, so it is garbage collected
+// with it.
+func (r *GatewayReconciler) reconcilePodMonitor(ctx context.Context, gw *gatewayv1.Gateway, params *caddy.Parameters) error {
+	svc, err := r.getService(ctx, gw)
+	if err != nil {
+		return err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return fmt.Errorf("service %s/%s has no selector", svc.Namespace, svc.Name)
+	}
+	endpoint, err := r.getPodMonitorEndpoint(gw, params)
+	if err != nil {
+		return err
+	}
+
+	selector := make(map[string]any, len(svc.Spec.Selector))
+	for k, v := range svc.Spec.Selector {
+		selector[k] = v
+	}
+
+	pm := &unstructured.Unstructured{}
+	pm.SetGroupVersionKind(podMonitorGVK)
+	pm.SetNamespace(gw.Namespace)
+	pm.SetName(gw.Name + "-caddy")
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, pm, func() error {
+		labels := pm.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[owningGatewayLabel] = gw.Name
+		pm.SetLabels(labels)
+		pm.Object["spec"] = map[string]any{
+			"selector": map[string]any{
+				"matchLabels": selector,
+			},
+			"podMetricsEndpoints": []any{endpoint},
+		}
+		return controllerutil.SetControllerReference(gw, pm, r.Scheme)
+	})
+	return err
+}
+
+// getPodMonitorEndpoint returns the endpoint of a PodMonitor scraping the
+// metrics of Caddy's admin endpoint.
+func (r *GatewayReconciler) getPodMonitorEndpoint(gw *gatewayv1.Gateway, params *caddy.Parameters) (map[string]any, error) {
+	if r.PodMonitors.TLSSecret == "" {
+		adminListen := params.GeneratorOptions(r.GeneratorOptions).AdminListen
+		if adminListen == "" {
+			adminListen = caddy.DefaultAdminListen
+		}
+		host, p, err := net.SplitHostPort(adminListen)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scrape admin endpoint %q: %w", adminListen, err)
+		}
+		port, err := strconv.ParseInt(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scrape admin endpoint %q: %w", adminListen, err)
+		}
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil, fmt.Errorf("unable to scrape admin endpoint %q as it only listens on loopback", adminListen)
+		}
+		return map[string]any{
+			"targetPort": port,
+			"path":       "/metrics",
+			"scheme":     "http",
+		}, nil
+	}
+
+	programmingPort := r.ProgrammingPort
+	if programmingPort == 0 {
+		programmingPort = defaultProgrammingPort
+	}
+	serverName := r.PodMonitors.ServerName
+	if serverName == "" {
+		serverName = provisionedName(gw) + "." + gw.Namespace
+	}
+	secretKey := func(key string) map[string]any {
+		return map[string]any{"name": r.PodMonitors.TLSSecret, "key": key}
+	}
+	return map[string]any{
+		"targetPort": int64(programmingPort),
+		"path":       "/metrics",
+		"scheme":     "https",
+		"tlsConfig": map[string]any{
+			"ca":        map[string]any{"secret": secretKey("ca.crt")},
+			"cert":      map[string]any{"secret": secretKey("tls.crt")},
+			"keySecret": secretKey("tls.key"),
+			// The server name can't vary by pod, see ServerName.
+			"serverName": serverName,
+		},
+	}, nil
+}
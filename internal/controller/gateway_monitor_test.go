@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+func TestGetPodMonitorEndpoint(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"}}
+	tlsEndpoint := func(serverName string) map[string]any {
+		secretKey := func(key string) map[string]any {
+			return map[string]any{"name": "metrics-tls", "key": key}
+		}
+		return map[string]any{
+			"targetPort": int64(2021),
+			"path":       "/metrics",
+			"scheme":     "https",
+			"tlsConfig": map[string]any{
+				"ca":         map[string]any{"secret": secretKey("ca.crt")},
+				"cert":       map[string]any{"secret": secretKey("tls.crt")},
+				"keySecret":  secretKey("tls.key"),
+				"serverName": serverName,
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		opts        PodMonitorOptions
+		adminListen string
+		want        map[string]any
+		wantErr     bool
+	}{
+		{
+			name: "admin endpoint",
+			want: map[string]any{"targetPort": int64(2019), "path": "/metrics", "scheme": "http"},
+		},
+		{
+			name:        "admin endpoint on loopback",
+			adminListen: "localhost:2019",
+			wantErr:     true,
+		},
+		{
+			name: "mTLS",
+			opts: PodMonitorOptions{TLSSecret: "metrics-tls"},
+			want: tlsEndpoint("gateway-caddy.default"),
+		},
+		{
+			name: "mTLS with a server name",
+			opts: PodMonitorOptions{TLSSecret: "metrics-tls", ServerName: "caddy.example.com"},
+			want: tlsEndpoint("caddy.example.com"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &GatewayReconciler{
+				PodMonitors:      tt.opts,
+				ProgrammingPort:  2021,
+				GeneratorOptions: caddy.GeneratorOptions{AdminListen: tt.adminListen},
+			}
+			got, err := r.getPodMonitorEndpoint(gw, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPodMonitorEndpoint() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("getPodMonitorEndpoint() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReconcilePodMonitor(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway", UID: "uid"}}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "gateway-caddy",
+			Labels:    map[string]string{owningGatewayLabel: "gateway"},
+		},
+		Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "caddy"}},
+	}
+	c := newTestClientWith(svc)
+	r := &GatewayReconciler{
+		Client:      c,
+		Scheme:      newTestScheme(t),
+		PodMonitors: PodMonitorOptions{Enabled: true, TLSSecret: "metrics-tls"},
+	}
+	if err := r.reconcilePodMonitor(context.Background(), gw, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pm := &unstructured.Unstructured{}
+	pm.SetGroupVersionKind(podMonitorGVK)
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "gateway-caddy"}, pm); err != nil {
+		t.Fatal(err)
+	}
+	if owner := metav1.GetControllerOf(pm); owner == nil || owner.UID != gw.UID {
+		t.Errorf("controller = %v, want the Gateway", owner)
+	}
+	selector, _, _ := unstructured.NestedStringMap(pm.Object, "spec", "selector", "matchLabels")
+	if !cmp.Equal(selector, svc.Spec.Selector) {
+		t.Errorf("selector = %v, want the Service's selector %v", selector, svc.Spec.Selector)
+	}
+	endpoints, _, _ := unstructured.NestedSlice(pm.Object, "spec", "podMetricsEndpoints")
+	if len(endpoints) != 1 {
+		t.Fatalf("got %d endpoints, want 1", len(endpoints))
+	}
+	serverName, _, _ := unstructured.NestedString(endpoints[0].(map[string]any), "tlsConfig", "serverName")
+	if serverName != "gateway-caddy.default" {
+		t.Errorf("server name = %q, want gateway-caddy.default", serverName)
+	}
+
+	// Services without a selector can't be monitored.
+	svc.Spec.Selector = nil
+	r.Client = newTestClientWith(svc)
+	if err := r.reconcilePodMonitor(context.Background(), gw, nil); err == nil {
+		t.Error("reconcilePodMonitor() succeeded for a Service without a selector")
+	}
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// programmingProgressInterval is how often the progress of programming Caddy
+// instances is reported while a Gateway is waiting to be programmed.
+const programmingProgressInterval = 2 * time.Second
+
+// programmingProgress counts the Caddy instances running a Gateway's config
+// while they are being programmed.
+type programmingProgress struct {
+	programmed atomic.Int64
+	total      int
+}
+
+// waitForProgramming waits for every Caddy instance to be programmed.
+//
+// Until a Gateway has been programmed for the first time, its Programmed
+// condition is periodically set to Pending with the number of instances
+// programmed so far, so users watching its status see forward progress on
+// large fleets. Gateways that are already programmed aren't changed, to
+// avoid flapping their status on every config change.
+//
+// The returned Gateway must be used as the original for any later status
+// updates, as it reflects the last status written.
+func (r *GatewayReconciler) waitForProgramming(ctx context.Context, original, gw *gatewayv1.Gateway, wg *sync.WaitGroup, progress *programmingProgress) *gatewayv1.Gateway {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	if r.Agent != nil || meta.IsStatusConditionTrue(original.Status.Conditions, string(gatewayv1.GatewayConditionProgrammed)) {
+		<-done
+		return original
+	}
+
+	ticker := time.NewTicker(programmingProgressInterval)
+	defer ticker.Stop()
+	reported := int64(-1)
+	for {
+		select {
+		case <-done:
+			return original
+		case <-ticker.C:
+		}
+		n := progress.programmed.Load()
+		if n == reported {
+			continue
+		}
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionProgrammed),
+			Status:  metav1.ConditionFalse,
+			Reason:  string(gatewayv1.GatewayReasonPending),
+			Message: strconv.FormatInt(n, 10) + "/" + strconv.Itoa(progress.total) + " instances programmed",
+		})
+		if err := r.updateStatus(ctx, original, gw); err != nil {
+			// The final status update will report the outcome regardless.
+			log.FromContext(ctx).V(logLevelDebug).Info("Unable to report programming progress", "error", err.Error())
+			continue
+		}
+		reported = n
+		original = gw.DeepCopy()
+	}
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+const (
+	// ServiceAnnotationActiveGateway is an annotation on a Service that isn't
+	// owned by a Gateway, naming the Gateway in the same namespace whose Caddy
+	// instances the Service sends traffic to.
+	//
+	// This allows running two Gateways with the same listeners side by side
+	// (e.g. blue and green, each with their own Caddy instances), and
+	// promoting one of them by changing the annotation. The selector of the
+	// Service is replaced with the selector of the promoted Gateway's own
+	// Service in a single update, so traffic switches over at once.
+	ServiceAnnotationActiveGateway = string(gateway.ControllerDomain) + "/active-gateway"
+
+	// GatewayConditionPromoted is a condition on a Gateway used to report the
+	// Services it has been promoted to receive traffic from, see
+	// ServiceAnnotationActiveGateway.
+	GatewayConditionPromoted = string(gateway.ControllerDomain) + "/Promoted"
+
+	// GatewayReasonPromoted is the reason of the Promoted condition when the
+	// Gateway receives traffic from every Service it has been promoted by.
+	GatewayReasonPromoted = "Promoted"
+
+	// GatewayReasonPromotionPending is the reason of the Promoted condition
+	// when Services promoting the Gateway can't be switched over to it yet,
+	// as none of its Caddy instances are running its config.
+	GatewayReasonPromotionPending = "PromotionPending"
+)
+
+// reconcilePromotion points every Service promoting the Gateway at its Caddy
+// instances, and reports them using the Promoted condition. The condition is
+// removed from Gateways that aren't promoted by any Service.
+//
+// Services are only switched over once the config published by p is running,
+// see promotionBlocker, until then the Promoted condition is False.
+func (r *GatewayReconciler) reconcilePromotion(ctx context.Context, gw *gatewayv1.Gateway, p *publication) error {
+	svcList := &corev1.ServiceList{}
+	if err := r.Client.List(ctx, svcList, client.InNamespace(gw.Namespace)); err != nil {
+		return err
+	}
+
+	var (
+		own      *corev1.Service
+		promoted []string
+
+		checked bool
+		blocker string
+		pending []string
+	)
+	for n := range svcList.Items {
+		svc := &svcList.Items[n]
+		if svc.Annotations[ServiceAnnotationActiveGateway] != gw.Name {
+			continue
+		}
+		// Services of Gateways are selected by the controller, not promoted.
+		if _, ok := svc.Labels[owningGatewayLabel]; ok {
+			continue
+		}
+		if own == nil {
+			var err error
+			if own, err = r.getService(ctx, gw); err != nil {
+				return err
+			}
+			if len(own.Spec.Selector) == 0 {
+				return fmt.Errorf("service %s/%s has no selector", own.Namespace, own.Name)
+			}
+		}
+		if !equality.Semantic.DeepEqual(svc.Spec.Selector, own.Spec.Selector) {
+			if !checked {
+				var err error
+				if blocker, err = r.promotionBlocker(ctx, gw, p); err != nil {
+					return err
+				}
+				checked = true
+			}
+			if blocker != "" {
+				pending = append(pending, svc.Name)
+				continue
+			}
+			svc.Spec.Selector = own.Spec.Selector
+			if err := r.Client.Update(ctx, svc); err != nil {
+				return fmt.Errorf("unable to promote Gateway on service %s: %w", svc.Name, err)
+			}
+			if r.Recorder != nil {
+				r.Recorder.Eventf(gw, corev1.EventTypeNormal, GatewayReasonPromoted, "Service %s now sends traffic to this Gateway", svc.Name)
+			}
+		}
+		promoted = append(promoted, svc.Name)
+	}
+
+	if len(pending) > 0 {
+		slices.Sort(pending)
+		meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+			Type:    GatewayConditionPromoted,
+			Status:  metav1.ConditionFalse,
+			Reason:  GatewayReasonPromotionPending,
+			Message: fmt.Sprintf("Not receiving traffic from Services %s yet, %s", strings.Join(pending, ", "), blocker),
+		})
+		return nil
+	}
+	if len(promoted) == 0 {
+		meta.RemoveStatusCondition(&gw.Status.Conditions, GatewayConditionPromoted)
+		return nil
+	}
+	slices.Sort(promoted)
+	meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+		Type:    GatewayConditionPromoted,
+		Status:  metav1.ConditionTrue,
+		Reason:  GatewayReasonPromoted,
+		Message: "Receiving traffic from Services: " + strings.Join(promoted, ", "),
+	})
+	return nil
+}
+
+// promotionBlocker returns why Services can't be switched over to the Gateway
+// yet, or an empty string if they can. This is the case once the Gateway is
+// programmed and at least one of its ready Caddy instances is running the
+// config published by p, so promoting a Gateway whose config couldn't be
+// published doesn't take down the Services.
+func (r *GatewayReconciler) promotionBlocker(ctx context.Context, gw *gatewayv1.Gateway, p *publication) (string, error) {
+	if c := p.programmedCondition(); c.Status != metav1.ConditionTrue {
+		return "as the Gateway isn't programmed: " + c.Message, nil
+	}
+	if p.direct {
+		if p.programmed == 0 {
+			return "as none of the Gateway's ready Caddy instances are running its config", nil
+		}
+		return "", nil
+	}
+
+	// Other publishers don't know when Caddy instances load the config, any
+	// ready instance is assumed to be running it.
+	endpointSlices, err := r.getEndpointSlices(ctx, gw)
+	if err != nil {
+		return "", err
+	}
+	for _, inst := range getCaddyInstances(endpointSlices) {
+		if inst.Ready {
+			return "", nil
+		}
+	}
+	return "as none of the Gateway's Caddy instances are ready", nil
+}
+
+// enqueueRequestForPromotingService enqueues the Gateway named by a Service's
+// active Gateway annotation. Updates map both the old and new Service, so the
+// demoted Gateway is reconciled as well.
+func (r *GatewayReconciler) enqueueRequestForPromotingService() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(o))
+
+		name := o.GetAnnotations()[ServiceAnnotationActiveGateway]
+		if name == "" {
+			return nil
+		}
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: o.GetNamespace(),
+				Name:      name,
+			},
+		}
+		log.V(logLevelEnqueue).Info("Enqueued Gateway for promoting Service", logKeyGateway, req.NamespacedName)
+		return []reconcile.Request{req}
+	})
+}
@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestReconcilePromotion(t *testing.T) {
+	// gatewayService returns the Service of a Gateway, selecting its Caddy
+	// instances.
+	gatewayService := func(gw string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      gw + "-caddy",
+				Labels:    map[string]string{owningGatewayLabel: gw},
+				Annotations: map[string]string{
+					// Services of Gateways are never promoted.
+					ServiceAnnotationActiveGateway: "blue",
+				},
+			},
+			Spec: corev1.ServiceSpec{Selector: map[string]string{"gateway": gw}},
+		}
+	}
+	// promotingService returns a Service promoting a Gateway, currently
+	// sending traffic to the green Gateway.
+	promotingService := func(name, active string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        name,
+				Annotations: map[string]string{ServiceAnnotationActiveGateway: active},
+			},
+			Spec: corev1.ServiceSpec{Selector: map[string]string{"gateway": "green"}},
+		}
+	}
+	blue := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "blue"}}
+	programmed := &publication{direct: true, instances: 2, programmed: 2}
+
+	tests := []struct {
+		name        string
+		objs        []client.Object
+		p           *publication
+		wasPromoted bool
+		want        map[string]string
+		wantReason  string
+		wantMessage string
+		wantEvents  int
+	}{
+		{
+			name: "promoted",
+			objs: []client.Object{
+				gatewayService("blue"),
+				gatewayService("green"),
+				promotingService("b", "blue"),
+				promotingService("a", "blue"),
+			},
+			want:        map[string]string{"a": "blue", "b": "blue", "green-caddy": "green"},
+			wantMessage: "Receiving traffic from Services: a, b",
+			wantEvents:  2,
+		},
+		{
+			name: "already promoted",
+			objs: []client.Object{
+				gatewayService("blue"),
+				&corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:   "default",
+						Name:        "a",
+						Annotations: map[string]string{ServiceAnnotationActiveGateway: "blue"},
+					},
+					Spec: corev1.ServiceSpec{Selector: map[string]string{"gateway": "blue"}},
+				},
+			},
+			want:        map[string]string{"a": "blue"},
+			wantMessage: "Receiving traffic from Services: a",
+		},
+		{
+			name: "publishing failed",
+			objs: []client.Object{
+				gatewayService("blue"),
+				promotingService("a", "blue"),
+			},
+			p: &publication{
+				direct:    true,
+				instances: 1,
+				failures:  []programmingFailure{{target: "default/blue-0", err: "connection refused"}},
+			},
+			want:        map[string]string{"a": "green"},
+			wantReason:  GatewayReasonPromotionPending,
+			wantMessage: "Not receiving traffic from Services a yet, as the Gateway isn't programmed: Unable to program any of the 1 Caddy instances: default/blue-0: connection refused",
+		},
+		{
+			name: "no instance programmed",
+			objs: []client.Object{
+				gatewayService("blue"),
+				promotingService("b", "blue"),
+				// Services already sending traffic to the Gateway keep doing so.
+				&corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:   "default",
+						Name:        "a",
+						Annotations: map[string]string{ServiceAnnotationActiveGateway: "blue"},
+					},
+					Spec: corev1.ServiceSpec{Selector: map[string]string{"gateway": "blue"}},
+				},
+			},
+			p:           &publication{direct: true},
+			want:        map[string]string{"a": "blue", "b": "green"},
+			wantReason:  GatewayReasonPromotionPending,
+			wantMessage: "Not receiving traffic from Services b yet, as none of the Gateway's ready Caddy instances are running its config",
+		},
+		{
+			name: "demoted",
+			objs: []client.Object{
+				gatewayService("blue"),
+				promotingService("a", "green"),
+			},
+			wasPromoted: true,
+			want:        map[string]string{"a": "green"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClientWith(tt.objs...)
+			recorder := record.NewFakeRecorder(10)
+			r := &GatewayReconciler{Client: c, Recorder: recorder}
+			gw := blue.DeepCopy()
+			if tt.wasPromoted {
+				meta.SetStatusCondition(&gw.Status.Conditions, metav1.Condition{
+					Type:   GatewayConditionPromoted,
+					Status: metav1.ConditionTrue,
+					Reason: GatewayReasonPromoted,
+				})
+			}
+			p := tt.p
+			if p == nil {
+				p = programmed
+			}
+			if err := r.reconcilePromotion(context.Background(), gw, p); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range tt.want {
+				svc := &corev1.Service{}
+				if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, svc); err != nil {
+					t.Fatal(err)
+				}
+				if got := svc.Spec.Selector["gateway"]; got != want {
+					t.Errorf("Service %s selects the %s Gateway, want %s", name, got, want)
+				}
+			}
+			promoted := meta.FindStatusCondition(gw.Status.Conditions, GatewayConditionPromoted)
+			switch {
+			case tt.wantMessage == "" && promoted != nil:
+				t.Errorf("Promoted condition = %+v, want none", promoted)
+			case tt.wantMessage != "" && (promoted == nil || promoted.Message != tt.wantMessage):
+				t.Errorf("Promoted condition = %+v, want message %q", promoted, tt.wantMessage)
+			case tt.wantReason != "" && promoted.Reason != tt.wantReason:
+				t.Errorf("Promoted reason = %q, want %q", promoted.Reason, tt.wantReason)
+			}
+			if len(recorder.Events) != tt.wantEvents {
+				t.Errorf("recorded %d events, want %d", len(recorder.Events), tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestReconcilePromotionWithoutRecorder(t *testing.T) {
+	c := newTestClientWith(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "blue-caddy", Labels: map[string]string{owningGatewayLabel: "blue"}},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"gateway": "blue"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a", Annotations: map[string]string{ServiceAnnotationActiveGateway: "blue"}},
+		},
+	)
+	r := &GatewayReconciler{Client: c}
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "blue"}}
+	if err := r.reconcilePromotion(context.Background(), gw, &publication{direct: true, instances: 1, programmed: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPromotionBlockerPublishedIndirectly(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "blue"}}
+	slice := func(ready bool) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta:  metav1.ObjectMeta{Namespace: "default", Name: "blue-caddy-1", Labels: map[string]string{owningGatewayLabel: "blue"}},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(ready)},
+				TargetRef:  &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "blue-0", UID: "a"},
+			}},
+		}
+	}
+
+	for _, ready := range []bool{true, false} {
+		r := &GatewayReconciler{Client: newTestClientWith(slice(ready))}
+		blocker, err := r.promotionBlocker(context.Background(), gw, &publication{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (blocker == "") != ready {
+			t.Errorf("promotionBlocker() with a ready instance: %t = %q", ready, blocker)
+		}
+	}
+}
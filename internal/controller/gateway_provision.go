@@ -0,0 +1,803 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// +kubebuilder:rbac:groups=apps,resources=deployments;daemonsets,verbs=create;delete;get;list;watch;update
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=create;delete;get;list;watch;update
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;update
+// +kubebuilder:rbac:groups=core,resources=services,verbs=create
+
+const (
+	// provisionedConfigKey is the key of the bootstrap config in the
+	// ConfigMap of provisioned Caddy instances.
+	provisionedConfigKey = "caddy.json"
+
+	// provisionedCertValidity is how long the certificates issued to
+	// provisioned Caddy instances are valid for, they are re-issued once a
+	// third of their validity remains.
+	provisionedCertValidity = 30 * 24 * time.Hour
+
+	// defaultProvisionReplicas is the number of Caddy instances created for
+	// a Gateway, unless ProvisionOptions.Replicas is set.
+	defaultProvisionReplicas = 2
+
+	// defaultRequestsPerSecondMetric is the pods metric autoscaling on
+	// requests per second uses, unless the parameters name another one.
+	defaultRequestsPerSecondMetric = "caddy_http_requests_per_second"
+
+	// defaultTargetCPUUtilization is the CPU utilization autoscaling aims
+	// for without any target, matching the HorizontalPodAutoscaler default.
+	defaultTargetCPUUtilization = 80
+
+	// annotationManagedLabels and annotationManagedAnnotations record the
+	// keys of the labels and annotations the controller set on an object, so
+	// they can be removed once they are no longer desired (e.g. when removed
+	// from the Gateway's `spec.infrastructure`).
+	annotationManagedLabels      = string(gateway.ControllerDomain) + "/managed-labels"
+	annotationManagedAnnotations = string(gateway.ControllerDomain) + "/managed-annotations"
+)
+
+// ProvisionOptions configure creating the Caddy instances of every Gateway,
+// rather than expecting them to be deployed alongside each Gateway.
+//
+// For each Gateway, a Service, a Deployment (or a DaemonSet for host network
+// Gateways), a ConfigMap with the config Caddy starts with and a Secret with
+// a client certificate are created, all owned by the Gateway. Caddy then
+// pulls its config from the controller, so provisioning requires
+// ConfigPublisherPull.
+//
+// Gateways with a Service that isn't owned by them are left as is, so
+// existing Caddy deployments keep working.
+type ProvisionOptions struct {
+	// Image is the Caddy image to run, provisioning is disabled if empty.
+	// It must include the modules used by the controller, see
+	// caddy.Containerfile.
+	Image string
+
+	// Replicas is the number of Caddy instances created for each Gateway,
+	// defaults to 2. It is only set when the Deployment is created, so
+	// Deployments can be scaled independently afterwards.
+	Replicas int32
+
+	// IssuerSecret is a `kubernetes.io/tls` Secret containing a CA
+	// certificate and its private key, used to issue the client certificates
+	// Caddy instances pull their config with. This must be the CA trusted by
+	// the controller, see AdminTLSOptions.
+	IssuerSecret types.NamespacedName
+}
+
+func (o ProvisionOptions) enabled() bool {
+	return o.Image != ""
+}
+
+// provisionedName returns the name of the resources provisioned for the
+// Caddy instances of a Gateway.
+func provisionedName(gw *gatewayv1.Gateway) string {
+	return gw.Name + "-caddy"
+}
+
+// provisionedSelector returns the labels of the provisioned Caddy instances
+// of a Gateway, which their Service and Deployment select.
+func provisionedSelector(gw *gatewayv1.Gateway) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       "caddy",
+		"app.kubernetes.io/instance":   gw.Name,
+		"app.kubernetes.io/managed-by": "caddy-gateway",
+	}
+}
+
+// provision creates or updates the Caddy instances of a Gateway, see
+// ProvisionOptions. Gateways whose Service wasn't provisioned are skipped.
+//
+// The image, replicas and resources of the Caddy instances may be set by the
+// parameters of the Gateway's GatewayClass. Unlike Replicas, replicas set by
+// the parameters are kept in sync, as they were set explicitly. Parameters
+// configuring autoscaling leave the replicas to a HorizontalPodAutoscaler
+// instead. The client certificates used by the Gateway's config are mounted
+// on the Caddy instances, see mountClientCertificates.
+func (r *GatewayReconciler) provision(ctx context.Context, gw *gatewayv1.Gateway, params *caddy.Parameters, clientCerts []*corev1.Secret) error {
+	if svc, err := r.getService(ctx, gw); err == nil && !metav1.IsControlledBy(svc, gw) {
+		return nil
+	}
+
+	labels, annotations := infrastructureMetadata(gw)
+	for k, v := range provisionedSelector(gw) {
+		labels[k] = v
+	}
+	ports := getServicePortsForGateway(gw)
+
+	if err := r.provisionService(ctx, gw, ports); err != nil {
+		return fmt.Errorf("unable to provision Service: %w", err)
+	}
+	if err := r.provisionCertificate(ctx, gw, labels, annotations); err != nil {
+		return fmt.Errorf("unable to provision certificate: %w", err)
+	}
+	if err := r.provisionConfig(ctx, gw, params, labels, annotations); err != nil {
+		return fmt.Errorf("unable to provision config: %w", err)
+	}
+
+	template := r.provisionedPodTemplate(gw, params, ports, labels, annotations)
+	mountClientCertificates(&template, clientCerts)
+	name := types.NamespacedName{Namespace: gw.Namespace, Name: provisionedName(gw)}
+	if isHostNetwork(gw) {
+		if err := r.deleteProvisioned(ctx, gw, &appsv1.Deployment{}, name); err != nil {
+			return err
+		}
+		if err := r.deleteProvisioned(ctx, gw, &autoscalingv2.HorizontalPodAutoscaler{}, name); err != nil {
+			return err
+		}
+		ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name}}
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, ds, func() error {
+			applyMetadata(&ds.ObjectMeta, labels, annotations)
+			ds.Spec.Selector = &metav1.LabelSelector{MatchLabels: provisionedSelector(gw)}
+			applyPodTemplate(&ds.Spec.Template, template)
+			return controllerutil.SetControllerReference(gw, ds, r.Scheme)
+		}); err != nil {
+			return fmt.Errorf("unable to provision DaemonSet: %w", err)
+		}
+		return nil
+	}
+
+	if err := r.deleteProvisioned(ctx, gw, &appsv1.DaemonSet{}, name); err != nil {
+		return err
+	}
+	dep := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, dep, func() error {
+		switch {
+		case params != nil && params.Autoscaling != nil:
+			// The HorizontalPodAutoscaler owns the replicas once the
+			// Deployment exists.
+			if dep.CreationTimestamp.IsZero() {
+				dep.Spec.Replicas = ptr.To(ptr.Deref(params.Autoscaling.MinReplicas, 1))
+			}
+		case params != nil && params.Replicas != nil:
+			dep.Spec.Replicas = ptr.To(*params.Replicas)
+		case dep.CreationTimestamp.IsZero():
+			dep.Spec.Replicas = ptr.To(cmp.Or(r.Provision.Replicas, defaultProvisionReplicas))
+		}
+		applyMetadata(&dep.ObjectMeta, labels, annotations)
+		dep.Spec.Selector = &metav1.LabelSelector{MatchLabels: provisionedSelector(gw)}
+		applyPodTemplate(&dep.Spec.Template, template)
+		return controllerutil.SetControllerReference(gw, dep, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("unable to provision Deployment: %w", err)
+	}
+
+	if params == nil || params.Autoscaling == nil {
+		return r.deleteProvisioned(ctx, gw, &autoscalingv2.HorizontalPodAutoscaler{}, name)
+	}
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, hpa, func() error {
+		applyMetadata(&hpa.ObjectMeta, labels, annotations)
+		// Only the fields set by the parameters are replaced, so the
+		// behavior defaulted by the API server is kept.
+		spec := provisionedAutoscalerSpec(gw, params.Autoscaling)
+		hpa.Spec.ScaleTargetRef = spec.ScaleTargetRef
+		hpa.Spec.MinReplicas = spec.MinReplicas
+		hpa.Spec.MaxReplicas = spec.MaxReplicas
+		hpa.Spec.Metrics = spec.Metrics
+		return controllerutil.SetControllerReference(gw, hpa, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("unable to provision HorizontalPodAutoscaler: %w", err)
+	}
+	return nil
+}
+
+// provisionedAutoscalerSpec returns the spec of the HorizontalPodAutoscaler
+// scaling the Deployment of a Gateway's Caddy instances.
+func provisionedAutoscalerSpec(gw *gatewayv1.Gateway, a *v1alpha1.CaddyGatewayAutoscaling) autoscalingv2.HorizontalPodAutoscalerSpec {
+	spec := autoscalingv2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "Deployment",
+			Name:       provisionedName(gw),
+		},
+		MinReplicas: ptr.To(ptr.Deref(a.MinReplicas, 1)),
+		MaxReplicas: a.MaxReplicas,
+	}
+	cpu := a.TargetCPUUtilizationPercentage
+	if cpu == nil && a.TargetRequestsPerSecond == nil {
+		// Set the default explicitly, otherwise the API server sets it and
+		// the HorizontalPodAutoscaler is updated on every reconcile.
+		cpu = ptr.To[int32](defaultTargetCPUUtilization)
+	}
+	if cpu != nil {
+		spec.Metrics = append(spec.Metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: ptr.To(*cpu),
+				},
+			},
+		})
+	}
+	if a.TargetRequestsPerSecond != nil {
+		spec.Metrics = append(spec.Metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{
+					Name: cmp.Or(a.RequestsPerSecondMetric, defaultRequestsPerSecondMetric),
+				},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: ptr.To(a.TargetRequestsPerSecond.DeepCopy()),
+				},
+			},
+		})
+	}
+	return spec
+}
+
+// deleteProvisioned deletes an object provisioned for a Gateway that is no
+// longer needed, such as its Deployment once it uses the host network.
+func (r *GatewayReconciler) deleteProvisioned(ctx context.Context, gw *gatewayv1.Gateway, obj client.Object, key types.NamespacedName) error {
+	if err := r.Client.Get(ctx, key, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, gw) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Client.Delete(ctx, obj))
+}
+
+// provisionService creates the Service of a Gateway, or updates its ports.
+// The type and any infrastructure metadata are set by
+// reconcileServiceExposure, so the Service is created as a ClusterIP to avoid
+// creating a load balancer that isn't wanted.
+func (r *GatewayReconciler) provisionService(ctx context.Context, gw *gatewayv1.Gateway, ports []corev1.ServicePort) error {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: gw.Namespace, Name: provisionedName(gw)}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, svc, func() error {
+		if svc.Labels == nil {
+			svc.Labels = map[string]string{}
+		}
+		svc.Labels[owningGatewayLabel] = gw.Name
+		if svc.CreationTimestamp.IsZero() {
+			svc.Spec.Type = corev1.ServiceTypeClusterIP
+		}
+		svc.Spec.Selector = provisionedSelector(gw)
+
+		// Keep the node ports already allocated to existing ports.
+		desired := slices.Clone(ports)
+		for n, p := range desired {
+			for _, existing := range svc.Spec.Ports {
+				if existing.Port == p.Port && existing.Protocol == p.Protocol {
+					desired[n].NodePort = existing.NodePort
+				}
+			}
+		}
+		svc.Spec.Ports = desired
+		return controllerutil.SetControllerReference(gw, svc, r.Scheme)
+	})
+	return err
+}
+
+// provisionConfig creates or updates the ConfigMap with the config the Caddy
+// instances of a Gateway are started with, which pulls the Gateway's config.
+func (r *GatewayReconciler) provisionConfig(ctx context.Context, gw *gatewayv1.Gateway, params *caddy.Parameters, labels, annotations map[string]string) error {
+	b, err := caddy.BootstrapConfig(params.GeneratorOptions(r.GeneratorOptions), r.Pull.configURL(client.ObjectKeyFromObject(gw)))
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: gw.Namespace, Name: provisionedName(gw)}}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		applyMetadata(&cm.ObjectMeta, labels, annotations)
+		cm.Data = map[string]string{provisionedConfigKey: string(b)}
+		return controllerutil.SetControllerReference(gw, cm, r.Scheme)
+	})
+	return err
+}
+
+// provisionCertificate issues the client certificate the Caddy instances of a
+// Gateway pull their config with, storing it in a Secret along with the CA.
+// The certificate is only re-issued once it nears expiry or the CA changes.
+func (r *GatewayReconciler) provisionCertificate(ctx context.Context, gw *gatewayv1.Gateway, labels, annotations map[string]string) error {
+	issuer := &corev1.Secret{}
+	if err := r.Client.Get(ctx, r.Provision.IssuerSecret, issuer); err != nil {
+		return fmt.Errorf("unable to get issuer secret: %w", err)
+	}
+	caPEM := issuer.Data[corev1.TLSCertKey]
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: gw.Namespace, Name: provisionedName(gw) + "-tls"}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		applyMetadata(&secret.ObjectMeta, labels, annotations)
+		secret.Type = corev1.SecretTypeTLS
+		if !bytes.Equal(secret.Data["ca.crt"], caPEM) || certificateNeedsRenewal(secret.Data[corev1.TLSCertKey], time.Now()) {
+			certPEM, keyPEM, err := issueCertificate(issuer, gw)
+			if err != nil {
+				return err
+			}
+			secret.Data = map[string][]byte{
+				corev1.TLSCertKey:       certPEM,
+				corev1.TLSPrivateKeyKey: keyPEM,
+				"ca.crt":                caPEM,
+			}
+		}
+		return controllerutil.SetControllerReference(gw, secret, r.Scheme)
+	})
+	return err
+}
+
+// certificateNeedsRenewal returns true if the PEM encoded certificate is
+// invalid, or less than a third of its validity remains.
+func certificateNeedsRenewal(certPEM []byte, now time.Time) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotAfter.Add(-lifetime / 3))
+}
+
+// issueCertificate issues a client certificate for the Caddy instances of a
+// Gateway, signed by the CA in the issuer Secret.
+func issueCertificate(issuer *corev1.Secret, gw *gatewayv1.Gateway) (certPEM, keyPEM []byte, err error) {
+	ca, err := tls.X509KeyPair(issuer.Data[corev1.TLSCertKey], issuer.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid issuer: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid issuer: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: provisionedName(gw) + "." + gw.Namespace},
+		DNSNames:     []string{provisionedName(gw) + "." + gw.Namespace + ".svc"},
+		// Allow for clock skew between the controller and Caddy.
+		NotBefore:   now.Add(-5 * time.Minute),
+		NotAfter:    now.Add(provisionedCertValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), ca.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// provisionedPodTemplate returns the pod template of the Caddy instances of a
+// Gateway, listening on every port of its Service.
+func (r *GatewayReconciler) provisionedPodTemplate(gw *gatewayv1.Gateway, params *caddy.Parameters, ports []corev1.ServicePort, labels, annotations map[string]string) corev1.PodTemplateSpec {
+	name := provisionedName(gw)
+
+	var containerPorts []corev1.ContainerPort
+	for _, p := range ports {
+		containerPorts = append(containerPorts, corev1.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: p.Port,
+			Protocol:      p.Protocol,
+		})
+	}
+
+	container := corev1.Container{
+		Name:  "caddy",
+		Image: r.Provision.Image,
+		Args:  []string{"run", "--config", "/etc/caddy/" + provisionedConfigKey},
+		Ports: containerPorts,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "bootstrap", MountPath: "/etc/caddy", ReadOnly: true},
+			{Name: "tls", MountPath: defaultAdminTLSDir, ReadOnly: true},
+			{Name: "config", MountPath: "/config"},
+			{Name: "data", MountPath: "/data"},
+			{Name: "tmp", MountPath: "/tmp"},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			ReadOnlyRootFilesystem:   ptr.To(true),
+			AllowPrivilegeEscalation: ptr.To(false),
+		},
+	}
+	if params != nil {
+		if params.Image != "" {
+			container.Image = params.Image
+		}
+		if params.Resources != nil {
+			container.Resources = *params.Resources
+		}
+	}
+	// Caddy's admin endpoint responds once Caddy has started, it can only be
+	// used as a probe if it listens on the pod's IP.
+	adminListen := cmp.Or(params.GeneratorOptions(r.GeneratorOptions).AdminListen, caddy.DefaultAdminListen)
+	if host, p, err := net.SplitHostPort(adminListen); err == nil && host != "localhost" && !net.ParseIP(host).IsLoopback() {
+		if port, err := strconv.Atoi(p); err == nil {
+			container.ReadinessProbe = &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{Path: "/metrics", Port: intstr.FromInt(port)},
+				},
+			}
+		}
+	}
+
+	spec := corev1.PodSpec{
+		Containers:                   []corev1.Container{container},
+		AutomountServiceAccountToken: ptr.To(false),
+		EnableServiceLinks:           ptr.To(false),
+		Volumes: []corev1.Volume{
+			{
+				Name: "bootstrap",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: name},
+					},
+				},
+			},
+			{
+				Name: "tls",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: name + "-tls"},
+				},
+			},
+			{Name: "config", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+	}
+	if isHostNetwork(gw) {
+		// Sysctls can't be set on the host network, so Caddy runs as the
+		// image's user to bind to privileged ports.
+		spec.HostNetwork = true
+		spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	} else {
+		spec.SecurityContext = &corev1.PodSecurityContext{
+			RunAsUser:    ptr.To[int64](1000),
+			RunAsGroup:   ptr.To[int64](100),
+			RunAsNonRoot: ptr.To(true),
+			FSGroup:      ptr.To[int64](100),
+			Sysctls: []corev1.Sysctl{
+				{Name: "net.ipv4.ip_unprivileged_port_start", Value: "0"},
+			},
+			SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		}
+	}
+
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: spec,
+	}
+}
+
+// PodAnnotationClientCertificatesHash is set on the pod template of
+// provisioned Caddy instances to a hash of the client certificates mounted on
+// them, replacing the pods when a certificate is rotated. Caddy only loads
+// client certificates from disk when its config is loaded, and the kubelet
+// updates mounted Secrets some time after they change, so reloading the
+// config could still load the old certificate.
+const PodAnnotationClientCertificatesHash = string(gateway.ControllerDomain) + "/client-certificates-hash"
+
+// mountClientCertificates mounts the client certificate Secrets used by the
+// config of a Gateway on its Caddy instances, each in a directory named after
+// the Secret under caddy.ClientCertificatesPath.
+func mountClientCertificates(template *corev1.PodTemplateSpec, secrets []*corev1.Secret) {
+	if len(secrets) == 0 {
+		return
+	}
+
+	h := sha256.New()
+	var sources []corev1.VolumeProjection
+	for _, s := range secrets {
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.Name},
+				Items: []corev1.KeyToPath{
+					{Key: "tls.crt", Path: s.Name + "/tls.crt"},
+					{Key: "tls.key", Path: s.Name + "/tls.key"},
+				},
+			},
+		})
+		for _, key := range []string{"tls.crt", "tls.key"} {
+			h.Write([]byte(s.Name + "/" + key + "\x00"))
+			h.Write(s.Data[key])
+		}
+	}
+
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: "client-certificates",
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{Sources: sources},
+		},
+	})
+	for n := range template.Spec.Containers {
+		c := &template.Spec.Containers[n]
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+			Name:      "client-certificates",
+			MountPath: caddy.ClientCertificatesPath,
+			ReadOnly:  true,
+		})
+	}
+
+	// The annotations may be shared with other provisioned objects.
+	annotations := make(map[string]string, len(template.Annotations)+1)
+	for k, v := range template.Annotations {
+		annotations[k] = v
+	}
+	annotations[PodAnnotationClientCertificatesHash] = hex.EncodeToString(h.Sum(nil))
+	template.Annotations = annotations
+}
+
+// applyMetadata sets the desired labels and annotations on an object,
+// keeping any others, as Kubernetes and other controllers set their own (e.g.
+// `deployment.kubernetes.io/revision`). The keys set are recorded on the
+// object, so the ones previously set that are no longer desired are removed.
+func applyMetadata(obj *metav1.ObjectMeta, labels, annotations map[string]string) {
+	managedLabels := managedKeys(obj.Annotations[annotationManagedLabels])
+	managedAnnotations := managedKeys(obj.Annotations[annotationManagedAnnotations])
+	obj.Labels = mergeMetadata(obj.Labels, labels, managedLabels)
+	obj.Annotations = mergeMetadata(obj.Annotations, annotations, managedAnnotations)
+	obj.Annotations = setManagedKeys(obj.Annotations, annotationManagedLabels, labels)
+	obj.Annotations = setManagedKeys(obj.Annotations, annotationManagedAnnotations, annotations)
+}
+
+// mergeMetadata sets the labels or annotations in desired on existing,
+// removing the managed ones that are no longer desired.
+func mergeMetadata(existing, desired map[string]string, managed []string) map[string]string {
+	for _, k := range managed {
+		if _, ok := desired[k]; !ok {
+			delete(existing, k)
+		}
+	}
+	if len(desired) == 0 {
+		return existing
+	}
+	if existing == nil {
+		existing = make(map[string]string, len(desired))
+	}
+	for k, v := range desired {
+		existing[k] = v
+	}
+	return existing
+}
+
+// managedKeys returns the keys recorded in a managed keys annotation.
+func managedKeys(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// setManagedKeys records the keys of desired in the annotation, which is
+// removed if there aren't any. Keys of labels and annotations can't contain
+// commas, so they are joined with them.
+func setManagedKeys(annotations map[string]string, annotation string, desired map[string]string) map[string]string {
+	if len(desired) == 0 {
+		delete(annotations, annotation)
+		return annotations
+	}
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotation] = strings.Join(keys, ",")
+	return annotations
+}
+
+// applyPodTemplate updates the pod template of provisioned Caddy instances.
+// Its metadata is applied with applyMetadata, so restarts triggered by `kubectl rollout restart`
+// aren't undone, and its spec is only replaced if a field set by
+// provisionedPodTemplate changed, as the API server sets defaults for fields
+// that it leaves empty.
+func applyPodTemplate(existing *corev1.PodTemplateSpec, desired corev1.PodTemplateSpec) {
+	applyMetadata(&existing.ObjectMeta, desired.Labels, desired.Annotations)
+	if !podSpecUpToDate(existing.Spec, desired.Spec) {
+		existing.Spec = desired.Spec
+	}
+}
+
+// podSpecUpToDate returns true if every field of the desired pod spec
+// returned by provisionedPodTemplate is set on the existing one, ignoring
+// the defaults set by the API server.
+func podSpecUpToDate(existing, desired corev1.PodSpec) bool {
+	if existing.HostNetwork != desired.HostNetwork ||
+		(desired.DNSPolicy != "" && existing.DNSPolicy != desired.DNSPolicy) ||
+		ptr.Deref(existing.AutomountServiceAccountToken, true) != ptr.Deref(desired.AutomountServiceAccountToken, true) ||
+		ptr.Deref(existing.EnableServiceLinks, true) != ptr.Deref(desired.EnableServiceLinks, true) ||
+		!equality.Semantic.DeepEqual(
+			ptr.Deref(existing.SecurityContext, corev1.PodSecurityContext{}),
+			ptr.Deref(desired.SecurityContext, corev1.PodSecurityContext{}),
+		) {
+		return false
+	}
+
+	if len(existing.Volumes) != len(desired.Volumes) {
+		return false
+	}
+	for n, v := range desired.Volumes {
+		e := existing.Volumes[n]
+		switch {
+		case e.Name != v.Name:
+			return false
+		case v.ConfigMap != nil:
+			if e.ConfigMap == nil || e.ConfigMap.Name != v.ConfigMap.Name {
+				return false
+			}
+		case v.Secret != nil:
+			if e.Secret == nil || e.Secret.SecretName != v.Secret.SecretName {
+				return false
+			}
+		case v.EmptyDir != nil:
+			if e.EmptyDir == nil {
+				return false
+			}
+		case v.Projected != nil:
+			if e.Projected == nil || !equality.Semantic.DeepEqual(e.Projected.Sources, v.Projected.Sources) {
+				return false
+			}
+		}
+	}
+
+	if len(existing.Containers) != len(desired.Containers) {
+		return false
+	}
+	for n, c := range desired.Containers {
+		if !containerUpToDate(existing.Containers[n], c) {
+			return false
+		}
+	}
+	return true
+}
+
+// containerUpToDate returns true if every field of the desired container
+// returned by provisionedPodTemplate is set on the existing one, ignoring
+// the defaults set by the API server.
+func containerUpToDate(existing, desired corev1.Container) bool {
+	if existing.Name != desired.Name ||
+		existing.Image != desired.Image ||
+		!slices.Equal(existing.Args, desired.Args) ||
+		!equality.Semantic.DeepEqual(existing.VolumeMounts, desired.VolumeMounts) ||
+		!equality.Semantic.DeepEqual(existing.SecurityContext, desired.SecurityContext) ||
+		!equality.Semantic.DeepEqual(existing.Resources.Limits, desired.Resources.Limits) {
+		return false
+	}
+	// Requests default to the limits.
+	if desired.Resources.Requests != nil && !equality.Semantic.DeepEqual(existing.Resources.Requests, desired.Resources.Requests) {
+		return false
+	}
+	if !slices.EqualFunc(existing.Ports, desired.Ports, func(e, d corev1.ContainerPort) bool {
+		return e.Name == d.Name && e.ContainerPort == d.ContainerPort && e.Protocol == d.Protocol
+	}) {
+		return false
+	}
+	if (existing.ReadinessProbe == nil) != (desired.ReadinessProbe == nil) {
+		return false
+	}
+	if desired.ReadinessProbe != nil {
+		e, d := existing.ReadinessProbe.HTTPGet, desired.ReadinessProbe.HTTPGet
+		if e == nil || e.Path != d.Path || e.Port != d.Port {
+			return false
+		}
+	}
+	return true
+}
+
+// getServicePortsForGateway returns the ports of the Service exposing a
+// Gateway, one for each port and protocol used by its listeners. HTTPS
+// listeners are also exposed over UDP for HTTP/3.
+func getServicePortsForGateway(gw *gatewayv1.Gateway) []corev1.ServicePort {
+	type key struct {
+		port     int32
+		protocol corev1.Protocol
+	}
+	seen := map[key]bool{}
+	var ports []corev1.ServicePort
+	add := func(port gatewayv1.PortNumber, protocol corev1.Protocol) {
+		k := key{port: int32(port), protocol: protocol}
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		ports = append(ports, corev1.ServicePort{
+			Name:       strings.ToLower(string(protocol)) + "-" + strconv.Itoa(int(port)),
+			Port:       int32(port),
+			TargetPort: intstr.FromInt(int(port)),
+			Protocol:   protocol,
+		})
+	}
+	for _, l := range gw.Spec.Listeners {
+		switch l.Protocol {
+		case gatewayv1.HTTPProtocolType, gatewayv1.TLSProtocolType, gatewayv1.TCPProtocolType:
+			add(l.Port, corev1.ProtocolTCP)
+		case gatewayv1.HTTPSProtocolType:
+			add(l.Port, corev1.ProtocolTCP)
+			add(l.Port, corev1.ProtocolUDP)
+		case gatewayv1.UDPProtocolType:
+			add(l.Port, corev1.ProtocolUDP)
+		}
+	}
+	slices.SortFunc(ports, func(a, b corev1.ServicePort) int {
+		return cmp.Or(cmp.Compare(a.Port, b.Port), cmp.Compare(a.Protocol, b.Protocol))
+	})
+	return ports
+}
+
+// infrastructureMetadata returns copies of the labels and annotations set
+// under the Gateway's `spec.infrastructure`, which are applied to every
+// resource provisioned for it. labels is never nil, as the selector of the
+// Caddy instances is added to it.
+func infrastructureMetadata(gw *gatewayv1.Gateway) (labels, annotations map[string]string) {
+	labels = map[string]string{}
+	infra := gw.Spec.Infrastructure
+	if infra == nil {
+		return labels, nil
+	}
+	for k, v := range infra.Labels {
+		labels[string(k)] = string(v)
+	}
+	// Annotations are left nil if there aren't any, so they match the
+	// objects read back from the API server.
+	for k, v := range infra.Annotations {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[string(k)] = string(v)
+	}
+	return labels, annotations
+}
@@ -0,0 +1,428 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// newIssuerSecret returns a Secret with a self-signed CA to issue
+// certificates with.
+func newIssuerSecret(t *testing.T) *corev1.Secret {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+}
+
+func TestGetServicePortsForGateway(t *testing.T) {
+	gw := &gatewayv1.Gateway{
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{
+				{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 443},
+				{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+				{Name: "http-2", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+				{Name: "tls", Protocol: gatewayv1.TLSProtocolType, Port: 443},
+				{Name: "dns", Protocol: gatewayv1.UDPProtocolType, Port: 53},
+				{Name: "tcp", Protocol: gatewayv1.TCPProtocolType, Port: 53},
+			},
+		},
+	}
+	want := []corev1.ServicePort{
+		{Name: "tcp-53", Port: 53, TargetPort: intstr.FromInt(53), Protocol: corev1.ProtocolTCP},
+		{Name: "udp-53", Port: 53, TargetPort: intstr.FromInt(53), Protocol: corev1.ProtocolUDP},
+		{Name: "tcp-80", Port: 80, TargetPort: intstr.FromInt(80), Protocol: corev1.ProtocolTCP},
+		{Name: "tcp-443", Port: 443, TargetPort: intstr.FromInt(443), Protocol: corev1.ProtocolTCP},
+		{Name: "udp-443", Port: 443, TargetPort: intstr.FromInt(443), Protocol: corev1.ProtocolUDP},
+	}
+	if got := getServicePortsForGateway(gw); !equality.Semantic.DeepEqual(got, want) {
+		t.Errorf("getServicePortsForGateway() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCertificateNeedsRenewal(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"}}
+	certPEM, _, err := issueCertificate(newIssuerSecret(t), gw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		certPEM []byte
+		now     time.Time
+		want    bool
+	}{
+		{name: "missing", want: true, now: now},
+		{name: "invalid", certPEM: []byte("invalid"), now: now, want: true},
+		{
+			name:    "not a certificate",
+			certPEM: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")}),
+			now:     now,
+			want:    true,
+		},
+		{name: "new", certPEM: certPEM, now: now},
+		{name: "before a third remains", certPEM: certPEM, now: now.Add(provisionedCertValidity * 2 / 3).Add(-time.Hour)},
+		{name: "a third remains", certPEM: certPEM, now: now.Add(provisionedCertValidity * 2 / 3).Add(time.Hour), want: true},
+		{name: "expired", certPEM: certPEM, now: now.Add(provisionedCertValidity + time.Hour), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := certificateNeedsRenewal(tt.certPEM, tt.now); got != tt.want {
+				t.Errorf("certificateNeedsRenewal() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvisionedPodTemplate(t *testing.T) {
+	r := &GatewayReconciler{Provision: ProvisionOptions{Image: "caddy:default"}}
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{
+				{Name: "https", Protocol: gatewayv1.HTTPSProtocolType, Port: 443},
+			},
+		},
+	}
+	ports := getServicePortsForGateway(gw)
+	labels := map[string]string{"app": "caddy"}
+	annotations := map[string]string{"example.com/owner": "team"}
+
+	t.Run("defaults", func(t *testing.T) {
+		tmpl := r.provisionedPodTemplate(gw, nil, ports, labels, annotations)
+		if !equality.Semantic.DeepEqual(tmpl.Labels, labels) || !equality.Semantic.DeepEqual(tmpl.Annotations, annotations) {
+			t.Errorf("metadata = %v, %v, want %v, %v", tmpl.Labels, tmpl.Annotations, labels, annotations)
+		}
+		if len(tmpl.Spec.Containers) != 1 {
+			t.Fatalf("got %d containers, want 1", len(tmpl.Spec.Containers))
+		}
+		c := tmpl.Spec.Containers[0]
+		if c.Image != "caddy:default" {
+			t.Errorf("image = %q, want %q", c.Image, "caddy:default")
+		}
+		wantPorts := []corev1.ContainerPort{
+			{Name: "tcp-443", ContainerPort: 443, Protocol: corev1.ProtocolTCP},
+			{Name: "udp-443", ContainerPort: 443, Protocol: corev1.ProtocolUDP},
+		}
+		if !slices.Equal(c.Ports, wantPorts) {
+			t.Errorf("ports = %+v, want %+v", c.Ports, wantPorts)
+		}
+		if c.ReadinessProbe == nil || c.ReadinessProbe.HTTPGet.Port != intstr.FromInt(2019) {
+			t.Errorf("readiness probe = %+v, want one on port 2019", c.ReadinessProbe)
+		}
+		if tmpl.Spec.HostNetwork || tmpl.Spec.SecurityContext == nil {
+			t.Errorf("pod must not use the host network and must have a security context")
+		}
+	})
+
+	t.Run("parameters", func(t *testing.T) {
+		params := &caddy.Parameters{
+			Image: "caddy:custom",
+			Resources: &corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+			},
+		}
+		c := r.provisionedPodTemplate(gw, params, ports, labels, annotations).Spec.Containers[0]
+		if c.Image != "caddy:custom" {
+			t.Errorf("image = %q, want %q", c.Image, "caddy:custom")
+		}
+		if !equality.Semantic.DeepEqual(c.Resources, *params.Resources) {
+			t.Errorf("resources = %+v, want %+v", c.Resources, *params.Resources)
+		}
+	})
+
+	t.Run("loopback admin endpoint", func(t *testing.T) {
+		r := &GatewayReconciler{
+			Provision:        r.Provision,
+			GeneratorOptions: caddy.GeneratorOptions{AdminListen: "localhost:2019"},
+		}
+		c := r.provisionedPodTemplate(gw, nil, ports, labels, annotations).Spec.Containers[0]
+		if c.ReadinessProbe != nil {
+			t.Errorf("readiness probe = %+v, want none", c.ReadinessProbe)
+		}
+	})
+
+	t.Run("host network", func(t *testing.T) {
+		gw := gw.DeepCopy()
+		gw.Annotations = map[string]string{GatewayAnnotationHostNetwork: "true"}
+		spec := r.provisionedPodTemplate(gw, nil, ports, labels, annotations).Spec
+		if !spec.HostNetwork || spec.DNSPolicy != corev1.DNSClusterFirstWithHostNet {
+			t.Errorf("host network = %t, DNS policy = %q, want the host network", spec.HostNetwork, spec.DNSPolicy)
+		}
+		if spec.SecurityContext != nil {
+			t.Errorf("security context = %+v, want none", spec.SecurityContext)
+		}
+	})
+}
+
+func TestApplyPodTemplate(t *testing.T) {
+	r := &GatewayReconciler{Provision: ProvisionOptions{Image: "caddy:default"}}
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{
+				{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+			},
+		},
+	}
+	desired := r.provisionedPodTemplate(gw, nil, getServicePortsForGateway(gw), provisionedSelector(gw), nil)
+
+	// existing is the template as read back from the API server, with its
+	// defaults and a restart triggered by kubectl.
+	existing := desired.DeepCopy()
+	existing.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "2024-01-01T00:00:00Z"}
+	existing.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	existing.Spec.DNSPolicy = corev1.DNSClusterFirst
+	existing.Spec.TerminationGracePeriodSeconds = ptr.To[int64](30)
+	existing.Spec.Volumes[0].ConfigMap.DefaultMode = ptr.To[int32](0o644)
+	existing.Spec.Volumes[1].Secret.DefaultMode = ptr.To[int32](0o644)
+	existing.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+	existing.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	existing.Spec.Containers[0].ReadinessProbe.TimeoutSeconds = 1
+	existing.Spec.Containers[0].ReadinessProbe.HTTPGet.Scheme = corev1.URISchemeHTTP
+	defaulted := existing.DeepCopy()
+
+	applyPodTemplate(existing, desired)
+	if !equality.Semantic.DeepEqual(existing.Spec, defaulted.Spec) {
+		t.Errorf("spec with only defaults was replaced")
+	}
+	if existing.Annotations["kubectl.kubernetes.io/restartedAt"] == "" {
+		t.Errorf("restartedAt annotation was removed")
+	}
+	if !equality.Semantic.DeepEqual(existing.Labels, desired.Labels) {
+		t.Errorf("labels = %v, want %v", existing.Labels, desired.Labels)
+	}
+
+	desired.Spec.Containers[0].Image = "caddy:new"
+	applyPodTemplate(existing, desired)
+	if got := existing.Spec.Containers[0].Image; got != "caddy:new" {
+		t.Errorf("image = %q, want %q", got, "caddy:new")
+	}
+}
+
+func TestApplyMetadata(t *testing.T) {
+	// obj was provisioned with the infrastructure label "team" and annotation
+	// "example.com/internal", and has metadata set by Kubernetes.
+	obj := metav1.ObjectMeta{}
+	applyMetadata(&obj, map[string]string{"app": "caddy", "team": "a"}, map[string]string{"example.com/internal": "true"})
+	obj.Labels["pod-template-hash"] = "abc"
+	obj.Annotations["deployment.kubernetes.io/revision"] = "1"
+
+	applyMetadata(&obj, map[string]string{"app": "caddy", "team": "b"}, map[string]string{"example.com/internal": "false"})
+	if obj.Labels["team"] != "b" || obj.Annotations["example.com/internal"] != "false" {
+		t.Errorf("metadata = %v, %v, want the updated values", obj.Labels, obj.Annotations)
+	}
+
+	applyMetadata(&obj, map[string]string{"app": "caddy"}, nil)
+	wantLabels := map[string]string{"app": "caddy", "pod-template-hash": "abc"}
+	if !equality.Semantic.DeepEqual(obj.Labels, wantLabels) {
+		t.Errorf("labels = %v, want %v", obj.Labels, wantLabels)
+	}
+	wantAnnotations := map[string]string{
+		"deployment.kubernetes.io/revision": "1",
+		annotationManagedLabels:             "app",
+	}
+	if !equality.Semantic.DeepEqual(obj.Annotations, wantAnnotations) {
+		t.Errorf("annotations = %v, want %v", obj.Annotations, wantAnnotations)
+	}
+}
+
+func TestMountClientCertificates(t *testing.T) {
+	r := &GatewayReconciler{Provision: ProvisionOptions{Image: "caddy:default"}}
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{
+				{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+			},
+		},
+	}
+	annotations := map[string]string{"example.com/owner": "team"}
+	template := func(secrets ...*corev1.Secret) corev1.PodTemplateSpec {
+		tmpl := r.provisionedPodTemplate(gw, nil, getServicePortsForGateway(gw), provisionedSelector(gw), annotations)
+		mountClientCertificates(&tmpl, secrets)
+		return tmpl
+	}
+	secret := func(name, cert string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Data: map[string][]byte{
+				"tls.crt": []byte(cert),
+				"tls.key": []byte("key"),
+			},
+		}
+	}
+
+	none := template()
+	if !equality.Semantic.DeepEqual(none, r.provisionedPodTemplate(gw, nil, getServicePortsForGateway(gw), provisionedSelector(gw), annotations)) {
+		t.Errorf("template without client certificates was changed")
+	}
+
+	tmpl := template(secret("a", "cert"), secret("b", "cert"))
+	v := tmpl.Spec.Volumes[len(tmpl.Spec.Volumes)-1]
+	if v.Projected == nil || len(v.Projected.Sources) != 2 {
+		t.Fatalf("volume = %+v, want a projected volume of both Secrets", v)
+	}
+	want := []corev1.KeyToPath{{Key: "tls.crt", Path: "b/tls.crt"}, {Key: "tls.key", Path: "b/tls.key"}}
+	if s := v.Projected.Sources[1].Secret; s == nil || s.Name != "b" || !slices.Equal(s.Items, want) {
+		t.Errorf("projected Secret = %+v, want b with items %+v", s, want)
+	}
+	mounts := tmpl.Spec.Containers[0].VolumeMounts
+	if m := mounts[len(mounts)-1]; m.Name != v.Name || m.MountPath != caddy.ClientCertificatesPath || !m.ReadOnly {
+		t.Errorf("volume mount = %+v, want %s mounted read-only at %s", m, v.Name, caddy.ClientCertificatesPath)
+	}
+	hash := tmpl.Annotations[PodAnnotationClientCertificatesHash]
+	if hash == "" || tmpl.Annotations["example.com/owner"] != "team" {
+		t.Errorf("annotations = %v, want the client certificates hash and infrastructure annotations", tmpl.Annotations)
+	}
+	if _, ok := annotations[PodAnnotationClientCertificatesHash]; ok {
+		t.Errorf("shared annotations were modified")
+	}
+
+	// Rotating a certificate replaces the pods.
+	rotated := template(secret("a", "cert"), secret("b", "rotated"))
+	if rotated.Annotations[PodAnnotationClientCertificatesHash] == hash {
+		t.Errorf("hash didn't change when a certificate was rotated")
+	}
+	if !podSpecUpToDate(tmpl.Spec, rotated.Spec) {
+		t.Errorf("spec must not change when a certificate is rotated")
+	}
+
+	// Adding or removing a certificate changes the mounted Secrets.
+	if podSpecUpToDate(tmpl.Spec, template(secret("a", "cert")).Spec) {
+		t.Errorf("spec must change when a client certificate is removed")
+	}
+	if podSpecUpToDate(none.Spec, tmpl.Spec) {
+		t.Errorf("spec must change when client certificates are added")
+	}
+}
+
+func TestProvisionedAutoscalerSpec(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"}}
+	cpu := func(percent int32) autoscalingv2.MetricSpec {
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name:   corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: ptr.To(percent)},
+			},
+		}
+	}
+	rps := func(metric, value string) autoscalingv2.MetricSpec {
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{Name: metric},
+				Target: autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: ptr.To(resource.MustParse(value))},
+			},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		autoscaling     *v1alpha1.CaddyGatewayAutoscaling
+		wantMinReplicas int32
+		wantMetrics     []autoscalingv2.MetricSpec
+	}{
+		{
+			name:            "defaults",
+			autoscaling:     &v1alpha1.CaddyGatewayAutoscaling{MaxReplicas: 5},
+			wantMinReplicas: 1,
+			wantMetrics:     []autoscalingv2.MetricSpec{cpu(80)},
+		},
+		{
+			name: "cpu",
+			autoscaling: &v1alpha1.CaddyGatewayAutoscaling{
+				MinReplicas:                    ptr.To[int32](2),
+				MaxReplicas:                    5,
+				TargetCPUUtilizationPercentage: ptr.To[int32](60),
+			},
+			wantMinReplicas: 2,
+			wantMetrics:     []autoscalingv2.MetricSpec{cpu(60)},
+		},
+		{
+			name: "requests per second",
+			autoscaling: &v1alpha1.CaddyGatewayAutoscaling{
+				MaxReplicas:             5,
+				TargetRequestsPerSecond: ptr.To(resource.MustParse("500")),
+			},
+			wantMinReplicas: 1,
+			wantMetrics:     []autoscalingv2.MetricSpec{rps("caddy_http_requests_per_second", "500")},
+		},
+		{
+			name: "cpu and requests per second",
+			autoscaling: &v1alpha1.CaddyGatewayAutoscaling{
+				MaxReplicas:                    5,
+				TargetCPUUtilizationPercentage: ptr.To[int32](70),
+				TargetRequestsPerSecond:        ptr.To(resource.MustParse("1k")),
+				RequestsPerSecondMetric:        "caddy_rps",
+			},
+			wantMinReplicas: 1,
+			wantMetrics:     []autoscalingv2.MetricSpec{cpu(70), rps("caddy_rps", "1k")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := provisionedAutoscalerSpec(gw, tt.autoscaling)
+			wantRef := autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "gateway-caddy"}
+			if spec.ScaleTargetRef != wantRef {
+				t.Errorf("scaleTargetRef = %+v, want %+v", spec.ScaleTargetRef, wantRef)
+			}
+			if ptr.Deref(spec.MinReplicas, 0) != tt.wantMinReplicas || spec.MaxReplicas != tt.autoscaling.MaxReplicas {
+				t.Errorf("replicas = %v-%d, want %d-%d", ptr.Deref(spec.MinReplicas, 0), spec.MaxReplicas, tt.wantMinReplicas, tt.autoscaling.MaxReplicas)
+			}
+			if !equality.Semantic.DeepEqual(spec.Metrics, tt.wantMetrics) {
+				t.Errorf("metrics = %+v, want %+v", spec.Metrics, tt.wantMetrics)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;update;patch
+
+const (
+	// GatewayAnnotationServiceType is an annotation on a Gateway used to choose
+	// the type of the Service used to expose the Gateway, either `LoadBalancer`
+	// (the default), `NodePort` or `ClusterIP`.
+	GatewayAnnotationServiceType = string(gateway.ControllerDomain) + "/service-type"
+
+	// serviceAnnotationDefaultType is an annotation on a Gateway's Service
+	// recording its type before it was changed by the controller, so it can be
+	// restored once the Gateway no longer requests another type.
+	serviceAnnotationDefaultType = string(gateway.ControllerDomain) + "/default-service-type"
+
+	// GatewayConditionExposure is a condition on a Gateway used to report how
+	// the Gateway is being exposed, the reason will be the type of the Service.
+	GatewayConditionExposure = string(gateway.ControllerDomain) + "/Exposure"
+)
+
+// reconcileServiceExposure applies the requested Service type and any
+// infrastructure labels and annotations from the Gateway to the Gateway's
+// Service, returning the type the Service is exposed with.
+//
+// Infrastructure annotations allow cloud-specific behaviour to be configured,
+// like requesting an internal load balancer.
+func (r *GatewayReconciler) reconcileServiceExposure(ctx context.Context, gw *gatewayv1.Gateway) (corev1.ServiceType, error) {
+	svc, err := r.getService(ctx, gw)
+	if err != nil {
+		return "", err
+	}
+
+	// The default type is the type of the Service before the controller
+	// changed it, provisioned Services are created as a ClusterIP to avoid
+	// creating a load balancer that isn't wanted so are exposed with a
+	// LoadBalancer by default.
+	defaultType := corev1.ServiceType(svc.Annotations[serviceAnnotationDefaultType])
+	if defaultType == "" {
+		defaultType = svc.Spec.Type
+		if metav1.IsControlledBy(svc, gw) {
+			defaultType = corev1.ServiceTypeLoadBalancer
+		}
+	}
+	serviceType := defaultType
+	if v, ok := gw.Annotations[GatewayAnnotationServiceType]; ok {
+		switch t := corev1.ServiceType(v); t {
+		case corev1.ServiceTypeLoadBalancer, corev1.ServiceTypeNodePort, corev1.ServiceTypeClusterIP:
+			serviceType = t
+		default:
+			return svc.Spec.Type, fmt.Errorf("unsupported service type %q", v)
+		}
+	}
+	if isHostNetwork(gw) {
+		// Host network Gateways are reached using the addresses of the
+		// nodes, so the Service is only used to discover Caddy instances.
+		serviceType = corev1.ServiceTypeClusterIP
+	}
+
+	desired := svc.DeepCopy()
+	setServiceType(&desired.Spec, serviceType)
+	if serviceType != defaultType {
+		if desired.Annotations == nil {
+			desired.Annotations = map[string]string{}
+		}
+		desired.Annotations[serviceAnnotationDefaultType] = string(defaultType)
+	} else {
+		delete(desired.Annotations, serviceAnnotationDefaultType)
+	}
+	labels, annotations := infrastructureMetadata(gw)
+	applyMetadata(&desired.ObjectMeta, labels, annotations)
+	// Never allow the infrastructure labels to disown the Service.
+	if owner, ok := svc.Labels[owningGatewayLabel]; ok {
+		desired.Labels[owningGatewayLabel] = owner
+	} else {
+		delete(desired.Labels, owningGatewayLabel)
+	}
+
+	if equality.Semantic.DeepEqual(svc, desired) {
+		return svc.Spec.Type, nil
+	}
+	if err := r.Client.Update(ctx, desired); err != nil {
+		return svc.Spec.Type, err
+	}
+	return desired.Spec.Type, nil
+}
+
+// setServiceType changes the type of a Service, clearing the fields the API
+// server rejects for the new type (e.g. the node ports of a ClusterIP).
+func setServiceType(spec *corev1.ServiceSpec, t corev1.ServiceType) {
+	if spec.Type == t {
+		return
+	}
+	spec.Type = t
+	if t == corev1.ServiceTypeLoadBalancer {
+		return
+	}
+	spec.AllocateLoadBalancerNodePorts = nil
+	spec.LoadBalancerClass = nil
+	spec.LoadBalancerSourceRanges = nil
+	spec.HealthCheckNodePort = 0
+	if t == corev1.ServiceTypeNodePort {
+		return
+	}
+	spec.ExternalTrafficPolicy = ""
+	for n := range spec.Ports {
+		spec.Ports[n].NodePort = 0
+	}
+}
@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// newGatewayService returns a LoadBalancer Service for the Gateway, with the
+// fields set by the API server for a LoadBalancer.
+func newGatewayService(gw *gatewayv1.Gateway) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: gw.Namespace,
+			Name:      gw.Name,
+			Labels:    map[string]string{owningGatewayLabel: gw.Name},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                          corev1.ServiceTypeLoadBalancer,
+			ClusterIP:                     "10.0.0.2",
+			ExternalTrafficPolicy:         corev1.ServiceExternalTrafficPolicyLocal,
+			HealthCheckNodePort:           32000,
+			AllocateLoadBalancerNodePorts: ptr.To(true),
+			Ports:                         []corev1.ServicePort{{Name: "tcp-80", Port: 80, NodePort: 30080}},
+		},
+	}
+}
+
+func TestReconcileServiceExposure(t *testing.T) {
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway", UID: types.UID("gateway")},
+	}
+	withAnnotations := func(annotations map[string]string) *gatewayv1.Gateway {
+		gw := gw.DeepCopy()
+		gw.Annotations = annotations
+		return gw
+	}
+	getService := func(t *testing.T, r *GatewayReconciler) *corev1.Service {
+		t.Helper()
+		svc, err := r.getService(context.Background(), gw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return svc
+	}
+
+	t.Run("downgrade and restore", func(t *testing.T) {
+		r := &GatewayReconciler{Client: newTestClientWith(newGatewayService(gw))}
+		clusterIP := withAnnotations(map[string]string{GatewayAnnotationServiceType: "ClusterIP"})
+		if got, err := r.reconcileServiceExposure(context.Background(), clusterIP); err != nil || got != corev1.ServiceTypeClusterIP {
+			t.Fatalf("reconcileServiceExposure() = %q, %v, want ClusterIP", got, err)
+		}
+		svc := getService(t, r)
+		if svc.Spec.Type != corev1.ServiceTypeClusterIP {
+			t.Errorf("type = %q, want ClusterIP", svc.Spec.Type)
+		}
+		if svc.Spec.Ports[0].NodePort != 0 || svc.Spec.ExternalTrafficPolicy != "" ||
+			svc.Spec.HealthCheckNodePort != 0 || svc.Spec.AllocateLoadBalancerNodePorts != nil {
+			t.Errorf("fields invalid for a ClusterIP weren't cleared: %+v", svc.Spec)
+		}
+		if got := svc.Annotations[serviceAnnotationDefaultType]; got != "LoadBalancer" {
+			t.Errorf("default type annotation = %q, want LoadBalancer", got)
+		}
+
+		if got, err := r.reconcileServiceExposure(context.Background(), gw); err != nil || got != corev1.ServiceTypeLoadBalancer {
+			t.Fatalf("reconcileServiceExposure() = %q, %v, want LoadBalancer", got, err)
+		}
+		svc = getService(t, r)
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			t.Errorf("type = %q, want LoadBalancer once the annotation is removed", svc.Spec.Type)
+		}
+		if _, ok := svc.Annotations[serviceAnnotationDefaultType]; ok {
+			t.Errorf("default type annotation wasn't removed")
+		}
+	})
+
+	t.Run("node port", func(t *testing.T) {
+		r := &GatewayReconciler{Client: newTestClientWith(newGatewayService(gw))}
+		nodePort := withAnnotations(map[string]string{GatewayAnnotationServiceType: "NodePort"})
+		if _, err := r.reconcileServiceExposure(context.Background(), nodePort); err != nil {
+			t.Fatal(err)
+		}
+		svc := getService(t, r)
+		if svc.Spec.Ports[0].NodePort != 30080 || svc.Spec.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyLocal {
+			t.Errorf("node port and external traffic policy must be kept for a NodePort: %+v", svc.Spec)
+		}
+		if svc.Spec.HealthCheckNodePort != 0 || svc.Spec.AllocateLoadBalancerNodePorts != nil {
+			t.Errorf("fields invalid for a NodePort weren't cleared: %+v", svc.Spec)
+		}
+	})
+
+	t.Run("unowned default", func(t *testing.T) {
+		svc := newGatewayService(gw)
+		svc.Spec = corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.0.0.2"}
+		r := &GatewayReconciler{Client: newTestClientWith(svc)}
+		if got, err := r.reconcileServiceExposure(context.Background(), gw); err != nil || got != corev1.ServiceTypeClusterIP {
+			t.Errorf("reconcileServiceExposure() = %q, %v, want the existing ClusterIP", got, err)
+		}
+	})
+
+	t.Run("provisioned default", func(t *testing.T) {
+		svc := newGatewayService(gw)
+		svc.Spec = corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.0.0.2"}
+		svc.OwnerReferences = []metav1.OwnerReference{{Name: gw.Name, UID: gw.UID, Controller: ptr.To(true)}}
+		r := &GatewayReconciler{Client: newTestClientWith(svc)}
+		if got, err := r.reconcileServiceExposure(context.Background(), gw); err != nil || got != corev1.ServiceTypeLoadBalancer {
+			t.Errorf("reconcileServiceExposure() = %q, %v, want LoadBalancer", got, err)
+		}
+	})
+
+	t.Run("host network", func(t *testing.T) {
+		r := &GatewayReconciler{Client: newTestClientWith(newGatewayService(gw))}
+		hostNetwork := withAnnotations(map[string]string{GatewayAnnotationHostNetwork: "true"})
+		if got, err := r.reconcileServiceExposure(context.Background(), hostNetwork); err != nil || got != corev1.ServiceTypeClusterIP {
+			t.Fatalf("reconcileServiceExposure() = %q, %v, want ClusterIP", got, err)
+		}
+		if svc := getService(t, r); svc.Spec.Ports[0].NodePort != 0 {
+			t.Errorf("node port = %d, want it cleared", svc.Spec.Ports[0].NodePort)
+		}
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		r := &GatewayReconciler{Client: newTestClientWith(newGatewayService(gw))}
+		externalName := withAnnotations(map[string]string{GatewayAnnotationServiceType: "ExternalName"})
+		if _, err := r.reconcileServiceExposure(context.Background(), externalName); err == nil {
+			t.Errorf("reconcileServiceExposure() succeeded for an unsupported type")
+		}
+	})
+
+	t.Run("infrastructure metadata", func(t *testing.T) {
+		r := &GatewayReconciler{Client: newTestClientWith(newGatewayService(gw))}
+		gw := gw.DeepCopy()
+		gw.Spec.Infrastructure = &gatewayv1.GatewayInfrastructure{
+			Labels:      map[gatewayv1.AnnotationKey]gatewayv1.AnnotationValue{owningGatewayLabel: "other", "team": "a"},
+			Annotations: map[gatewayv1.AnnotationKey]gatewayv1.AnnotationValue{"example.com/internal": "true"},
+		}
+		if _, err := r.reconcileServiceExposure(context.Background(), gw); err != nil {
+			t.Fatal(err)
+		}
+		svc := getService(t, r)
+		if svc.Labels[owningGatewayLabel] != gw.Name || svc.Labels["team"] != "a" || svc.Annotations["example.com/internal"] != "true" {
+			t.Errorf("metadata = %v, %v, want the infrastructure metadata without disowning the Service", svc.Labels, svc.Annotations)
+		}
+
+		// Metadata removed from the infrastructure is removed from the
+		// Service, but not metadata set by others.
+		svc.Labels["other"] = "b"
+		if err := r.Client.Update(context.Background(), svc); err != nil {
+			t.Fatal(err)
+		}
+		gw.Spec.Infrastructure = nil
+		if _, err := r.reconcileServiceExposure(context.Background(), gw); err != nil {
+			t.Fatal(err)
+		}
+		svc = getService(t, r)
+		if _, ok := svc.Labels["team"]; ok {
+			t.Errorf("labels = %v, want the removed infrastructure label removed", svc.Labels)
+		}
+		if _, ok := svc.Annotations["example.com/internal"]; ok {
+			t.Errorf("annotations = %v, want the removed infrastructure annotation removed", svc.Annotations)
+		}
+		if svc.Labels[owningGatewayLabel] != gw.Name || svc.Labels["other"] != "b" {
+			t.Errorf("labels = %v, want the owning Gateway and other labels kept", svc.Labels)
+		}
+	})
+}
@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=create;delete;get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=create;delete
+
+const (
+	// validationConfigKey is the key of the config in the validation Secret.
+	validationConfigKey = "caddy.json"
+
+	// validationPollInterval is how often a Gateway is reconciled while its
+	// config is being validated, in case the Job's events are missed.
+	validationPollInterval = 5 * time.Second
+
+	// validationDeadline is how long a validation Job may run for.
+	validationDeadline = 2 * time.Minute
+
+	// validationJobTTL is how long a finished validation Job is kept for, in
+	// case the controller doesn't delete it once its result is known.
+	validationJobTTL = 5 * time.Minute
+
+	// validationLabel marks the Jobs and Secrets validating the configs of a
+	// Gateway, so those validating superseded configs can be deleted.
+	validationLabel = "gateway.caddyserver.com/config-validation"
+)
+
+// configValidationError is returned when Caddy rejects a config during
+// validation.
+type configValidationError struct {
+	Message string
+}
+
+func (e *configValidationError) Error() string {
+	return "config failed validation: " + e.Message
+}
+
+type validationResult struct {
+	hash [sha256.Size]byte
+	err  error
+}
+
+// validatedConfigs remembers the result of validating the last config of each
+// Gateway, so the same config is only validated once.
+type validatedConfigs struct {
+	mu      sync.Mutex
+	results map[types.NamespacedName]validationResult
+}
+
+func (v *validatedConfigs) get(gw types.NamespacedName, hash [sha256.Size]byte) (error, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	res, ok := v.results[gw]
+	if !ok || res.hash != hash {
+		return nil, false
+	}
+	return res.err, true
+}
+
+func (v *validatedConfigs) set(gw types.NamespacedName, hash [sha256.Size]byte, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.results == nil {
+		v.results = map[types.NamespacedName]validationResult{}
+	}
+	v.results[gw] = validationResult{hash: hash, err: err}
+}
+
+// validateConfig validates a config by running `caddy validate` against it in
+// a Job, before it is pushed to any Caddy instance. This protects every
+// listener of the Gateway from being taken down by a config that Caddy
+// rejects, e.g. due to a bug in the controller.
+//
+// done is false while the Job is still running. A *configValidationError is
+// returned if Caddy rejected the config.
+func (r *GatewayReconciler) validateConfig(ctx context.Context, gw *gatewayv1.Gateway, b []byte) (done bool, err error) {
+	key := client.ObjectKeyFromObject(gw)
+	hash := sha256.Sum256(b)
+	if err, ok := r.validated.get(key, hash); ok {
+		return true, err
+	}
+
+	name := validationJobName(gw, hash)
+	job := &batchv1.Job{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: gw.Namespace, Name: name}, job); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		// Only the latest config of a Gateway is validated, any Jobs still
+		// validating superseded configs are no longer needed.
+		if err := r.deleteStaleValidations(ctx, gw, name); err != nil {
+			return false, err
+		}
+		return false, r.createValidationJob(ctx, gw, name, b)
+	}
+
+	var result error
+	switch {
+	case hasJobCondition(job, batchv1.JobComplete):
+	case hasJobCondition(job, batchv1.JobFailed):
+		result = &configValidationError{Message: r.getValidationFailure(ctx, job)}
+	default:
+		return false, nil
+	}
+	r.validated.set(key, hash, result)
+
+	// Clean up now the result is known, the Job's TTL acts as a fallback.
+	if err := r.deleteValidation(ctx, gw.Namespace, name); err != nil {
+		return true, err
+	}
+	return true, result
+}
+
+// deleteStaleValidations deletes the validation Jobs and Secrets of a Gateway
+// other than the named one, which validate configs that have been superseded.
+func (r *GatewayReconciler) deleteStaleValidations(ctx context.Context, gw *gatewayv1.Gateway, name string) error {
+	labels := client.MatchingLabels{owningGatewayLabel: gw.Name, validationLabel: "true"}
+	stale := map[string]struct{}{}
+
+	jobList := &batchv1.JobList{}
+	if err := r.Client.List(ctx, jobList, client.InNamespace(gw.Namespace), labels); err != nil {
+		return err
+	}
+	for _, job := range jobList.Items {
+		stale[job.Name] = struct{}{}
+	}
+	// Secrets may not be cached, see --cache-tls-secrets-only, and outlive
+	// their Job if it was deleted by its TTL.
+	reader := r.apiReader
+	if reader == nil {
+		reader = r.Client
+	}
+	secretList := &corev1.SecretList{}
+	if err := reader.List(ctx, secretList, client.InNamespace(gw.Namespace), labels); err != nil {
+		return err
+	}
+	for _, secret := range secretList.Items {
+		stale[secret.Name] = struct{}{}
+	}
+
+	delete(stale, name)
+	for n := range stale {
+		if err := r.deleteValidation(ctx, gw.Namespace, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteValidation deletes a validation Job and its Secret.
+func (r *GatewayReconciler) deleteValidation(ctx context.Context, namespace, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	if err := r.Client.Delete(ctx, job, &client.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	if err := r.Client.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// createValidationJob creates a Secret containing the config and a Job
+// validating it. The config contains private keys, so it must be stored in a
+// Secret rather than a ConfigMap.
+func (r *GatewayReconciler) createValidationJob(ctx context.Context, gw *gatewayv1.Gateway, name string, b []byte) error {
+	labels := map[string]string{owningGatewayLabel: gw.Name, validationLabel: "true"}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: gw.Namespace,
+			Name:      name,
+			Labels:    labels,
+		},
+		Data: map[string][]byte{validationConfigKey: b},
+	}
+	if err := controllerutil.SetControllerReference(gw, secret, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Client.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	var (
+		backoffLimit int32 = 0
+		ttl                = int32(validationJobTTL / time.Second)
+		deadline           = int64(validationDeadline / time.Second)
+	)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: gw.Namespace,
+			Name:      name,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			ActiveDeadlineSeconds:   &deadline,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:                corev1.RestartPolicyNever,
+					AutomountServiceAccountToken: new(bool),
+					Containers: []corev1.Container{
+						{
+							Name:    "validate",
+							Image:   r.ValidationImage,
+							Command: []string{"caddy", "validate", "--config", "/etc/caddy/" + validationConfigKey},
+							// Surface why validation failed in the pod's status.
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "config", MountPath: "/etc/caddy", ReadOnly: true},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "config",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{SecretName: name},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if err := controllerutil.SetControllerReference(gw, job, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Client.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// getValidationFailure returns why a validation Job failed, using the
+// termination message of its pod, which falls back to the end of its logs.
+func (r *GatewayReconciler) getValidationFailure(ctx context.Context, job *batchv1.Job) string {
+	// Only the metadata of pods is cached, so their statuses are read from the
+	// API server.
+	reader := r.apiReader
+	if reader == nil {
+		reader = r.Client
+	}
+	podList := &corev1.PodList{}
+	if err := reader.List(ctx, podList, client.InNamespace(job.Namespace), client.MatchingLabels{
+		"job-name": job.Name,
+	}); err == nil {
+		for _, pod := range podList.Items {
+			for _, cs := range pod.Status.ContainerStatuses {
+				if t := cs.State.Terminated; t != nil && t.Message != "" {
+					return strings.TrimSpace(t.Message)
+				}
+			}
+		}
+	}
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Message != "" {
+			return c.Message
+		}
+	}
+	return "caddy validate failed"
+}
+
+func hasJobCondition(job *batchv1.Job, t batchv1.JobConditionType) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == t && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// validationJobName returns the name of the Job validating a config, the hash
+// is included so a new Job is created whenever the config changes.
+func validationJobName(gw *gatewayv1.Gateway, hash [sha256.Size]byte) string {
+	name := gw.Name
+	// Job names are used in a label of its pods, so must fit in 63 characters.
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return strings.TrimSuffix(name, "-") + "-validate-" + hex.EncodeToString(hash[:4])
+}
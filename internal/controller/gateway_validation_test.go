@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestValidateConfigDeletesStaleValidations(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway", UID: "uid"}}
+	validation := func(gateway, name string) []client.Object {
+		meta := metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{owningGatewayLabel: gateway, validationLabel: "true"},
+		}
+		return []client.Object{&batchv1.Job{ObjectMeta: meta}, &corev1.Secret{ObjectMeta: meta}}
+	}
+
+	var objs []client.Object
+	objs = append(objs, validation("gateway", "gateway-validate-old")...)
+	objs = append(objs, validation("other", "other-validate-old")...)
+	objs = append(objs,
+		// The Secret of a validation whose Job was deleted by its TTL.
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "gateway-validate-expired",
+			Labels:    map[string]string{owningGatewayLabel: "gateway", validationLabel: "true"},
+		}},
+		// Other objects owned by the Gateway are kept.
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      publishedConfigName(gw),
+			Labels:    map[string]string{owningGatewayLabel: "gateway"},
+		}},
+	)
+	c := newTestClientWith(objs...)
+	r := &GatewayReconciler{Client: c, Scheme: newTestScheme(t), ValidationImage: "caddy"}
+
+	b := []byte(`{}`)
+	done, err := r.validateConfig(context.Background(), gw, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done {
+		t.Error("validation is done before the Job ran")
+	}
+
+	name := validationJobName(gw, sha256.Sum256(b))
+	exists := func(obj client.Object, name string) bool {
+		return c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, obj) == nil
+	}
+	job := &batchv1.Job{}
+	if !exists(job, name) || !exists(&corev1.Secret{}, name) {
+		t.Fatalf("validation Job and Secret %s weren't created", name)
+	}
+	if job.Spec.TTLSecondsAfterFinished == nil || *job.Spec.TTLSecondsAfterFinished <= 0 {
+		t.Errorf("TTL = %v, want the Job to be deleted once finished", job.Spec.TTLSecondsAfterFinished)
+	}
+	for _, name := range []string{"gateway-validate-old", "gateway-validate-expired"} {
+		if exists(&batchv1.Job{}, name) || exists(&corev1.Secret{}, name) {
+			t.Errorf("superseded validation %s wasn't deleted", name)
+		}
+	}
+	if !exists(&batchv1.Job{}, "other-validate-old") || !exists(&corev1.Secret{}, "other-validate-old") {
+		t.Error("validation of another Gateway was deleted")
+	}
+	if !exists(&corev1.Secret{}, publishedConfigName(gw)) {
+		t.Error("Secret of the Gateway that isn't used for validation was deleted")
+	}
+}
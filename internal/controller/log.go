@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+// Logging conventions used by all controllers.
+//
+// Reconcilers use the logger from the context, controller-runtime already
+// adds the kind, namespace and name of the object being reconciled to it, so
+// those must not be added again.
+//
+// Other objects are logged using the keys below, with a types.NamespacedName
+// (or just the name for cluster-scoped objects) as the value.
+const (
+	// logKeyResource is the object that triggered a watch event.
+	logKeyResource = "resource"
+	// logKeyGateway is a Gateway.
+	logKeyGateway = "gateway"
+	// logKeyGatewayClass is a GatewayClass.
+	logKeyGatewayClass = "gatewayClass"
+	// logKeyRoute is a route of any kind.
+	logKeyRoute = "route"
+)
+
+// Log verbosity levels, errors are always logged regardless of verbosity.
+const (
+	// logLevelDebug is used for the progress of individual reconciles, like
+	// programming each Caddy instance.
+	logLevelDebug = 1
+	// logLevelEnqueue is used for reconcile requests enqueued by watches,
+	// these are logged for every event so are extremely noisy.
+	logLevelEnqueue = 2
+	// logLevelTrace is used for objects that are ignored.
+	logLevelTrace = 3
+)
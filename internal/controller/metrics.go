@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+const metricsNamespace = "caddy_gateway"
+
+var (
+	configRoutes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_routes",
+		Help:      "Number of routes in the config generated for a Gateway listener.",
+	}, []string{"namespace", "gateway", "listener"})
+
+	configCertificates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_certificates",
+		Help:      "Number of certificates in the config generated for a Gateway listener.",
+	}, []string{"namespace", "gateway", "listener"})
+
+	configBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_bytes",
+		Help:      "Size of the config generated for a Gateway in bytes.",
+	}, []string{"namespace", "gateway"})
+
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "build_info",
+		Help:      "Build of the controller and the Gateway API it supports, always 1.",
+	}, []string{"version", "revision", "goversion", "gateway_api_version", "minimum_bundle_version"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(configRoutes, configCertificates, configBytes, buildInfo)
+
+	info := readBuildInfo()
+	buildInfo.WithLabelValues(info.Version, info.Revision, info.GoVersion, info.GatewayAPIVersion, info.MinimumBundleVersion).Set(1)
+}
+
+// recordConfigMetrics records the size of the config generated for a Gateway,
+// so operators can correlate the time it takes Caddy to load configs with
+// their growth.
+func recordConfigMetrics(gw types.NamespacedName, i *caddy.Input, config []byte) {
+	// Listeners may have been removed since the last config was generated.
+	forgetConfigMetrics(gw)
+	for name, s := range i.ListenerSummaries() {
+		configRoutes.WithLabelValues(gw.Namespace, gw.Name, string(name)).Set(float64(s.Routes))
+		configCertificates.WithLabelValues(gw.Namespace, gw.Name, string(name)).Set(float64(s.Certificates))
+	}
+	configBytes.WithLabelValues(gw.Namespace, gw.Name).Set(float64(len(config)))
+}
+
+// forgetConfigMetrics removes the metrics recorded for a Gateway.
+func forgetConfigMetrics(gw types.NamespacedName) {
+	labels := prometheus.Labels{"namespace": gw.Namespace, "gateway": gw.Name}
+	configRoutes.DeletePartialMatch(labels)
+	configCertificates.DeletePartialMatch(labels)
+	configBytes.DeletePartialMatch(labels)
+}
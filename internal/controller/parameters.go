@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	certificatesv1alpha1 "k8s.io/api/certificates/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=clustertrustbundles,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.caddyserver.com,resources=caddygatewayconfigs,verbs=get;list;watch
+
+// caddyGatewayConfigGVK is the kind of CaddyGatewayConfig, which may not be
+// installed.
+var caddyGatewayConfigGVK = v1alpha1.GroupVersion.WithKind("CaddyGatewayConfig")
+
+// getGatewayClassParameters returns the parsed parameters of the GatewayClass,
+// or nil if it doesn't reference any.
+//
+// Parameters must be a ConfigMap, see caddy.ParseParameters for the supported
+// keys, or a CaddyGatewayConfig.
+func getGatewayClassParameters(ctx context.Context, c client.Client, gwc *gatewayv1.GatewayClass) (*caddy.Parameters, error) {
+	ref := gwc.Spec.ParametersRef
+	if ref == nil {
+		return nil, nil
+	}
+	switch {
+	case isParametersConfigMap(ref):
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: string(*ref.Namespace), Name: ref.Name}, cm); err != nil {
+			return nil, fmt.Errorf("unable to get parameters: %w", err)
+		}
+		return caddy.ParseParameters(cm.Data)
+	case isParametersCaddyGatewayConfig(ref):
+		cfg := &v1alpha1.CaddyGatewayConfig{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: string(*ref.Namespace), Name: ref.Name}, cfg); err != nil {
+			if meta.IsNoMatchError(err) {
+				return nil, fmt.Errorf("unable to get parameters: the CaddyGatewayConfig CRD is not installed")
+			}
+			return nil, fmt.Errorf("unable to get parameters: %w", err)
+		}
+		return caddy.ParametersFromConfig(cfg.Spec)
+	}
+	return nil, fmt.Errorf("unsupported parametersRef %s/%s, only namespaced ConfigMaps and CaddyGatewayConfigs are supported", ref.Group, ref.Kind)
+}
+
+// isParametersConfigMap returns true if the parametersRef references a
+// ConfigMap.
+func isParametersConfigMap(ref *gatewayv1.ParametersReference) bool {
+	return ref.Group == "" && ref.Kind == "ConfigMap" && ref.Namespace != nil
+}
+
+// isParametersCaddyGatewayConfig returns true if the parametersRef references
+// a CaddyGatewayConfig.
+func isParametersCaddyGatewayConfig(ref *gatewayv1.ParametersReference) bool {
+	return string(ref.Group) == caddyGatewayConfigGVK.Group && string(ref.Kind) == caddyGatewayConfigGVK.Kind && ref.Namespace != nil
+}
+
+// isParametersObject returns true if the parametersRef references obj.
+func isParametersObject(ref *gatewayv1.ParametersReference, obj client.Object) bool {
+	if ref.Namespace == nil || string(*ref.Namespace) != obj.GetNamespace() || ref.Name != obj.GetName() {
+		return false
+	}
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		return isParametersConfigMap(ref)
+	case *v1alpha1.CaddyGatewayConfig:
+		return isParametersCaddyGatewayConfig(ref)
+	}
+	return false
+}
+
+// getGatewayClassesForParameters returns the names of all GatewayClasses of
+// ours that reference the given object as their parameters, or whose
+// parameters reference it (or a ClusterTrustBundle) as their backend CA
+// certificates.
+func getGatewayClassesForParameters(ctx context.Context, c client.Client, obj client.Object) []string {
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(obj))
+
+	gwcList := &gatewayv1.GatewayClassList{}
+	if err := c.List(ctx, gwcList); err != nil {
+		log.Error(err, "Unable to list GatewayClasses")
+		return nil
+	}
+	var names []string
+	for _, gwc := range gwcList.Items {
+		if !gateway.IsManagedGatewayClass(&gwc) {
+			continue
+		}
+		ref := gwc.Spec.ParametersRef
+		if ref == nil {
+			continue
+		}
+		if isParametersObject(ref, obj) {
+			names = append(names, gwc.Name)
+			continue
+		}
+		params, err := getGatewayClassParameters(ctx, c, &gwc)
+		if err != nil || params == nil {
+			continue
+		}
+		if params.BackendCACertificates == client.ObjectKeyFromObject(obj) {
+			names = append(names, gwc.Name)
+			continue
+		}
+		if _, ok := obj.(*certificatesv1alpha1.ClusterTrustBundle); ok && params.BackendClusterTrustBundle == obj.GetName() {
+			names = append(names, gwc.Name)
+		}
+	}
+	return names
+}
+
+// getGatewaysForParameters returns all Gateways using a GatewayClass that
+// references the given object as its parameters.
+func getGatewaysForParameters(ctx context.Context, c client.Client, obj client.Object) []types.NamespacedName {
+	log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(obj))
+
+	classes := getGatewayClassesForParameters(ctx, c, obj)
+	if len(classes) == 0 {
+		return nil
+	}
+	gwList := &gatewayv1.GatewayList{}
+	if err := c.List(ctx, gwList); err != nil {
+		log.Error(err, "Unable to list Gateways")
+		return nil
+	}
+	var gateways []types.NamespacedName
+	for _, gw := range gwList.Items {
+		for _, name := range classes {
+			if string(gw.Spec.GatewayClassName) == name {
+				gateways = append(gateways, client.ObjectKeyFromObject(&gw))
+				break
+			}
+		}
+	}
+	return gateways
+}
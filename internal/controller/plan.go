@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+// Plan generates the config for every Gateway managed by the controller and
+// writes the difference between it and the config currently served by each of
+// the Gateway's Caddy instances to w, without programming anything.
+//
+// changed is true if any Caddy instance would be re-programmed, or couldn't be
+// queried for its current config.
+func (r *GatewayReconciler) Plan(ctx context.Context, w io.Writer) (changed bool, err error) {
+	switch r.ConfigPublisher {
+	case "", ConfigPublisherAdminAPI:
+	default:
+		return false, fmt.Errorf("plan is not supported with the %q config publisher", r.ConfigPublisher)
+	}
+	if r.tlsConfig == nil {
+		if err := r.setupTLS(r.Client); err != nil {
+			return false, err
+		}
+	}
+
+	gwList := &gatewayv1.GatewayList{}
+	if err := r.Client.List(ctx, gwList); err != nil {
+		return false, err
+	}
+	slices.SortFunc(gwList.Items, func(a, b gatewayv1.Gateway) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+
+	for n := range gwList.Items {
+		gw := &gwList.Items[n]
+		if gw.DeletionTimestamp != nil {
+			continue
+		}
+		gwc := &gatewayv1.GatewayClass{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: string(gw.Spec.GatewayClassName)}, gwc); err != nil {
+			return changed, fmt.Errorf("unable to get GatewayClass for Gateway %s/%s: %w", gw.Namespace, gw.Name, err)
+		}
+		if !gateway.IsManagedGatewayClass(gwc) {
+			continue
+		}
+
+		fmt.Fprintf(w, "Gateway %s/%s (GatewayClass %s)\n", gw.Namespace, gw.Name, gwc.Name)
+		if c := meta.FindStatusCondition(gwc.Status.Conditions, string(gatewayv1.GatewayClassConditionStatusAccepted)); c == nil || c.Status != metav1.ConditionTrue {
+			fmt.Fprintf(w, "  skipped, GatewayClass isn't Accepted\n\n")
+			continue
+		}
+		gwChanged, err := r.planGateway(ctx, w, gw, gwc)
+		if err != nil {
+			return changed, fmt.Errorf("unable to plan Gateway %s/%s: %w", gw.Namespace, gw.Name, err)
+		}
+		changed = changed || gwChanged
+		fmt.Fprintln(w)
+	}
+	return changed, nil
+}
+
+// planGateway writes the difference between the generated config for a Gateway
+// and the config served by each of its Caddy instances to w.
+func (r *GatewayReconciler) planGateway(ctx context.Context, w io.Writer, gw *gatewayv1.Gateway, gwc *gatewayv1.GatewayClass) (bool, error) {
+	programmingPort := r.ProgrammingPort
+	if programmingPort == 0 {
+		programmingPort = defaultProgrammingPort
+	}
+
+	i, err := r.newInput(ctx, gw, gwc)
+	if err != nil {
+		return false, err
+	}
+	desired, err := i.Config()
+	if err != nil {
+		return false, err
+	}
+
+	endpointSlices, err := r.getEndpointSlices(ctx, gw)
+	if err != nil {
+		fmt.Fprintf(w, "  unable to find Caddy instances: %v\n", err)
+		return false, nil
+	}
+	instances := getCaddyInstances(endpointSlices)
+	if len(instances) < 1 {
+		fmt.Fprintf(w, "  no Caddy instances found\n")
+		return false, nil
+	}
+
+	// Instances being drained are programmed with their own config, so they
+	// must be compared against it instead.
+	draining, err := r.getDrainingPods(ctx, instances)
+	if err != nil {
+		return false, err
+	}
+	var drainDesired []byte
+	if len(draining) > 0 {
+		i.Draining = true
+		drainDesired, err = i.Config()
+		i.Draining = false
+		if err != nil {
+			return false, err
+		}
+	}
+
+	var changed bool
+	for _, a := range instances {
+		want := desired
+		if _, ok := draining[a.TargetRef.UID]; ok {
+			want = drainDesired
+		}
+		target := client.ObjectKey{
+			Namespace: a.TargetRef.Namespace,
+			Name:      a.TargetRef.Name,
+		}
+
+		tlsConfig := r.tlsConfig.Clone()
+		tlsConfig.ServerName = target.Name + "." + target.Namespace
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = tlsConfig
+		httpClient := &http.Client{Transport: tr}
+
+		baseURL := "https://" + net.JoinHostPort(a.IP, strconv.Itoa(programmingPort))
+		current, err := getCaddyConfig(ctx, httpClient, baseURL+"/config/")
+		tr.CloseIdleConnections()
+		if err != nil {
+			fmt.Fprintf(w, "  %s (%s): unable to get current config: %v\n", target, a.IP, err)
+			changed = true
+			continue
+		}
+		diff, err := diffCaddyConfigs(current, want)
+		if err != nil {
+			return changed, err
+		}
+		if diff == "" {
+			fmt.Fprintf(w, "  %s (%s): no changes\n", target, a.IP)
+			continue
+		}
+		changed = true
+		fmt.Fprintf(w, "  %s (%s): changes (-current +desired):\n", target, a.IP)
+		for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+	return changed, nil
+}
+
+// diffCaddyConfigs returns a human-readable diff between two JSON configs, or
+// an empty string if they are semantically equal.
+func diffCaddyConfigs(current, desired []byte) (string, error) {
+	var a, b any
+	// Caddy responds with `null` when it isn't serving a config yet.
+	if err := json.Unmarshal(current, &a); err != nil {
+		return "", fmt.Errorf("unable to parse current config: %w", err)
+	}
+	if err := json.Unmarshal(desired, &b); err != nil {
+		return "", fmt.Errorf("unable to parse desired config: %w", err)
+	}
+	return cmp.Diff(a, b), nil
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// programmedStateTTL is how long an instance is assumed to still be running
+// the config it was last programmed with. Once it expires the instance is
+// programmed again, in case Caddy lost its config without the instance ever
+// becoming unready (e.g. a quick restart of the container).
+const programmedStateTTL = 10 * time.Minute
+
+// programmedKey identifies a Caddy instance serving a Gateway.
+type programmedKey struct {
+	Gateway types.NamespacedName
+	Pod     types.UID
+}
+
+// programmedHashes are the hashes of the config an instance was programmed
+// with. The TLS app is hashed separately, so instances whose config only
+// differs by their TLS app can be sent just the new TLS app.
+type programmedHashes struct {
+	Config [sha256.Size]byte
+	TLS    [sha256.Size]byte
+}
+
+// programmedConfig is a generated config to program instances with.
+type programmedConfig struct {
+	body   []byte
+	tls    []byte
+	hashes programmedHashes
+}
+
+func newProgrammedConfig(b []byte) (programmedConfig, error) {
+	base, tls, err := splitTLSApp(b)
+	if err != nil {
+		return programmedConfig{}, err
+	}
+	c := programmedConfig{
+		body: b,
+		tls:  tls,
+		hashes: programmedHashes{
+			Config: sha256.Sum256(base),
+		},
+	}
+	if tls != nil {
+		c.hashes.TLS = sha256.Sum256(tls)
+	}
+	return c, nil
+}
+
+type programmedInstance struct {
+	hashes programmedHashes
+	at     time.Time
+}
+
+// programmedState tracks the config each Caddy instance was last programmed
+// with, so reconciles only need to program instances that aren't already
+// running the generated config, like a newly added pod.
+type programmedState struct {
+	mu        sync.Mutex
+	instances map[programmedKey]programmedInstance
+}
+
+// isProgrammed reports whether the instance is known to be running the config
+// with the given hashes.
+func (s *programmedState) isProgrammed(key programmedKey, hashes programmedHashes) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.instances[key]
+	return ok && p.hashes == hashes && time.Since(p.at) < programmedStateTTL
+}
+
+// onlyTLSChanged reports whether the instance is known to be running a config
+// that only differs from the config with the given hashes by its TLS app.
+func (s *programmedState) onlyTLSChanged(key programmedKey, hashes programmedHashes) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.instances[key]
+	return ok && p.hashes.Config == hashes.Config && p.hashes.TLS != hashes.TLS && time.Since(p.at) < programmedStateTTL
+}
+
+// programmed records that the instance was programmed with the config with the
+// given hashes.
+func (s *programmedState) programmed(key programmedKey, hashes programmedHashes) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.instances == nil {
+		s.instances = map[programmedKey]programmedInstance{}
+	}
+	s.instances[key] = programmedInstance{hashes: hashes, at: time.Now()}
+}
+
+// forget removes any state for the instance, so it will be programmed on the
+// next reconcile.
+func (s *programmedState) forget(key programmedKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.instances, key)
+}
+
+// retain removes the state of every instance of the Gateway that is no longer
+// ready. Instances that become unready may be restarted and lose their
+// config, so they must be programmed again once they are ready.
+func (s *programmedState) retain(gw types.NamespacedName, ready map[programmedKey]struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.instances {
+		if key.Gateway != gw {
+			continue
+		}
+		if _, ok := ready[key]; !ok {
+			delete(s.instances, key)
+		}
+	}
+}
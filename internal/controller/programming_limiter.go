@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// programmingLimiter limits how many Caddy instances are programmed at once
+// across every Gateway, while sharing the limit fairly between Gateways.
+//
+// Each Gateway that is programming instances may only use its share of the
+// limit, so a Gateway with thousands of instances can't starve a Gateway with
+// only a few of them. Shares are recalculated as Gateways start and finish
+// programming, so a single Gateway can still use the entire limit.
+type programmingLimiter struct {
+	limit int
+
+	mu sync.Mutex
+	// wake is closed, and replaced, whenever a slot may have become
+	// available.
+	wake     chan struct{}
+	inFlight int
+	gateways map[types.NamespacedName]*programmingGateway
+}
+
+type programmingGateway struct {
+	waiting  int
+	inFlight int
+}
+
+// newProgrammingLimiter returns a limiter allowing up to limit instances to be
+// programmed at once, a limit of zero or less is unlimited.
+func newProgrammingLimiter(limit int) *programmingLimiter {
+	return &programmingLimiter{
+		limit:    limit,
+		wake:     make(chan struct{}),
+		gateways: map[types.NamespacedName]*programmingGateway{},
+	}
+}
+
+// acquire blocks until an instance of the Gateway may be programmed, or ctx is
+// done. release must be called once the instance has been programmed, unless
+// an error is returned.
+func (l *programmingLimiter) acquire(ctx context.Context, gw types.NamespacedName) error {
+	if l == nil || l.limit <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g, ok := l.gateways[gw]
+	if !ok {
+		g = &programmingGateway{}
+		l.gateways[gw] = g
+	}
+	g.waiting++
+	for l.inFlight >= l.limit || g.inFlight >= l.share() {
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+			l.mu.Lock()
+		case <-ctx.Done():
+			l.mu.Lock()
+			g.waiting--
+			if g.inFlight == 0 && g.waiting == 0 {
+				// The shares of other Gateways grow now this one is gone.
+				delete(l.gateways, gw)
+				l.broadcast()
+			}
+			return ctx.Err()
+		}
+	}
+	g.waiting--
+	g.inFlight++
+	l.inFlight++
+	return nil
+}
+
+// release frees the slot acquired for an instance of the Gateway.
+func (l *programmingLimiter) release(gw types.NamespacedName) {
+	if l == nil || l.limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g := l.gateways[gw]
+	g.inFlight--
+	l.inFlight--
+	if g.inFlight == 0 && g.waiting == 0 {
+		delete(l.gateways, gw)
+	}
+	l.broadcast()
+}
+
+// broadcast wakes every waiting acquire. l.mu must be held.
+func (l *programmingLimiter) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// share returns the number of instances each Gateway may program at once.
+// l.mu must be held.
+func (l *programmingLimiter) share() int {
+	n := len(l.gateways)
+	if n == 0 {
+		return l.limit
+	}
+	// Round up so the entire limit can always be used.
+	return max(1, (l.limit+n-1)/n)
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestProgrammingLimiter(t *testing.T) {
+	a := types.NamespacedName{Namespace: "default", Name: "a"}
+	b := types.NamespacedName{Namespace: "default", Name: "b"}
+	l := newProgrammingLimiter(1)
+	ctx := context.Background()
+
+	if err := l.acquire(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cancelled acquire returns without waiting for a slot.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() { errc <- l.acquire(cancelCtx, b) }()
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("acquire() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire() blocked after its context was cancelled")
+	}
+	l.mu.Lock()
+	if _, ok := l.gateways[b]; ok {
+		t.Error("cancelled acquire left its Gateway behind")
+	}
+	l.mu.Unlock()
+
+	// A waiting acquire continues once a slot is released.
+	go func() { errc <- l.acquire(ctx, b) }()
+	l.release(a)
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire() blocked after a slot was released")
+	}
+	l.release(b)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight != 0 || len(l.gateways) != 0 {
+		t.Errorf("limiter not empty after releasing every slot: %d in flight, gateways %v", l.inFlight, l.gateways)
+	}
+}
+
+func TestProgrammingLimiterUnlimited(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, l := range []*programmingLimiter{nil, newProgrammingLimiter(0)} {
+		if err := l.acquire(ctx, types.NamespacedName{Name: "a"}); err != nil {
+			t.Errorf("acquire() = %v, want no error without a limit", err)
+		}
+		l.release(types.NamespacedName{Name: "a"})
+	}
+}
@@ -0,0 +1,575 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=update
+
+// defaultProgrammingPort is the port of Caddy's admin endpoint, proxied with
+// mTLS, that ConfigPublisherAdminAPI programs Caddy instances on by default.
+const defaultProgrammingPort = 2021
+
+// ConfigPublisher is how generated configs are delivered to Caddy.
+type ConfigPublisher string
+
+const (
+	// ConfigPublisherAdminAPI pushes configs to the admin endpoint of every
+	// Caddy instance over the pod network, this is the default.
+	ConfigPublisherAdminAPI ConfigPublisher = "admin-api"
+
+	// ConfigPublisherSecret writes configs to a Secret per Gateway, which is
+	// mounted into the Caddy pods and loaded with `caddy run --watch`.
+	//
+	// Configs contain private keys, so they are stored in a Secret rather
+	// than a ConfigMap.
+	ConfigPublisherSecret ConfigPublisher = "secret"
+
+	// ConfigPublisherFile writes configs to a file per Gateway in a directory
+	// shared with the Caddy pods, which is loaded with `caddy run --watch`.
+	ConfigPublisherFile ConfigPublisher = "file"
+
+	// ConfigPublisherPull serves configs from the controller, Caddy instances
+	// are configured to periodically pull their config, see PullOptions.
+	// Unlike pushing configs, instances that restart while the controller is
+	// unavailable recover once it returns without needing to be reconciled.
+	ConfigPublisherPull ConfigPublisher = "pull"
+)
+
+// publishedConfigKey is the key of the config in Secrets written by the
+// Secret publisher.
+const publishedConfigKey = "caddy.json"
+
+// publication is a config generated for a Gateway that needs to be delivered
+// to Caddy.
+type publication struct {
+	// original is the Gateway as last written, publishers that report
+	// progress update it so it can be used for later status updates.
+	original *gatewayv1.Gateway
+	gw       *gatewayv1.Gateway
+
+	input  *caddy.Input
+	config []byte
+
+	// instances is the number of ready Caddy instances the config was
+	// published to, and failures are those that couldn't be programmed. Only
+	// set by publishers that program instances directly.
+	instances int
+	failures  []programmingFailure
+
+	// direct is set by publishers that program instances directly, which
+	// set programmed to the number of ready instances running the config.
+	direct     bool
+	programmed int
+
+	// halted is set if the rollout of the config was halted, which isn't an
+	// error as the config must change for the rollout to continue.
+	halted *rolloutHaltedError
+}
+
+// programmingFailure is a Caddy instance that couldn't be programmed.
+type programmingFailure struct {
+	target string
+	err    string
+}
+
+// maxReportedFailures is the maximum number of instances that couldn't be
+// programmed listed in a Gateway's Programmed condition.
+const maxReportedFailures = 3
+
+// programmedCondition returns the Programmed condition of a Gateway whose
+// config was published, listing any instances that couldn't be programmed.
+// The Gateway is still programmed if only some instances failed, as the rest
+// serve its config.
+func (p *publication) programmedCondition() metav1.Condition {
+	if len(p.failures) == 0 {
+		return metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionProgrammed),
+			Status:  metav1.ConditionTrue,
+			Reason:  string(gatewayv1.GatewayReasonProgrammed),
+			Message: "Gateway has been programmed",
+		}
+	}
+
+	failures := slices.Clone(p.failures)
+	slices.SortFunc(failures, func(a, b programmingFailure) int {
+		return strings.Compare(a.target, b.target)
+	})
+	var details []string
+	for _, f := range failures[:min(len(failures), maxReportedFailures)] {
+		details = append(details, f.target+": "+f.err)
+	}
+	if n := len(failures) - maxReportedFailures; n > 0 {
+		details = append(details, fmt.Sprintf("and %d more", n))
+	}
+	if len(failures) >= p.instances {
+		return metav1.Condition{
+			Type:    string(gatewayv1.GatewayConditionProgrammed),
+			Status:  metav1.ConditionFalse,
+			Reason:  string(gatewayv1.GatewayReasonPending),
+			Message: fmt.Sprintf("Unable to program any of the %d Caddy instances: %s", p.instances, strings.Join(details, "; ")),
+		}
+	}
+	return metav1.Condition{
+		Type:   string(gatewayv1.GatewayConditionProgrammed),
+		Status: metav1.ConditionTrue,
+		Reason: string(gatewayv1.GatewayReasonProgrammed),
+		Message: fmt.Sprintf("Gateway has been programmed, but %d of %d Caddy instances failed: %s",
+			len(failures), p.instances, strings.Join(details, "; ")),
+	}
+}
+
+// publisher delivers the configs generated for Gateways to Caddy.
+type publisher interface {
+	// publish delivers a config, the returned result is used as the result of
+	// the reconcile if the Gateway is otherwise reconciled successfully.
+	publish(ctx context.Context, p *publication) (ctrl.Result, error)
+}
+
+// newPublisher returns the publisher for the configured ConfigPublisher.
+func (r *GatewayReconciler) newPublisher() (publisher, error) {
+	switch r.ConfigPublisher {
+	case "", ConfigPublisherAdminAPI:
+		return &adminAPIPublisher{r: r}, nil
+	case ConfigPublisherSecret:
+		return &secretPublisher{r: r}, nil
+	case ConfigPublisherFile:
+		if r.ConfigDir == "" {
+			return nil, errors.New("a config directory is required to publish configs to files")
+		}
+		return &filePublisher{dir: r.ConfigDir}, nil
+	case ConfigPublisherPull:
+		if r.Pull.Listen == "" || r.Pull.URL == "" || r.Pull.Interval <= 0 {
+			return nil, errors.New("a listen address, URL and interval are required to serve configs for Caddy to pull")
+		}
+		return &configServer{
+			listen:    r.Pull.Listen,
+			persisted: &secretPublisher{r: r},
+			reader:    r.Client,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown config publisher %q", r.ConfigPublisher)
+	}
+}
+
+// programmingWork is a Caddy instance to be programmed by the
+// adminAPIPublisher.
+type programmingWork struct {
+	inst     caddyInstance
+	config   programmedConfig
+	target   client.ObjectKey
+	key      programmedKey
+	onlyTLS  bool
+	draining bool
+}
+
+// adminAPIPublisher pushes configs to the admin endpoint of every Caddy
+// instance of a Gateway, using mTLS.
+type adminAPIPublisher struct {
+	r *GatewayReconciler
+}
+
+var _ publisher = (*adminAPIPublisher)(nil)
+
+func (pub *adminAPIPublisher) publish(ctx context.Context, p *publication) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	r := pub.r
+	gw, i := p.gw, p.input
+	gwKey := client.ObjectKeyFromObject(gw)
+
+	programmingPort := r.ProgrammingPort
+	if programmingPort == 0 {
+		programmingPort = defaultProgrammingPort
+	}
+
+	endpointSlices, err := r.getEndpointSlices(ctx, gw)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Configure Caddy in parallel, so when someone runs Caddy as a DaemonSet on
+	// a 5,000 node cluster, we bring the gateway controller to its knees.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  int
+		busy    int
+		skipped int
+
+		unchanged int
+		tlsOnly   int
+	)
+	config, err := newProgrammedConfig(p.config)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	instances := getCaddyInstances(endpointSlices)
+	present, ready := instanceKeys(gwKey, instances)
+	readyInstances := len(ready)
+
+	// Instances being drained get their own config, which fails health checks.
+	draining, err := r.getDrainingPods(ctx, instances)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var drainConfig programmedConfig
+	if len(draining) > 0 {
+		i.Draining = true
+		drainBody, err := i.Config()
+		i.Draining = false
+		if err != nil {
+			log.Error(err, "Error generating Gateway config for draining instances")
+			return ctrl.Result{}, err
+		}
+		if drainConfig, err = newProgrammedConfig(drainBody); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Rollouts of configs that broke the instances they were programmed on
+	// aren't continued, until the config changes and triggers a reconcile.
+	rolling := r.Rollout.enabled()
+	if rolling {
+		if halted := r.rollouts.get(gwKey, config.hashes); halted != nil {
+			p.halted = halted
+			return ctrl.Result{}, nil
+		}
+	}
+
+	p.instances = readyInstances
+	progress := &programmingProgress{total: readyInstances}
+	var work []programmingWork
+	for _, inst := range instances {
+		config := config
+		_, isDraining := draining[inst.TargetRef.UID]
+		if isDraining {
+			config = drainConfig
+		}
+		target := client.ObjectKey{
+			Namespace: inst.TargetRef.Namespace,
+			Name:      inst.TargetRef.Name,
+		}
+		key := programmedKey{Gateway: gwKey, Pod: inst.TargetRef.UID}
+		if r.TargetedProgramming && r.programmed.isProgrammed(key, config.hashes) {
+			unchanged++
+			if inst.Ready {
+				progress.programmed.Add(1)
+			}
+			continue
+		}
+		// Skip instances that have been persistently unreachable, so they
+		// don't slow down programming every other instance.
+		if !r.breaker.allow(key) {
+			log.V(logLevelDebug).Info("Skipping unreachable Caddy instance", "ip", inst.IP, "target", target)
+			if inst.Ready {
+				skipped++
+				p.failures = append(p.failures, programmingFailure{target: target.String(), err: "skipped as unreachable"})
+			}
+			continue
+		}
+
+		// Instances whose config only differs by the TLS app, usually because
+		// certificates were renewed, are only sent the new TLS app.
+		onlyTLS := config.tls != nil && r.programmed.onlyTLSChanged(key, config.hashes)
+		if onlyTLS {
+			tlsOnly++
+		}
+		work = append(work, programmingWork{
+			inst:     inst,
+			config:   config,
+			target:   target,
+			key:      key,
+			onlyTLS:  onlyTLS,
+			draining: isDraining,
+		})
+	}
+
+	// program programs an instance, returning a client for its admin
+	// endpoint if successful.
+	program := func(w programmingWork) (*http.Client, string) {
+		a, target, key := w.inst, w.target, w.key
+
+		if err := r.limiter.acquire(ctx, gwKey); err != nil {
+			// The reconcile was cancelled while waiting for its turn, the
+			// instance is programmed by the next one.
+			r.programmed.forget(key)
+			mu.Lock()
+			failed++
+			p.failures = append(p.failures, programmingFailure{target: target.String(), err: err.Error()})
+			mu.Unlock()
+			return nil, ""
+		}
+		defer r.limiter.release(gwKey)
+
+		tlsConfig := r.tlsConfig.Clone()
+		tlsConfig.ServerName = target.Name + "." + target.Namespace
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = tlsConfig
+		httpClient := &http.Client{Transport: tr}
+
+		log.V(logLevelDebug).Info("Programming Caddy instance", "ip", a.IP, "target", target)
+		baseURL := "https://" + net.JoinHostPort(a.IP, strconv.Itoa(programmingPort))
+		var err error
+		if w.onlyTLS {
+			err = loadCaddyTLSApp(ctx, httpClient, baseURL, w.config.tls)
+		} else {
+			err = loadCaddyConfig(ctx, httpClient, baseURL+"/load", w.config.body)
+		}
+		if err != nil && !a.Ready {
+			// Caddy may not be listening yet, the instance is programmed
+			// again once it becomes ready and its EndpointSlices change.
+			log.V(logLevelDebug).Info("Unable to program Caddy instance that isn't ready", "ip", a.IP, "target", target, "error", err.Error())
+			r.programmed.forget(key)
+			return nil, ""
+		}
+		if err != nil && isCaddyBusy(ctx, err) {
+			// The instance is still loading another config, it isn't counted
+			// as failed so the Gateway isn't reported as such while it
+			// catches up. Instances that are never done loading time out,
+			// tripping the breaker.
+			log.V(logLevelDebug).Info("Caddy instance is busy, retrying later", "ip", a.IP, "target", target, "error", err.Error())
+			r.breaker.failure(key, err)
+			r.programmed.forget(key)
+			mu.Lock()
+			busy++
+			mu.Unlock()
+			return nil, ""
+		}
+		if err != nil {
+			log.Error(err, "Error programming Caddy instance", "ip", a.IP, "target", target)
+			r.breaker.failure(key, err)
+			r.programmed.forget(key)
+			mu.Lock()
+			failed++
+			p.failures = append(p.failures, programmingFailure{target: target.String(), err: err.Error()})
+			mu.Unlock()
+			return nil, ""
+		}
+		r.breaker.success(key)
+		r.programmed.programmed(key, w.config.hashes)
+		if a.Ready {
+			progress.programmed.Add(1)
+		}
+		log.V(logLevelDebug).Info("Successfully programmed Caddy instance", "ip", a.IP, "target", target)
+		return httpClient, baseURL
+	}
+
+	// Without a rolling update every instance is programmed in one batch,
+	// otherwise each batch is verified before programming the next.
+	var (
+		halted    *rolloutHaltedError
+		rolledOut []programmingWork
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		batches := rolloutBatches(work, r.Rollout.BatchPercent)
+		for n, batch := range batches {
+			var (
+				batchWG     sync.WaitGroup
+				verifyFails int
+			)
+			for _, w := range batch {
+				batchWG.Add(1)
+				go func(w programmingWork) {
+					defer batchWG.Done()
+					httpClient, baseURL := program(w)
+					if httpClient == nil {
+						return
+					}
+					mu.Lock()
+					rolledOut = append(rolledOut, w)
+					mu.Unlock()
+					// Instances that aren't ready may not be listening yet,
+					// and draining instances fail health checks on purpose.
+					if !rolling || !w.inst.Ready || w.draining {
+						return
+					}
+					if err := r.verifyCaddyInstance(ctx, httpClient, baseURL, w.inst.IP, gw.Annotations[GatewayAnnotationRolloutVerifyURL]); err != nil {
+						log.Error(err, "Caddy instance failed verification", "ip", w.inst.IP, "target", w.target)
+						mu.Lock()
+						verifyFails++
+						mu.Unlock()
+					}
+				}(w)
+			}
+			batchWG.Wait()
+			if verifyFails > 0 {
+				var remaining int
+				for _, b := range batches[n+1:] {
+					remaining += len(b)
+				}
+				halted = &rolloutHaltedError{failed: verifyFails, remaining: remaining}
+				if verified, ok := r.verified.get(gwKey); ok && verified.hashes != config.hashes {
+					halted.rolledBack = rollback(rolledOut, verified, func(w programmingWork) bool {
+						httpClient, _ := program(w)
+						return httpClient != nil
+					})
+				}
+				return
+			}
+		}
+	}()
+	p.original = r.waitForProgramming(ctx, p.original, gw, &wg, progress)
+	p.direct = true
+	p.programmed = int(progress.programmed.Load())
+	if halted != nil {
+		r.rollouts.halt(gwKey, config.hashes, halted)
+		if r.Recorder != nil {
+			r.Recorder.Event(p.original, corev1.EventTypeWarning, halted.reason(), halted.Error())
+		}
+		p.halted = halted
+		return ctrl.Result{}, nil
+	}
+	if rolling {
+		r.rollouts.clear(gwKey)
+		if failed == 0 && busy == 0 && skipped == 0 {
+			r.verified.set(gwKey, config)
+		}
+	}
+	r.programmed.retain(gwKey, ready)
+	r.breaker.retain(gwKey, present)
+	if unchanged > 0 {
+		log.V(logLevelDebug).Info("Skipped Caddy instances already running the config", "count", unchanged)
+	}
+	if tlsOnly > 0 {
+		log.V(logLevelDebug).Info("Programmed only the TLS app of Caddy instances", "count", tlsOnly)
+	}
+
+	// Report instances that couldn't be programmed, then continue on so the
+	// Gateway's status reflects the instances that were programmed. Retry
+	// with a backoff until every instance is programmed, so skipped
+	// instances are programmed once they recover.
+	var result ctrl.Result
+	if failed > 0 || skipped > 0 {
+		if r.Recorder != nil {
+			r.Recorder.Eventf(p.original, corev1.EventTypeWarning, "ProgrammingFailed",
+				"Unable to program %d of %d Caddy instances (%d skipped as unreachable)",
+				failed+skipped, readyInstances, skipped)
+		}
+		result.RequeueAfter = r.retries.failure(gwKey)
+	} else {
+		r.retries.success(gwKey)
+	}
+	if busy > 0 {
+		log.Info("Caddy instances were busy loading another config, retrying", "count", busy)
+		result.RequeueAfter = caddyBusyRequeue
+	}
+	return result, nil
+}
+
+// instanceKeys returns the keys of every Caddy instance of a Gateway, and of
+// the ones that are ready. Only ready instances are remembered as programmed,
+// as Caddy runs without --resume: an instance that becomes unready may have
+// restarted and lost its config, so it is programmed again once it is ready.
+func instanceKeys(gw types.NamespacedName, instances []caddyInstance) (present, ready map[programmedKey]struct{}) {
+	present = make(map[programmedKey]struct{}, len(instances))
+	ready = make(map[programmedKey]struct{}, len(instances))
+	for _, inst := range instances {
+		key := programmedKey{Gateway: gw, Pod: inst.TargetRef.UID}
+		present[key] = struct{}{}
+		if inst.Ready {
+			ready[key] = struct{}{}
+		}
+	}
+	return present, ready
+}
+
+// secretPublisher writes configs to a Secret owned by the Gateway, Caddy pods
+// mount the Secret and watch the config for changes.
+//
+// The kubelet takes up to a minute to update mounted Secrets, so changes take
+// longer to be applied than when pushed to the admin endpoint.
+type secretPublisher struct {
+	r *GatewayReconciler
+}
+
+var _ publisher = (*secretPublisher)(nil)
+
+func (pub *secretPublisher) publish(ctx context.Context, p *publication) (ctrl.Result, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: p.gw.Namespace,
+			Name:      publishedConfigName(p.gw),
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, pub.r.Client, secret, func() error {
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		secret.Labels[owningGatewayLabel] = p.gw.Name
+		secret.Data = map[string][]byte{publishedConfigKey: p.config}
+		return controllerutil.SetControllerReference(p.gw, secret, pub.r.Scheme)
+	})
+	return ctrl.Result{}, err
+}
+
+// publishedConfigName returns the name of the Secret a Gateway's config is
+// published to.
+func publishedConfigName(gw *gatewayv1.Gateway) string {
+	return gw.Name + "-caddy-config"
+}
+
+// filePublisher writes configs to a file per Gateway, named
+// `<namespace>/<name>.json` within dir. Caddy pods share the directory (such
+// as an NFS volume) and watch their Gateway's config for changes.
+type filePublisher struct {
+	dir string
+}
+
+var _ publisher = (*filePublisher)(nil)
+
+func (pub *filePublisher) publish(_ context.Context, p *publication) (ctrl.Result, error) {
+	return ctrl.Result{}, writeFileAtomic(pub.path(client.ObjectKeyFromObject(p.gw)), p.config)
+}
+
+func (pub *filePublisher) path(gw types.NamespacedName) string {
+	return filepath.Join(pub.dir, gw.Namespace, gw.Name+".json")
+}
+
+// writeFileAtomic writes b to path by renaming a temporary file over it, so
+// Caddy never reads a partially written config.
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	// CreateTemp only allows the owner to read the file, which is kept as
+	// configs contain private keys.
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
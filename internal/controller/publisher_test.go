@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestProgrammedCondition(t *testing.T) {
+	// failures returns n failures, in reverse order of their targets.
+	failures := func(n int) []programmingFailure {
+		var f []programmingFailure
+		for i := n - 1; i >= 0; i-- {
+			f = append(f, programmingFailure{target: fmt.Sprintf("default/caddy-%d", i), err: "connection refused"})
+		}
+		return f
+	}
+
+	tests := []struct {
+		name        string
+		instances   int
+		failures    []programmingFailure
+		wantStatus  metav1.ConditionStatus
+		wantReason  gatewayv1.GatewayConditionReason
+		wantMessage string
+	}{
+		{
+			name:        "programmed",
+			instances:   3,
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  gatewayv1.GatewayReasonProgrammed,
+			wantMessage: "Gateway has been programmed",
+		},
+		{
+			name:        "partial failure",
+			instances:   3,
+			failures:    failures(2),
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  gatewayv1.GatewayReasonProgrammed,
+			wantMessage: "Gateway has been programmed, but 2 of 3 Caddy instances failed: default/caddy-0: connection refused; default/caddy-1: connection refused",
+		},
+		{
+			name:        "total failure",
+			instances:   2,
+			failures:    failures(2),
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  gatewayv1.GatewayReasonPending,
+			wantMessage: "Unable to program any of the 2 Caddy instances: default/caddy-0: connection refused; default/caddy-1: connection refused",
+		},
+		{
+			name:       "truncated",
+			instances:  10,
+			failures:   failures(5),
+			wantStatus: metav1.ConditionTrue,
+			wantReason: gatewayv1.GatewayReasonProgrammed,
+			wantMessage: "Gateway has been programmed, but 5 of 10 Caddy instances failed: default/caddy-0: connection refused; " +
+				"default/caddy-1: connection refused; default/caddy-2: connection refused; and 2 more",
+		},
+		{
+			name:       "truncated total failure",
+			instances:  4,
+			failures:   failures(4),
+			wantStatus: metav1.ConditionFalse,
+			wantReason: gatewayv1.GatewayReasonPending,
+			wantMessage: "Unable to program any of the 4 Caddy instances: default/caddy-0: connection refused; " +
+				"default/caddy-1: connection refused; default/caddy-2: connection refused; and 1 more",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &publication{instances: tt.instances, failures: tt.failures}
+			got := p.programmedCondition()
+			if got.Type != string(gatewayv1.GatewayConditionProgrammed) {
+				t.Errorf("type = %q, want %q", got.Type, gatewayv1.GatewayConditionProgrammed)
+			}
+			if got.Status != tt.wantStatus || got.Reason != string(tt.wantReason) {
+				t.Errorf("status = %s (%s), want %s (%s)", got.Status, got.Reason, tt.wantStatus, tt.wantReason)
+			}
+			if got.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", got.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestInstanceKeysUnreadyInstance(t *testing.T) {
+	gw := types.NamespacedName{Namespace: "default", Name: "gateway"}
+	instance := func(ready bool) []caddyInstance {
+		return []caddyInstance{{IP: "10.0.0.1", TargetRef: &corev1.ObjectReference{UID: "a"}, Ready: ready}}
+	}
+	key := programmedKey{Gateway: gw, Pod: "a"}
+	hashes := programmedHashes{Config: sha256.Sum256([]byte("config"))}
+
+	var s programmedState
+	s.programmed(key, hashes)
+	_, ready := instanceKeys(gw, instance(true))
+	s.retain(gw, ready)
+	if !s.isProgrammed(key, hashes) {
+		t.Fatal("ready instance was forgotten")
+	}
+
+	// The pod goes unready, e.g. because Caddy restarted without its config.
+	present, ready := instanceKeys(gw, instance(false))
+	if _, ok := present[key]; !ok {
+		t.Error("unready instance isn't present")
+	}
+	if _, ok := ready[key]; ok {
+		t.Error("unready instance is ready")
+	}
+	s.retain(gw, ready)
+	if s.isProgrammed(key, hashes) {
+		t.Error("unready instance is still programmed")
+	}
+
+	// Once the pod is ready again it is programmed, instead of being skipped.
+	_, ready = instanceKeys(gw, instance(true))
+	s.retain(gw, ready)
+	if s.isProgrammed(key, hashes) {
+		t.Error("instance that was unready is skipped once ready again")
+	}
+}
+
+func TestGatewayReconcilerForget(t *testing.T) {
+	deleted := types.NamespacedName{Namespace: "default", Name: "deleted"}
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+	deletedKey := programmedKey{Gateway: deleted, Pod: "a"}
+	otherKey := programmedKey{Gateway: other, Pod: "b"}
+
+	r := &GatewayReconciler{}
+	for _, key := range []programmedKey{deletedKey, otherKey} {
+		r.retries.failure(key.Gateway)
+		r.breaker.failure(key, errors.New("connection refused"))
+		r.programmed.programmed(key, programmedHashes{})
+		r.verified.set(key.Gateway, programmedConfig{})
+		r.rollouts.halt(key.Gateway, programmedHashes{}, &rolloutHaltedError{})
+	}
+
+	r.forget(deleted)
+	if _, ok := r.retries.failures[deleted]; ok {
+		t.Error("retries of the deleted Gateway were kept")
+	}
+	if _, ok := r.breaker.instances[deletedKey]; ok {
+		t.Error("breaker state of the deleted Gateway's instances was kept")
+	}
+	if _, ok := r.programmed.instances[deletedKey]; ok {
+		t.Error("programmed state of the deleted Gateway's instances was kept")
+	}
+	if _, ok := r.verified.get(deleted); ok {
+		t.Error("verified config of the deleted Gateway was kept")
+	}
+	if r.rollouts.get(deleted, programmedHashes{}) != nil {
+		t.Error("halted rollout of the deleted Gateway was kept")
+	}
+
+	// The state of other Gateways is kept.
+	if _, ok := r.retries.failures[other]; !ok {
+		t.Error("retries of another Gateway were removed")
+	}
+	if _, ok := r.breaker.instances[otherKey]; !ok {
+		t.Error("breaker state of another Gateway's instances was removed")
+	}
+	if _, ok := r.programmed.instances[otherKey]; !ok {
+		t.Error("programmed state of another Gateway's instances was removed")
+	}
+	if _, ok := r.verified.get(other); !ok {
+		t.Error("verified config of another Gateway was removed")
+	}
+	if r.rollouts.get(other, programmedHashes{}) == nil {
+		t.Error("halted rollout of another Gateway was removed")
+	}
+}
@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/apimachinery/pkg/types"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+const (
+	// GatewayAnnotationRolloutVerifyURL is an annotation on a Gateway with a URL
+	// requested from each of its Caddy instances once programmed during a rolling
+	// update, after checking its admin endpoint responds. The request is sent to
+	// the instance's IP on the URL's port, and fails verification if it can't be
+	// completed or responds with a 5xx status. Only the admin endpoint is checked
+	// if unset.
+	GatewayAnnotationRolloutVerifyURL = string(gateway.ControllerDomain) + "/rollout-verify-url"
+
+	// GatewayReasonRolloutHalted is the reason of a Gateway's Programmed
+	// condition when a rolling update of its config was halted, as the
+	// config broke the Caddy instances it was programmed on.
+	GatewayReasonRolloutHalted = "RolloutHalted"
+
+	// GatewayReasonRolledBack is the reason of a Gateway's Programmed
+	// condition when a rolling update was halted, and the instances it was
+	// programmed on were rolled back to the last verified config.
+	GatewayReasonRolledBack = "RolledBack"
+)
+
+// RolloutOptions configure programming the Caddy instances of a Gateway in
+// batches, verifying each batch before programming the next. This limits the
+// impact of a config that Caddy accepts, but that breaks routing.
+type RolloutOptions struct {
+	// BatchPercent is the percentage of a Gateway's Caddy instances that are
+	// programmed at a time. Every instance is programmed at once if zero or
+	// 100, in which case instances aren't verified.
+	BatchPercent int
+
+	// MaxErrorRate is the highest ratio of requests an instance may respond
+	// to with a 5xx status over ErrorRateWindow after being programmed,
+	// taken from Caddy's metrics. The error rate isn't checked if zero.
+	MaxErrorRate float64
+
+	// ErrorRateWindow is how long the error rate of an instance is measured
+	// for, defaults to 30 seconds.
+	ErrorRateWindow time.Duration
+}
+
+// minErrorRateRequests is how many requests an instance must have served
+// while its error rate is measured, for the error rate to be meaningful.
+const minErrorRateRequests = 10
+
+// enabled returns true if instances are programmed in more than one batch.
+func (o RolloutOptions) enabled() bool {
+	return o.BatchPercent > 0 && o.BatchPercent < 100
+}
+
+// rolloutBatches splits the instances to program into batches of
+// RolloutOptions.BatchPercent, rounded up so every batch has an instance.
+func rolloutBatches[T any](items []T, percent int) [][]T {
+	if percent <= 0 || percent >= 100 || len(items) == 0 {
+		return [][]T{items}
+	}
+	size := max(1, (len(items)*percent+99)/100)
+	var batches [][]T
+	for len(items) > 0 {
+		n := min(size, len(items))
+		batches = append(batches, items[:n])
+		items = items[n:]
+	}
+	return batches
+}
+
+// rolloutHaltedError is returned when a rolling update is halted, as the
+// instances of a batch failed verification.
+type rolloutHaltedError struct {
+	// failed is the number of instances that failed verification.
+	failed int
+
+	// remaining is the number of instances that weren't programmed.
+	remaining int
+
+	// rolledBack is the number of instances rolled back to the last
+	// verified config.
+	rolledBack int
+}
+
+func (e *rolloutHaltedError) Error() string {
+	msg := fmt.Sprintf("rollout halted: %d Caddy instances failed verification, %d instances were not programmed", e.failed, e.remaining)
+	if e.rolledBack > 0 {
+		msg += fmt.Sprintf(", %d instances were rolled back to the last verified config", e.rolledBack)
+	}
+	return msg
+}
+
+// reason returns the reason of the Gateway's Programmed condition.
+func (e *rolloutHaltedError) reason() string {
+	if e.rolledBack > 0 {
+		return GatewayReasonRolledBack
+	}
+	return GatewayReasonRolloutHalted
+}
+
+// haltedRollouts tracks the configs whose rollout was halted for each Gateway,
+// so they aren't rolled out to more instances by later reconciles.
+type haltedRollouts struct {
+	mu      sync.Mutex
+	configs map[types.NamespacedName]haltedRollout
+}
+
+// haltedRollout is a config whose rollout was halted, and why.
+type haltedRollout struct {
+	hashes programmedHashes
+	err    *rolloutHaltedError
+}
+
+// get returns why the rollout of the config was halted, or nil if it wasn't.
+func (h *haltedRollouts) get(gw types.NamespacedName, hashes programmedHashes) *rolloutHaltedError {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	halted, ok := h.configs[gw]
+	if !ok || halted.hashes != hashes {
+		return nil
+	}
+	return halted.err
+}
+
+func (h *haltedRollouts) halt(gw types.NamespacedName, hashes programmedHashes, err *rolloutHaltedError) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.configs == nil {
+		h.configs = map[types.NamespacedName]haltedRollout{}
+	}
+	h.configs[gw] = haltedRollout{hashes: hashes, err: err}
+}
+
+func (h *haltedRollouts) clear(gw types.NamespacedName) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.configs, gw)
+}
+
+// verifiedConfigs tracks the last config of each Gateway that was rolled out
+// to every instance and verified, which instances are rolled back to if a
+// later rollout is halted.
+type verifiedConfigs struct {
+	mu      sync.Mutex
+	configs map[types.NamespacedName]programmedConfig
+}
+
+func (v *verifiedConfigs) get(gw types.NamespacedName) (programmedConfig, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.configs[gw]
+	return c, ok
+}
+
+func (v *verifiedConfigs) set(gw types.NamespacedName, c programmedConfig) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.configs == nil {
+		v.configs = map[types.NamespacedName]programmedConfig{}
+	}
+	v.configs[gw] = c
+}
+
+func (v *verifiedConfigs) forget(gw types.NamespacedName) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.configs, gw)
+}
+
+// rollback programs the instances a config was rolled out to with the last
+// verified config, returning how many were rolled back. Draining instances
+// are left alone, as they are about to be removed.
+func rollback(rolledOut []programmingWork, verified programmedConfig, program func(programmingWork) bool) int {
+	var (
+		wg         sync.WaitGroup
+		rolledBack atomic.Int64
+	)
+	for _, w := range rolledOut {
+		if w.draining {
+			continue
+		}
+		w.config, w.onlyTLS = verified, false
+		wg.Add(1)
+		go func(w programmingWork) {
+			defer wg.Done()
+			if program(w) {
+				rolledBack.Add(1)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return int(rolledBack.Load())
+}
+
+// verifyCaddyInstance checks a Caddy instance is healthy after being
+// programmed, using the same client and admin endpoint it was programmed with,
+// then requests the Gateway's verify URL from it if set, see
+// GatewayAnnotationRolloutVerifyURL.
+func (r *GatewayReconciler) verifyCaddyInstance(ctx context.Context, c *http.Client, baseURL, ip, verifyURL string) error {
+	if _, err := getCaddyConfig(ctx, c, baseURL+"/config/"); err != nil {
+		return fmt.Errorf("admin endpoint is unavailable: %w", err)
+	}
+	if err := r.verifyErrorRate(ctx, c, baseURL); err != nil {
+		return err
+	}
+	if verifyURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(verifyURL)
+	if err != nil {
+		return fmt.Errorf("invalid verify URL: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	// Connect to the instance itself, while keeping the URL's host for the
+	// Host header and SNI so the request is routed like any other.
+	addr := net.JoinHostPort(ip, port)
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	ctx, cancel := context.WithTimeout(ctx, caddyRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	c = &http.Client{
+		Transport: tr,
+		// Redirects, such as to HTTPS, would be sent to the same address.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("verify request failed: %w", err)
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("verify request responded with %d", res.StatusCode)
+	}
+	return nil
+}
+
+// verifyErrorRate checks the ratio of requests a Caddy instance responds to
+// with a 5xx status over RolloutOptions.ErrorRateWindow, using the metrics of
+// its HTTP servers.
+func (r *GatewayReconciler) verifyErrorRate(ctx context.Context, c *http.Client, baseURL string) error {
+	if r.Rollout.MaxErrorRate <= 0 {
+		return nil
+	}
+	window := r.Rollout.ErrorRateWindow
+	if window <= 0 {
+		window = 30 * time.Second
+	}
+
+	total, errs, err := getCaddyRequestCounts(ctx, c, baseURL)
+	if err != nil {
+		return err
+	}
+	t := time.NewTimer(window)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	case <-t.C:
+	}
+	total2, errs2, err := getCaddyRequestCounts(ctx, c, baseURL)
+	if err != nil {
+		return err
+	}
+
+	requests := total2 - total
+	if requests < minErrorRateRequests {
+		return nil
+	}
+	if rate := (errs2 - errs) / requests; rate > r.Rollout.MaxErrorRate {
+		return fmt.Errorf("error rate of %.1f%% over %s exceeds %.1f%%", rate*100, window, r.Rollout.MaxErrorRate*100)
+	}
+	return nil
+}
+
+// getCaddyRequestCounts returns how many requests the HTTP servers of a Caddy
+// instance have responded to, and how many of them with a 5xx status.
+func getCaddyRequestCounts(ctx context.Context, c *http.Client, baseURL string) (total, errs float64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, caddyRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/metrics", nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to get metrics: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("unable to get metrics: unexpected status %d", res.StatusCode)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(res.Body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to parse metrics: %w", err)
+	}
+	for _, m := range families["caddy_http_request_duration_seconds"].GetMetric() {
+		count := float64(m.GetHistogram().GetSampleCount())
+		total += count
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "code" && strings.HasPrefix(l.GetValue(), "5") {
+				errs += count
+			}
+		}
+	}
+	return total, errs, nil
+}
@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRolloutBatches(t *testing.T) {
+	items := func(n int) []int {
+		s := make([]int, n)
+		for i := range s {
+			s[i] = i
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		items   int
+		percent int
+		sizes   []int
+	}{
+		{name: "disabled", items: 4, percent: 0, sizes: []int{4}},
+		{name: "every instance", items: 4, percent: 100, sizes: []int{4}},
+		{name: "no instances", items: 0, percent: 25, sizes: []int{0}},
+		{name: "even", items: 8, percent: 25, sizes: []int{2, 2, 2, 2}},
+		{name: "rounded up", items: 5, percent: 25, sizes: []int{2, 2, 1}},
+		{name: "at least one", items: 3, percent: 10, sizes: []int{1, 1, 1}},
+		{name: "half", items: 3, percent: 50, sizes: []int{2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := rolloutBatches(items(tt.items), tt.percent)
+			var (
+				sizes []int
+				all   []int
+			)
+			for _, b := range batches {
+				sizes = append(sizes, len(b))
+				all = append(all, b...)
+			}
+			if !slices.Equal(sizes, tt.sizes) {
+				t.Errorf("batch sizes = %v, want %v", sizes, tt.sizes)
+			}
+			if !slices.Equal(all, items(tt.items)) {
+				t.Errorf("batches = %v, want every item once and in order", batches)
+			}
+		})
+	}
+}
+
+func TestHaltedRollouts(t *testing.T) {
+	var (
+		h      haltedRollouts
+		gw     = types.NamespacedName{Namespace: "default", Name: "gateway"}
+		other  = types.NamespacedName{Namespace: "default", Name: "other"}
+		config = programmedHashes{Config: [32]byte{1}}
+		next   = programmedHashes{Config: [32]byte{2}}
+		err    = &rolloutHaltedError{failed: 1, remaining: 2, rolledBack: 1}
+	)
+	if got := h.get(gw, config); got != nil {
+		t.Errorf("get() = %v before halting, want nil", got)
+	}
+	h.halt(gw, config, err)
+	if got := h.get(gw, config); got != err {
+		t.Errorf("get() = %v, want the error the rollout was halted with", got)
+	}
+	if got := h.get(gw, next); got != nil {
+		t.Errorf("get() = %v for another config, want nil", got)
+	}
+	if got := h.get(other, config); got != nil {
+		t.Errorf("get() = %v for another Gateway, want nil", got)
+	}
+	h.clear(gw)
+	if got := h.get(gw, config); got != nil {
+		t.Errorf("get() = %v once cleared, want nil", got)
+	}
+}
+
+func TestVerifiedConfigs(t *testing.T) {
+	var (
+		v      verifiedConfigs
+		gw     = types.NamespacedName{Namespace: "default", Name: "gateway"}
+		config = programmedConfig{body: []byte("{}"), hashes: programmedHashes{Config: [32]byte{1}}}
+	)
+	if _, ok := v.get(gw); ok {
+		t.Errorf("get() found a config before one was verified")
+	}
+	v.set(gw, config)
+	if got, ok := v.get(gw); !ok || got.hashes != config.hashes {
+		t.Errorf("get() = %v, %t, want the verified config", got.hashes, ok)
+	}
+	v.forget(gw)
+	if _, ok := v.get(gw); ok {
+		t.Errorf("get() found a config once forgotten")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	var (
+		verified  = programmedConfig{body: []byte(`{"verified":true}`), hashes: programmedHashes{Config: [32]byte{1}}}
+		broken    = programmedConfig{body: []byte(`{"broken":true}`), hashes: programmedHashes{Config: [32]byte{2}}}
+		rolledOut = []programmingWork{
+			{target: types.NamespacedName{Name: "a"}, config: broken, onlyTLS: true},
+			{target: types.NamespacedName{Name: "b"}, config: broken},
+			{target: types.NamespacedName{Name: "draining"}, config: broken, draining: true},
+			{target: types.NamespacedName{Name: "unreachable"}, config: broken},
+		}
+
+		mu         sync.Mutex
+		programmed []string
+	)
+	n := rollback(rolledOut, verified, func(w programmingWork) bool {
+		if w.config.hashes != verified.hashes || w.onlyTLS {
+			t.Errorf("instance %s rolled back with config %v (only TLS: %t), want the whole verified config", w.target.Name, w.config.hashes, w.onlyTLS)
+		}
+		mu.Lock()
+		programmed = append(programmed, w.target.Name)
+		mu.Unlock()
+		return w.target.Name != "unreachable"
+	})
+	if n != 2 {
+		t.Errorf("rollback() = %d, want 2", n)
+	}
+	slices.Sort(programmed)
+	if want := []string{"a", "b", "unreachable"}; !slices.Equal(programmed, want) {
+		t.Errorf("programmed %v, want %v as draining instances are left alone", programmed, want)
+	}
+}
+
+// caddyMetrics returns Caddy's request metrics, with total requests of which
+// errs were responded to with a 500.
+func caddyMetrics(total, errs int) string {
+	return fmt.Sprintf(`# TYPE caddy_http_request_duration_seconds histogram
+caddy_http_request_duration_seconds_bucket{code="200",server="srv0",le="+Inf"} %[1]d
+caddy_http_request_duration_seconds_sum{code="200",server="srv0"} 1
+caddy_http_request_duration_seconds_count{code="200",server="srv0"} %[1]d
+caddy_http_request_duration_seconds_bucket{code="500",server="srv0",le="+Inf"} %[2]d
+caddy_http_request_duration_seconds_sum{code="500",server="srv0"} 1
+caddy_http_request_duration_seconds_count{code="500",server="srv0"} %[2]d
+`, total-errs, errs)
+}
+
+func TestVerifyCaddyInstance(t *testing.T) {
+	// The admin endpoint reports metrics with errs more errors on every
+	// request for them.
+	newAdmin := func(t *testing.T, errs int) *httptest.Server {
+		var requests atomic.Int64
+		mux := http.NewServeMux()
+		mux.HandleFunc("/config/", func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprint(w, "{}")
+		})
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			n := int(requests.Add(1))
+			fmt.Fprint(w, caddyMetrics(n*100, n*errs))
+		})
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	// The instance responds to the verify URL with the status, and fails
+	// requests that aren't for the URL.
+	newInstance := func(t *testing.T, status int) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if host, _, _ := net.SplitHostPort(r.Host); host != "example.com" || r.URL.Path != "/healthz" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(srv.Close)
+		_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+		return "http://example.com:" + port + "/healthz"
+	}
+
+	tests := []struct {
+		name         string
+		adminDown    bool
+		errs         int
+		maxErrorRate float64
+		status       int
+		wantErr      bool
+	}{
+		{name: "admin endpoint only"},
+		{name: "admin endpoint unavailable", adminDown: true, wantErr: true},
+		{name: "verify URL", status: http.StatusOK},
+		{name: "verify URL redirects", status: http.StatusMovedPermanently},
+		{name: "verify URL fails", status: http.StatusServiceUnavailable, wantErr: true},
+		{name: "error rate below maximum", errs: 1, maxErrorRate: 0.05},
+		{name: "error rate above maximum", errs: 10, maxErrorRate: 0.05, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := newAdmin(t, tt.errs)
+			if tt.adminDown {
+				admin.Close()
+			}
+			var verifyURL string
+			if tt.status != 0 {
+				verifyURL = newInstance(t, tt.status)
+			}
+			r := &GatewayReconciler{
+				Rollout: RolloutOptions{MaxErrorRate: tt.maxErrorRate, ErrorRateWindow: time.Millisecond},
+			}
+			err := r.verifyCaddyInstance(context.Background(), admin.Client(), admin.URL, "127.0.0.1", verifyURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyCaddyInstance() error = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,41 +6,18 @@ package controller
 import (
 	"context"
 
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	gateway "github.com/caddyserver/gateway/internal"
 )
 
-func isAttachable(_ context.Context, gw *gatewayv1.Gateway, route metav1.Object, parents []gatewayv1.RouteParentStatus) bool {
-	for _, rps := range parents {
-		ns := gateway.NamespaceDerefOr(rps.ParentRef.Namespace, route.GetNamespace())
-		if ns != gw.GetNamespace() {
-			continue
-		}
-
-		if string(rps.ParentRef.Name) != gw.GetName() {
-			continue
-		}
-
-		for _, cond := range rps.Conditions {
-			if cond.Type == string(gatewayv1.RouteConditionAccepted) && cond.Status == metav1.ConditionTrue {
-				return true
-			}
-
-			if cond.Type == string(gatewayv1.RouteConditionResolvedRefs) && cond.Status == metav1.ConditionFalse {
-				return true
-			}
-		}
-	}
-
-	return false
-}
-
 func parentRefMatched(gw *gatewayv1.Gateway, listener *gatewayv1.Listener, routeNamespace string, refs []gatewayv1.ParentReference) bool {
 	for _, ref := range refs {
 		if string(ref.Name) == gw.GetName() && gw.GetNamespace() == gateway.NamespaceDerefOr(ref.Namespace, routeNamespace) {
@@ -57,8 +34,48 @@ func parentRefMatched(gw *gatewayv1.Gateway, listener *gatewayv1.Listener, route
 	return false
 }
 
+// getReconcileRequestsForBackendService returns a reconcile request for each
+// Gateway that has an HTTPRoute or GRPCRoute attached that references the
+// given Service as a backend.
+func getReconcileRequestsForBackendService(ctx context.Context, c client.Client, service types.NamespacedName) ([]reconcile.Request, error) {
+	opts := &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(backendServiceIndex, service.String()),
+	}
+	httpRouteList := &gatewayv1.HTTPRouteList{}
+	if err := c.List(ctx, httpRouteList, opts); err != nil {
+		return nil, err
+	}
+	grpcRouteList := &gatewayv1.GRPCRouteList{}
+	if err := c.List(ctx, grpcRouteList, opts); err != nil {
+		return nil, err
+	}
+
+	seen := map[types.NamespacedName]struct{}{}
+	var reqs []reconcile.Request
+	add := func(route metav1.Object, spec gatewayv1.CommonRouteSpec) {
+		for _, req := range getReconcileRequestsForRoute(ctx, c, route, spec) {
+			if _, ok := seen[req.NamespacedName]; ok {
+				continue
+			}
+			seen[req.NamespacedName] = struct{}{}
+			reqs = append(reqs, req)
+		}
+	}
+	for _, route := range httpRouteList.Items {
+		add(&route, route.Spec.CommonRouteSpec)
+	}
+	for _, route := range grpcRouteList.Items {
+		add(&route, route.Spec.CommonRouteSpec)
+	}
+	return reqs, nil
+}
+
 // isAllowed returns true if the provided Route is allowed to attach to given gateway
 func isAllowed(ctx context.Context, c client.Client, gw *gatewayv1.Gateway, route metav1.Object) bool {
+	// The labels of the route's namespace are only needed by listeners using a
+	// selector, so are only read once one is found.
+	var nsLabels map[string]string
+	var nsLabelsRead bool
 	for _, listener := range gw.Spec.Listeners {
 		// all routes in the same namespace are allowed for this listener
 		if listener.AllowedRoutes == nil || listener.AllowedRoutes.Namespaces == nil {
@@ -79,17 +96,16 @@ func isAllowed(ctx context.Context, c client.Client, gw *gatewayv1.Gateway, rout
 				return true
 			}
 		case gatewayv1.NamespacesFromSelector:
-			nsList := &corev1.NamespaceList{}
-			selector, _ := metav1.LabelSelectorAsSelector(listener.AllowedRoutes.Namespaces.Selector)
-			if err := c.List(ctx, nsList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
-				log.FromContext(ctx).Error(err, "Unable to list Namespaces")
-				return false
-			}
-
-			for _, ns := range nsList.Items {
-				if ns.Name == route.GetNamespace() {
-					return true
+			if !nsLabelsRead {
+				var err error
+				if nsLabels, err = gateway.GetNamespaceLabels(ctx, c, route.GetNamespace()); err != nil {
+					log.FromContext(ctx).Error(err, "Unable to get Namespace", logKeyResource, route.GetNamespace())
+					return false
 				}
+				nsLabelsRead = true
+			}
+			if gateway.NamespaceMatchesSelector(listener.AllowedRoutes.Namespaces.Selector, nsLabels) {
+				return true
 			}
 		}
 	}
@@ -97,31 +113,7 @@ func isAllowed(ctx context.Context, c client.Client, gw *gatewayv1.Gateway, rout
 }
 
 func isKindAllowed(listener gatewayv1.Listener, route metav1.Object) bool {
-	if listener.AllowedRoutes.Kinds == nil {
-		return true
-	}
-
-	routeKind := getGatewayKindForObject(route)
-	for _, kind := range listener.AllowedRoutes.Kinds {
-		// TODO: validate group.
-		//if kind.Group != nil {
-		//	//string(*kind.Group)
-		//}
-
-		switch kind.Kind {
-		case "HTTPRoute":
-			return routeKind == "HTTPRoute"
-		case "GRPCRoute":
-			return routeKind == "GRPCRoute"
-		case "TCPRoute":
-			return routeKind == "TCPRoute"
-		case "TLSRoute":
-			return routeKind == "TLSRoute"
-		case "UDPRoute":
-			return routeKind == "UDPRoute"
-		}
-	}
-	return false
+	return gateway.IsRouteKindAllowed(listener, getGatewayKindForObject(route))
 }
 
 func getGatewayKindForObject(obj metav1.Object) gatewayv1.Kind {
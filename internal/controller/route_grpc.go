@@ -5,40 +5,304 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/routechecks"
 )
 
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=grpcroutes,verbs=get;list;watch
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=grpcroutes/status,verbs=patch;update
 
+// GRPCRouteReconciler reconciles GRPCRoutes attached to Gateways managed by
+// the controller, setting the status of each of their managed parents.
 type GRPCRouteReconciler struct {
 	client.Client
 
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// ExtraChecks are run against every GRPCRoute after the checks of
+	// routechecks.GRPCRouteChecks, e.g. to enforce naming policies.
+	ExtraChecks routechecks.Checks
 }
 
 var _ reconcile.Reconciler = (*GRPCRouteReconciler)(nil)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *GRPCRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ctx := context.Background()
+
+	// Index GRPCRoutes by their backend Services, so they are reconciled
+	// when one of them changes.
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &gatewayv1.GRPCRoute{}, backendServiceIndex, indexGRPCRouteBackendServices(mgr)); err != nil {
+		return err
+	}
+
+	// Index GRPCRoutes by their parent Gateways, so they are reconciled when
+	// one of them changes.
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &gatewayv1.GRPCRoute{}, gatewayIndex, func(o client.Object) []string {
+		route, ok := o.(*gatewayv1.GRPCRoute)
+		if !ok {
+			return nil
+		}
+		var gateways []string
+		for _, parent := range route.Spec.ParentRefs {
+			if !gateway.IsGateway(parent) {
+				continue
+			}
+			gateways = append(gateways, types.NamespacedName{
+				Namespace: gateway.NamespaceDerefOr(parent.Namespace, route.Namespace),
+				Name:      string(parent.Name),
+			}.String())
+		}
+		return gateways
+	}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&gatewayv1.GRPCRoute{}).
+		Watches(&corev1.Service{}, r.enqueueRequestForBackendService()).
+		Watches(&gatewayv1beta1.ReferenceGrant{}, r.enqueueRequestForReferenceGrant()).
+		Watches(
+			&gatewayv1.Gateway{},
+			r.enqueueRequestForGateway(),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.hasMatchingController(ctx))),
+		).
 		Complete(r)
 }
 
+// indexGRPCRouteBackendServices is used to index GRPCRoutes by the Services
+// they reference as backends.
+func indexGRPCRouteBackendServices(mgr ctrl.Manager) client.IndexerFunc {
+	return func(o client.Object) []string {
+		route, ok := o.(*gatewayv1.GRPCRoute)
+		if !ok {
+			return nil
+		}
+		var backendServices []string
+		for _, rule := range route.Spec.Rules {
+			for _, backend := range rule.BackendRefs {
+				backendServiceName, err := gateway.GetBackendServiceName(backend.BackendObjectReference)
+				if err != nil {
+					mgr.GetLogger().WithValues(
+						"controller", "grpc-route",
+						logKeyResource, client.ObjectKeyFromObject(o),
+					).Error(err, "Failed to get backend service name")
+					continue
+				}
+
+				backendServices = append(backendServices, types.NamespacedName{
+					Namespace: gateway.NamespaceDerefOr(backend.Namespace, route.Namespace),
+					Name:      backendServiceName,
+				}.String())
+			}
+		}
+		return backendServices
+	}
+}
+
+// Reconcile runs the route checks against a GRPCRoute, setting the Accepted
+// and ResolvedRefs conditions for each of its parents managed by us.
 func (r *GRPCRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
-	_ = log
 
-	// TODO: implement
+	original := &gatewayv1.GRPCRoute{}
+	if err := r.Client.Get(ctx, req.NamespacedName, original); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Unable to get GRPCRoute")
+		return ctrl.Result{}, err
+	}
+
+	// Check if the GRPCRoute is being deleted.
+	if original.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	route := original.DeepCopy()
+
+	// Only report the status of parents managed by us. Only the status of the
+	// route is ever updated, so the modified spec is never persisted.
+	route.Spec.ParentRefs = managedParentRefs(ctx, r.Client, route.Namespace, route.Spec.ParentRefs)
+	if len(route.Spec.ParentRefs) == 0 {
+		log.V(logLevelTrace).Info("Ignoring GRPCRoute as it has no parents managed by us")
+		return ctrl.Result{}, nil
+	}
 
+	grants := &gatewayv1beta1.ReferenceGrantList{}
+	if err := r.Client.List(ctx, grants); err != nil {
+		return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to retrieve reference grants: %w", err), original, route)
+	}
+
+	// input for the validators
+	i := &routechecks.GRPCRouteInput{
+		Ctx:       ctx,
+		Client:    r.Client,
+		Grants:    grants,
+		GRPCRoute: route,
+	}
+
+	checks := routechecks.GRPCRouteChecks().With(r.ExtraChecks)
+
+	// gateway validators
+	for _, parent := range route.Spec.ParentRefs {
+		// set acceptance to okay, this wil be overwritten in checks if needed
+		i.SetParentCondition(parent, metav1.Condition{
+			Type:    string(gatewayv1.RouteConditionAccepted),
+			Status:  metav1.ConditionTrue,
+			Reason:  string(gatewayv1.RouteReasonAccepted),
+			Message: "Accepted GRPCRoute",
+		})
+
+		// set status to okay, this wil be overwritten in checks if needed
+		i.SetAllParentCondition(metav1.Condition{
+			Type:    string(gatewayv1.RouteConditionResolvedRefs),
+			Status:  metav1.ConditionTrue,
+			Reason:  string(gatewayv1.RouteReasonResolvedRefs),
+			Message: "Service reference is valid",
+		})
+
+		// run the actual validators
+		for _, fn := range checks.Gateway {
+			continueCheck, err := fn(i, parent)
+			if err != nil {
+				return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Gateway check: %w", err), original, route)
+			}
+
+			if !continueCheck {
+				break
+			}
+		}
+	}
+
+	for _, fn := range checks.Rule {
+		continueCheck, err := fn(i)
+		if err != nil {
+			return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Backend check: %w", err), original, route)
+		}
+
+		if !continueCheck {
+			break
+		}
+	}
+
+	if err := r.updateStatus(ctx, original, route); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update GRPCRoute status: %w", err)
+	}
+
+	log.V(logLevelDebug).Info("Reconciled GRPCRoute")
 	return ctrl.Result{}, nil
 }
+
+// enqueueRequestForBackendService enqueues the GRPCRoutes referencing a
+// Service as a backend.
+func (r *GRPCRouteReconciler) enqueueRequestForBackendService() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(r.enqueueFromIndex(backendServiceIndex))
+}
+
+// enqueueRequestForGateway enqueues the GRPCRoutes attached to a Gateway.
+func (r *GRPCRouteReconciler) enqueueRequestForGateway() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(r.enqueueFromIndex(gatewayIndex))
+}
+
+// enqueueRequestForReferenceGrant enqueues every GRPCRoute, as any of them
+// may reference a backend allowed by a ReferenceGrant.
+func (r *GRPCRouteReconciler) enqueueRequestForReferenceGrant() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(r.enqueueAll())
+}
+
+// enqueueFromIndex returns a map function enqueueing the GRPCRoutes whose
+// index matches the key of the object.
+func (r *GRPCRouteReconciler) enqueueFromIndex(index string) handler.MapFunc {
+	return func(ctx context.Context, o client.Object) []reconcile.Request {
+		return r.enqueue(ctx, &client.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector(index, client.ObjectKeyFromObject(o).String()),
+		})
+	}
+}
+
+// enqueueAll returns a map function enqueueing every GRPCRoute.
+func (r *GRPCRouteReconciler) enqueueAll() handler.MapFunc {
+	return func(ctx context.Context, _ client.Object) []reconcile.Request {
+		return r.enqueue(ctx)
+	}
+}
+
+// enqueue returns a request for each GRPCRoute matching the options.
+func (r *GRPCRouteReconciler) enqueue(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	log := log.FromContext(ctx)
+
+	list := &gatewayv1.GRPCRouteList{}
+	if err := r.Client.List(ctx, list, opts...); err != nil {
+		log.Error(err, "Failed to get GRPCRoute")
+		return []reconcile.Request{}
+	}
+
+	requests := make([]reconcile.Request, len(list.Items))
+	for i, item := range list.Items {
+		route := types.NamespacedName{
+			Namespace: item.GetNamespace(),
+			Name:      item.GetName(),
+		}
+		requests[i] = reconcile.Request{
+			NamespacedName: route,
+		}
+		log.V(logLevelEnqueue).Info("Enqueued GRPCRoute", logKeyRoute, route)
+	}
+	return requests
+}
+
+// hasMatchingController returns a predicate matching Gateways whose
+// GatewayClass is managed by us.
+func (r *GRPCRouteReconciler) hasMatchingController(ctx context.Context) func(object client.Object) bool {
+	return hasMatchingController(ctx, r.Client)
+}
+
+// updateStatus updates the status of a GRPCRoute if it changed, keeping the
+// parent statuses set by other controllers.
+func (r *GRPCRouteReconciler) updateStatus(ctx context.Context, original, new *gatewayv1.GRPCRoute) error {
+	oldStatus := original.Status.DeepCopy()
+	newStatus := new.Status.DeepCopy()
+
+	opts := cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")
+	if cmp.Equal(oldStatus, newStatus, opts) {
+		return nil
+	}
+	ctx, cancel := statusContext(ctx)
+	defer cancel()
+	return updateStatusWithRetry(ctx, r.Client, new, func(latest *gatewayv1.GRPCRoute) {
+		latest.Status.Parents = mergeRouteParentStatuses(latest.Status.Parents, new.Status.Parents, latest.Spec.ParentRefs, new.Spec.ParentRefs)
+	})
+}
+
+// handleReconcileErrorWithStatus updates the status of a GRPCRoute before
+// returning the reconcile error, so conditions set before the error are
+// still reported.
+func (r *GRPCRouteReconciler) handleReconcileErrorWithStatus(ctx context.Context, reconcileErr error, original, modified *gatewayv1.GRPCRoute) (ctrl.Result, error) {
+	if err := r.updateStatus(ctx, original, modified); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update GRPCRoute status while handling the reconcile error %w: %w", reconcileErr, err)
+	}
+	return ctrl.Result{}, reconcileErr
+}
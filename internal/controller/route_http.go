@@ -11,6 +11,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -26,8 +27,9 @@ import (
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
+	"github.com/caddyserver/gateway/api/v1alpha1"
 	gateway "github.com/caddyserver/gateway/internal"
-	"github.com/caddyserver/gateway/internal/routechecks"
+	"github.com/caddyserver/gateway/pkg/routechecks"
 )
 
 // +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch
@@ -40,6 +42,14 @@ type HTTPRouteReconciler struct {
 
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// ExtraChecks are run against every HTTPRoute after the checks of
+	// routechecks.HTTPRouteChecks, e.g. to enforce naming policies.
+	ExtraChecks routechecks.Checks
+
+	// AllowedFilterHandlers are the Caddy HTTP handler modules
+	// CaddyHTTPFilters may use, see caddy.GeneratorOptions.
+	AllowedFilterHandlers []string
 }
 
 var _ reconcile.Reconciler = (*HTTPRouteReconciler)(nil)
@@ -49,31 +59,7 @@ func (r *HTTPRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	ctx := context.Background()
 
 	// TODO: document
-	if err := mgr.GetFieldIndexer().IndexField(ctx, &gatewayv1.HTTPRoute{}, backendServiceIndex, func(o client.Object) []string {
-		route, ok := o.(*gatewayv1.HTTPRoute)
-		if !ok {
-			return nil
-		}
-		var backendServices []string
-		for _, rule := range route.Spec.Rules {
-			for _, backend := range rule.BackendRefs {
-				backendServiceName, err := gateway.GetBackendServiceName(backend.BackendObjectReference)
-				if err != nil {
-					mgr.GetLogger().WithValues(
-						"controller", "http-route",
-						"resource", client.ObjectKeyFromObject(o),
-					).Error(err, "Failed to get backend service name")
-					continue
-				}
-
-				backendServices = append(backendServices, types.NamespacedName{
-					Namespace: gateway.NamespaceDerefOr(backend.Namespace, route.Namespace),
-					Name:      backendServiceName,
-				}.String())
-			}
-		}
-		return backendServices
-	}); err != nil {
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &gatewayv1.HTTPRoute{}, backendServiceIndex, indexHTTPRouteBackendServices(mgr)); err != nil {
 		return err
 	}
 
@@ -98,9 +84,17 @@ func (r *HTTPRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr)
+	// CaddyHTTPFilters can only be watched if their CRD is installed.
+	if _, err := mgr.GetRESTMapper().RESTMapping(caddyHTTPFilterGVK.GroupKind(), caddyHTTPFilterGVK.Version); err == nil {
+		b = b.Watches(&v1alpha1.CaddyHTTPFilter{}, r.enqueueRequestForExtensionRef())
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+	return b.
 		For(&gatewayv1.HTTPRoute{}).
 		Watches(&corev1.Service{}, r.enqueueRequestForBackendService()).
+		Watches(&corev1.ConfigMap{}, r.enqueueRequestForExtensionRef()).
 		Watches(&gatewayv1beta1.ReferenceGrant{}, r.enqueueRequestForReferenceGrant()).
 		Watches(
 			&gatewayv1.Gateway{},
@@ -110,6 +104,36 @@ func (r *HTTPRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
+// indexHTTPRouteBackendServices is used to index HTTPRoutes by the Services
+// they reference as backends.
+func indexHTTPRouteBackendServices(mgr ctrl.Manager) client.IndexerFunc {
+	return func(o client.Object) []string {
+		route, ok := o.(*gatewayv1.HTTPRoute)
+		if !ok {
+			return nil
+		}
+		var backendServices []string
+		for _, rule := range route.Spec.Rules {
+			for _, backend := range rule.BackendRefs {
+				backendServiceName, err := gateway.GetBackendServiceName(backend.BackendObjectReference)
+				if err != nil {
+					mgr.GetLogger().WithValues(
+						"controller", "http-route",
+						logKeyResource, client.ObjectKeyFromObject(o),
+					).Error(err, "Failed to get backend service name")
+					continue
+				}
+
+				backendServices = append(backendServices, types.NamespacedName{
+					Namespace: gateway.NamespaceDerefOr(backend.Namespace, route.Namespace),
+					Name:      backendServiceName,
+				}.String())
+			}
+		}
+		return backendServices
+	}
+}
+
 // Reconcile .
 // TODO: document
 func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -131,6 +155,14 @@ func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 	route := original.DeepCopy()
 
+	// Only report the status of parents managed by us. Only the status of the
+	// route is ever updated, so the modified spec is never persisted.
+	route.Spec.ParentRefs = managedParentRefs(ctx, r.Client, route.Namespace, route.Spec.ParentRefs)
+	if len(route.Spec.ParentRefs) == 0 {
+		log.V(logLevelTrace).Info("Ignoring HTTPRoute as it has no parents managed by us")
+		return ctrl.Result{}, nil
+	}
+
 	grants := &gatewayv1beta1.ReferenceGrantList{}
 	if err := r.Client.List(ctx, grants); err != nil {
 		return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to retrieve reference grants: %w", err), original, route)
@@ -142,8 +174,12 @@ func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		Client:    r.Client,
 		Grants:    grants,
 		HTTPRoute: route,
+
+		AllowedFilterHandlers: r.AllowedFilterHandlers,
 	}
 
+	checks := routechecks.HTTPRouteChecks().With(r.ExtraChecks)
+
 	// gateway validators
 	for _, parent := range route.Spec.ParentRefs {
 		// set acceptance to okay, this wil be overwritten in checks if needed
@@ -163,13 +199,7 @@ func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		})
 
 		// run the actual validators
-		for _, fn := range []routechecks.CheckGatewayFunc{
-			routechecks.CheckGatewayAllowedForNamespace,
-			routechecks.CheckGatewayRouteKindAllowed,
-			routechecks.CheckGatewayMatchingPorts,
-			routechecks.CheckGatewayMatchingHostnames,
-			routechecks.CheckGatewayMatchingSection,
-		} {
+		for _, fn := range checks.Gateway {
 			continueCheck, err := fn(i, parent)
 			if err != nil {
 				return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Gateway check: %w", err), original, route)
@@ -181,11 +211,7 @@ func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
-	for _, fn := range []routechecks.CheckRuleFunc{
-		routechecks.CheckAgainstCrossNamespaceBackendReferences,
-		routechecks.CheckBackend,
-		routechecks.CheckBackendIsExistingService,
-	} {
+	for _, fn := range checks.Rule {
 		continueCheck, err := fn(i)
 		if err != nil {
 			return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Backend check: %w", err), original, route)
@@ -200,7 +226,7 @@ func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, fmt.Errorf("failed to update HTTPRoute status: %w", err)
 	}
 
-	log.Info("Reconciled HTTPRoute")
+	log.V(logLevelDebug).Info("Reconciled HTTPRoute")
 	return ctrl.Result{}, nil
 }
 
@@ -210,6 +236,32 @@ func (r *HTTPRouteReconciler) enqueueRequestForBackendService() handler.EventHan
 	return handler.EnqueueRequestsFromMapFunc(r.enqueueFromIndex(backendServiceIndex))
 }
 
+// enqueueRequestForExtensionRef returns an event handler for any changes to
+// ConfigMaps or CaddyHTTPFilters, enqueueing the HTTPRoutes whose ExtensionRef
+// filters reference them.
+func (r *HTTPRouteReconciler) enqueueRequestForExtensionRef() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		log := log.FromContext(ctx, logKeyResource, client.ObjectKeyFromObject(o))
+
+		list := &gatewayv1.HTTPRouteList{}
+		if err := r.Client.List(ctx, list, client.InNamespace(o.GetNamespace())); err != nil {
+			log.Error(err, "Failed to get HTTPRoute")
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, item := range list.Items {
+			if !referencesExtension(&item, o) {
+				continue
+			}
+			route := client.ObjectKeyFromObject(&item)
+			requests = append(requests, reconcile.Request{NamespacedName: route})
+			log.V(logLevelEnqueue).Info("Enqueued HTTPRoute", logKeyRoute, route)
+		}
+		return requests
+	})
+}
+
 // enqueueRequestForGateway .
 // TODO: document
 func (r *HTTPRouteReconciler) enqueueRequestForGateway() handler.EventHandler {
@@ -260,7 +312,7 @@ func (r *HTTPRouteReconciler) enqueue(ctx context.Context, opts ...client.ListOp
 		requests[i] = reconcile.Request{
 			NamespacedName: route,
 		}
-		log.Info("Enqueued HTTPRoute for resource", "route", route)
+		log.V(logLevelEnqueue).Info("Enqueued HTTPRoute", logKeyRoute, route)
 	}
 	return requests
 }
@@ -281,7 +333,11 @@ func (r *HTTPRouteReconciler) updateStatus(ctx context.Context, original, new *g
 	if cmp.Equal(oldStatus, newStatus, opts) {
 		return nil
 	}
-	return r.Client.Status().Update(ctx, new)
+	ctx, cancel := statusContext(ctx)
+	defer cancel()
+	return updateStatusWithRetry(ctx, r.Client, new, func(latest *gatewayv1.HTTPRoute) {
+		latest.Status.Parents = mergeRouteParentStatuses(latest.Status.Parents, new.Status.Parents, latest.Spec.ParentRefs, new.Spec.ParentRefs)
+	})
 }
 
 // handleReconcileErrorWithStatus .
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/pkg/routechecks"
+)
+
+func TestHTTPRouteReconcilerExtraChecks(t *testing.T) {
+	route := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+			},
+			Rules: []gatewayv1.HTTPRouteRule{{
+				BackendRefs: []gatewayv1.HTTPBackendRef{{
+					BackendRef: gatewayv1.BackendRef{
+						BackendObjectReference: gatewayv1.BackendObjectReference{
+							Name: "app",
+							Port: ptr.To[gatewayv1.PortNumber](80),
+						},
+					},
+				}},
+			}},
+		},
+	}
+	// requireTeamLabel only accepts routes with a team label.
+	requireTeamLabel := func(input routechecks.Input, ref gatewayv1.ParentReference) (bool, error) {
+		hr := input.(*routechecks.HTTPRouteInput).HTTPRoute
+		if hr.Labels["team"] != "" {
+			return true, nil
+		}
+		input.SetParentCondition(ref, metav1.Condition{
+			Type:    string(gatewayv1.RouteConditionAccepted),
+			Status:  metav1.ConditionFalse,
+			Reason:  string(gatewayv1.RouteReasonNotAllowedByListeners),
+			Message: "HTTPRoutes must have a team label",
+		})
+		return false, nil
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   metav1.ConditionStatus
+	}{
+		{name: "accepted", labels: map[string]string{"team": "a"}, want: metav1.ConditionTrue},
+		{name: "rejected by extra check", want: metav1.ConditionFalse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := route.DeepCopy()
+			route.Labels = tt.labels
+			c := newTestClient(route)
+			r := &HTTPRouteReconciler{
+				Client: c,
+				ExtraChecks: routechecks.Checks{
+					Gateway: []routechecks.CheckGatewayFunc{requireTeamLabel},
+				},
+			}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(route)}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := &gatewayv1.HTTPRoute{}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(route), got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Status.Parents) != 1 {
+				t.Fatalf("got %d parent statuses, want 1", len(got.Status.Parents))
+			}
+			accepted := meta.FindStatusCondition(got.Status.Parents[0].Conditions, string(gatewayv1.RouteConditionAccepted))
+			if accepted == nil || accepted.Status != tt.want {
+				t.Errorf("Accepted condition = %+v, want status %s", accepted, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPRouteReconcilerExtensionRefs(t *testing.T) {
+	route := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+			},
+			Rules: []gatewayv1.HTTPRouteRule{{
+				Filters: []gatewayv1.HTTPRouteFilter{{
+					Type: gatewayv1.HTTPRouteFilterExtensionRef,
+					ExtensionRef: &gatewayv1.LocalObjectReference{
+						Kind: "ConfigMap",
+						Name: "error-page",
+					},
+				}},
+				BackendRefs: []gatewayv1.HTTPBackendRef{{
+					BackendRef: gatewayv1.BackendRef{
+						BackendObjectReference: gatewayv1.BackendObjectReference{
+							Name: "app",
+							Port: ptr.To[gatewayv1.PortNumber](80),
+						},
+					},
+				}},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		data       map[string]string
+		missing    bool
+		wantReason string
+	}{
+		{name: "valid", data: map[string]string{"body": "oops"}, wantReason: string(gatewayv1.RouteReasonResolvedRefs)},
+		{name: "valid fallback", data: map[string]string{"fallback": "app:80"}, wantReason: string(gatewayv1.RouteReasonResolvedRefs)},
+		{name: "missing", missing: true, wantReason: routechecks.RouteReasonInvalidFilter},
+		{name: "invalid status codes", data: map[string]string{"body": "oops", "statusCodes": "5xx"}, wantReason: routechecks.RouteReasonInvalidFilter},
+		{name: "missing fallback Service", data: map[string]string{"fallback": "missing:80"}, wantReason: routechecks.RouteReasonInvalidFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{route.DeepCopy()}
+			if !tt.missing {
+				objs = append(objs, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "error-page"},
+					Data:       tt.data,
+				})
+			}
+			c := newTestClient(objs...)
+			r := &HTTPRouteReconciler{Client: c}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(route)}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := &gatewayv1.HTTPRoute{}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(route), got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Status.Parents) != 1 {
+				t.Fatalf("got %d parent statuses, want 1", len(got.Status.Parents))
+			}
+			conditions := got.Status.Parents[0].Conditions
+			resolved := meta.FindStatusCondition(conditions, string(gatewayv1.RouteConditionResolvedRefs))
+			if resolved == nil || resolved.Reason != tt.wantReason {
+				t.Errorf("ResolvedRefs condition = %+v, want reason %s", resolved, tt.wantReason)
+			}
+			// Requests are responded to with a 500 instead, so the route is
+			// still accepted.
+			if !meta.IsStatusConditionTrue(conditions, string(gatewayv1.RouteConditionAccepted)) {
+				t.Errorf("Accepted condition = %+v, want true", meta.FindStatusCondition(conditions, string(gatewayv1.RouteConditionAccepted)))
+			}
+		})
+	}
+}
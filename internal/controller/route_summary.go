@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes;tcproutes;tlsroutes;udproutes,verbs=patch
+
+// RouteAnnotationGeneratedConfig is an annotation set on routes by the
+// controller, summarising the config generated for the route by each Gateway
+// it is attached to. The value is a JSON object keyed by the `namespace/name`
+// of the Gateway, with the listeners the route was added to and the number of
+// Caddy handlers generated for it.
+//
+// A route that is attached to a Gateway but has no entry for it didn't
+// produce any config, e.g. because none of its listeners allow the route.
+const RouteAnnotationGeneratedConfig = string(gateway.ControllerDomain) + "/generated-config"
+
+// setRouteSummaries updates the RouteAnnotationGeneratedConfig annotation of
+// every route attached to the Gateway. Failures are only logged, as the
+// annotation is purely informational.
+func (r *GatewayReconciler) setRouteSummaries(ctx context.Context, gw *gatewayv1.Gateway, i *caddy.Input) {
+	for _, hr := range i.HTTPRoutes {
+		r.setRouteSummary(ctx, gw, &hr, i.RouteSummary("HTTPRoute", &hr))
+	}
+	for _, tr := range i.TCPRoutes {
+		r.setRouteSummary(ctx, gw, &tr, i.RouteSummary("TCPRoute", &tr))
+	}
+	for _, tr := range i.TLSRoutes {
+		r.setRouteSummary(ctx, gw, &tr, i.RouteSummary("TLSRoute", &tr))
+	}
+	for _, ur := range i.UDPRoutes {
+		r.setRouteSummary(ctx, gw, &ur, i.RouteSummary("UDPRoute", &ur))
+	}
+}
+
+func (r *GatewayReconciler) setRouteSummary(ctx context.Context, gw *gatewayv1.Gateway, route client.Object, summary *caddy.RouteSummary) {
+	log := log.FromContext(ctx, logKeyRoute, client.ObjectKeyFromObject(route))
+
+	summaries := map[string]*caddy.RouteSummary{}
+	if v, ok := route.GetAnnotations()[RouteAnnotationGeneratedConfig]; ok {
+		// Start over if the annotation was mangled.
+		_ = json.Unmarshal([]byte(v), &summaries)
+	}
+	key := client.ObjectKeyFromObject(gw).String()
+	if summary == nil {
+		delete(summaries, key)
+	} else {
+		summaries[key] = summary
+	}
+	b, err := json.Marshal(summaries)
+	if err != nil {
+		log.Error(err, "Unable to marshal generated config summary")
+		return
+	}
+	if route.GetAnnotations()[RouteAnnotationGeneratedConfig] == string(b) {
+		return
+	}
+
+	original, ok := route.DeepCopyObject().(client.Object)
+	if !ok {
+		return
+	}
+	annotations := route.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[RouteAnnotationGeneratedConfig] = string(b)
+	route.SetAnnotations(annotations)
+	// Use an optimistic lock, as other Gateways may be updating the
+	// annotation at the same time. Conflicts are resolved on the next
+	// reconcile.
+	if err := r.Client.Patch(ctx, route, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		log.V(logLevelDebug).Info("Unable to update generated config summary", "error", err)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"fmt"
 
 	gateway "github.com/caddyserver/gateway/internal"
-	"github.com/caddyserver/gateway/internal/routechecks"
+	"github.com/caddyserver/gateway/pkg/routechecks"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	corev1 "k8s.io/api/core/v1"
@@ -38,6 +38,10 @@ type TLSRouteReconciler struct {
 
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// ExtraChecks are run against every TLSRoute after the checks of
+	// routechecks.TLSRouteChecks, e.g. to enforce naming policies.
+	ExtraChecks routechecks.Checks
 }
 
 var _ reconcile.Reconciler = (*TLSRouteReconciler)(nil)
@@ -58,7 +62,7 @@ func (r *TLSRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				if err != nil {
 					mgr.GetLogger().WithValues(
 						"controller", "tls-route",
-						"resource", client.ObjectKeyFromObject(o),
+						logKeyResource, client.ObjectKeyFromObject(o),
 					).Error(err, "Failed to get backend service name")
 					continue
 				}
@@ -125,6 +129,14 @@ func (r *TLSRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	route := original.DeepCopy()
 
+	// Only report the status of parents managed by us. Only the status of the
+	// route is ever updated, so the modified spec is never persisted.
+	route.Spec.ParentRefs = managedParentRefs(ctx, r.Client, route.Namespace, route.Spec.ParentRefs)
+	if len(route.Spec.ParentRefs) == 0 {
+		log.V(logLevelTrace).Info("Ignoring TLSRoute as it has no parents managed by us")
+		return ctrl.Result{}, nil
+	}
+
 	grants := &gatewayv1beta1.ReferenceGrantList{}
 	if err := r.Client.List(ctx, grants); err != nil {
 		return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to retrieve reference grants: %w", err), original, route)
@@ -138,6 +150,8 @@ func (r *TLSRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		TLSRoute: route,
 	}
 
+	checks := routechecks.TLSRouteChecks().With(r.ExtraChecks)
+
 	// gateway validators
 	for _, parent := range route.Spec.ParentRefs {
 		// set acceptance to okay, this wil be overwritten in checks if needed
@@ -157,13 +171,7 @@ func (r *TLSRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		})
 
 		// run the actual validators
-		for _, fn := range []routechecks.CheckGatewayFunc{
-			routechecks.CheckGatewayAllowedForNamespace,
-			routechecks.CheckGatewayRouteKindAllowed,
-			routechecks.CheckGatewayMatchingPorts,
-			routechecks.CheckGatewayMatchingHostnames,
-			routechecks.CheckGatewayMatchingSection,
-		} {
+		for _, fn := range checks.Gateway {
 			continueCheck, err := fn(i, parent)
 			if err != nil {
 				return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Gateway check: %w", err), original, route)
@@ -174,11 +182,7 @@ func (r *TLSRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	}
 
-	for _, fn := range []routechecks.CheckRuleFunc{
-		routechecks.CheckAgainstCrossNamespaceBackendReferences,
-		routechecks.CheckBackend,
-		routechecks.CheckBackendIsExistingService,
-	} {
+	for _, fn := range checks.Rule {
 		continueCheck, err := fn(i)
 		if err != nil {
 			return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Backend check: %w", err), original, route)
@@ -192,7 +196,7 @@ func (r *TLSRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, fmt.Errorf("failed to update TLSRoute status: %w", err)
 	}
 
-	log.Info("Reconciled TLSRoute")
+	log.V(logLevelDebug).Info("Reconciled TLSRoute")
 	return ctrl.Result{}, nil
 }
 
@@ -252,7 +256,7 @@ func (r *TLSRouteReconciler) enqueue(ctx context.Context, opts ...client.ListOpt
 		requests[i] = reconcile.Request{
 			NamespacedName: route,
 		}
-		log.Info("Enqueued TLSRoute for resource", "route", route)
+		log.V(logLevelEnqueue).Info("Enqueued TLSRoute", logKeyRoute, route)
 	}
 	return requests
 }
@@ -273,7 +277,11 @@ func (r *TLSRouteReconciler) updateStatus(ctx context.Context, original, new *ga
 	if cmp.Equal(oldStatus, newStatus, opts) {
 		return nil
 	}
-	return r.Client.Status().Update(ctx, new)
+	ctx, cancel := statusContext(ctx)
+	defer cancel()
+	return updateStatusWithRetry(ctx, r.Client, new, func(latest *gatewayv1alpha2.TLSRoute) {
+		latest.Status.Parents = mergeRouteParentStatuses(latest.Status.Parents, new.Status.Parents, latest.Spec.ParentRefs, new.Spec.ParentRefs)
+	})
 }
 
 // handleReconcileErrorWithStatus .
@@ -8,7 +8,7 @@ import (
 	"fmt"
 
 	gateway "github.com/caddyserver/gateway/internal"
-	"github.com/caddyserver/gateway/internal/routechecks"
+	"github.com/caddyserver/gateway/pkg/routechecks"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	corev1 "k8s.io/api/core/v1"
@@ -38,6 +38,10 @@ type UDPRouteReconciler struct {
 
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// ExtraChecks are run against every UDPRoute after the checks of
+	// routechecks.UDPRouteChecks, e.g. to enforce naming policies.
+	ExtraChecks routechecks.Checks
 }
 
 var _ reconcile.Reconciler = (*UDPRouteReconciler)(nil)
@@ -58,7 +62,7 @@ func (r *UDPRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				if err != nil {
 					mgr.GetLogger().WithValues(
 						"controller", "udp-route",
-						"resource", client.ObjectKeyFromObject(o),
+						logKeyResource, client.ObjectKeyFromObject(o),
 					).Error(err, "Failed to get backend service name")
 					continue
 				}
@@ -98,6 +102,11 @@ func (r *UDPRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&gatewayv1alpha2.UDPRoute{}).
 		Watches(&corev1.Service{}, r.enqueueRequestForBackendService()).
 		Watches(&gatewayv1beta1.ReferenceGrant{}, r.enqueueRequestForReferenceGrant()).
+		Watches(
+			&gatewayv1alpha2.UDPRoute{},
+			r.enqueueRequestForSiblingRoute(),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
 		Watches(
 			&gatewayv1.Gateway{},
 			r.enqueueRequestForGateway(),
@@ -125,6 +134,14 @@ func (r *UDPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	route := original.DeepCopy()
 
+	// Only report the status of parents managed by us. Only the status of the
+	// route is ever updated, so the modified spec is never persisted.
+	route.Spec.ParentRefs = managedParentRefs(ctx, r.Client, route.Namespace, route.Spec.ParentRefs)
+	if len(route.Spec.ParentRefs) == 0 {
+		log.V(logLevelTrace).Info("Ignoring UDPRoute as it has no parents managed by us")
+		return ctrl.Result{}, nil
+	}
+
 	grants := &gatewayv1beta1.ReferenceGrantList{}
 	if err := r.Client.List(ctx, grants); err != nil {
 		return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to retrieve reference grants: %w", err), original, route)
@@ -138,6 +155,8 @@ func (r *UDPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		UDPRoute: route,
 	}
 
+	checks := routechecks.UDPRouteChecks().With(r.ExtraChecks)
+
 	// gateway validators
 	for _, parent := range route.Spec.ParentRefs {
 		// set acceptance to okay, this wil be overwritten in checks if needed
@@ -157,12 +176,7 @@ func (r *UDPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		})
 
 		// run the actual validators
-		for _, fn := range []routechecks.CheckGatewayFunc{
-			routechecks.CheckGatewayAllowedForNamespace,
-			routechecks.CheckGatewayRouteKindAllowed,
-			routechecks.CheckGatewayMatchingPorts,
-			routechecks.CheckGatewayMatchingSection,
-		} {
+		for _, fn := range checks.Gateway {
 			continueCheck, err := fn(i, parent)
 			if err != nil {
 				return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Gateway check: %w", err), original, route)
@@ -173,11 +187,7 @@ func (r *UDPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	}
 
-	for _, fn := range []routechecks.CheckRuleFunc{
-		routechecks.CheckAgainstCrossNamespaceBackendReferences,
-		routechecks.CheckBackend,
-		routechecks.CheckBackendIsExistingService,
-	} {
+	for _, fn := range checks.Rule {
 		continueCheck, err := fn(i)
 		if err != nil {
 			return r.handleReconcileErrorWithStatus(ctx, fmt.Errorf("failed to apply Backend check: %w", err), original, route)
@@ -191,7 +201,7 @@ func (r *UDPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, fmt.Errorf("failed to update UDPRoute status: %w", err)
 	}
 
-	log.Info("Reconciled UDPRoute")
+	log.V(logLevelDebug).Info("Reconciled UDPRoute")
 	return ctrl.Result{}, nil
 }
 
@@ -213,6 +223,37 @@ func (r *UDPRouteReconciler) enqueueRequestForReferenceGrant() handler.EventHand
 	return handler.EnqueueRequestsFromMapFunc(r.enqueueAll())
 }
 
+// enqueueRequestForSiblingRoute returns an event handler that enqueues every
+// UDPRoute attached to the same Gateways as a UDPRoute that changed, as only
+// one UDPRoute may be accepted per listener, so deleting or moving a route
+// may allow another to be accepted.
+func (r *UDPRouteReconciler) enqueueRequestForSiblingRoute() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []reconcile.Request {
+		route, ok := o.(*gatewayv1alpha2.UDPRoute)
+		if !ok {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, parent := range route.Spec.ParentRefs {
+			if !gateway.IsGateway(parent) {
+				continue
+			}
+			gw := types.NamespacedName{
+				Namespace: gateway.NamespaceDerefOr(parent.Namespace, route.Namespace),
+				Name:      string(parent.Name),
+			}
+			for _, req := range r.enqueue(ctx, &client.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector(gatewayIndex, gw.String()),
+			}) {
+				if req.NamespacedName != client.ObjectKeyFromObject(route) {
+					requests = append(requests, req)
+				}
+			}
+		}
+		return requests
+	})
+}
+
 // enqueueFromIndex .
 // TODO: document
 func (r *UDPRouteReconciler) enqueueFromIndex(index string) handler.MapFunc {
@@ -251,7 +292,7 @@ func (r *UDPRouteReconciler) enqueue(ctx context.Context, opts ...client.ListOpt
 		requests[i] = reconcile.Request{
 			NamespacedName: route,
 		}
-		log.Info("Enqueued UDPRoute for resource", "route", route)
+		log.V(logLevelEnqueue).Info("Enqueued UDPRoute", logKeyRoute, route)
 	}
 	return requests
 }
@@ -272,7 +313,11 @@ func (r *UDPRouteReconciler) updateStatus(ctx context.Context, original, new *ga
 	if cmp.Equal(oldStatus, newStatus, opts) {
 		return nil
 	}
-	return r.Client.Status().Update(ctx, new)
+	ctx, cancel := statusContext(ctx)
+	defer cancel()
+	return updateStatusWithRetry(ctx, r.Client, new, func(latest *gatewayv1alpha2.UDPRoute) {
+		latest.Status.Parents = mergeRouteParentStatuses(latest.Status.Parents, new.Status.Parents, latest.Spec.ParentRefs, new.Spec.ParentRefs)
+	})
 }
 
 // handleReconcileErrorWithStatus .
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// +kubebuilder:webhook:path=/validate-gateway-networking-k8s-io-v1-httproute,mutating=false,failurePolicy=ignore,sideEffects=None,groups=gateway.networking.k8s.io,resources=httproutes,verbs=create;update,versions=v1,name=vhttproute.caddyserver.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-gateway-networking-k8s-io-v1-grpcroute,mutating=false,failurePolicy=ignore,sideEffects=None,groups=gateway.networking.k8s.io,resources=grpcroutes,verbs=create;update,versions=v1,name=vgrpcroute.caddyserver.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-gateway-networking-k8s-io-v1alpha2-tcproute,mutating=false,failurePolicy=ignore,sideEffects=None,groups=gateway.networking.k8s.io,resources=tcproutes,verbs=create;update,versions=v1alpha2,name=vtcproute.caddyserver.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-gateway-networking-k8s-io-v1alpha2-tlsroute,mutating=false,failurePolicy=ignore,sideEffects=None,groups=gateway.networking.k8s.io,resources=tlsroutes,verbs=create;update,versions=v1alpha2,name=vtlsroute.caddyserver.com,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-gateway-networking-k8s-io-v1alpha2-udproute,mutating=false,failurePolicy=ignore,sideEffects=None,groups=gateway.networking.k8s.io,resources=udproutes,verbs=create;update,versions=v1alpha2,name=vudproute.caddyserver.com,admissionReviewVersions=v1
+
+// RouteValidator is a validating webhook for routes, it generates a config for
+// every Gateway of ours that a route is attached to and rejects the route if
+// the config can't be generated.
+//
+// This gives users feedback when applying a route, rather than them having to
+// dig through the controller's logs after the fact.
+type RouteValidator struct {
+	client.Client
+
+	// Gateways is the reconciler of the Gateways routes are validated
+	// against, their configs are generated with the same input and options.
+	Gateways *GatewayReconciler
+}
+
+var _ admission.CustomValidator = (*RouteValidator)(nil)
+
+// SetupWithManager registers the webhook for every supported route kind.
+func (v *RouteValidator) SetupWithManager(mgr ctrl.Manager) error {
+	for _, obj := range []runtime.Object{
+		&gatewayv1.HTTPRoute{},
+		&gatewayv1.GRPCRoute{},
+		&gatewayv1alpha2.TCPRoute{},
+		&gatewayv1alpha2.TLSRoute{},
+		&gatewayv1alpha2.UDPRoute{},
+	} {
+		if err := ctrl.NewWebhookManagedBy(mgr).
+			For(obj).
+			WithValidator(v).
+			Complete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *RouteValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *RouteValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *RouteValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *RouteValidator) validate(ctx context.Context, obj runtime.Object) error {
+	route, ok := obj.(client.Object)
+	if !ok {
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+	log := log.FromContext(ctx, logKeyRoute, client.ObjectKeyFromObject(route))
+
+	var parentRefs []gatewayv1.ParentReference
+	switch r := obj.(type) {
+	case *gatewayv1.HTTPRoute:
+		parentRefs = r.Spec.ParentRefs
+	case *gatewayv1.GRPCRoute:
+		parentRefs = r.Spec.ParentRefs
+	case *gatewayv1alpha2.TCPRoute:
+		parentRefs = r.Spec.ParentRefs
+	case *gatewayv1alpha2.TLSRoute:
+		parentRefs = r.Spec.ParentRefs
+	case *gatewayv1alpha2.UDPRoute:
+		parentRefs = r.Spec.ParentRefs
+	default:
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+
+	switch r := obj.(type) {
+	case *gatewayv1.HTTPRoute:
+		if err := caddy.ValidateHTTPRouteAnnotations(r); err != nil {
+			return err
+		}
+	case *gatewayv1alpha2.TLSRoute:
+		if err := caddy.ValidateTLSRouteAnnotations(r); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range parentRefs {
+		if !gateway.IsGateway(ref) {
+			continue
+		}
+		key := client.ObjectKey{
+			Namespace: gateway.NamespaceDerefOr(ref.Namespace, route.GetNamespace()),
+			Name:      string(ref.Name),
+		}
+		gw := &gatewayv1.Gateway{}
+		if err := v.Client.Get(ctx, key, gw); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		gwc := &gatewayv1.GatewayClass{}
+		if err := v.Client.Get(ctx, client.ObjectKey{Name: string(gw.Spec.GatewayClassName)}, gwc); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if !gateway.IsManagedGatewayClass(gwc) {
+			continue
+		}
+
+		i, err := v.getInput(ctx, gw, gwc)
+		if err != nil {
+			return err
+		}
+		// Only routes attached to a listener are added to a config, so
+		// generate it as if the route had been accepted by every parent.
+		status := admittedStatus(parentRefs)
+		switch r := obj.(type) {
+		case *gatewayv1.HTTPRoute:
+			r = r.DeepCopy()
+			r.Status.RouteStatus = status
+			i.HTTPRoutes = []gatewayv1.HTTPRoute{*r}
+		case *gatewayv1.GRPCRoute:
+			r = r.DeepCopy()
+			r.Status.RouteStatus = status
+			i.GRPCRoutes = []gatewayv1.GRPCRoute{*r}
+		case *gatewayv1alpha2.TCPRoute:
+			r = r.DeepCopy()
+			r.Status.RouteStatus = status
+			i.TCPRoutes = []gatewayv1alpha2.TCPRoute{*r}
+		case *gatewayv1alpha2.TLSRoute:
+			r = r.DeepCopy()
+			r.Status.RouteStatus = status
+			i.TLSRoutes = []gatewayv1alpha2.TLSRoute{*r}
+		case *gatewayv1alpha2.UDPRoute:
+			r = r.DeepCopy()
+			r.Status.RouteStatus = status
+			i.UDPRoutes = []gatewayv1alpha2.UDPRoute{*r}
+		}
+		if _, err := i.Config(); err != nil {
+			log.V(logLevelDebug).Info("Rejected route", logKeyGateway, key, "error", err)
+			return fmt.Errorf("unable to generate config for Gateway %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// admittedStatus returns the status of a route accepted by each of its
+// parents. Routes have no status when they are created, and their status may
+// not reflect their updated parents, so it can't be used to decide which
+// listeners the route is validated against.
+func admittedStatus(parentRefs []gatewayv1.ParentReference) gatewayv1.RouteStatus {
+	status := gatewayv1.RouteStatus{}
+	for _, ref := range parentRefs {
+		status.Parents = append(status.Parents, gatewayv1.RouteParentStatus{
+			ParentRef:      ref,
+			ControllerName: gateway.ControllerName,
+		})
+	}
+	return status
+}
+
+// getInput returns the input used to generate a config for the Gateway,
+// without any routes. It is the same input the Gateway is reconciled with, so
+// the route is validated against the Gateway's actual config.
+func (v *RouteValidator) getInput(ctx context.Context, gw *gatewayv1.Gateway, gwc *gatewayv1.GatewayClass) (*caddy.Input, error) {
+	i, err := v.Gateways.newInput(ctx, gw, gwc)
+	if err != nil {
+		return nil, err
+	}
+	// Only the route being validated is added to the config.
+	i.HTTPRoutes = nil
+	i.GRPCRoutes = nil
+	i.TCPRoutes = nil
+	i.TLSRoutes = nil
+	i.UDPRoutes = nil
+	return i, nil
+}
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+)
+
+// newTestClient returns a fake client with a managed Gateway named `gateway`
+// in the default namespace, listening for HTTP on port 80, and a Service
+// named `app` to route to.
+func newTestClient(objs ...client.Object) client.Client {
+	objs = append(objs,
+		&gatewayv1.GatewayClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "caddy"},
+			Spec:       gatewayv1.GatewayClassSpec{ControllerName: gateway.ControllerName},
+		},
+		&gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+			Spec: gatewayv1.GatewaySpec{
+				GatewayClassName: "caddy",
+				Listeners: []gatewayv1.Listener{{
+					Name:     "http",
+					Protocol: gatewayv1.HTTPProtocolType,
+					Port:     80,
+				}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: "10.0.0.1",
+				Ports:     []corev1.ServicePort{{Name: "http", Port: 80}},
+			},
+		},
+	)
+	return newTestClientWith(objs...)
+}
+
+// newTestRouteValidator returns a RouteValidator validating routes against
+// the Gateways of the client.
+func newTestRouteValidator(c client.Client) *RouteValidator {
+	return &RouteValidator{Client: c, Gateways: &GatewayReconciler{Client: c}}
+}
+
+func TestRouteValidatorValidateCreate(t *testing.T) {
+	route := func(timeout gatewayv1.Duration) *gatewayv1.HTTPRoute {
+		return &gatewayv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{
+					ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+				},
+				Rules: []gatewayv1.HTTPRouteRule{{
+					BackendRefs: []gatewayv1.HTTPBackendRef{{
+						BackendRef: gatewayv1.BackendRef{
+							BackendObjectReference: gatewayv1.BackendObjectReference{
+								Name: "app",
+								Port: ptr.To[gatewayv1.PortNumber](80),
+							},
+						},
+					}},
+					Timeouts: &gatewayv1.HTTPRouteTimeouts{Request: ptr.To(timeout)},
+				}},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		route   *gatewayv1.HTTPRoute
+		wantErr bool
+	}{
+		{name: "valid", route: route("10s")},
+		{name: "invalid", route: route("10"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestRouteValidator(newTestClient())
+			// Routes have no status when they are created.
+			_, err := v.ValidateCreate(context.Background(), tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCreate() error = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRouteValidatorIgnoresOtherGateways(t *testing.T) {
+	route := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{{Name: "missing"}},
+			},
+			Rules: []gatewayv1.HTTPRouteRule{{
+				Timeouts: &gatewayv1.HTTPRouteTimeouts{Request: ptr.To[gatewayv1.Duration]("10")},
+			}},
+		},
+	}
+	v := newTestRouteValidator(newTestClient())
+	if _, err := v.ValidateCreate(context.Background(), route); err != nil {
+		t.Errorf("ValidateCreate() error = %v, want nil for a route without a Gateway of ours", err)
+	}
+}
+
+func TestRouteValidatorInput(t *testing.T) {
+	gwc := &gatewayv1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "caddy"},
+		Spec: gatewayv1.GatewayClassSpec{
+			ControllerName: gateway.ControllerName,
+			ParametersRef: &gatewayv1.ParametersReference{
+				Kind:      "ConfigMap",
+				Namespace: ptr.To[gatewayv1.Namespace]("default"),
+				Name:      "parameters",
+			},
+		},
+	}
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec:       gatewayv1.GatewaySpec{GatewayClassName: "caddy"},
+	}
+	attached := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "attached"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+			},
+		},
+		Status: gatewayv1.HTTPRouteStatus{RouteStatus: admittedStatus([]gatewayv1.ParentReference{{Name: "gateway"}})},
+	}
+	c := newTestClientWith(gwc, gw, attached,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "parameters"},
+			Data:       map[string]string{caddy.ParameterCatchAllStatusCode: "404"},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app-abcde"},
+		},
+	)
+	v := &RouteValidator{
+		Client: c,
+		Gateways: &GatewayReconciler{
+			Client:           c,
+			GeneratorOptions: caddy.GeneratorOptions{AllowedFilterHandlers: []string{"encode"}},
+			PodUpstreams:     true,
+		},
+	}
+
+	i, err := v.getInput(context.Background(), gw, gwc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Parameters == nil || i.Parameters.CatchAllStatusCode != 404 {
+		t.Errorf("Parameters = %+v, want the GatewayClass's parameters", i.Parameters)
+	}
+	if !slices.Equal(i.AllowedFilterHandlers, []string{"encode"}) {
+		t.Errorf("AllowedFilterHandlers = %v, want the reconciler's", i.AllowedFilterHandlers)
+	}
+	if !i.PodUpstreams || len(i.EndpointSlices) != 1 {
+		t.Errorf("PodUpstreams = %t with %d EndpointSlices, want the reconciler's with every EndpointSlice", i.PodUpstreams, len(i.EndpointSlices))
+	}
+	// Only the validated route is added to the input.
+	if len(i.HTTPRoutes) != 0 {
+		t.Errorf("got %d HTTPRoutes, want none", len(i.HTTPRoutes))
+	}
+}
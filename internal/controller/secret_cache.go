@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TLSSecretsCacheOptions returns the cache options used to only cache Secrets
+// of type `kubernetes.io/tls`.
+//
+// The controller must be able to read every Secret, as listeners and
+// BackendTLSPolicies may reference Secrets in any namespace, but caching all
+// of them keeps every credential in the cluster in memory. Other Secrets that
+// are referenced are read using TLSSecretsClient.
+func TLSSecretsCacheOptions() cache.ByObject {
+	return cache.ByObject{
+		Field: fields.OneTermEqualSelector("type", string(corev1.SecretTypeTLS)),
+	}
+}
+
+// TLSSecretsClient wraps a client whose cache only holds TLS Secrets, see
+// TLSSecretsCacheOptions. Secrets that aren't in the cache are read using
+// apiReader instead, so Secrets of other types can still be referenced.
+//
+// Changes to Secrets that aren't cached aren't watched, so are only noticed
+// the next time a Gateway is reconciled.
+func TLSSecretsClient(c client.Client, apiReader client.Reader) client.Client {
+	return &tlsSecretsClient{Client: c, apiReader: apiReader}
+}
+
+type tlsSecretsClient struct {
+	client.Client
+
+	apiReader client.Reader
+}
+
+func (c *tlsSecretsClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	err := c.Client.Get(ctx, key, obj, opts...)
+	if _, ok := obj.(*corev1.Secret); ok && apierrors.IsNotFound(err) {
+		return c.apiReader.Get(ctx, key, obj, opts...)
+	}
+	return err
+}
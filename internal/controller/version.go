@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package controller
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// Version is the version of the controller, releases set it with
+// `-ldflags "-X github.com/caddyserver/gateway/internal/controller.Version=v0.1.0"`.
+// The version of the main module is used if it isn't set.
+var Version string
+
+// gatewayAPIModule is the module of the Gateway API the controller is built
+// against, its version is the newest CRD bundle we support.
+const gatewayAPIModule = "sigs.k8s.io/gateway-api"
+
+// BuildInfo describes the build of the controller and what it supports, it is
+// served by the `/version` endpoint of the probe server.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	GoVersion string `json:"goVersion"`
+
+	// GatewayAPIVersion is the version of the Gateway API the controller is
+	// built against.
+	GatewayAPIVersion string `json:"gatewayAPIVersion"`
+
+	// MinimumBundleVersion is the oldest Gateway API CRD bundle supported.
+	MinimumBundleVersion string `json:"minimumBundleVersion"`
+
+	// SupportedFeatures are the features of the Gateway API we support.
+	SupportedFeatures []FeatureSupport `json:"supportedFeatures"`
+
+	// Features are the optional features of the controller that are
+	// enabled, named after the flags enabling them.
+	Features []string `json:"features"`
+}
+
+// FeatureSupport describes a feature of the Gateway API we support.
+type FeatureSupport struct {
+	Name gatewayv1.SupportedFeature `json:"name"`
+
+	// MinimumBundleVersion is the oldest Gateway API CRD bundle the feature
+	// is advertised with, if newer than BuildInfo.MinimumBundleVersion.
+	MinimumBundleVersion string `json:"minimumBundleVersion,omitempty"`
+}
+
+// readBuildInfo returns the build of the controller, without any features.
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:              Version,
+		GoVersion:            runtime.Version(),
+		MinimumBundleVersion: "v" + minimumBundleVersion.String(),
+		SupportedFeatures:    make([]FeatureSupport, 0, len(supportedFeatures)),
+		Features:             []string{},
+	}
+	for _, f := range supportedFeatures {
+		s := FeatureSupport{Name: f}
+		if v, ok := featureMinimumBundleVersions[f]; ok {
+			s.MinimumBundleVersion = "v" + v.String()
+		}
+		info.SupportedFeatures = append(info.SupportedFeatures, s)
+	}
+	slices.SortFunc(info.SupportedFeatures, func(a, b FeatureSupport) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			info.Revision = s.Value
+		}
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == gatewayAPIModule {
+			info.GatewayAPIVersion = dep.Version
+		}
+	}
+	return info
+}
+
+// BuildInfo returns the build of the controller, along with the optional
+// features enabled on the reconciler.
+func (r *GatewayReconciler) BuildInfo() BuildInfo {
+	info := readBuildInfo()
+	add := func(enabled bool, feature string) {
+		if enabled {
+			info.Features = append(info.Features, feature)
+		}
+	}
+	add(r.Agent != nil, "agent-gateway")
+	add(r.DisableBackendAutoTLS, "disable-backend-auto-tls")
+	add(r.PodUpstreams, "pod-upstreams")
+	add(r.TargetedProgramming, "targeted-programming")
+	add(r.Rollout.enabled(), "rollout-batch-percent")
+	add(r.PodMonitors.Enabled, "pod-monitors")
+	add(r.Provision.enabled(), "provision-image")
+	add(r.ValidationImage != "", "validation-image")
+	publisher := r.ConfigPublisher
+	if publisher == "" {
+		publisher = ConfigPublisherAdminAPI
+	}
+	info.Features = append(info.Features, "config-publisher="+string(publisher))
+	return info
+}
+
+// VersionHandler serves the build of the controller as JSON.
+func VersionHandler(info BuildInfo) http.Handler {
+	b, err := json.Marshal(info)
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	})
+}
@@ -4,15 +4,30 @@
 package gateway
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"slices"
+	"strconv"
 	"strings"
 
+	certificatesv1alpha1 "k8s.io/api/certificates/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
 )
 
 const (
@@ -22,6 +37,10 @@ const (
 	ControllerName = ControllerDomain + "/gateway-controller"
 )
 
+// MaxBackendWeight is the largest weight a BackendRef may have.
+// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.BackendRef
+const MaxBackendWeight = 1_000_000
+
 // MatchesControllerName checks if the given string matches the name of our
 // gateway controller.
 func MatchesControllerName[T ~string](v T) bool {
@@ -30,6 +49,27 @@ func MatchesControllerName[T ~string](v T) bool {
 	return strings.HasPrefix(string(v), string(ControllerName))
 }
 
+// watchedGatewayClasses are the names of the GatewayClasses the controller is
+// restricted to, if empty every GatewayClass using our controller is watched.
+var watchedGatewayClasses []string
+
+// SetWatchedGatewayClasses restricts the controller to the GatewayClasses with
+// the given names, allowing multiple instances of the controller to each manage
+// their own GatewayClasses. This must be called before any controllers are
+// started.
+func SetWatchedGatewayClasses(names []string) {
+	watchedGatewayClasses = names
+}
+
+// IsManagedGatewayClass checks if the given GatewayClass uses our gateway
+// controller and is watched by this instance of it.
+func IsManagedGatewayClass(gwc *gatewayv1.GatewayClass) bool {
+	if !MatchesControllerName(gwc.Spec.ControllerName) {
+		return false
+	}
+	return len(watchedGatewayClasses) == 0 || slices.Contains(watchedGatewayClasses, gwc.Name)
+}
+
 // IsGateway checks if the given ParentReference references a Gateway resource.
 func IsGateway(parent gatewayv1.ParentReference) bool {
 	return (parent.Group == nil || *parent.Group == gatewayv1.GroupName) && (parent.Kind == nil || *parent.Kind == "Gateway")
@@ -55,11 +95,113 @@ func IsLocalConfigMap(be gatewayv1.LocalObjectReference) bool {
 	return be.Group == corev1.GroupName && be.Kind == "ConfigMap"
 }
 
+// IsLocalCaddyHTTPFilter checks if the given LocalObjectReference references a
+// CaddyHTTPFilter resource.
+func IsLocalCaddyHTTPFilter(be gatewayv1.LocalObjectReference) bool {
+	return string(be.Group) == v1alpha1.GroupVersion.Group && be.Kind == "CaddyHTTPFilter"
+}
+
+// ValidateCaddyHTTPFilter checks the handler of a CaddyHTTPFilter is a JSON
+// object naming the module of a Caddy HTTP handler, which must be one of the
+// allowed handlers. The handler's config is only validated by Caddy.
+//
+// Handlers are added to the config as-is, so only modules that can't be used
+// to read files from, or reach the admin endpoint of, the Caddy instances
+// should be allowed.
+func ValidateCaddyHTTPFilter(f *v1alpha1.CaddyHTTPFilter, allowedHandlers []string) error {
+	var h struct {
+		Handler string `json:"handler"`
+	}
+	if err := json.Unmarshal(f.Spec.Handler.Raw, &h); err != nil {
+		return fmt.Errorf("CaddyHTTPFilter %s has an invalid handler: %w", f.Name, err)
+	}
+	if h.Handler == "" {
+		return fmt.Errorf("CaddyHTTPFilter %s has no handler module, it must be set using the \"handler\" key", f.Name)
+	}
+	if !slices.Contains(allowedHandlers, h.Handler) {
+		return fmt.Errorf("CaddyHTTPFilter %s uses the %q handler module, which isn't allowed by the controller", f.Name, h.Handler)
+	}
+	return nil
+}
+
+// Keys supported in a ConfigMap referenced by an HTTPRoute ExtensionRef
+// filter, which intercepts error responses from the rule's backends.
+//
+// ref; https://caddyserver.com/docs/json/apps/http/servers/routes/handle/reverse_proxy/#handle_response
+const (
+	// ErrorPageStatusCodes is a comma-separated list of backend response
+	// status codes to intercept. A single digit matches every status code in
+	// that class, e.g. `5` for every 5xx status. Defaults to `5`.
+	ErrorPageStatusCodes = "statusCodes"
+
+	// ErrorPageBody is the body of the page served instead of the backend's
+	// response, with the backend's status code.
+	ErrorPageBody = "body"
+
+	// ErrorPageContentType is the Content-Type of the page, defaults to
+	// `text/html; charset=utf-8`.
+	ErrorPageContentType = "contentType"
+
+	// ErrorPageFallback is the `name:port` of a Service in the route's
+	// namespace to proxy the request to instead, e.g. a static maintenance
+	// page. Takes priority over ErrorPageBody. The original request body is
+	// not sent to the fallback, so it should only be used for idempotent
+	// requests.
+	ErrorPageFallback = "fallback"
+)
+
+// ValidateErrorPage checks an error page ConfigMap and returns the status
+// codes it intercepts. Whether the fallback Service exists is only checked
+// when the page is used.
+func ValidateErrorPage(cm *corev1.ConfigMap) ([]int, error) {
+	codes := []int{5}
+	if v, ok := cm.Data[ErrorPageStatusCodes]; ok {
+		codes = nil
+		for _, s := range strings.Split(v, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(s))
+			// Either a status class (e.g. `5`) or a status code.
+			if err != nil || (code < 1 || code > 5) && (code < 100 || code > 599) {
+				return nil, fmt.Errorf("error page %s has an invalid status code %q", cm.Name, s)
+			}
+			codes = append(codes, code)
+		}
+	}
+	if v := cm.Data[ErrorPageFallback]; v != "" {
+		if _, _, err := ParseErrorPageFallback(v); err != nil {
+			return nil, fmt.Errorf("error page %s: %w", cm.Name, err)
+		}
+	} else if cm.Data[ErrorPageBody] == "" {
+		return nil, fmt.Errorf("error page %s: one of %q or %q must be set", cm.Name, ErrorPageBody, ErrorPageFallback)
+	}
+	return codes, nil
+}
+
+// ParseErrorPageFallback parses the `name:port` of an error page's fallback
+// Service.
+func ParseErrorPageFallback(v string) (string, int32, error) {
+	name, portStr, err := net.SplitHostPort(v)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid fallback %q: %w", v, err)
+	}
+	port, err := strconv.ParseInt(portStr, 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid fallback port %q: %w", portStr, err)
+	}
+	return name, int32(port), nil
+}
+
 // IsLocalSecret checks if the given LocalObjectReference references a Secret resource.
 func IsLocalSecret(be gatewayv1.LocalObjectReference) bool {
 	return be.Group == corev1.GroupName && be.Kind == "Secret"
 }
 
+// IsLocalClusterTrustBundle checks if the given LocalObjectReference references a
+// ClusterTrustBundle resource. ClusterTrustBundles are cluster-scoped, so the
+// reference isn't actually local to the referencing resource's namespace.
+func IsLocalClusterTrustBundle(be gatewayv1.LocalObjectReference) bool {
+	return be.Group == certificatesv1alpha1.GroupName && be.Kind == "ClusterTrustBundle"
+}
+
 // NamespaceDerefOr attempts to dereference the given Namespace if it is present, otherwise the
 // provided default value will be returned.
 func NamespaceDerefOr(ns *gatewayv1.Namespace, defaultNamespace string) string {
@@ -78,6 +220,207 @@ func GetBackendServiceName(bor gatewayv1.BackendObjectReference) (string, error)
 	return "", fmt.Errorf("unsupported backend kind %s", *bor.Kind)
 }
 
+// SupportedRouteKinds returns the kinds of routes that are able to attach to a
+// listener using the given protocol.
+func SupportedRouteKinds(protocol gatewayv1.ProtocolType) []gatewayv1.Kind {
+	switch protocol {
+	case gatewayv1.HTTPProtocolType, gatewayv1.HTTPSProtocolType:
+		return []gatewayv1.Kind{"HTTPRoute", "GRPCRoute"}
+	case gatewayv1.TLSProtocolType:
+		return []gatewayv1.Kind{"TLSRoute"}
+	case gatewayv1.TCPProtocolType:
+		return []gatewayv1.Kind{"TCPRoute"}
+	case gatewayv1.UDPProtocolType:
+		return []gatewayv1.Kind{"UDPRoute"}
+	default:
+		return nil
+	}
+}
+
+// IsRouteKindAllowed returns true if routes of the given kind are allowed to
+// attach to the listener, this takes both the listener's protocol and the
+// listener's `allowedRoutes.kinds` into account.
+func IsRouteKindAllowed(l gatewayv1.Listener, kind gatewayv1.Kind) bool {
+	if !slices.Contains(SupportedRouteKinds(l.Protocol), kind) {
+		return false
+	}
+	if l.AllowedRoutes == nil || len(l.AllowedRoutes.Kinds) == 0 {
+		return true
+	}
+	for _, k := range l.AllowedRoutes.Kinds {
+		if k.Group != nil && *k.Group != gatewayv1.GroupName {
+			continue
+		}
+		if k.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenerRouteKinds returns the kinds of routes that are able to attach to
+// the listener, as reported by the `supportedKinds` of its status. invalid is
+// true if the listener's `allowedRoutes.kinds` contains a kind that isn't
+// supported by the listener's protocol.
+func ListenerRouteKinds(l gatewayv1.Listener) (kinds []gatewayv1.RouteGroupKind, invalid bool) {
+	supported := SupportedRouteKinds(l.Protocol)
+	group := gatewayv1.Group(gatewayv1.GroupName)
+	if l.AllowedRoutes == nil || len(l.AllowedRoutes.Kinds) == 0 {
+		for _, k := range supported {
+			kinds = append(kinds, gatewayv1.RouteGroupKind{Group: &group, Kind: k})
+		}
+		return kinds, false
+	}
+	for _, k := range l.AllowedRoutes.Kinds {
+		if (k.Group != nil && *k.Group != gatewayv1.GroupName) || !slices.Contains(supported, k.Kind) {
+			invalid = true
+			continue
+		}
+		kinds = append(kinds, gatewayv1.RouteGroupKind{Group: &group, Kind: k.Kind})
+	}
+	return kinds, invalid
+}
+
+// ConflictedListeners returns why each listener conflicts with another
+// listener on the same port, listeners without conflicts are omitted.
+//
+// Listeners on the same port conflict if they use different protocols, as
+// Caddy can't serve them from a single server, or if they use the same
+// protocol and hostname, as requests can't be told apart.
+func ConflictedListeners(listeners []gatewayv1.Listener) map[gatewayv1.SectionName]gatewayv1.ListenerConditionReason {
+	conflicts := map[gatewayv1.SectionName]gatewayv1.ListenerConditionReason{}
+	for n, a := range listeners {
+		for _, b := range listeners[n+1:] {
+			if a.Port != b.Port {
+				continue
+			}
+			var reason gatewayv1.ListenerConditionReason
+			switch {
+			case a.Protocol != b.Protocol:
+				reason = gatewayv1.ListenerReasonProtocolConflict
+			case ptr.Deref(a.Hostname, "") == ptr.Deref(b.Hostname, ""):
+				reason = gatewayv1.ListenerReasonHostnameConflict
+			default:
+				continue
+			}
+			// Protocol conflicts take precedence, as they can't be resolved
+			// by changing hostnames.
+			for _, name := range []gatewayv1.SectionName{a.Name, b.Name} {
+				if conflicts[name] != gatewayv1.ListenerReasonProtocolConflict {
+					conflicts[name] = reason
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// ErrServicePortProtocol is returned by ResolveServicePort when the Service
+// has the referenced port, but only for another protocol.
+var ErrServicePortProtocol = errors.New("service port uses another protocol")
+
+// ResolveServicePort returns the port on the Service that is referenced by the
+// port of a backendRef. A Service may use the same port for more than one
+// protocol, such as TCP and UDP for DNS, so the ServicePort of the protocol
+// used to connect to the backend is returned.
+func ResolveServicePort(svc *corev1.Service, port int32, protocol corev1.Protocol) (corev1.ServicePort, error) {
+	var others []string
+	for _, sp := range svc.Spec.Ports {
+		if sp.Port != port {
+			continue
+		}
+		p := sp.Protocol
+		if p == "" {
+			p = corev1.ProtocolTCP
+		}
+		if p == protocol {
+			return sp, nil
+		}
+		others = append(others, string(p))
+	}
+	if len(others) > 0 {
+		return corev1.ServicePort{}, fmt.Errorf(
+			"%w: service %s/%s has port %d for %s, not %s",
+			ErrServicePortProtocol, svc.Namespace, svc.Name, port, strings.Join(others, ", "), protocol,
+		)
+	}
+	return corev1.ServicePort{}, fmt.Errorf("service %s/%s has no port %d", svc.Namespace, svc.Name, port)
+}
+
+// IsRouteAttachable returns true if the route has been accepted by the
+// Gateway, according to the given statuses of its parents.
+//
+// A route that wasn't accepted by a parent, e.g. because none of its hostnames
+// intersect with the hostnames of the parent's listeners, is never attached to
+// it, even if its references couldn't be resolved either.
+func IsRouteAttachable(gw *gatewayv1.Gateway, route metav1.Object, parents []gatewayv1.RouteParentStatus) bool {
+	for _, rps := range parents {
+		ns := NamespaceDerefOr(rps.ParentRef.Namespace, route.GetNamespace())
+		if ns != gw.GetNamespace() {
+			continue
+		}
+
+		if string(rps.ParentRef.Name) != gw.GetName() {
+			continue
+		}
+
+		if c := meta.FindStatusCondition(rps.Conditions, string(gatewayv1.RouteConditionAccepted)); c != nil && c.Status == metav1.ConditionFalse {
+			continue
+		}
+
+		for _, cond := range rps.Conditions {
+			if cond.Type == string(gatewayv1.RouteConditionAccepted) && cond.Status == metav1.ConditionTrue {
+				return true
+			}
+
+			if cond.Type == string(gatewayv1.RouteConditionResolvedRefs) && cond.Status == metav1.ConditionFalse {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NamespaceMatchesSelector returns true if a namespace with the given labels is
+// selected by the namespace selector of a listener's AllowedRoutes.
+//
+// An empty selector selects every namespace, while a nil or invalid selector
+// selects none.
+func NamespaceMatchesSelector(selector *metav1.LabelSelector, nsLabels map[string]string) bool {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return s.Matches(labels.Set(nsLabels))
+}
+
+// GetNamespaceLabels returns the labels of a namespace. Only the metadata of
+// the namespace is read, so when c is backed by a cache this is served by the
+// metadata-only informer for Namespaces rather than the API server.
+func GetNamespaceLabels(ctx context.Context, c client.Reader, name string) (map[string]string, error) {
+	ns := &metav1.PartialObjectMetadata{}
+	ns.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, ns); err != nil {
+		return nil, err
+	}
+	return ns.GetLabels(), nil
+}
+
+// IsOlderRoute returns true if route a takes precedence over route b when
+// they conflict. The oldest route wins, then the route appearing first in
+// alphabetical order by `{namespace}/{name}`.
+func IsOlderRoute(a, b metav1.Object) bool {
+	ac, bc := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !ac.Equal(&bc) {
+		return ac.Before(&bc)
+	}
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+	return a.GetName() < b.GetName()
+}
+
 // IsBackendReferenceAllowed returns true if the backend reference is allowed by the reference grant.
 func IsBackendReferenceAllowed(originatingNamespace string, be gatewayv1.BackendRef, gvk schema.GroupVersionKind, grants []gatewayv1beta1.ReferenceGrant) bool {
 	if IsService(be.BackendObjectReference) {
@@ -86,6 +429,22 @@ func IsBackendReferenceAllowed(originatingNamespace string, be gatewayv1.Backend
 	return false
 }
 
+// IsSecretReferenceAllowed returns true if the certificate reference of a
+// Gateway in originatingNamespace is allowed by the reference grants.
+func IsSecretReferenceAllowed(originatingNamespace string, ref gatewayv1.SecretObjectReference, grants []gatewayv1beta1.ReferenceGrant) bool {
+	if IsSecret(ref) {
+		return isReferenceAllowed(originatingNamespace, string(ref.Name), ref.Namespace, gatewayv1.SchemeGroupVersion.WithKind("Gateway"), corev1.SchemeGroupVersion.WithKind("Secret"), grants)
+	}
+	return false
+}
+
+// IsClientCertificateReferenceAllowed returns true if a BackendTLSPolicy in
+// originatingNamespace is allowed to reference the client certificate Secret
+// with the given namespace and name by the reference grants.
+func IsClientCertificateReferenceAllowed(originatingNamespace, namespace, name string, grants []gatewayv1beta1.ReferenceGrant) bool {
+	return isReferenceAllowed(originatingNamespace, name, ptr.To(gatewayv1.Namespace(namespace)), gatewayv1alpha3.SchemeGroupVersion.WithKind("BackendTLSPolicy"), corev1.SchemeGroupVersion.WithKind("Secret"), grants)
+}
+
 func isReferenceAllowed(originatingNamespace, name string, namespace *gatewayv1.Namespace, fromGVK, toGVK schema.GroupVersionKind, grants []gatewayv1beta1.ReferenceGrant) bool {
 	ns := NamespaceDerefOr(namespace, originatingNamespace)
 	if originatingNamespace == ns {
@@ -111,6 +470,34 @@ func isReferenceAllowed(originatingNamespace, name string, namespace *gatewayv1.
 	return false
 }
 
+// ValidateHostname checks if the given hostname is a valid RFC 1123 hostname
+// that can be used by a Listener or Route. Hostnames may be prefixed with a
+// single wildcard label (`*.`), but IP addresses are not allowed.
+//
+// The returned error describes exactly why the hostname is invalid.
+func ValidateHostname(hostname string) error {
+	if hostname == "" {
+		return errors.New("hostname must not be empty")
+	}
+	if net.ParseIP(hostname) != nil {
+		return fmt.Errorf("hostname %q must not be an IP address", hostname)
+	}
+
+	var errs []string
+	if strings.HasPrefix(hostname, "*") {
+		errs = validation.IsWildcardDNS1123Subdomain(hostname)
+	} else {
+		if strings.Contains(hostname, "*") {
+			return fmt.Errorf("hostname %q may only contain a wildcard as the first label", hostname)
+		}
+		errs = validation.IsDNS1123Subdomain(hostname)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("hostname %q is invalid: %s", hostname, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // ComputeHosts returns a list of the intersecting hostnames between the route and the listener.
 // The below function is inspired from https://github.com/envoyproxy/gateway/blob/main/internal/gatewayapi/helpers.go.
 // Special thanks to Envoy team.
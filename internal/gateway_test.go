@@ -0,0 +1,406 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package gateway
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+)
+
+func TestNamespaceMatchesSelector(t *testing.T) {
+	labels := map[string]string{
+		"kubernetes.io/metadata.name": "apps",
+		"env":                         "prod",
+		"team":                        "web",
+	}
+	tests := []struct {
+		name     string
+		selector *metav1.LabelSelector
+		labels   map[string]string
+		want     bool
+	}{
+		{
+			name:     "nil selector",
+			selector: nil,
+			labels:   labels,
+			want:     false,
+		},
+		{
+			name:     "empty selector",
+			selector: &metav1.LabelSelector{},
+			labels:   labels,
+			want:     true,
+		},
+		{
+			name:     "empty selector without labels",
+			selector: &metav1.LabelSelector{},
+			labels:   nil,
+			want:     true,
+		},
+		{
+			name:     "match labels",
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod", "team": "web"}},
+			labels:   labels,
+			want:     true,
+		},
+		{
+			name:     "match labels partial",
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod", "team": "api"}},
+			labels:   labels,
+			want:     false,
+		},
+		{
+			name: "expression in",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "env",
+				Operator: metav1.LabelSelectorOpIn,
+				Values:   []string{"staging", "prod"},
+			}}},
+			labels: labels,
+			want:   true,
+		},
+		{
+			name: "expression not in",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "env",
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{"prod"},
+			}}},
+			labels: labels,
+			want:   false,
+		},
+		{
+			name: "expression exists",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "team",
+				Operator: metav1.LabelSelectorOpExists,
+			}}},
+			labels: labels,
+			want:   true,
+		},
+		{
+			name: "expression does not exist",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "team",
+				Operator: metav1.LabelSelectorOpDoesNotExist,
+			}}},
+			labels: labels,
+			want:   false,
+		},
+		{
+			name: "labels and expressions",
+			selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"team": "web"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      "env",
+					Operator: metav1.LabelSelectorOpNotIn,
+					Values:   []string{"prod"},
+				}},
+			},
+			labels: labels,
+			want:   false,
+		},
+		{
+			name: "invalid selector",
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      "env",
+				Operator: metav1.LabelSelectorOpIn,
+			}}},
+			labels: labels,
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NamespaceMatchesSelector(tt.selector, tt.labels); got != tt.want {
+				t.Errorf("NamespaceMatchesSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRouteAttachable(t *testing.T) {
+	gw := &gatewayv1.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"}}
+	route := &gatewayv1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "route"}}
+	parent := func(name string, conditions ...metav1.Condition) gatewayv1.RouteParentStatus {
+		return gatewayv1.RouteParentStatus{
+			ParentRef:  gatewayv1.ParentReference{Name: gatewayv1.ObjectName(name)},
+			Conditions: conditions,
+		}
+	}
+	accepted := func(status metav1.ConditionStatus) metav1.Condition {
+		return metav1.Condition{Type: string(gatewayv1.RouteConditionAccepted), Status: status}
+	}
+	resolvedRefs := func(status metav1.ConditionStatus) metav1.Condition {
+		return metav1.Condition{Type: string(gatewayv1.RouteConditionResolvedRefs), Status: status}
+	}
+	tests := []struct {
+		name    string
+		parents []gatewayv1.RouteParentStatus
+		want    bool
+	}{
+		{
+			name:    "no parents",
+			parents: nil,
+			want:    false,
+		},
+		{
+			name:    "accepted",
+			parents: []gatewayv1.RouteParentStatus{parent("gateway", accepted(metav1.ConditionTrue), resolvedRefs(metav1.ConditionTrue))},
+			want:    true,
+		},
+		{
+			name:    "accepted by another gateway",
+			parents: []gatewayv1.RouteParentStatus{parent("other", accepted(metav1.ConditionTrue))},
+			want:    false,
+		},
+		{
+			name:    "accepted with unresolved refs",
+			parents: []gatewayv1.RouteParentStatus{parent("gateway", accepted(metav1.ConditionTrue), resolvedRefs(metav1.ConditionFalse))},
+			want:    true,
+		},
+		{
+			name:    "not accepted",
+			parents: []gatewayv1.RouteParentStatus{parent("gateway", accepted(metav1.ConditionFalse), resolvedRefs(metav1.ConditionTrue))},
+			want:    false,
+		},
+		{
+			name:    "not accepted with unresolved refs",
+			parents: []gatewayv1.RouteParentStatus{parent("gateway", accepted(metav1.ConditionFalse), resolvedRefs(metav1.ConditionFalse))},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRouteAttachable(gw, route, tt.parents); got != tt.want {
+				t.Errorf("IsRouteAttachable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListenerRouteKinds(t *testing.T) {
+	kinds := func(k ...gatewayv1.Kind) *gatewayv1.AllowedRoutes {
+		allowed := &gatewayv1.AllowedRoutes{}
+		for _, kind := range k {
+			allowed.Kinds = append(allowed.Kinds, gatewayv1.RouteGroupKind{Kind: kind})
+		}
+		return allowed
+	}
+	tests := []struct {
+		name        string
+		listener    gatewayv1.Listener
+		want        []gatewayv1.Kind
+		wantInvalid bool
+	}{
+		{
+			name:     "defaults to protocol kinds",
+			listener: gatewayv1.Listener{Protocol: gatewayv1.HTTPSProtocolType},
+			want:     []gatewayv1.Kind{"HTTPRoute", "GRPCRoute"},
+		},
+		{
+			name:     "allowed kinds",
+			listener: gatewayv1.Listener{Protocol: gatewayv1.HTTPProtocolType, AllowedRoutes: kinds("GRPCRoute")},
+			want:     []gatewayv1.Kind{"GRPCRoute"},
+		},
+		{
+			name:        "unsupported kind",
+			listener:    gatewayv1.Listener{Protocol: gatewayv1.HTTPProtocolType, AllowedRoutes: kinds("HTTPRoute", "TCPRoute")},
+			want:        []gatewayv1.Kind{"HTTPRoute"},
+			wantInvalid: true,
+		},
+		{
+			name:     "unsupported protocol",
+			listener: gatewayv1.Listener{Protocol: "SCTP"},
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, invalid := ListenerRouteKinds(tt.listener)
+			var gotKinds []gatewayv1.Kind
+			for _, k := range got {
+				if k.Group == nil || *k.Group != gatewayv1.GroupName {
+					t.Errorf("ListenerRouteKinds() group = %v, want %s", k.Group, gatewayv1.GroupName)
+				}
+				gotKinds = append(gotKinds, k.Kind)
+			}
+			if !slices.Equal(gotKinds, tt.want) || invalid != tt.wantInvalid {
+				t.Errorf("ListenerRouteKinds() = %v, %v, want %v, %v", gotKinds, invalid, tt.want, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestConflictedListeners(t *testing.T) {
+	listener := func(name string, protocol gatewayv1.ProtocolType, port gatewayv1.PortNumber, hostname string) gatewayv1.Listener {
+		l := gatewayv1.Listener{Name: gatewayv1.SectionName(name), Protocol: protocol, Port: port}
+		if hostname != "" {
+			h := gatewayv1.Hostname(hostname)
+			l.Hostname = &h
+		}
+		return l
+	}
+	tests := []struct {
+		name      string
+		listeners []gatewayv1.Listener
+		want      map[gatewayv1.SectionName]gatewayv1.ListenerConditionReason
+	}{
+		{
+			name: "different hostnames",
+			listeners: []gatewayv1.Listener{
+				listener("a", gatewayv1.HTTPSProtocolType, 443, "a.example.com"),
+				listener("b", gatewayv1.HTTPSProtocolType, 443, "b.example.com"),
+				listener("c", gatewayv1.HTTPSProtocolType, 443, ""),
+			},
+			want: map[gatewayv1.SectionName]gatewayv1.ListenerConditionReason{},
+		},
+		{
+			name: "same hostname",
+			listeners: []gatewayv1.Listener{
+				listener("a", gatewayv1.HTTPProtocolType, 80, "example.com"),
+				listener("b", gatewayv1.HTTPProtocolType, 80, "example.com"),
+				listener("c", gatewayv1.HTTPProtocolType, 8080, "example.com"),
+			},
+			want: map[gatewayv1.SectionName]gatewayv1.ListenerConditionReason{
+				"a": gatewayv1.ListenerReasonHostnameConflict,
+				"b": gatewayv1.ListenerReasonHostnameConflict,
+			},
+		},
+		{
+			name: "protocol conflict takes precedence",
+			listeners: []gatewayv1.Listener{
+				listener("a", gatewayv1.HTTPProtocolType, 80, ""),
+				listener("b", gatewayv1.HTTPProtocolType, 80, ""),
+				listener("c", gatewayv1.TCPProtocolType, 80, ""),
+			},
+			want: map[gatewayv1.SectionName]gatewayv1.ListenerConditionReason{
+				"a": gatewayv1.ListenerReasonProtocolConflict,
+				"b": gatewayv1.ListenerReasonProtocolConflict,
+				"c": gatewayv1.ListenerReasonProtocolConflict,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConflictedListeners(tt.listeners); !maps.Equal(got, tt.want) {
+				t.Errorf("ConflictedListeners() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveServicePort(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt32(8080)},
+				{Name: "dns-tcp", Port: 53, Protocol: corev1.ProtocolTCP},
+				{Name: "dns-udp", Port: 53, Protocol: corev1.ProtocolUDP},
+				{Name: "syslog", Port: 514, Protocol: corev1.ProtocolUDP},
+			},
+		},
+	}
+	tests := []struct {
+		name         string
+		port         int32
+		protocol     corev1.Protocol
+		want         string
+		wantProtocol bool
+	}{
+		{name: "port", port: 80, protocol: corev1.ProtocolTCP, want: "http"},
+		{name: "tcp port shared with udp", port: 53, protocol: corev1.ProtocolTCP, want: "dns-tcp"},
+		{name: "udp port shared with tcp", port: 53, protocol: corev1.ProtocolUDP, want: "dns-udp"},
+		// Only ports can be referenced by a backendRef, not targetPorts.
+		{name: "target port", port: 8080, protocol: corev1.ProtocolTCP},
+		{name: "missing port", port: 443, protocol: corev1.ProtocolTCP},
+		{name: "port of another protocol", port: 514, protocol: corev1.ProtocolTCP, wantProtocol: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveServicePort(svc, tt.port, tt.protocol)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("ResolveServicePort() = %s, want an error", got.Name)
+				}
+				if errors.Is(err, ErrServicePortProtocol) != tt.wantProtocol {
+					t.Errorf("ResolveServicePort() error = %v, want ErrServicePortProtocol: %t", err, tt.wantProtocol)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want {
+				t.Errorf("ResolveServicePort() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCaddyHTTPFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		wantErr bool
+	}{
+		{name: "valid", handler: `{"handler":"encode","encodings":{"gzip":{}}}`},
+		{name: "handler not allowed", handler: `{"handler":"file_server","root":"/"}`, wantErr: true},
+		{name: "handler not allowed by name", handler: `{"handler":"reverse_proxy","upstreams":[{"dial":"localhost:2019"}]}`, wantErr: true},
+		{name: "missing handler", handler: `{"encodings":{"gzip":{}}}`, wantErr: true},
+		{name: "not a string", handler: `{"handler":1}`, wantErr: true},
+		{name: "not an object", handler: `["encode"]`, wantErr: true},
+		{name: "empty", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &v1alpha1.CaddyHTTPFilter{
+				Spec: v1alpha1.CaddyHTTPFilterSpec{Handler: runtime.RawExtension{Raw: []byte(tt.handler)}},
+			}
+			if err := ValidateCaddyHTTPFilter(f, []string{"encode", "templates"}); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCaddyHTTPFilter() error = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateErrorPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    []int
+		wantErr bool
+	}{
+		{name: "default status codes", data: map[string]string{"body": "oops"}, want: []int{5}},
+		{name: "status codes", data: map[string]string{"body": "oops", "statusCodes": "4, 503"}, want: []int{4, 503}},
+		{name: "fallback", data: map[string]string{"fallback": "maintenance:80"}, want: []int{5}},
+		{name: "invalid status code", data: map[string]string{"body": "oops", "statusCodes": "5xx"}, wantErr: true},
+		{name: "status code out of range", data: map[string]string{"body": "oops", "statusCodes": "600"}, wantErr: true},
+		{name: "invalid status class", data: map[string]string{"body": "oops", "statusCodes": "6"}, wantErr: true},
+		{name: "invalid fallback", data: map[string]string{"fallback": "maintenance"}, wantErr: true},
+		{name: "no body or fallback", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateErrorPage(&corev1.ConfigMap{Data: tt.data})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateErrorPage() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ValidateErrorPage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +0,0 @@
-// SPDX-License-Identifier: Apache-2.0
-// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
-
-package layer4
-
-type Handler interface {
-	IAmAHandler()
-}
@@ -6,7 +6,11 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -16,18 +20,28 @@ import (
 	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	//+kubebuilder:scaffold:imports
 
+	gatewayv1alpha1 "github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
 	"github.com/caddyserver/gateway/internal/controller"
+	"github.com/caddyserver/gateway/pkg/routechecks"
 )
 
 var (
@@ -42,6 +56,8 @@ func init() {
 	utilruntime.Must(gatewayv1alpha2.Install(scheme))
 	utilruntime.Must(gatewayv1alpha3.Install(scheme))
 	utilruntime.Must(gatewayv1beta1.Install(scheme))
+
+	utilruntime.Must(gatewayv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -51,6 +67,47 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var mode string
+	var agentGateway string
+	var adminSocket string
+	var logFormat string
+	var disableBackendAutoTLS bool
+	var podUpstreams bool
+	var targetedProgramming bool
+	var maxConcurrentReconciles int
+	var programmingConcurrency int
+	var validationImage string
+	var configPublisher string
+	var configDir string
+	var configPullListen string
+	var configPullURL string
+	var configPullInterval time.Duration
+	var watchGatewayClasses string
+	var gracefulShutdownTimeout time.Duration
+	var enableRouteWebhook bool
+	var cacheTLSSecretsOnly bool
+	var caddyAdminListen string
+	var caddyProgrammingPort int
+	var programmingStrategy string
+	var rolloutBatchPercent int
+	var rolloutMaxErrorRate float64
+	var rolloutErrorRateWindow time.Duration
+	var adminTLSCA string
+	var adminTLSCert string
+	var adminTLSKey string
+	var adminTLSSecret string
+	var caddyGracePeriod time.Duration
+	var caddyCatchAllStatusCode int
+	var caddyReservedPathPrefixes string
+	var caddyHTTPFilterHandlers string
+	var syncPeriod time.Duration
+	var podMonitors bool
+	var podMonitorTLSSecret string
+	var podMonitorServerName string
+	var provisionImage string
+	var provisionReplicas int
+	var provisionIssuerSecret string
+	var profile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -60,13 +117,145 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&mode, "mode", "controller",
+		"The mode to run in, either \"controller\", \"agent\" or \"plan\". "+
+			"Agents run alongside a single Caddy instance and program it over a local Unix socket. "+
+			"Plan prints the changes that would be made to every Caddy instance and exits without making them.")
+	flag.StringVar(&agentGateway, "agent-gateway", "",
+		"The namespace/name of the Gateway served by the local Caddy instance, required in agent mode.")
+	flag.StringVar(&adminSocket, "admin-socket", "/run/caddy/admin.sock",
+		"The path to the Unix socket of Caddy's admin endpoint, used in agent mode.")
+	flag.BoolVar(&disableBackendAutoTLS, "disable-backend-auto-tls", false,
+		"If set, backends without a BackendTLSPolicy will never be connected to over TLS, even if their "+
+			"Service port is named https, is port 443 or has an appProtocol of https.")
+	flag.BoolVar(&podUpstreams, "pod-upstreams", false,
+		"If set, HTTP requests are proxied directly to the ready endpoints of backend Services instead of their ClusterIP.")
+	flag.BoolVar(&targetedProgramming, "targeted-programming", true,
+		"If set, only Caddy instances that aren't already running the generated config are programmed, "+
+			"such as newly added pods, rather than every instance on every reconcile.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The maximum number of Gateways reconciled at once.")
+	flag.IntVar(&programmingConcurrency, "programming-concurrency", 0,
+		"The maximum number of Caddy instances programmed at once, shared fairly between Gateways. "+
+			"Zero is unlimited.")
+	flag.StringVar(&validationImage, "validation-image", "",
+		"If set, generated configs are validated by running `caddy validate` in a Job using this Caddy image "+
+			"before being pushed to any Caddy instance. The image must include any Caddy modules in use.")
+	flag.StringVar(&configPublisher, "config-publisher", string(controller.ConfigPublisherAdminAPI),
+		"How generated configs are delivered to Caddy, either \"admin-api\" to push them to every Caddy instance, "+
+			"\"secret\" to write them to a Secret per Gateway, \"file\" to write them to --config-dir or "+
+			"\"pull\" to serve them for Caddy to pull. "+
+			"Secrets and files must be mounted into the Caddy pods and loaded with `caddy run --watch`.")
+	flag.StringVar(&configDir, "config-dir", "",
+		"The directory configs are written to when --config-publisher is \"file\", usually a volume shared with Caddy.")
+	flag.StringVar(&configPullListen, "config-pull-listen", ":2022",
+		"The address configs are served on when --config-publisher is \"pull\".")
+	flag.StringVar(&configPullURL, "config-pull-url", "",
+		"The base URL Caddy pulls configs from when --config-publisher is \"pull\", "+
+			"e.g. https://caddy-gateway.caddy-system.svc:2022.")
+	flag.DurationVar(&configPullInterval, "config-pull-interval", 30*time.Second,
+		"How often Caddy pulls its config when --config-publisher is \"pull\".")
+	flag.StringVar(&watchGatewayClasses, "watch-gateway-class", "",
+		"A comma-separated list of GatewayClass names to restrict the controller to. "+
+			"By default every GatewayClass using this controller is watched.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second,
+		"How long to wait for in-flight reconciles to finish (and persist their status) when shutting down.")
+	flag.BoolVar(&enableRouteWebhook, "enable-route-webhook", false,
+		"If set, a validating webhook is served that rejects routes a Caddy config can't be generated for.")
+	flag.BoolVar(&cacheTLSSecretsOnly, "cache-tls-secrets-only", false,
+		"If set, only Secrets of type kubernetes.io/tls are cached and watched, other referenced Secrets are "+
+			"read from the API server when a Gateway is reconciled.")
+	flag.StringVar(&caddyAdminListen, "caddy-admin-listen", caddy.DefaultAdminListen,
+		"The address Caddy's admin endpoint listens on, set in every generated config.")
+	flag.IntVar(&caddyProgrammingPort, "caddy-programming-port", 2021,
+		"The port Caddy instances are programmed on when --config-publisher is \"admin-api\", "+
+			"usually a proxy to Caddy's admin endpoint that requires mTLS.")
+	flag.StringVar(&programmingStrategy, "programming-strategy", "all",
+		"How Caddy instances are programmed with a new config when --config-publisher is \"admin-api\", "+
+			"either \"all\" to program every instance at once, or \"rolling\" to program them in batches of "+
+			"--rollout-batch-percent, verifying each batch before programming the next.")
+	flag.IntVar(&rolloutBatchPercent, "rollout-batch-percent", 25,
+		"The percentage of a Gateway's Caddy instances programmed at a time with --programming-strategy=rolling.")
+	flag.Float64Var(&rolloutMaxErrorRate, "rollout-max-error-rate", 0,
+		"The highest ratio of requests (e.g. 0.05) a Caddy instance may respond to with a 5xx status over "+
+			"--rollout-error-rate-window after being programmed with --programming-strategy=rolling, "+
+			"taken from Caddy's metrics. Disabled if 0.")
+	flag.DurationVar(&rolloutErrorRateWindow, "rollout-error-rate-window", 30*time.Second,
+		"How long the error rate of a Caddy instance is measured for, see --rollout-max-error-rate.")
+	flag.StringVar(&adminTLSCA, "admin-tls-ca", "/var/run/secrets/tls/ca.crt",
+		"The CA trusted to verify Caddy instances when connecting to them over mTLS.")
+	flag.StringVar(&adminTLSCert, "admin-tls-cert", "/var/run/secrets/tls/tls.crt",
+		"The client certificate presented to Caddy instances when connecting to them over mTLS.")
+	flag.StringVar(&adminTLSKey, "admin-tls-key", "/var/run/secrets/tls/tls.key",
+		"The private key of --admin-tls-cert.")
+	flag.StringVar(&adminTLSSecret, "admin-tls-secret", "",
+		"The namespace/name of a Secret with the CA (ca.crt) and client certificate (tls.crt and tls.key) "+
+			"used to connect to Caddy instances over mTLS, instead of --admin-tls-ca, --admin-tls-cert "+
+			"and --admin-tls-key. The client certificate is reloaded whenever the Secret changes.")
+	flag.DurationVar(&caddyGracePeriod, "caddy-grace-period", caddy.DefaultGracePeriod,
+		"How long Caddy waits for active connections to close when reloading its config. "+
+			"Can be overridden by the gracePeriod GatewayClass parameter.")
+	flag.IntVar(&caddyCatchAllStatusCode, "caddy-catch-all-status-code", caddy.DefaultCatchAllStatusCode,
+		"The status code Caddy responds with to requests that don't match any route. "+
+			"Can be overridden by the catchAllStatusCode GatewayClass parameter.")
+	flag.StringVar(&caddyReservedPathPrefixes, "caddy-reserved-path-prefixes", "",
+		"A comma-separated list of path prefixes that routes never match, e.g. /.well-known/acme-challenge/. "+
+			"Caddy responds to requests for them with a 404.")
+	flag.StringVar(&caddyHTTPFilterHandlers, "caddy-http-filter-handlers", "",
+		"A comma-separated list of Caddy HTTP handler modules CaddyHTTPFilters may use, e.g. encode,templates. "+
+			"Filters using any other module are rejected, by default CaddyHTTPFilters can't be used.")
+	flag.BoolVar(&podMonitors, "pod-monitors", false,
+		"If set, a Prometheus Operator PodMonitor is created for the Caddy instances of every Gateway, "+
+			"scraping the metrics of Caddy's admin endpoint.")
+	flag.StringVar(&podMonitorTLSSecret, "pod-monitor-tls-secret", "",
+		"The name of a Secret in the namespace of each Gateway with a client certificate (tls.crt and tls.key) "+
+			"and CA (ca.crt), used by PodMonitors to scrape Caddy instances over mTLS on --caddy-programming-port. "+
+			"By default Caddy's admin endpoint is scraped over plain HTTP.")
+	flag.StringVar(&podMonitorServerName, "pod-monitor-server-name", "",
+		"The name the certificates of every Caddy instance must carry to be scraped with --pod-monitor-tls-secret, "+
+			"defaults to <gateway>-caddy.<namespace>.")
+	flag.StringVar(&provisionImage, "provision-image", "",
+		"If set, a Service, Deployment (or DaemonSet for host network Gateways) and certificate are created for "+
+			"every Gateway, running this Caddy image. Requires --config-publisher to be \"pull\".")
+	flag.IntVar(&provisionReplicas, "provision-replicas", 2,
+		"The number of Caddy instances created for each Gateway when --provision-image is set.")
+	flag.StringVar(&provisionIssuerSecret, "provision-issuer-secret", "",
+		"The namespace/name of a TLS Secret with the CA certificate and key used to issue the client certificates "+
+			"provisioned Caddy instances pull their configs with, required with --provision-image.")
+	flag.DurationVar(&syncPeriod, "sync-period", 10*time.Hour,
+		"How often cached objects are resynced, causing everything to be reconciled again.")
+	flag.StringVar(&profile, "profile", "",
+		"A preset of flags tuned for the size of the cluster, either \""+strings.Join(profileNames(), "\" or \"")+"\". "+
+			"Flags that are set explicitly take precedence over the profile.")
+	flag.StringVar(&logFormat, "log-format", "",
+		"The format of logs, either \"text\" or \"json\". Takes precedence over --zap-encoder when set.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
+	if err := applyProfile(flag.CommandLine, profile); err != nil {
+		// The logger isn't setup yet, so this can't be logged.
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+		return
+	}
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	loggerOpts := []zap.Opts{zap.UseFlagOptions(&opts)}
+	switch logFormat {
+	case "":
+		// Leave the encoder to --zap-encoder.
+	case "text":
+		loggerOpts = append(loggerOpts, zap.ConsoleEncoder())
+	case "json":
+		loggerOpts = append(loggerOpts, zap.JSONEncoder())
+	default:
+		// The logger isn't setup yet, so this can't be logged.
+		fmt.Fprintf(os.Stderr, "unknown log format %q\n", logFormat)
+		os.Exit(1)
+		return
+	}
+	ctrl.SetLogger(zap.New(loggerOpts...))
 
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
@@ -79,6 +268,149 @@ func main() {
 		c.NextProtos = []string{"http/1.1"}
 	}
 
+	var agent *controller.AgentOptions
+	switch mode {
+	case "controller", "plan":
+	case "agent":
+		namespace, name, ok := strings.Cut(agentGateway, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Error(nil, "--agent-gateway must be set to namespace/name in agent mode")
+			os.Exit(1)
+			return
+		}
+		agent = &controller.AgentOptions{
+			Gateway:     types.NamespacedName{Namespace: namespace, Name: name},
+			AdminSocket: adminSocket,
+		}
+		// Every agent needs to program its own Caddy instance.
+		enableLeaderElection = false
+	default:
+		setupLog.Error(nil, "unknown mode", "mode", mode)
+		os.Exit(1)
+		return
+	}
+
+	adminTLS := controller.AdminTLSOptions{
+		CAPath:   adminTLSCA,
+		CertPath: adminTLSCert,
+		KeyPath:  adminTLSKey,
+	}
+	if adminTLSSecret != "" {
+		namespace, name, ok := strings.Cut(adminTLSSecret, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Error(nil, "--admin-tls-secret must be set to namespace/name")
+			os.Exit(1)
+			return
+		}
+		adminTLS.Secret = types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
+	var rollout controller.RolloutOptions
+	switch programmingStrategy {
+	case "all":
+	case "rolling":
+		if rolloutBatchPercent <= 0 || rolloutBatchPercent >= 100 {
+			setupLog.Error(nil, "--rollout-batch-percent must be between 1 and 99")
+			os.Exit(1)
+			return
+		}
+		rollout = controller.RolloutOptions{
+			BatchPercent:    rolloutBatchPercent,
+			MaxErrorRate:    rolloutMaxErrorRate,
+			ErrorRateWindow: rolloutErrorRateWindow,
+		}
+	default:
+		setupLog.Error(nil, "unknown programming strategy", "strategy", programmingStrategy)
+		os.Exit(1)
+		return
+	}
+
+	provision := controller.ProvisionOptions{
+		Image:    provisionImage,
+		Replicas: int32(provisionReplicas),
+	}
+	if provisionIssuerSecret != "" {
+		namespace, name, ok := strings.Cut(provisionIssuerSecret, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Error(nil, "--provision-issuer-secret must be set to namespace/name")
+			os.Exit(1)
+			return
+		}
+		provision.IssuerSecret = types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
+	if watchGatewayClasses != "" {
+		var names []string
+		for _, name := range strings.Split(watchGatewayClasses, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		gateway.SetWatchedGatewayClasses(names)
+	}
+
+	var reservedPathPrefixes []string
+	for _, prefix := range strings.Split(caddyReservedPathPrefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix == "" {
+			continue
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			setupLog.Error(nil, "--caddy-reserved-path-prefixes must only contain absolute paths", "prefix", prefix)
+			os.Exit(1)
+			return
+		}
+		reservedPathPrefixes = append(reservedPathPrefixes, prefix)
+	}
+
+	var filterHandlers []string
+	for _, name := range strings.Split(caddyHTTPFilterHandlers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			filterHandlers = append(filterHandlers, name)
+		}
+	}
+
+	gatewayReconciler := &controller.GatewayReconciler{
+		Agent: agent,
+
+		DisableBackendAutoTLS: disableBackendAutoTLS,
+		PodUpstreams:          podUpstreams,
+		TargetedProgramming:   targetedProgramming,
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		ProgrammingConcurrency:  programmingConcurrency,
+		ValidationImage:         validationImage,
+
+		GeneratorOptions: caddy.GeneratorOptions{
+			AdminListen:          caddyAdminListen,
+			GracePeriod:          caddyGracePeriod,
+			CatchAllStatusCode:   caddyCatchAllStatusCode,
+			ReservedPathPrefixes: reservedPathPrefixes,
+
+			AllowedFilterHandlers: filterHandlers,
+		},
+		ProgrammingPort: caddyProgrammingPort,
+		AdminTLS:        adminTLS,
+		Rollout:         rollout,
+		PodMonitors: controller.PodMonitorOptions{
+			Enabled:    podMonitors,
+			TLSSecret:  podMonitorTLSSecret,
+			ServerName: podMonitorServerName,
+		},
+		Provision: provision,
+
+		ConfigPublisher: controller.ConfigPublisher(configPublisher),
+		ConfigDir:       configDir,
+		Pull: controller.PullOptions{
+			Listen:   configPullListen,
+			URL:      configPullURL,
+			Interval: configPullInterval,
+		},
+	}
+	if mode == "plan" {
+		os.Exit(plan(gatewayReconciler))
+		return
+	}
+
 	tlsOpts := []func(*tls.Config){}
 	if !enableHTTP2 {
 		tlsOpts = append(tlsOpts, disableHTTP2)
@@ -88,15 +420,34 @@ func main() {
 		TLSOpts: tlsOpts,
 	})
 
+	cacheOpts := cache.Options{
+		ByObject:   map[client.Object]cache.ByObject{},
+		SyncPeriod: &syncPeriod,
+	}
+	if agent != nil {
+		// Agents only care about a single Gateway, don't bother caching the rest.
+		cacheOpts.ByObject[&gatewayv1.Gateway{}] = cache.ByObject{
+			Field: fields.SelectorFromSet(fields.Set{
+				"metadata.namespace": agent.Gateway.Namespace,
+				"metadata.name":      agent.Gateway.Name,
+			}),
+		}
+	}
+	if cacheTLSSecretsOnly {
+		cacheOpts.ByObject[&corev1.Secret{}] = controller.TLSSecretsCacheOptions()
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache:  cacheOpts,
 		Metrics: metricsserver.Options{
 			BindAddress:   metricsAddr,
 			SecureServing: secureMetrics,
 			TLSOpts:       tlsOpts,
 		},
-		WebhookServer:          webhookServer,
-		HealthProbeBindAddress: probeAddr,
+		WebhookServer: webhookServer,
+		// The probe server is added by run, so it can also serve /version.
+		HealthProbeBindAddress: "0",
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "657d83d7.caddyserver.com",
 
@@ -111,6 +462,11 @@ func main() {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		LeaderElectionReleaseOnCancel: true,
+
+		// Give in-flight reconciles a chance to persist the status they have
+		// already computed before exiting, otherwise an upgrade of the
+		// controller can leave stale conditions behind.
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -119,81 +475,152 @@ func main() {
 	}
 
 	client := mgr.GetClient()
+	if cacheTLSSecretsOnly {
+		client = controller.TLSSecretsClient(client, mgr.GetAPIReader())
+	}
 	scheme := mgr.GetScheme()
 	recorder := mgr.GetEventRecorderFor("caddy-gateway")
 
-	if err = (&controller.GatewayReconciler{
-		Client:   client,
-		Scheme:   scheme,
-		Recorder: recorder,
-	}).SetupWithManager(mgr); err != nil {
+	gatewayReconciler.Client = client
+	gatewayReconciler.Scheme = scheme
+	gatewayReconciler.Recorder = recorder
+	if err = gatewayReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Gateway")
 		os.Exit(1)
 		return
 	}
+	if agent != nil {
+		// Agents only program Caddy, the controller is responsible for
+		// everything else.
+		run(mgr, probeAddr, gatewayReconciler.BuildInfo())
+		return
+	}
 	if err = (&controller.GatewayClassReconciler{
-		Client:   client,
-		Scheme:   scheme,
-		Recorder: recorder,
+		Client:    client,
+		APIReader: mgr.GetAPIReader(),
+		Scheme:    scheme,
+		Recorder:  recorder,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GatewayClass")
 		os.Exit(1)
 		return
 	}
-	//if err = (&controller.GRPCRouteReconciler{
-	//	Client:   client,
-	//	Scheme:   scheme,
-	//	Recorder: recorder,
-	//}).SetupWithManager(mgr); err != nil {
-	//	setupLog.Error(err, "unable to create controller", "controller", "GRPCRoute")
-	//	os.Exit(1)
-	//	return
-	//}
+	if err = (&controller.GRPCRouteReconciler{
+		Client:      client,
+		Scheme:      scheme,
+		Recorder:    recorder,
+		ExtraChecks: routechecks.Registered("GRPCRoute"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GRPCRoute")
+		os.Exit(1)
+		return
+	}
 	if err = (&controller.HTTPRouteReconciler{
-		Client:   client,
-		Scheme:   scheme,
-		Recorder: recorder,
+		Client:      client,
+		Scheme:      scheme,
+		Recorder:    recorder,
+		ExtraChecks: routechecks.Registered("HTTPRoute"),
+
+		AllowedFilterHandlers: filterHandlers,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HTTPRoute")
 		os.Exit(1)
 		return
 	}
 	if err = (&controller.TCPRouteReconciler{
-		Client:   client,
-		Scheme:   scheme,
-		Recorder: recorder,
+		Client:      client,
+		Scheme:      scheme,
+		Recorder:    recorder,
+		ExtraChecks: routechecks.Registered("TCPRoute"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TCPRoute")
 		os.Exit(1)
 		return
 	}
 	if err = (&controller.TLSRouteReconciler{
-		Client:   client,
-		Scheme:   scheme,
-		Recorder: recorder,
+		Client:      client,
+		Scheme:      scheme,
+		Recorder:    recorder,
+		ExtraChecks: routechecks.Registered("TLSRoute"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TLSRoute")
 		os.Exit(1)
 		return
 	}
 	if err = (&controller.UDPRouteReconciler{
-		Client:   client,
-		Scheme:   scheme,
-		Recorder: recorder,
+		Client:      client,
+		Scheme:      scheme,
+		Recorder:    recorder,
+		ExtraChecks: routechecks.Registered("UDPRoute"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "UDPRoute")
 		os.Exit(1)
 		return
 	}
+	if enableRouteWebhook {
+		if err = (&controller.RouteValidator{
+			Client:   client,
+			Gateways: gatewayReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Route")
+			os.Exit(1)
+			return
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up health check")
-		os.Exit(1)
+	info := gatewayReconciler.BuildInfo()
+	if enableRouteWebhook {
+		info.Features = append(info.Features, "enable-route-webhook")
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
-		os.Exit(1)
+	run(mgr, probeAddr, info)
+}
+
+// plan prints the changes that would be made to every Caddy instance without
+// making them, it returns 2 as the exit code if there are any changes.
+func plan(r *controller.GatewayReconciler) int {
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create client")
+		return 1
+	}
+	r.Client = c
+	r.Scheme = scheme
+
+	changed, err := r.Plan(ctrl.SetupSignalHandler(), os.Stdout)
+	if err != nil {
+		setupLog.Error(err, "unable to plan")
+		return 1
+	}
+	if changed {
+		return 2
+	}
+	return 0
+}
+
+func run(mgr ctrl.Manager, probeAddr string, info controller.BuildInfo) {
+	// Serve the probes ourselves rather than through the manager, which
+	// doesn't allow adding other endpoints to its probe server.
+	if probeAddr != "0" {
+		mux := http.NewServeMux()
+		probe := func(path string, h http.Handler) {
+			mux.Handle(path, http.StripPrefix(path, h))
+			mux.Handle(path+"/", http.StripPrefix(path, h))
+		}
+		probe("/healthz", &healthz.Handler{Checks: map[string]healthz.Checker{"healthz": healthz.Ping}})
+		probe("/readyz", &healthz.Handler{Checks: map[string]healthz.Checker{"readyz": healthz.Ping}})
+		mux.Handle("/version", controller.VersionHandler(info))
+		if err := mgr.Add(&manager.Server{
+			Name: "health probe",
+			Server: &http.Server{
+				Addr:              probeAddr,
+				Handler:           mux,
+				ReadHeaderTimeout: 32 * time.Second,
+			},
+		}); err != nil {
+			setupLog.Error(err, "unable to set up health probe server")
+			os.Exit(1)
+		}
 	}
 
 	setupLog.Info("starting manager")
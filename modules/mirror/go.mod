@@ -0,0 +1,8 @@
+module github.com/caddyserver/gateway/modules/mirror
+
+go 1.22.0
+
+require (
+	github.com/caddyserver/caddy/v2 v2.8.4
+	go.uber.org/zap v1.27.0
+)
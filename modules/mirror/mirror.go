@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+// Package mirror is a Caddy module that mirrors requests to other handlers,
+// usually a reverse proxy, ignoring their responses. It is used to implement
+// the RequestMirror filter of HTTPRoutes and must be built into Caddy for the
+// filter to be used, see caddy.Containerfile.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+}
+
+// Default values for Handler.
+const (
+	DefaultMaxBodySize   = 1 << 20
+	DefaultTimeout       = 30 * time.Second
+	DefaultMaxConcurrent = 100
+)
+
+// Handler mirrors requests to its routes in the background, before passing
+// them on to the next handler. Responses to mirrored requests are discarded.
+type Handler struct {
+	// Percent of requests to mirror, between 0 and 100. Defaults to 100.
+	Percent *float64 `json:"percent,omitempty"`
+
+	// MaxBodySize is the maximum size of a request body that will be
+	// buffered in order to mirror it, requests with larger bodies aren't
+	// mirrored. Defaults to 1MiB.
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+
+	// Timeout for handling a mirrored request. Defaults to 30s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// MaxConcurrent is the maximum number of mirrored requests in flight,
+	// requests aren't mirrored while it is reached so a slow mirror can't
+	// exhaust the resources of Caddy. Defaults to 100.
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+
+	// Routes that mirrored requests are handled by.
+	Routes caddyhttp.RouteList `json:"routes,omitempty"`
+
+	handler  caddyhttp.Handler
+	inflight chan struct{}
+	logger   *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mirror",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision implements caddy.Provisioner.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	h.logger = ctx.Logger()
+	if h.Percent != nil && (*h.Percent < 0 || *h.Percent > 100) {
+		return fmt.Errorf("percent must be between 0 and 100, got %v", *h.Percent)
+	}
+	if h.MaxBodySize <= 0 {
+		h.MaxBodySize = DefaultMaxBodySize
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = caddy.Duration(DefaultTimeout)
+	}
+	if h.MaxConcurrent <= 0 {
+		h.MaxConcurrent = DefaultMaxConcurrent
+	}
+	h.inflight = make(chan struct{}, h.MaxConcurrent)
+	if err := h.Routes.Provision(ctx); err != nil {
+		return err
+	}
+	// Responses to mirrored requests are discarded, so there is nothing for
+	// the routes to fall through to.
+	h.handler = h.Routes.Compile(caddyhttp.HandlerFunc(func(http.ResponseWriter, *http.Request) error {
+		return nil
+	}))
+	return nil
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if h.sample() {
+		if err := h.mirror(r); err != nil {
+			return err
+		}
+	}
+	return next.ServeHTTP(w, r)
+}
+
+// mirror sends a copy of the request to the routes in the background, unless
+// too many mirrored requests are already in flight or its body is too large
+// to buffer.
+func (h *Handler) mirror(r *http.Request) error {
+	select {
+	case h.inflight <- struct{}{}:
+	default:
+		h.logger.Debug("too many mirrored requests in flight, not mirroring request", zap.String("uri", r.RequestURI))
+		return nil
+	}
+
+	// The body can only be read once, so it is buffered to be sent to both
+	// the mirror and the next handler.
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, h.MaxBodySize+1))
+		if err != nil {
+			<-h.inflight
+			return caddyhttp.Error(http.StatusBadRequest, err)
+		}
+		if int64(len(body)) > h.MaxBodySize {
+			<-h.inflight
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			return nil
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// The mirrored request must outlive the original, and must not share its
+	// replacer or variables as they aren't safe for concurrent use.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Duration(h.Timeout))
+	ctx = context.WithValue(ctx, caddy.ReplacerCtxKey, caddy.NewReplacer())
+	ctx = context.WithValue(ctx, caddyhttp.VarsCtxKey, map[string]any{})
+	mr := r.Clone(ctx)
+	if body != nil {
+		mr.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	go func() {
+		defer func() { <-h.inflight }()
+		defer cancel()
+		if err := h.handler.ServeHTTP(&discardResponseWriter{}, mr); err != nil {
+			h.logger.Debug("mirrored request failed", zap.String("uri", mr.RequestURI), zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// sample returns true if a request should be mirrored.
+func (h *Handler) sample() bool {
+	if h.Percent == nil {
+		return true
+	}
+	return rand.Float64()*100 < *h.Percent
+}
+
+// readCloser reads from a reader while closing the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// discardResponseWriter is a http.ResponseWriter that discards the response.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+)
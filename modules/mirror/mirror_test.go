@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package mirror
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// provision provisions the handler, mirroring requests to mirror.
+func provision(t *testing.T, h *Handler, mirror caddyhttp.HandlerFunc) {
+	t.Helper()
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := h.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h.handler = mirror
+}
+
+// serve serves a request with the body, checking the next handler receives
+// the whole body.
+func serve(t *testing.T, h *Handler, body string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	next := caddyhttp.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		if string(b) != body {
+			t.Errorf("next handler got body %q, want %q", b, body)
+		}
+		return nil
+	})
+	if err := h.ServeHTTP(httptest.NewRecorder(), r, next); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent float64
+		wantErr bool
+	}{
+		{name: "valid", percent: 12.5},
+		{name: "negative", percent: -1, wantErr: true},
+		{name: "over 100", percent: 101, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+			defer cancel()
+			h := &Handler{Percent: &tt.percent}
+			if err := h.Provision(ctx); (err != nil) != tt.wantErr {
+				t.Errorf("Provision() error = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMirror(t *testing.T) {
+	got := make(chan string, 1)
+	h := &Handler{}
+	provision(t, h, func(_ http.ResponseWriter, r *http.Request) error {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		got <- string(b)
+		return nil
+	})
+
+	serve(t, h, "hello")
+	select {
+	case body := <-got:
+		if body != "hello" {
+			t.Errorf("mirror got body %q, want %q", body, "hello")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request wasn't mirrored")
+	}
+}
+
+func TestMirrorBodyTooLarge(t *testing.T) {
+	mirrored := make(chan struct{}, 1)
+	h := &Handler{MaxBodySize: 4}
+	provision(t, h, func(http.ResponseWriter, *http.Request) error {
+		mirrored <- struct{}{}
+		return nil
+	})
+
+	serve(t, h, "too large")
+	select {
+	case <-mirrored:
+		t.Error("request with a body larger than MaxBodySize was mirrored")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(h.inflight) != 0 {
+		t.Errorf("%d mirrored requests in flight, want 0", len(h.inflight))
+	}
+}
+
+func TestMirrorMaxConcurrent(t *testing.T) {
+	var (
+		mirrored = make(chan struct{}, 2)
+		release  = make(chan struct{})
+	)
+	h := &Handler{MaxConcurrent: 1}
+	provision(t, h, func(http.ResponseWriter, *http.Request) error {
+		mirrored <- struct{}{}
+		<-release
+		return nil
+	})
+
+	// The first request is mirrored and blocks, so the second isn't.
+	serve(t, h, "first")
+	<-mirrored
+	serve(t, h, "second")
+	close(release)
+	select {
+	case <-mirrored:
+		t.Error("request was mirrored while MaxConcurrent requests were in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Once the first mirrored request is done, requests are mirrored again.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.inflight) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	serve(t, h, "third")
+	select {
+	case <-mirrored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request wasn't mirrored after the in flight request was done")
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+// Package caddy contains types for Caddy's JSON config.
+//
+// The types mirror the structure of the config accepted by Caddy's admin API
+// (POST /load), they only contain fields and don't depend on Caddy itself, so
+// they may be used to generate configs without importing Caddy.
+package caddy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ModuleMap is a map that can contain multiple modules,
+// where the map key is the module's name. (The namespace
+// is usually read from an associated field's struct tag.)
+// Because the module's name is given as the key in a
+// module map, the name does not have to be given in the
+// json.RawMessage.
+type ModuleMap map[string]json.RawMessage
+
+// ModuleName returns the name of the module that the JSON config of a module is
+// for, which is read from the given key, such as "handler" or "policy".
+func ModuleName(b []byte, key string) (string, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+	var name string
+	if v, ok := m[key]; ok {
+		if err := json.Unmarshal(v, &name); err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if name == "" {
+		return "", fmt.Errorf("module name is missing from the %q key", key)
+	}
+	return name, nil
+}
+
+// UnmarshalModule unmarshals the JSON config of a module into the type returned
+// by the constructor for its name in modules, the name is read from the given
+// key. The zero value is returned for a JSON null.
+func UnmarshalModule[T any](b []byte, key string, modules map[string]func() T) (T, error) {
+	var zero T
+	if IsNull(b) {
+		return zero, nil
+	}
+	name, err := ModuleName(b, key)
+	if err != nil {
+		return zero, err
+	}
+	fn, ok := modules[name]
+	if !ok {
+		return zero, fmt.Errorf("unknown %s %q", key, name)
+	}
+	m := fn()
+	if err := json.Unmarshal(b, m); err != nil {
+		return zero, fmt.Errorf("%s %q: %w", key, name, err)
+	}
+	return m, nil
+}
+
+// IsNull returns whether b is empty or a JSON null.
+func IsNull(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) == 0 || bytes.Equal(b, []byte("null"))
+}
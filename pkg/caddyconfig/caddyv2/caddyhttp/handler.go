@@ -6,12 +6,49 @@ package caddyhttp
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
+
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
 )
 
 type Handler interface {
 	IAmAHandler()
 }
 
+// handlers maps the names of handler modules to a constructor for their type,
+// so they can be unmarshalled.
+var handlers = map[string]func() Handler{
+	"error":           func() Handler { return &StaticError{} },
+	"invoke":          func() Handler { return &Invoke{} },
+	"static_response": func() Handler { return &StaticResponse{} },
+	"subroute":        func() Handler { return &Subroute{} },
+	"vars":            func() Handler { return &VarsMiddleware{} },
+}
+
+// RegisterHandler registers the constructor of a handler module, so the
+// handler can be unmarshalled into its type. It is called by the packages that
+// implement handlers when they are initialized, so it is not safe to call
+// concurrently with unmarshalling.
+func RegisterHandler(name string, fn func() Handler) {
+	handlers[name] = fn
+}
+
+// UnmarshalHandler unmarshals the JSON config of a handler. Handlers whose
+// module isn't registered are returned as a RawHandler.
+func UnmarshalHandler(b []byte) (Handler, error) {
+	if caddy.IsNull(b) {
+		return nil, nil
+	}
+	name, err := caddy.ModuleName(b, "handler")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := handlers[name]; !ok {
+		return RawHandler(slices.Clone(b)), nil
+	}
+	return caddy.UnmarshalModule(b, "handler", handlers)
+}
+
 type StaticResponseHandlerName string
 
 func (StaticResponseHandlerName) MarshalJSON() ([]byte, error) {
@@ -90,6 +127,28 @@ type StaticError struct {
 
 func (StaticError) IAmAHandler() {}
 
+type InvokeHandlerName string
+
+func (InvokeHandlerName) MarshalJSON() ([]byte, error) {
+	return []byte(`"invoke"`), nil
+}
+
+// Invoke implements a handler that compiles and executes a
+// named route that was defined on the server.
+//
+// EXPERIMENTAL: Subject to change or removal.
+type Invoke struct {
+	// Handler is the name of this handler for the JSON config.
+	// DO NOT USE this. This is a special value to represent this handler.
+	// It will be overwritten when we are marshalled.
+	Handler InvokeHandlerName `json:"handler"`
+
+	// Name is the key of the named route to execute
+	Name string `json:"name,omitempty"`
+}
+
+func (Invoke) IAmAHandler() {}
+
 // VarsMiddleware is an HTTP middleware which sets variables to
 // have values that can be used in the HTTP request handler
 // chain. The primary way to access variables is with placeholders,
@@ -103,7 +162,41 @@ type VarsMiddleware map[string]any
 func (VarsMiddleware) IAmAHandler() {}
 
 func (h VarsMiddleware) MarshalJSON() ([]byte, error) {
-	h["handler"] = "vars"
-	// TODO: if we get stuck looping when marshalling the config, this is wrong.
-	return json.Marshal(map[string]any(h))
+	// Copy the map, so marshalling never modifies the middleware. Converting
+	// to a plain map also stops this method from being called recursively.
+	m := make(map[string]any, len(h)+1)
+	for k, v := range h {
+		m[k] = v
+	}
+	m["handler"] = "vars"
+	return json.Marshal(m)
+}
+
+func (h *VarsMiddleware) UnmarshalJSON(b []byte) error {
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	delete(m, "handler")
+	*h = m
+	return nil
+}
+
+// RawHandler is the JSON config of a handler that isn't otherwise typed, such
+// as one provided by a user. It must include the `handler` key naming the
+// handler's module.
+type RawHandler json.RawMessage
+
+func (RawHandler) IAmAHandler() {}
+
+func (h RawHandler) MarshalJSON() ([]byte, error) {
+	if len(h) == 0 {
+		return []byte("null"), nil
+	}
+	return h, nil
+}
+
+func (h *RawHandler) UnmarshalJSON(b []byte) error {
+	*h = slices.Clone(b)
+	return nil
 }
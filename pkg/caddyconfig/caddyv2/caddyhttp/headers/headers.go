@@ -6,7 +6,7 @@ package headers
 import (
 	"net/http"
 
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
 )
 
 type HandlerName string
@@ -39,6 +39,10 @@ type Handler struct {
 
 func (Handler) IAmAHandler() {}
 
+func init() {
+	caddyhttp.RegisterHandler("headers", func() caddyhttp.Handler { return &Handler{} })
+}
+
 // HeaderOps defines manipulations for HTTP headers.
 type HeaderOps struct {
 	// Adds HTTP headers; does not replace any existing header fields.
@@ -4,6 +4,7 @@
 package caddyhttp
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/url"
@@ -88,12 +89,29 @@ type MatchNot struct {
 }
 
 func (m MatchNot) MarshalJSON() ([]byte, error) {
+	// Returning no bytes is not valid JSON and would fail the entire config
+	// from being marshalled, use an empty array instead.
 	if len(m.MatcherSets) == 0 {
-		return nil, nil
+		return []byte("[]"), nil
 	}
 	return json.Marshal(m.MatcherSets)
 }
 
+// UnmarshalJSON accepts either a single matcher set or an array of matcher
+// sets, just like Caddy does.
+func (m *MatchNot) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '{' {
+		var ms Match
+		if err := json.Unmarshal(b, &ms); err != nil {
+			return err
+		}
+		m.MatcherSets = []Match{ms}
+		return nil
+	}
+	return json.Unmarshal(b, &m.MatcherSets)
+}
+
 // MatchClientIP matches requests by the client IP address,
 // i.e. the resolved address, considering trusted proxies.
 type MatchClientIP struct {
@@ -314,3 +332,7 @@ type MatchExpression struct {
 func (m MatchExpression) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m.Expr)
 }
+
+func (m *MatchExpression) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &m.Expr)
+}
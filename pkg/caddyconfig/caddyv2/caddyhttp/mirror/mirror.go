@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package mirror
+
+import (
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+)
+
+type HandlerName string
+
+func (HandlerName) MarshalJSON() ([]byte, error) {
+	return []byte(`"mirror"`), nil
+}
+
+// Handler is an HTTP handler that mirrors requests to its routes in the
+// background, discarding their responses, before passing them on to the next
+// handler.
+//
+// This handler is not part of Caddy, it is provided by the
+// github.com/caddyserver/gateway/modules/mirror module.
+type Handler struct {
+	// Handler is the name of this handler for the JSON config.
+	// DO NOT USE this. This is a special value to represent this handler.
+	// It will be overwritten when we are marshalled.
+	Handler HandlerName `json:"handler"`
+
+	// Percent of requests to mirror, between 0 and 100. Defaults to 100.
+	Percent *float64 `json:"percent,omitempty"`
+
+	// MaxBodySize is the maximum size of a request body that will be
+	// buffered in order to mirror it, requests with larger bodies aren't
+	// mirrored. Defaults to 1MiB.
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+
+	// Timeout for handling a mirrored request. Defaults to 30s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// MaxConcurrent is the maximum number of mirrored requests in flight,
+	// requests aren't mirrored while it is reached. Defaults to 100.
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+
+	// Routes that mirrored requests are handled by.
+	Routes []caddyhttp.Route `json:"routes,omitempty"`
+}
+
+func (Handler) IAmAHandler() {}
+
+func init() {
+	caddyhttp.RegisterHandler("mirror", func() caddyhttp.Handler { return &Handler{} })
+}
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package requestbody
+
+import "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+
+type HandlerName string
+
+func (HandlerName) MarshalJSON() ([]byte, error) {
+	return []byte(`"request_body"`), nil
+}
+
+// RequestBody is an HTTP handler that configures the request body.
+type RequestBody struct {
+	// Handler is the name of this handler for the JSON config.
+	// DO NOT USE this. This is a special value to represent this handler.
+	// It will be overwritten when we are marshalled.
+	Handler HandlerName `json:"handler"`
+
+	// The maximum number of bytes to allow reading from the body by a later
+	// handler. If more bytes are read, an error with HTTP status 413 is
+	// returned.
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+func (RequestBody) IAmAHandler() {}
+
+func init() {
+	caddyhttp.RegisterHandler("request_body", func() caddyhttp.Handler { return &RequestBody{} })
+}
@@ -6,7 +6,7 @@ package reverseproxy
 import (
 	"net/http"
 
-	caddy "github.com/caddyserver/gateway/internal/caddyv2"
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
 )
 
 // HealthChecks configures active and passive health checks.
@@ -6,10 +6,10 @@ package reverseproxy
 import (
 	"encoding/json"
 
-	caddy "github.com/caddyserver/gateway/internal/caddyv2"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp/headers"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp/rewrite"
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/headers"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/rewrite"
 )
 
 type HandlerName string
@@ -168,14 +168,31 @@ type Handler struct {
 	VerboseLogs bool `json:"verbose_logs,omitempty"`
 }
 
+func (h *Handler) UnmarshalJSON(b []byte) error {
+	type handler Handler
+	v := struct {
+		*handler
+		Transport json.RawMessage `json:"transport,omitempty"`
+	}{handler: (*handler)(h)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	h.Transport, err = UnmarshalTransport(v.Transport)
+	return err
+}
+
 func (Handler) IAmAHandler() {}
 
+func init() {
+	caddyhttp.RegisterHandler("reverse_proxy", func() caddyhttp.Handler { return &Handler{} })
+}
+
 // LoadBalancing has parameters related to load balancing.
 type LoadBalancing struct {
 	// A selection policy is how to choose an available backend.
 	// The default policy is random selection.
-	// TODO: type this
-	SelectionPolicy any `json:"selection_policy,omitempty"`
+	SelectionPolicy SelectionPolicy `json:"selection_policy,omitempty"`
 
 	// How many times to retry selecting available backends for each
 	// request if the next available host is down. If try_duration is
@@ -208,3 +225,17 @@ type LoadBalancing struct {
 	// TODO: check if this is the correct typing.
 	RetryMatch []caddyhttp.Match `json:"retry_match,omitempty"`
 }
+
+func (lb *LoadBalancing) UnmarshalJSON(b []byte) error {
+	type loadBalancing LoadBalancing
+	v := struct {
+		*loadBalancing
+		SelectionPolicy json.RawMessage `json:"selection_policy,omitempty"`
+	}{loadBalancing: (*loadBalancing)(lb)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	lb.SelectionPolicy, err = UnmarshalSelectionPolicy(v.SelectionPolicy)
+	return err
+}
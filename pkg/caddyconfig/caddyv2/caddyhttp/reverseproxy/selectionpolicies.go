@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package reverseproxy
+
+import (
+	"encoding/json"
+
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+)
+
+// SelectionPolicy is a policy used to select an upstream.
+type SelectionPolicy interface {
+	IAmASelectionPolicy()
+}
+
+// selectionPolicies maps the names of selection policies to a constructor for
+// their type, so they can be unmarshalled.
+var selectionPolicies = map[string]func() SelectionPolicy{
+	"client_ip_hash":       func() SelectionPolicy { return &ClientIPHashSelection{} },
+	"first":                func() SelectionPolicy { return &FirstSelection{} },
+	"header":               func() SelectionPolicy { return &HeaderHashSelection{} },
+	"ip_hash":              func() SelectionPolicy { return &IPHashSelection{} },
+	"least_conn":           func() SelectionPolicy { return &LeastConnSelection{} },
+	"random":               func() SelectionPolicy { return &RandomSelection{} },
+	"random_choose":        func() SelectionPolicy { return &RandomChoiceSelection{} },
+	"round_robin":          func() SelectionPolicy { return &RoundRobinSelection{} },
+	"uri_hash":             func() SelectionPolicy { return &URIHashSelection{} },
+	"weighted_round_robin": func() SelectionPolicy { return &WeightedRoundRobinSelection{} },
+}
+
+// UnmarshalSelectionPolicy unmarshals the JSON config of a selection policy.
+func UnmarshalSelectionPolicy(b []byte) (SelectionPolicy, error) {
+	return caddy.UnmarshalModule(b, "policy", selectionPolicies)
+}
+
+type RandomSelectionName string
+
+func (RandomSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"random"`), nil
+}
+
+// RandomSelection is a policy that selects an available host at random.
+type RandomSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy RandomSelectionName `json:"policy"`
+}
+
+func (RandomSelection) IAmASelectionPolicy() {}
+
+type RandomChoiceSelectionName string
+
+func (RandomChoiceSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"random_choose"`), nil
+}
+
+// RandomChoiceSelection is a policy that selects two or more available hosts at
+// random, then chooses the one with the least load.
+type RandomChoiceSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy RandomChoiceSelectionName `json:"policy"`
+
+	// The size of the sub-pool created from the larger upstream pool. The
+	// default value is 2 and the maximum at selection time is the size of
+	// the upstream pool.
+	Choose int `json:"choose,omitempty"`
+}
+
+func (RandomChoiceSelection) IAmASelectionPolicy() {}
+
+type LeastConnSelectionName string
+
+func (LeastConnSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"least_conn"`), nil
+}
+
+// LeastConnSelection is a policy that selects the host with the least active
+// requests. If multiple hosts have the same fewest number, one is chosen
+// randomly.
+type LeastConnSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy LeastConnSelectionName `json:"policy"`
+}
+
+func (LeastConnSelection) IAmASelectionPolicy() {}
+
+type RoundRobinSelectionName string
+
+func (RoundRobinSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"round_robin"`), nil
+}
+
+// RoundRobinSelection is a policy that selects hosts based on round-robin
+// ordering.
+type RoundRobinSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy RoundRobinSelectionName `json:"policy"`
+}
+
+func (RoundRobinSelection) IAmASelectionPolicy() {}
+
+type WeightedRoundRobinSelectionName string
+
+func (WeightedRoundRobinSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"weighted_round_robin"`), nil
+}
+
+// WeightedRoundRobinSelection is a policy that selects hosts based on weighted
+// round-robin ordering.
+type WeightedRoundRobinSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy WeightedRoundRobinSelectionName `json:"policy"`
+
+	// The weight of each upstream in order, corresponding with the list of
+	// upstreams configured.
+	Weights []int `json:"weights,omitempty"`
+}
+
+func (WeightedRoundRobinSelection) IAmASelectionPolicy() {}
+
+type FirstSelectionName string
+
+func (FirstSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"first"`), nil
+}
+
+// FirstSelection is a policy that selects the first available host.
+type FirstSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy FirstSelectionName `json:"policy"`
+}
+
+func (FirstSelection) IAmASelectionPolicy() {}
+
+type IPHashSelectionName string
+
+func (IPHashSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"ip_hash"`), nil
+}
+
+// IPHashSelection is a policy that selects a host based on hashing the
+// remote IP of the request.
+type IPHashSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy IPHashSelectionName `json:"policy"`
+}
+
+func (IPHashSelection) IAmASelectionPolicy() {}
+
+type ClientIPHashSelectionName string
+
+func (ClientIPHashSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"client_ip_hash"`), nil
+}
+
+// ClientIPHashSelection is a policy that selects a host based on hashing the
+// client IP of the request, as determined by the HTTP app's trusted proxies
+// settings.
+type ClientIPHashSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy ClientIPHashSelectionName `json:"policy"`
+}
+
+func (ClientIPHashSelection) IAmASelectionPolicy() {}
+
+type URIHashSelectionName string
+
+func (URIHashSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"uri_hash"`), nil
+}
+
+// URIHashSelection is a policy that selects a host by hashing the request URI.
+type URIHashSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy URIHashSelectionName `json:"policy"`
+}
+
+func (URIHashSelection) IAmASelectionPolicy() {}
+
+type HeaderHashSelectionName string
+
+func (HeaderHashSelectionName) MarshalJSON() ([]byte, error) {
+	return []byte(`"header"`), nil
+}
+
+// HeaderHashSelection is a policy that selects a host based on a given request
+// header.
+type HeaderHashSelection struct {
+	// Policy is the name of this policy for the JSON config.
+	// DO NOT USE this. This is a special value to represent this policy.
+	// It will be overwritten when we are marshalled.
+	Policy HeaderHashSelectionName `json:"policy"`
+
+	// The HTTP header field whose value is to be hashed and used for upstream
+	// selection.
+	Field string `json:"field,omitempty"`
+
+	// The default policy to use if the header is not present. If not set,
+	// random selection is used.
+	Fallback SelectionPolicy `json:"fallback,omitempty"`
+}
+
+func (s *HeaderHashSelection) UnmarshalJSON(b []byte) error {
+	type selection HeaderHashSelection
+	v := struct {
+		*selection
+		Fallback json.RawMessage `json:"fallback,omitempty"`
+	}{selection: (*selection)(s)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	s.Fallback, err = UnmarshalSelectionPolicy(v.Fallback)
+	return err
+}
+
+func (HeaderHashSelection) IAmASelectionPolicy() {}
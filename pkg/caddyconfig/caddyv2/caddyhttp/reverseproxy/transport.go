@@ -4,14 +4,27 @@
 package reverseproxy
 
 import (
-	caddy "github.com/caddyserver/gateway/internal/caddyv2"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddytls"
+	"encoding/json"
+
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
 )
 
 type Transport interface {
 	IAmATransport()
 }
 
+// transports maps the names of transport protocols to a constructor for their
+// type, so they can be unmarshalled.
+var transports = map[string]func() Transport{
+	"http": func() Transport { return &HTTPTransport{} },
+}
+
+// UnmarshalTransport unmarshals the JSON config of a transport.
+func UnmarshalTransport(b []byte) (Transport, error) {
+	return caddy.UnmarshalModule(b, "protocol", transports)
+}
+
 type HTTPTransportProtocol string
 
 func (HTTPTransportProtocol) MarshalJSON() ([]byte, error) {
@@ -152,6 +165,20 @@ type TLSConfig struct {
 	Curves []string `json:"curves,omitempty"`
 }
 
+func (c *TLSConfig) UnmarshalJSON(b []byte) error {
+	type config TLSConfig
+	v := struct {
+		*config
+		CA json.RawMessage `json:"ca,omitempty"`
+	}{config: (*config)(c)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	c.CA, err = caddytls.UnmarshalCA(v.CA)
+	return err
+}
+
 // KeepAlive holds configuration pertaining to HTTP Keep-Alive.
 type KeepAlive struct {
 	// Whether HTTP Keep-Alive is enabled. Default: `true`
@@ -3,6 +3,8 @@
 
 package rewrite
 
+import "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+
 type HandlerName string
 
 func (HandlerName) MarshalJSON() ([]byte, error) {
@@ -74,6 +76,10 @@ type Rewrite struct {
 
 func (Rewrite) IAmAHandler() {}
 
+func init() {
+	caddyhttp.RegisterHandler("rewrite", func() caddyhttp.Handler { return &Rewrite{} })
+}
+
 // SubstrReplacer describes either a simple and fast substring replacement.
 type SubstrReplacer struct {
 	// A substring to find. Supports placeholders.
@@ -3,6 +3,8 @@
 
 package caddyhttp
 
+import "encoding/json"
+
 // Route consists of a set of rules for matching HTTP requests,
 // a list of handlers to execute, and optional flow control
 // parameters which customize the handling of HTTP requests
@@ -74,6 +76,26 @@ type Route struct {
 	Terminal bool `json:"terminal,omitempty"`
 }
 
+func (r *Route) UnmarshalJSON(b []byte) error {
+	type route Route
+	v := struct {
+		*route
+		Handlers []json.RawMessage `json:"handle,omitempty"`
+	}{route: (*route)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r.Handlers = nil
+	for _, raw := range v.Handlers {
+		h, err := UnmarshalHandler(raw)
+		if err != nil {
+			return err
+		}
+		r.Handlers = append(r.Handlers, h)
+	}
+	return nil
+}
+
 type SubrouteHandlerName string
 
 func (SubrouteHandlerName) MarshalJSON() ([]byte, error) {
@@ -4,12 +4,15 @@
 package caddyhttp
 
 import (
-	caddy "github.com/caddyserver/gateway/internal/caddyv2"
-	"github.com/caddyserver/gateway/internal/caddyv2/caddytls"
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
 )
 
 // Server describes an HTTP server.
 type Server struct {
+	// ID is used to address the server using Caddy's `/id/` admin API.
+	ID string `json:"@id,omitempty"`
+
 	// Socket addresses to which to bind listeners. Accepts
 	// [network addresses](/docs/conventions#network-addresses)
 	// that may include port ranges. Listener addresses must
@@ -3,6 +3,8 @@
 
 package tracing
 
+import "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+
 type HandlerName string
 
 func (HandlerName) MarshalJSON() ([]byte, error) {
@@ -26,3 +28,7 @@ type Tracing struct {
 }
 
 func (Tracing) IAmAHandler() {}
+
+func init() {
+	caddyhttp.RegisterHandler("tracing", func() caddyhttp.Handler { return &Tracing{} })
+}
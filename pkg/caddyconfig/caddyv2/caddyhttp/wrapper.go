@@ -4,7 +4,7 @@
 package caddyhttp
 
 import (
-	"github.com/caddyserver/gateway/internal/caddyv2/caddyhttp/proxyprotocol"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/proxyprotocol"
 )
 
 // ListenerWrappers .
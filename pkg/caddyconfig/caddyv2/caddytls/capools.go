@@ -3,12 +3,28 @@
 
 package caddytls
 
+import caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+
 // CA .
 // TODO: document
 type CA interface {
 	IAmACA()
 }
 
+// caPools maps the names of CA pool providers to a constructor for their type,
+// so they can be unmarshalled.
+var caPools = map[string]func() CA{
+	"file":             func() CA { return &FileCAPool{} },
+	"inline":           func() CA { return &InlineCAPool{} },
+	"pki_intermediate": func() CA { return &PKIIntermediateCAPool{} },
+	"pki_root":         func() CA { return &PKIRootCAPool{} },
+}
+
+// UnmarshalCA unmarshals the JSON config of a CA pool provider.
+func UnmarshalCA(b []byte) (CA, error) {
+	return caddy.UnmarshalModule(b, "provider", caPools)
+}
+
 type InlineCAPoolProvider string
 
 func (InlineCAPoolProvider) MarshalJSON() ([]byte, error) {
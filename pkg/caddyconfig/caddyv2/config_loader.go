@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddy
+
+import "net/http"
+
+type HTTPLoaderModuleName string
+
+func (HTTPLoaderModuleName) MarshalJSON() ([]byte, error) {
+	return []byte(`"http"`), nil
+}
+
+// HTTPLoader can load Caddy configs over HTTP(S).
+//
+// If the response is not a JSON config, a config adapter must be specified
+// either in the loader config (`adapter`), or in the Content-Type HTTP header
+// returned in the HTTP response from the server. The Content-Type header is
+// read just like the admin API's `/load` endpoint. If you don't have control
+// over the HTTP server (but can still trust its response), you can override
+// the Content-Type header by setting the `adapter` property in this config.
+type HTTPLoader struct {
+	// Module is the name of this config loader for the JSON config.
+	// DO NOT USE this. This is a special value to represent this module.
+	// It will be overwritten when we are marshalled.
+	Module HTTPLoaderModuleName `json:"module"`
+
+	// The method for the request. Default: GET
+	Method string `json:"method,omitempty"`
+
+	// The URL of the request.
+	URL string `json:"url,omitempty"`
+
+	// HTTP headers to add to the request.
+	Headers http.Header `json:"header,omitempty"`
+
+	// Maximum time allowed for a complete connection and request.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// The name of the config adapter to use, if any. Only needed
+	// if the HTTP response is not a JSON config and if the server's
+	// Content-Type header is missing or incorrect.
+	Adapter string `json:"adapter,omitempty"`
+
+	TLS *HTTPLoaderTLS `json:"tls,omitempty"`
+}
+
+// HTTPLoaderTLS configures the TLS client of an HTTPLoader.
+type HTTPLoaderTLS struct {
+	// Present this instance's managed remote identity credentials to the
+	// server.
+	UseServerIdentity bool `json:"use_server_identity,omitempty"`
+
+	// PEM-encoded client certificate filename to present to the server.
+	ClientCertificateFile string `json:"client_certificate_file,omitempty"`
+
+	// PEM-encoded key to use with the client certificate.
+	ClientCertificateKeyFile string `json:"client_certificate_key_file,omitempty"`
+
+	// List of PEM-encoded CA certificate files to add to the same trust
+	// store as RootCAPool (or root_ca_pool in the JSON).
+	RootCAPEMFiles []string `json:"root_ca_pem_files,omitempty"`
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddyconfig
+
+import (
+	"slices"
+
+	caddyv2 "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
+
+	// Register the handlers, so configs can be unmarshalled into their types.
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/headers"
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/mirror"
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/requestbody"
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/rewrite"
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/tracing"
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/layer4/l4proxy"
+	_ "github.com/caddyserver/gateway/pkg/caddyconfig/layer4/l4tls"
+)
+
+// Config represents the configuration for a Caddy server.
+type Config struct {
+	Admin   *caddyv2.AdminConfig `json:"admin,omitempty"`
+	Logging *caddyv2.Logging     `json:"logging,omitempty"`
+	Apps    *Apps                `json:"apps,omitempty"`
+}
+
+// Apps is the configuration for "apps" on a Caddy server.
+type Apps struct {
+	HTTP   *caddyhttp.App `json:"http,omitempty"`
+	TLS    *caddytls.TLS  `json:"tls,omitempty"`
+	Layer4 *layer4.App    `json:"layer4,omitempty"`
+}
+
+// RemoveServers removes all servers with the given IDs from the config,
+// dropping any apps that are left without servers.
+func (c *Config) RemoveServers(ids []string) {
+	if c == nil || c.Apps == nil || len(ids) == 0 {
+		return
+	}
+	if h := c.Apps.HTTP; h != nil {
+		for key, s := range h.Servers {
+			if s != nil && slices.Contains(ids, s.ID) {
+				delete(h.Servers, key)
+			}
+		}
+		if len(h.Servers) == 0 {
+			c.Apps.HTTP = nil
+		}
+	}
+	if l4 := c.Apps.Layer4; l4 != nil {
+		for key, s := range l4.Servers {
+			if s != nil && slices.Contains(ids, s.ID) {
+				delete(l4.Servers, key)
+			}
+		}
+		if len(l4.Servers) == 0 {
+			c.Apps.Layer4 = nil
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package caddyconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	caddyv2 "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/headers"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/mirror"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/requestbody"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/reverseproxy"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/rewrite"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddyhttp/tracing"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4/l4proxy"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4/l4tls"
+)
+
+// testConfig returns a config using every module implemented by this package's
+// sub-packages.
+func testConfig() *Config {
+	return &Config{
+		Admin: &caddyv2.AdminConfig{Listen: ":2019"},
+		Apps: &Apps{
+			HTTP: &caddyhttp.App{
+				Servers: map[string]*caddyhttp.Server{
+					"http": {
+						Listen: []string{":80"},
+						Routes: []caddyhttp.Route{
+							{
+								MatcherSets: []caddyhttp.Match{{
+									Host:       caddyhttp.MatchHost{"example.com"},
+									Expression: &caddyhttp.MatchExpression{Expr: "{http.request.header.X} == 'y'"},
+									Not:        &caddyhttp.MatchNot{MatcherSets: []caddyhttp.Match{{Method: caddyhttp.MatchMethod{"POST"}}}},
+								}},
+								Handlers: []caddyhttp.Handler{
+									&caddyhttp.VarsMiddleware{"route": "app"},
+									&requestbody.RequestBody{MaxSize: 1024},
+									&tracing.Tracing{SpanName: "app"},
+									&headers.Handler{Request: &headers.HeaderOps{Set: map[string][]string{"X": {"y"}}}},
+									&rewrite.Rewrite{URI: "/app"},
+									&mirror.Handler{Percent: ptr(50.0)},
+									&caddyhttp.Subroute{
+										Routes: []caddyhttp.Route{{
+											Handlers: []caddyhttp.Handler{
+												&caddyhttp.Invoke{Name: "app"},
+												&reverseproxy.Handler{
+													Transport: &reverseproxy.HTTPTransport{
+														TLS: &reverseproxy.TLSConfig{
+															CA: &caddytls.InlineCAPool{TrustedCACerts: []string{"MIIB"}},
+														},
+													},
+													LoadBalancing: &reverseproxy.LoadBalancing{
+														SelectionPolicy: &reverseproxy.HeaderHashSelection{
+															Field:    "X",
+															Fallback: &reverseproxy.WeightedRoundRobinSelection{Weights: []int{1, 2}},
+														},
+														TryDuration: caddyv2.Duration(time.Second),
+													},
+													Upstreams: reverseproxy.UpstreamPool{{Dial: "10.0.0.1:80"}},
+												},
+											},
+										}},
+										Errors: &caddyhttp.HTTPErrorConfig{
+											Routes: []caddyhttp.Route{{
+												Handlers: []caddyhttp.Handler{&caddyhttp.StaticResponse{StatusCode: "500"}},
+											}},
+										},
+									},
+									&caddyhttp.StaticError{Error: "unreachable"},
+									caddyhttp.RawHandler(`{"handler":"encode","encodings":{"gzip":{}}}`),
+								},
+							},
+						},
+					},
+				},
+			},
+			Layer4: &layer4.App{
+				Servers: map[string]*layer4.Server{
+					"tls": {
+						Listen: []string{":443"},
+						Routes: layer4.RouteList{{
+							Handlers: []layer4.Handler{
+								&l4tls.Handler{},
+								&l4proxy.Handler{
+									LoadBalancing: &l4proxy.LoadBalancing{SelectionPolicy: &l4proxy.RoundRobinSelection{}},
+									Upstreams:     l4proxy.UpstreamPool{{Dial: []string{"10.0.0.1:443"}}},
+								},
+							},
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	want, err := json.Marshal(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := json.Unmarshal(want, &config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("config changed after a round trip:\n%s\n%s", want, got)
+	}
+
+	// Modules are unmarshalled into the type implementing them.
+	route := config.Apps.HTTP.Servers["http"].Routes[0]
+	var gotTypes []string
+	for _, h := range route.Handlers {
+		gotTypes = append(gotTypes, reflect.TypeOf(h).String())
+	}
+	wantTypes := []string{
+		"*caddyhttp.VarsMiddleware",
+		"*requestbody.RequestBody",
+		"*tracing.Tracing",
+		"*headers.Handler",
+		"*rewrite.Rewrite",
+		"*mirror.Handler",
+		"*caddyhttp.Subroute",
+		"*caddyhttp.StaticError",
+		"caddyhttp.RawHandler",
+	}
+	if !reflect.DeepEqual(gotTypes, wantTypes) {
+		t.Errorf("handlers were unmarshalled as %v, want %v", gotTypes, wantTypes)
+	}
+	proxy, ok := route.Handlers[6].(*caddyhttp.Subroute).Routes[0].Handlers[1].(*reverseproxy.Handler)
+	if !ok {
+		t.Fatalf("subroute handler was unmarshalled as %T", route.Handlers[6].(*caddyhttp.Subroute).Routes[0].Handlers[1])
+	}
+	if _, ok := proxy.Transport.(*reverseproxy.HTTPTransport).TLS.CA.(*caddytls.InlineCAPool); !ok {
+		t.Errorf("CA was unmarshalled as %T", proxy.Transport.(*reverseproxy.HTTPTransport).TLS.CA)
+	}
+	if _, ok := proxy.LoadBalancing.SelectionPolicy.(*reverseproxy.HeaderHashSelection).Fallback.(*reverseproxy.WeightedRoundRobinSelection); !ok {
+		t.Errorf("fallback selection policy was unmarshalled as %T", proxy.LoadBalancing.SelectionPolicy.(*reverseproxy.HeaderHashSelection).Fallback)
+	}
+	l4 := config.Apps.Layer4.Servers["tls"].Routes[0]
+	if _, ok := l4.Handlers[1].(*l4proxy.Handler).LoadBalancing.SelectionPolicy.(*l4proxy.RoundRobinSelection); !ok {
+		t.Errorf("layer4 handlers were unmarshalled as %T and %T", l4.Handlers[0], l4.Handlers[1])
+	}
+}
+
+func TestUnmarshalConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "matcher set negated without an array",
+			config: `{"apps":{"http":{"servers":{"http":{"routes":[{"match":[{"not":{"method":["POST"]}}]}]}}}}}`,
+			want:   `{"apps":{"http":{"servers":{"http":{"routes":[{"match":[{"not":[{"method":["POST"]}]}]}]}}}}}`,
+		},
+		{
+			name:   "null modules",
+			config: `{"apps":{"http":{"servers":{"http":{"routes":[{"handle":[{"handler":"reverse_proxy","transport":null,"load_balancing":{"selection_policy":null}}]}]}}}}}`,
+			want:   `{"apps":{"http":{"servers":{"http":{"routes":[{"handle":[{"handler":"reverse_proxy","load_balancing":{}}]}]}}}}}`,
+		},
+		{
+			name:    "handler without a name",
+			config:  `{"apps":{"http":{"servers":{"http":{"routes":[{"handle":[{"body":"hi"}]}]}}}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown selection policy",
+			config:  `{"apps":{"http":{"servers":{"http":{"routes":[{"handle":[{"handler":"reverse_proxy","load_balancing":{"selection_policy":{"policy":"cookie"}}}]}]}}}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown layer4 handler",
+			config:  `{"apps":{"layer4":{"servers":{"tls":{"routes":[{"handle":[{"handler":"echo"}]}]}}}}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			err := json.Unmarshal([]byte(tt.config), &config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(&config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzConfig(f *testing.F) {
+	b, err := json.Marshal(testConfig())
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	f.Add([]byte(`{"apps":{"http":{"servers":{"http":{"routes":[{"match":[{"not":{}}],"handle":[{"handler":"vars"}]}]}}}}}`))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var config Config
+		if err := json.Unmarshal(b, &config); err != nil {
+			return
+		}
+		// Any config that could be unmarshalled marshals into valid JSON,
+		// which stays the same after another round trip.
+		want, err := json.Marshal(&config)
+		if err != nil {
+			t.Fatalf("marshalling %s: %v", b, err)
+		}
+		config = Config{}
+		if err := json.Unmarshal(want, &config); err != nil {
+			t.Fatalf("unmarshalling %s: %v", want, err)
+		}
+		got, err := json.Marshal(&config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("config changed after a round trip:\n%s\n%s", want, got)
+		}
+	})
+}
+
+func TestRemoveServers(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Apps: &Apps{
+				HTTP: &caddyhttp.App{
+					Servers: map[string]*caddyhttp.Server{
+						"http":  {ID: "http"},
+						"https": {ID: "https"},
+						"nil":   nil,
+					},
+				},
+				Layer4: &layer4.App{
+					Servers: map[string]*layer4.Server{
+						"tcp": {ID: "tcp"},
+					},
+				},
+			},
+		}
+	}
+
+	c := newConfig()
+	c.RemoveServers([]string{"http", "unknown"})
+	if _, ok := c.Apps.HTTP.Servers["http"]; ok {
+		t.Error("removed server is still present")
+	}
+	if len(c.Apps.HTTP.Servers) != 2 || c.Apps.Layer4 == nil {
+		t.Errorf("other servers were removed: %+v, %+v", c.Apps.HTTP.Servers, c.Apps.Layer4)
+	}
+
+	// Apps without any servers left are dropped.
+	c = newConfig()
+	c.RemoveServers([]string{"tcp"})
+	if c.Apps.Layer4 != nil {
+		t.Errorf("layer4 app = %+v, want none", c.Apps.Layer4)
+	}
+	if c.Apps.HTTP == nil {
+		t.Error("HTTP app was dropped")
+	}
+
+	// Nothing to remove.
+	c = newConfig()
+	c.RemoveServers(nil)
+	if !reflect.DeepEqual(c, newConfig()) {
+		t.Errorf("config changed without any IDs to remove")
+	}
+	var nilConfig *Config
+	nilConfig.RemoveServers([]string{"http"})
+}
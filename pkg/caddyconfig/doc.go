@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+// Package caddyconfig contains types for generating Caddy JSON configs.
+//
+// Config is the root of a config. The caddyv2 package and its sub-packages
+// cover Caddy's core, http and tls apps, while the layer4 package and its
+// sub-packages cover the github.com/mholt/caddy-l4 app.
+//
+// These packages follow semantic versioning along with the rest of the module,
+// exported types and fields will not be removed or renamed without a major
+// version bump. Fields that are added to mirror new Caddy config options are
+// not considered breaking changes.
+//
+// Modules that are selected by name in Caddy's config (handlers, matchers,
+// selection policies, etc.) are represented as an interface that every
+// implementation satisfies, with the name being set automatically when the
+// config is marshalled. Fields that accept modules which are not implemented
+// here are typed as any and must be given a value that marshals to the JSON
+// Caddy expects.
+//
+// Configs can be unmarshalled as well, modules are unmarshalled into the type
+// implementing them by their name. HTTP handlers that aren't implemented here
+// are unmarshalled as a caddyhttp.RawHandler.
+package caddyconfig
@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package layer4
+
+import caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
+
+type Handler interface {
+	IAmAHandler()
+}
+
+// handlers maps the names of handler modules to a constructor for their type,
+// so they can be unmarshalled.
+var handlers = map[string]func() Handler{}
+
+// RegisterHandler registers the constructor of a handler module, so the
+// handler can be unmarshalled into its type. It is called by the packages that
+// implement handlers when they are initialized, so it is not safe to call
+// concurrently with unmarshalling.
+func RegisterHandler(name string, fn func() Handler) {
+	handlers[name] = fn
+}
+
+// UnmarshalHandler unmarshals the JSON config of a handler, the handler's
+// module must be registered.
+func UnmarshalHandler(b []byte) (Handler, error) {
+	return caddy.UnmarshalModule(b, "handler", handlers)
+}
@@ -4,7 +4,8 @@
 package l4tls
 
 import (
-	"github.com/caddyserver/gateway/internal/caddyv2/caddytls"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2/caddytls"
+	"github.com/caddyserver/gateway/pkg/caddyconfig/layer4"
 )
 
 type HandlerName string
@@ -24,3 +25,7 @@ type Handler struct {
 }
 
 func (Handler) IAmAHandler() {}
+
+func init() {
+	layer4.RegisterHandler("tls", func() layer4.Handler { return &Handler{} })
+}
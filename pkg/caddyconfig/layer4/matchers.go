@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package layer4
+
+// Match .
+// TODO: document
+type Match struct {
+	TLS *MatchTLS `json:"tls,omitempty"`
+}
+
+func (m *Match) IsEmpty() bool {
+	if m == nil {
+		return true
+	}
+	if !m.TLS.IsEmpty() {
+		return false
+	}
+	return true
+}
+
+// MatchTLS matches connections by their TLS ClientHello, every matcher that
+// is set must match.
+// ref; https://caddyserver.com/docs/json/apps/layer4/servers/routes/match/tls/
+type MatchTLS struct {
+	SNI      MatchSNI          `json:"sni,omitempty"`
+	ALPN     MatchALPN         `json:"alpn,omitempty"`
+	RemoteIP *MatchTLSRemoteIP `json:"remote_ip,omitempty"`
+	LocalIP  *MatchTLSLocalIP  `json:"local_ip,omitempty"`
+}
+
+func (m *MatchTLS) IsEmpty() bool {
+	if m == nil {
+		return true
+	}
+	if len(m.SNI) > 0 {
+		return false
+	}
+	if len(m.ALPN) > 0 {
+		return false
+	}
+	if m.RemoteIP != nil {
+		return false
+	}
+	if m.LocalIP != nil {
+		return false
+	}
+	return true
+}
+
+// MatchSNI matches based on SNI (server name indication).
+// ref; https://caddyserver.com/docs/modules/tls.handshake_match.sni
+type MatchSNI []string
+
+// MatchALPN matches based on the protocols offered by the client during
+// Application-Layer Protocol Negotiation, matching if any of them are offered.
+// ref; https://caddyserver.com/docs/modules/tls.handshake_match.alpn
+type MatchALPN []string
+
+// MatchTLSRemoteIP matches based on the remote IP of the connection.
+// ref; https://caddyserver.com/docs/modules/tls.handshake_match.remote_ip
+type MatchTLSRemoteIP struct {
+	// The IPs or CIDR ranges to match.
+	Ranges []string `json:"ranges,omitempty"`
+
+	// The IPs or CIDR ranges to *NOT* match.
+	NotRanges []string `json:"not_ranges,omitempty"`
+}
+
+// MatchTLSLocalIP matches based on the local IP the connection was accepted
+// on.
+// ref; https://caddyserver.com/docs/modules/tls.handshake_match.local_ip
+type MatchTLSLocalIP struct {
+	// The IPs or CIDR ranges to match.
+	Ranges []string `json:"ranges,omitempty"`
+}
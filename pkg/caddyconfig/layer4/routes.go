@@ -3,6 +3,8 @@
 
 package layer4
 
+import "encoding/json"
+
 // Route represents a collection of handlers that are gated by
 // matching logic. A route is invoked if its matchers match
 // the byte stream. In an equivalent "if...then" statement,
@@ -21,6 +23,26 @@ type Route struct {
 	Handlers []Handler `json:"handle,omitempty"`
 }
 
+func (r *Route) UnmarshalJSON(b []byte) error {
+	type route Route
+	v := struct {
+		*route
+		Handlers []json.RawMessage `json:"handle,omitempty"`
+	}{route: (*route)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r.Handlers = nil
+	for _, raw := range v.Handlers {
+		h, err := UnmarshalHandler(raw)
+		if err != nil {
+			return err
+		}
+		r.Handlers = append(r.Handlers, h)
+	}
+	return nil
+}
+
 // RouteList is a list of connection routes that can create
 // a middleware chain. Routes are evaluated in sequential
 // order: for the first route, the matchers will be evaluated,
@@ -4,11 +4,14 @@
 package layer4
 
 import (
-	caddy "github.com/caddyserver/gateway/internal/caddyv2"
+	caddy "github.com/caddyserver/gateway/pkg/caddyconfig/caddyv2"
 )
 
 // Server represents a Caddy layer4 server.
 type Server struct {
+	// ID is used to address the server using Caddy's `/id/` admin API.
+	ID string `json:"@id,omitempty"`
+
 	// The network address to bind to. Any Caddy network address
 	// is an acceptable value:
 	// https://caddyserver.com/docs/conventions#network-addresses
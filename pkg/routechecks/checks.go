@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package routechecks
+
+import (
+	"slices"
+	"sync"
+
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// Checks are the checks run against a route to set its status. The Gateway
+// checks are run for each of the route's parents, followed by the rule checks
+// for the whole route. Each list stops at the first check returning false.
+type Checks struct {
+	Gateway []CheckGatewayFunc
+	Rule    []CheckRuleFunc
+}
+
+// With returns the checks followed by the extra checks, without modifying
+// either of them.
+func (c Checks) With(extra Checks) Checks {
+	return Checks{
+		Gateway: append(slices.Clip(c.Gateway), extra.Gateway...),
+		Rule:    append(slices.Clip(c.Rule), extra.Rule...),
+	}
+}
+
+var (
+	registeredMu sync.RWMutex
+	registered   = map[gatewayv1.Kind]Checks{}
+)
+
+// Register adds checks to run against every route of a kind (e.g.
+// `HTTPRoute`) after the built-in checks. Like Caddy modules, checks are
+// meant to be registered from the init function of a package that is
+// imported by the controller's main package.
+func Register(kind gatewayv1.Kind, checks Checks) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered[kind] = registered[kind].With(checks)
+}
+
+// Registered returns the checks registered for a kind of route.
+func Registered(kind gatewayv1.Kind) Checks {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	return registered[kind]
+}
+
+// backendChecks are the rule checks shared by every kind of route.
+func backendChecks() []CheckRuleFunc {
+	return []CheckRuleFunc{
+		CheckAgainstCrossNamespaceBackendReferences,
+		CheckBackend,
+		CheckBackendWeights,
+		CheckBackendIsExistingService,
+	}
+}
+
+// HTTPRouteChecks returns the checks run against HTTPRoutes.
+func HTTPRouteChecks() Checks {
+	return Checks{
+		Gateway: []CheckGatewayFunc{
+			CheckGatewayAllowedForNamespace,
+			CheckGatewayRouteKindAllowed,
+			CheckGatewayMatchingPorts,
+			CheckHostnamesValid,
+			CheckGatewayMatchingHostnames,
+			CheckGatewayMatchingSection,
+		},
+		Rule: append(backendChecks(), CheckExtensionRefs),
+	}
+}
+
+// GRPCRouteChecks returns the checks run against GRPCRoutes.
+func GRPCRouteChecks() Checks {
+	return HTTPRouteChecks()
+}
+
+// TLSRouteChecks returns the checks run against TLSRoutes.
+func TLSRouteChecks() Checks {
+	return HTTPRouteChecks()
+}
+
+// TCPRouteChecks returns the checks run against TCPRoutes.
+func TCPRouteChecks() Checks {
+	return Checks{
+		Gateway: []CheckGatewayFunc{
+			CheckGatewayAllowedForNamespace,
+			CheckGatewayRouteKindAllowed,
+			CheckGatewayMatchingPorts,
+			CheckGatewayMatchingSection,
+		},
+		Rule: backendChecks(),
+	}
+}
+
+// UDPRouteChecks returns the checks run against UDPRoutes.
+func UDPRouteChecks() Checks {
+	return Checks{
+		Gateway: []CheckGatewayFunc{
+			CheckGatewayAllowedForNamespace,
+			CheckGatewayRouteKindAllowed,
+			CheckGatewayMatchingPorts,
+			CheckGatewayMatchingSection,
+			CheckUDPListenerInUse,
+		},
+		Rule: backendChecks(),
+	}
+}
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package routechecks
+
+import (
+	"testing"
+
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestRegister(t *testing.T) {
+	check := func(Input, gatewayv1.ParentReference) (bool, error) { return true, nil }
+	rule := func(Input) (bool, error) { return true, nil }
+
+	Register("TestRoute", Checks{Gateway: []CheckGatewayFunc{check}})
+	Register("TestRoute", Checks{Gateway: []CheckGatewayFunc{check}, Rule: []CheckRuleFunc{rule}})
+
+	got := Registered("TestRoute")
+	if len(got.Gateway) != 2 || len(got.Rule) != 1 {
+		t.Errorf("Registered() has %d Gateway and %d rule checks, want 2 and 1", len(got.Gateway), len(got.Rule))
+	}
+	if got := Registered("OtherRoute"); len(got.Gateway) != 0 || len(got.Rule) != 0 {
+		t.Errorf("Registered() for another kind = %+v, want no checks", got)
+	}
+
+	builtin := HTTPRouteChecks()
+	with := builtin.With(Registered("TestRoute"))
+	if len(with.Gateway) != len(builtin.Gateway)+2 || len(with.Rule) != len(builtin.Rule)+1 {
+		t.Errorf("With() has %d Gateway and %d rule checks, want %d and %d", len(with.Gateway), len(with.Rule), len(builtin.Gateway)+2, len(builtin.Rule)+1)
+	}
+	if len(HTTPRouteChecks().Gateway) != len(builtin.Gateway) {
+		t.Errorf("With() modified the built-in checks")
+	}
+}
@@ -6,10 +6,10 @@ package routechecks
 import (
 	"fmt"
 
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	gateway "github.com/caddyserver/gateway/internal"
 )
 
 func CheckGatewayAllowedForNamespace(input Input, parentRef gatewayv1.ParentReference) (bool, error) {
@@ -33,7 +33,7 @@ func CheckGatewayAllowedForNamespace(input Input, parentRef gatewayv1.ParentRefe
 		if listener.AllowedRoutes.Namespaces == nil {
 			continue
 		}
-		if parentRef.SectionName != nil && listener.Name != *parentRef.SectionName {
+		if !listenerMatchesParentRef(listener, parentRef) {
 			continue
 		}
 		// if gateway allows all namespaces, we do not need to check anything here
@@ -42,19 +42,11 @@ func CheckGatewayAllowedForNamespace(input Input, parentRef gatewayv1.ParentRefe
 		}
 
 		if *listener.AllowedRoutes.Namespaces.From == gatewayv1.NamespacesFromSelector {
-			nsList := &corev1.NamespaceList{}
-			selector, _ := metav1.LabelSelectorAsSelector(listener.AllowedRoutes.Namespaces.Selector)
-			if err := input.GetClient().List(input.GetContext(), nsList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
-				return false, fmt.Errorf("unable to list namespaces: %w", err)
-			}
-
-			allowed := false
-			for _, ns := range nsList.Items {
-				if ns.Name == input.GetNamespace() {
-					allowed = true
-				}
+			nsLabels, err := gateway.GetNamespaceLabels(input.GetContext(), input.GetClient(), input.GetNamespace())
+			if err != nil {
+				return false, fmt.Errorf("unable to get namespace: %w", err)
 			}
-			if !allowed {
+			if !gateway.NamespaceMatchesSelector(listener.AllowedRoutes.Namespaces.Selector, nsLabels) {
 				input.SetParentCondition(parentRef, metav1.Condition{
 					Type:    "Accepted",
 					Status:  metav1.ConditionFalse,
@@ -100,6 +92,9 @@ func CheckGatewayRouteKindAllowed(input Input, parentRef gatewayv1.ParentReferen
 	}
 
 	for _, listener := range gw.Spec.Listeners {
+		if !listenerMatchesParentRef(listener, parentRef) {
+			continue
+		}
 		if listener.AllowedRoutes == nil || len(listener.AllowedRoutes.Kinds) == 0 {
 			continue
 		}
@@ -129,6 +124,24 @@ func CheckGatewayRouteKindAllowed(input Input, parentRef gatewayv1.ParentReferen
 	return true, nil
 }
 
+// CheckHostnamesValid checks that all the hostnames on the route are valid.
+func CheckHostnamesValid(input Input, parentRef gatewayv1.ParentReference) (bool, error) {
+	for _, h := range input.GetHostnames() {
+		if err := gateway.ValidateHostname(string(h)); err != nil {
+			input.SetParentCondition(parentRef, metav1.Condition{
+				Type:    string(gatewayv1.RouteConditionAccepted),
+				Status:  metav1.ConditionFalse,
+				Reason:  string(gatewayv1.RouteReasonUnsupportedValue),
+				Message: "Invalid route hostname: " + err.Error(),
+			})
+
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
 func CheckGatewayMatchingHostnames(input Input, parentRef gatewayv1.ParentReference) (bool, error) {
 	gw, err := input.GetGateway(parentRef)
 	if err != nil {
@@ -142,7 +155,7 @@ func CheckGatewayMatchingHostnames(input Input, parentRef gatewayv1.ParentRefere
 		return false, nil
 	}
 
-	if len(computeHosts(gw, input.GetHostnames())) == 0 {
+	if len(computeHosts(gw, parentRef, gatewayv1.Kind(input.GetGVK().Kind), input.GetHostnames())) == 0 {
 		input.SetParentCondition(parentRef, metav1.Condition{
 			Type:    string(gatewayv1.RouteConditionAccepted),
 			Status:  metav1.ConditionFalse,
@@ -169,17 +182,24 @@ func CheckGatewayMatchingPorts(input Input, parentRef gatewayv1.ParentReference)
 		return false, nil
 	}
 
+	// A port on its own matches every listener using that port, when used
+	// together with a sectionName both must match the same listener.
+	// ref; https://gateway-api.sigs.k8s.io/reference/spec/#gateway.networking.k8s.io/v1.ParentReference
 	if parentRef.Port != nil {
 		for _, listener := range gw.Spec.Listeners {
-			if listener.Port == *parentRef.Port {
+			if listenerMatchesParentRef(listener, parentRef) {
 				return true, nil
 			}
 		}
+		message := fmt.Sprintf("No matching listener with port %d", *parentRef.Port)
+		if parentRef.SectionName != nil {
+			message = fmt.Sprintf("No matching listener with sectionName %s and port %d", *parentRef.SectionName, *parentRef.Port)
+		}
 		input.SetParentCondition(parentRef, metav1.Condition{
 			Type:    string(gatewayv1.RouteConditionAccepted),
 			Status:  metav1.ConditionFalse,
-			Reason:  "NoMatchingParent",
-			Message: fmt.Sprintf("No matching listener with port %d", *parentRef.Port),
+			Reason:  string(gatewayv1.RouteReasonNoMatchingParent),
+			Message: message,
 		})
 
 		return false, nil
@@ -213,7 +233,7 @@ func CheckGatewayMatchingSection(input Input, parentRef gatewayv1.ParentReferenc
 			input.SetParentCondition(parentRef, metav1.Condition{
 				Type:    string(gatewayv1.RouteConditionAccepted),
 				Status:  metav1.ConditionFalse,
-				Reason:  "NoMatchingParent",
+				Reason:  string(gatewayv1.RouteReasonNoMatchingParent),
 				Message: fmt.Sprintf("No matching listener with sectionName %s", *parentRef.SectionName),
 			})
 
@@ -223,3 +243,15 @@ func CheckGatewayMatchingSection(input Input, parentRef gatewayv1.ParentReferenc
 
 	return true, nil
 }
+
+// listenerMatchesParentRef returns true if the listener is selected by the
+// sectionName and port of the parentRef, unset fields match any listener.
+func listenerMatchesParentRef(listener gatewayv1.Listener, parentRef gatewayv1.ParentReference) bool {
+	if parentRef.SectionName != nil && listener.Name != *parentRef.SectionName {
+		return false
+	}
+	if parentRef.Port != nil && listener.Port != *parentRef.Port {
+		return false
+	}
+	return true
+}
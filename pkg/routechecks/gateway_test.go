@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package routechecks
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestListenerMatchesParentRef(t *testing.T) {
+	listener := gatewayv1.Listener{
+		Name:     "https",
+		Protocol: gatewayv1.HTTPSProtocolType,
+		Port:     443,
+	}
+	tests := []struct {
+		name      string
+		parentRef gatewayv1.ParentReference
+		want      bool
+	}{
+		{
+			name: "neither set",
+			want: true,
+		},
+		{
+			name:      "section name",
+			parentRef: gatewayv1.ParentReference{SectionName: ptr.To[gatewayv1.SectionName]("https")},
+			want:      true,
+		},
+		{
+			name:      "other section name",
+			parentRef: gatewayv1.ParentReference{SectionName: ptr.To[gatewayv1.SectionName]("http")},
+		},
+		{
+			name:      "port",
+			parentRef: gatewayv1.ParentReference{Port: ptr.To[gatewayv1.PortNumber](443)},
+			want:      true,
+		},
+		{
+			name:      "other port",
+			parentRef: gatewayv1.ParentReference{Port: ptr.To[gatewayv1.PortNumber](80)},
+		},
+		{
+			name: "section name and port",
+			parentRef: gatewayv1.ParentReference{
+				SectionName: ptr.To[gatewayv1.SectionName]("https"),
+				Port:        ptr.To[gatewayv1.PortNumber](443),
+			},
+			want: true,
+		},
+		{
+			name: "section name and other port",
+			parentRef: gatewayv1.ParentReference{
+				SectionName: ptr.To[gatewayv1.SectionName]("https"),
+				Port:        ptr.To[gatewayv1.PortNumber](80),
+			},
+		},
+		{
+			name: "other section name and port",
+			parentRef: gatewayv1.ParentReference{
+				SectionName: ptr.To[gatewayv1.SectionName]("http"),
+				Port:        ptr.To[gatewayv1.PortNumber](443),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listenerMatchesParentRef(listener, tt.parentRef); got != tt.want {
+				t.Errorf("listenerMatchesParentRef() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPRouteChecksInvalidListenerHostname(t *testing.T) {
+	invalid := gatewayv1.Hostname("-app-.example.com")
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{
+				{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80},
+				{Name: "invalid", Hostname: &invalid, Protocol: gatewayv1.HTTPProtocolType, Port: 8080},
+			},
+		},
+	}
+	parentRef := gatewayv1.ParentReference{Name: "gateway"}
+	route := &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "route"},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{parentRef}},
+		},
+	}
+	input := &HTTPRouteInput{
+		Ctx:       context.Background(),
+		Client:    udpClient{gw: gw},
+		HTTPRoute: route,
+	}
+
+	// An invalid listener hostname is reported on the listener's status, it
+	// must not reject routes attached to the Gateway.
+	for _, check := range HTTPRouteChecks().Gateway {
+		ok, err := check(input, parentRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("route was rejected: %+v", route.Status.Parents)
+		}
+	}
+}
@@ -9,9 +9,16 @@ import (
 	gateway "github.com/caddyserver/gateway/internal"
 )
 
-func computeHosts[T ~string](gw *gatewayv1.Gateway, hostnames []T) []string {
+// computeHosts returns the hostnames of a route that intersect with the
+// hostnames of the listeners it is attached to by parentRef. Listeners that
+// don't allow the kind of route are ignored, as the route will never be
+// programmed on them.
+func computeHosts[T ~string](gw *gatewayv1.Gateway, parentRef gatewayv1.ParentReference, kind gatewayv1.Kind, hostnames []T) []string {
 	hosts := make([]string, 0, len(hostnames))
 	for _, listener := range gw.Spec.Listeners {
+		if !listenerMatchesParentRef(listener, parentRef) || !gateway.IsRouteKindAllowed(listener, kind) {
+			continue
+		}
 		hosts = append(hosts, computeHostsForListener(&listener, hostnames)...)
 	}
 
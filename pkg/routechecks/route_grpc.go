@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package routechecks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+type GRPCRouteInput struct {
+	Ctx       context.Context
+	Client    client.Client
+	Grants    *gatewayv1beta1.ReferenceGrantList
+	GRPCRoute *gatewayv1.GRPCRoute
+
+	gateways map[gatewayv1.ParentReference]*gatewayv1.Gateway
+}
+
+func (h *GRPCRouteInput) SetParentCondition(ref gatewayv1.ParentReference, condition metav1.Condition) {
+	// fill in the condition
+	condition.LastTransitionTime = metav1.NewTime(time.Now())
+	condition.ObservedGeneration = h.GRPCRoute.GetGeneration()
+
+	h.mergeStatusConditions(ref, []metav1.Condition{
+		condition,
+	})
+}
+
+func (h *GRPCRouteInput) SetAllParentCondition(condition metav1.Condition) {
+	// fill in the condition
+	condition.LastTransitionTime = metav1.NewTime(time.Now())
+	condition.ObservedGeneration = h.GRPCRoute.GetGeneration()
+
+	for _, parent := range h.GRPCRoute.Spec.ParentRefs {
+		h.mergeStatusConditions(parent, []metav1.Condition{
+			condition,
+		})
+	}
+}
+
+func (h *GRPCRouteInput) mergeStatusConditions(parentRef gatewayv1.ParentReference, updates []metav1.Condition) {
+	index := -1
+	for i, parent := range h.GRPCRoute.Status.RouteStatus.Parents {
+		if reflect.DeepEqual(parent.ParentRef, parentRef) {
+			index = i
+			break
+		}
+	}
+	if index != -1 {
+		h.GRPCRoute.Status.RouteStatus.Parents[index].Conditions = merge(h.GRPCRoute.Status.RouteStatus.Parents[index].Conditions, updates...)
+		return
+	}
+	h.GRPCRoute.Status.RouteStatus.Parents = append(h.GRPCRoute.Status.RouteStatus.Parents, gatewayv1.RouteParentStatus{
+		ParentRef:      parentRef,
+		ControllerName: gateway.ControllerName,
+		Conditions:     updates,
+	})
+}
+
+func (h *GRPCRouteInput) GetGrants() []gatewayv1beta1.ReferenceGrant {
+	return h.Grants.Items
+}
+
+func (h *GRPCRouteInput) GetNamespace() string {
+	return h.GRPCRoute.GetNamespace()
+}
+
+func (h *GRPCRouteInput) GetGVK() schema.GroupVersionKind {
+	return gatewayv1.SchemeGroupVersion.WithKind("GRPCRoute")
+}
+
+func (h *GRPCRouteInput) GetRules() []GenericRule {
+	rules := make([]GenericRule, len(h.GRPCRoute.Spec.Rules))
+	for i, rule := range h.GRPCRoute.Spec.Rules {
+		rules[i] = &GRPCRouteRule{rule}
+	}
+	return rules
+}
+
+func (h *GRPCRouteInput) GetClient() client.Client {
+	return h.Client
+}
+
+func (h *GRPCRouteInput) GetContext() context.Context {
+	return h.Ctx
+}
+
+func (h *GRPCRouteInput) GetHostnames() []gatewayv1.Hostname {
+	return h.GRPCRoute.Spec.Hostnames
+}
+
+func (h *GRPCRouteInput) GetGateway(parent gatewayv1.ParentReference) (*gatewayv1.Gateway, error) {
+	if h.gateways == nil {
+		h.gateways = make(map[gatewayv1.ParentReference]*gatewayv1.Gateway)
+	}
+	if gw, exists := h.gateways[parent]; exists {
+		return gw, nil
+	}
+
+	ns := gateway.NamespaceDerefOr(parent.Namespace, h.GetNamespace())
+	gw := &gatewayv1.Gateway{}
+	if err := h.Client.Get(h.Ctx, client.ObjectKey{Namespace: ns, Name: string(parent.Name)}, gw); err != nil {
+		if !apierrors.IsNotFound(err) {
+			// if it is not just a not found error, we should return the error as something is bad
+			return nil, fmt.Errorf("error while getting gateway: %w", err)
+		}
+		// Gateway does not exist skip further checks
+		return nil, fmt.Errorf("gateway %q (%q) does not exist: %w", parent.Name, ns, err)
+	}
+
+	h.gateways[parent] = gw
+	return gw, nil
+}
+
+// GRPCRouteRule is used to implement the GenericRule interface for GRPCRoute
+type GRPCRouteRule struct {
+	Rule gatewayv1.GRPCRouteRule
+}
+
+func (t *GRPCRouteRule) GetBackendRefs() []gatewayv1.BackendRef {
+	var refs []gatewayv1.BackendRef
+	for _, backend := range t.Rule.BackendRefs {
+		refs = append(refs, backend.BackendRef)
+	}
+	for _, f := range t.Rule.Filters {
+		if f.Type == gatewayv1.GRPCRouteFilterRequestMirror {
+			if f.RequestMirror == nil {
+				continue
+			}
+			refs = append(refs, gatewayv1.BackendRef{
+				BackendObjectReference: f.RequestMirror.BackendRef,
+			})
+		}
+	}
+	return refs
+}
@@ -25,6 +25,10 @@ type HTTPRouteInput struct {
 	Grants    *gatewayv1beta1.ReferenceGrantList
 	HTTPRoute *gatewayv1.HTTPRoute
 
+	// AllowedFilterHandlers are the Caddy HTTP handler modules the
+	// CaddyHTTPFilters referenced by the route may use.
+	AllowedFilterHandlers []string
+
 	gateways map[gatewayv1.ParentReference]*gatewayv1.Gateway
 }
 
@@ -101,6 +105,10 @@ func (h *HTTPRouteInput) GetHostnames() []gatewayv1.Hostname {
 	return h.HTTPRoute.Spec.Hostnames
 }
 
+func (h *HTTPRouteInput) GetAllowedFilterHandlers() []string {
+	return h.AllowedFilterHandlers
+}
+
 func (h *HTTPRouteInput) GetGateway(parent gatewayv1.ParentReference) (*gatewayv1.Gateway, error) {
 	if h.gateways == nil {
 		h.gateways = make(map[gatewayv1.ParentReference]*gatewayv1.Gateway)
@@ -146,3 +154,13 @@ func (t *HTTPRouteRule) GetBackendRefs() []gatewayv1.BackendRef {
 	}
 	return refs
 }
+
+func (t *HTTPRouteRule) GetExtensionRefs() []gatewayv1.LocalObjectReference {
+	var refs []gatewayv1.LocalObjectReference
+	for _, f := range t.Rule.Filters {
+		if f.Type == gatewayv1.HTTPRouteFilterExtensionRef && f.ExtensionRef != nil {
+			refs = append(refs, *f.ExtensionRef)
+		}
+	}
+	return refs
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -133,3 +134,86 @@ type UDPRouteRule struct {
 func (t *UDPRouteRule) GetBackendRefs() []gatewayv1.BackendRef {
 	return t.Rule.BackendRefs
 }
+
+// CheckUDPListenerInUse rejects the UDPRoute if every UDP listener selected by
+// the parentRef already has an older UDPRoute attached to it, i.e. accepted by
+// the Gateway. UDP packets have nothing to match routes on, so only a single
+// UDPRoute may be attached to each listener.
+func CheckUDPListenerInUse(input Input, parentRef gatewayv1.ParentReference) (bool, error) {
+	i, ok := input.(*UDPRouteInput)
+	if !ok {
+		return true, nil
+	}
+	gw, err := input.GetGateway(parentRef)
+	if err != nil {
+		input.SetParentCondition(parentRef, metav1.Condition{
+			Type:    "Accepted",
+			Status:  metav1.ConditionFalse,
+			Reason:  "Invalid" + input.GetGVK().Kind,
+			Message: err.Error(),
+		})
+
+		return false, nil
+	}
+
+	routes := &gatewayv1alpha2.UDPRouteList{}
+	if err := i.Client.List(i.Ctx, routes); err != nil {
+		return false, fmt.Errorf("failed to list UDPRoutes: %w", err)
+	}
+
+	var (
+		selected int
+		inUse    []string
+	)
+	for _, l := range gw.Spec.Listeners {
+		if l.Protocol != gatewayv1.UDPProtocolType || !listenerMatchesParentRef(l, parentRef) {
+			continue
+		}
+		selected++
+		for idx := range routes.Items {
+			other := &routes.Items[idx]
+			if other.Namespace == i.UDPRoute.Namespace && other.Name == i.UDPRoute.Name {
+				continue
+			}
+			if !gateway.IsOlderRoute(other, i.UDPRoute) || !udpRouteSelectsListener(other, gw, l) {
+				continue
+			}
+			// Older routes that weren't accepted aren't attached, so don't
+			// use the listener.
+			if !gateway.IsRouteAttachable(gw, other, other.Status.Parents) {
+				continue
+			}
+			inUse = append(inUse, fmt.Sprintf("listener %s is in use by UDPRoute %s/%s", l.Name, other.Namespace, other.Name))
+			break
+		}
+	}
+	if selected == 0 || len(inUse) < selected {
+		return true, nil
+	}
+
+	input.SetParentCondition(parentRef, metav1.Condition{
+		Type:    string(gatewayv1.RouteConditionAccepted),
+		Status:  metav1.ConditionFalse,
+		Reason:  string(gatewayv1.RouteReasonNotAllowedByListeners),
+		Message: strings.Join(inUse, "; "),
+	})
+
+	return false, nil
+}
+
+// udpRouteSelectsListener returns true if any parentRef of the UDPRoute
+// selects the listener of the Gateway.
+func udpRouteSelectsListener(route *gatewayv1alpha2.UDPRoute, gw *gatewayv1.Gateway, l gatewayv1.Listener) bool {
+	for _, ref := range route.Spec.ParentRefs {
+		if !gateway.IsGateway(ref) || string(ref.Name) != gw.Name {
+			continue
+		}
+		if gateway.NamespaceDerefOr(ref.Namespace, route.Namespace) != gw.Namespace {
+			continue
+		}
+		if listenerMatchesParentRef(l, ref) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package routechecks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// udpClient is a client only able to get a Gateway and list UDPRoutes.
+type udpClient struct {
+	client.Client
+
+	gw     *gatewayv1.Gateway
+	routes []gatewayv1alpha2.UDPRoute
+}
+
+func (c udpClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	gw, ok := obj.(*gatewayv1.Gateway)
+	if !ok || key != client.ObjectKeyFromObject(c.gw) {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	c.gw.DeepCopyInto(gw)
+	return nil
+}
+
+func (c udpClient) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	routes := list.(*gatewayv1alpha2.UDPRouteList)
+	for _, r := range c.routes {
+		routes.Items = append(routes.Items, *r.DeepCopy())
+	}
+	return nil
+}
+
+func TestCheckUDPListenerInUse(t *testing.T) {
+	gw := &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+		Spec: gatewayv1.GatewaySpec{
+			Listeners: []gatewayv1.Listener{{Name: "dns", Protocol: gatewayv1.UDPProtocolType, Port: 53}},
+		},
+	}
+	parentRef := gatewayv1.ParentReference{Name: "gateway"}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// udpRoute returns a UDPRoute created the given number of minutes after
+	// the route being checked, with the Accepted condition of its parent.
+	udpRoute := func(name string, minutes int, accepted metav1.ConditionStatus) gatewayv1alpha2.UDPRoute {
+		route := gatewayv1alpha2.UDPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created.Add(time.Duration(minutes) * time.Minute)),
+			},
+			Spec: gatewayv1alpha2.UDPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{parentRef}},
+			},
+		}
+		if accepted != "" {
+			route.Status.Parents = []gatewayv1.RouteParentStatus{{
+				ParentRef: parentRef,
+				Conditions: []metav1.Condition{{
+					Type:   string(gatewayv1.RouteConditionAccepted),
+					Status: accepted,
+				}},
+			}}
+		}
+		return route
+	}
+
+	tests := []struct {
+		name   string
+		others []gatewayv1alpha2.UDPRoute
+		want   bool
+	}{
+		{name: "only route", want: true},
+		{name: "older accepted route", others: []gatewayv1alpha2.UDPRoute{udpRoute("older", -1, metav1.ConditionTrue)}},
+		{name: "older rejected route", others: []gatewayv1alpha2.UDPRoute{udpRoute("older", -1, metav1.ConditionFalse)}, want: true},
+		{name: "older route without status", others: []gatewayv1alpha2.UDPRoute{udpRoute("older", -1, "")}, want: true},
+		{name: "newer accepted route", others: []gatewayv1alpha2.UDPRoute{udpRoute("newer", 1, metav1.ConditionTrue)}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := udpRoute("route", 0, "")
+			input := &UDPRouteInput{
+				Ctx:      context.Background(),
+				Client:   udpClient{gw: gw, routes: append(tt.others, route)},
+				UDPRoute: &route,
+			}
+			got, err := CheckUDPListenerInUse(input, parentRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CheckUDPListenerInUse() = %t, want %t", got, tt.want)
+			}
+			rejected := len(route.Status.Parents) > 0 &&
+				meta.IsStatusConditionFalse(route.Status.Parents[0].Conditions, string(gatewayv1.RouteConditionAccepted))
+			if rejected == tt.want {
+				t.Errorf("parent statuses = %+v, want rejected: %t", route.Status.Parents, !tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 // SPDX-License-Identifier: Apache-2.0
 // SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
 
-// Package routechecks .
-// TODO: document
+// Package routechecks implements the checks the controller runs against
+// routes to set their status, such as whether a route is allowed to attach to
+// its parent Gateways and whether its backends can be resolved.
+//
+// Distributions of the controller can run their own checks against routes
+// (e.g. to enforce naming conventions or allowed ports) by registering them
+// with Register.
 package routechecks
 
 import (
@@ -19,6 +24,19 @@ type GenericRule interface {
 	GetBackendRefs() []gatewayv1.BackendRef
 }
 
+// ExtensionRefRule is implemented by rules with filters that can reference
+// implementation-specific resources using ExtensionRefs.
+type ExtensionRefRule interface {
+	GetExtensionRefs() []gatewayv1.LocalObjectReference
+}
+
+// FilterHandlersInput is implemented by inputs of routes whose rules can
+// reference CaddyHTTPFilters, returning the Caddy HTTP handler modules the
+// filters may use.
+type FilterHandlersInput interface {
+	GetAllowedFilterHandlers() []string
+}
+
 type Input interface {
 	GetRules() []GenericRule
 	GetNamespace() string
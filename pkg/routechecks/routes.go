@@ -0,0 +1,247 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package routechecks
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+// RouteReasonInvalidFilter is used with the ResolvedRefs condition when a
+// filter referenced by an ExtensionRef doesn't exist or is invalid.
+const RouteReasonInvalidFilter = "InvalidFilter"
+
+func CheckAgainstCrossNamespaceBackendReferences(input Input) (bool, error) {
+	continueChecks := true
+	for _, rule := range input.GetRules() {
+		for _, be := range rule.GetBackendRefs() {
+			ns := gateway.NamespaceDerefOr(be.Namespace, input.GetNamespace())
+
+			if ns != input.GetNamespace() && !gateway.IsBackendReferenceAllowed(input.GetNamespace(), be, input.GetGVK(), input.GetGrants()) {
+				// no reference grants, update the status for all the parents
+				input.SetAllParentCondition(metav1.Condition{
+					Type:    string(gatewayv1.RouteConditionResolvedRefs),
+					Status:  metav1.ConditionFalse,
+					Reason:  string(gatewayv1.RouteReasonRefNotPermitted),
+					Message: "Cross namespace references are not allowed",
+				})
+
+				continueChecks = false
+			}
+		}
+	}
+	return continueChecks, nil
+}
+
+func CheckBackend(input Input) (bool, error) {
+	continueChecks := true
+	for _, rule := range input.GetRules() {
+		for _, be := range rule.GetBackendRefs() {
+			if !gateway.IsService(be.BackendObjectReference) {
+				input.SetAllParentCondition(metav1.Condition{
+					Type:    string(gatewayv1alpha2.RouteConditionResolvedRefs),
+					Status:  metav1.ConditionFalse,
+					Reason:  string(gatewayv1.RouteReasonInvalidKind),
+					Message: "Unsupported backend kind " + string(*be.Kind),
+				})
+
+				continueChecks = false
+				continue
+			}
+			if be.BackendObjectReference.Port == nil {
+				input.SetAllParentCondition(metav1.Condition{
+					Type:    string(gatewayv1alpha2.RouteConditionResolvedRefs),
+					Status:  metav1.ConditionFalse,
+					Reason:  string(gatewayv1.RouteReasonInvalidKind),
+					Message: "Must have port for backend object reference",
+				})
+
+				continueChecks = false
+				continue
+			}
+		}
+	}
+	return continueChecks, nil
+}
+
+// CheckBackendWeights rejects backendRefs with weights outside of the range
+// allowed by the Gateway API. These are normally rejected by the CRD's
+// validation, but that may be bypassed by older CRDs.
+//
+// Weights are relative to the other backendRefs of the same rule, a weight of
+// zero sends no traffic to the backend, so a rule whose backendRefs all have a
+// weight of zero is accepted but never routes requests.
+func CheckBackendWeights(input Input) (bool, error) {
+	for _, rule := range input.GetRules() {
+		for _, be := range rule.GetBackendRefs() {
+			if be.Weight == nil {
+				continue
+			}
+			if w := *be.Weight; w < 0 || w > gateway.MaxBackendWeight {
+				input.SetAllParentCondition(metav1.Condition{
+					Type:    string(gatewayv1.RouteConditionAccepted),
+					Status:  metav1.ConditionFalse,
+					Reason:  string(gatewayv1.RouteReasonUnsupportedValue),
+					Message: fmt.Sprintf("Backend %s has weight %d, weights must be between 0 and %d", be.Name, w, gateway.MaxBackendWeight),
+				})
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func CheckBackendIsExistingService(input Input) (bool, error) {
+	protocol := corev1.ProtocolTCP
+	if input.GetGVK().Kind == "UDPRoute" {
+		protocol = corev1.ProtocolUDP
+	}
+	for _, rule := range input.GetRules() {
+		for _, be := range rule.GetBackendRefs() {
+			ns := gateway.NamespaceDerefOr(be.Namespace, input.GetNamespace())
+			svcName, err := gateway.GetBackendServiceName(be.BackendObjectReference)
+			if err != nil {
+				// Service Import does not exist, update the status for all the parents
+				// The `Accepted` condition on a route only describes whether
+				// the route attached successfully to its parent, so no error
+				// is returned here, so that the next validation can be run.
+				input.SetAllParentCondition(metav1.Condition{
+					Type:    string(gatewayv1.RouteConditionResolvedRefs),
+					Status:  metav1.ConditionFalse,
+					Reason:  string(gatewayv1.RouteReasonBackendNotFound),
+					Message: err.Error(),
+				})
+				continue
+			}
+			svc := &corev1.Service{}
+			if err := input.GetClient().Get(input.GetContext(), client.ObjectKey{Name: svcName, Namespace: ns}, svc); err != nil {
+				if !apierrors.IsNotFound(err) {
+					// input.Log().WithError(err).Error("Failed to get Service")
+					return false, err
+				}
+				// Service does not exist, update the status for all the parents
+				// The `Accepted` condition on a route only describes whether
+				// the route attached successfully to its parent, so no error
+				// is returned here, so that the next validation can be run.
+				input.SetAllParentCondition(metav1.Condition{
+					Type:    string(gatewayv1.RouteConditionResolvedRefs),
+					Status:  metav1.ConditionFalse,
+					Reason:  string(gatewayv1.RouteReasonBackendNotFound),
+					Message: err.Error(),
+				})
+				continue
+			}
+			if be.Port == nil {
+				continue
+			}
+			if _, err := gateway.ResolveServicePort(svc, int32(*be.Port), protocol); err != nil {
+				reason := gatewayv1.RouteReasonBackendNotFound
+				if errors.Is(err, gateway.ErrServicePortProtocol) {
+					reason = gatewayv1.RouteReasonUnsupportedProtocol
+				}
+				input.SetAllParentCondition(metav1.Condition{
+					Type:    string(gatewayv1.RouteConditionResolvedRefs),
+					Status:  metav1.ConditionFalse,
+					Reason:  string(reason),
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+	return true, nil
+}
+
+// CheckExtensionRefs checks the error page ConfigMaps and CaddyHTTPFilters
+// referenced by the ExtensionRef filters of a route's rules exist and are
+// valid. CaddyHTTPFilters may only use the handler modules allowed by
+// FilterHandlersInput. Requests handled by a filter that can't be resolved are
+// responded to with a 500, so the route is still accepted.
+func CheckExtensionRefs(input Input) (bool, error) {
+	var allowedHandlers []string
+	if i, ok := input.(FilterHandlersInput); ok {
+		allowedHandlers = i.GetAllowedFilterHandlers()
+	}
+	for _, rule := range input.GetRules() {
+		r, ok := rule.(ExtensionRefRule)
+		if !ok {
+			continue
+		}
+		for _, ref := range r.GetExtensionRefs() {
+			var (
+				obj      client.Object
+				validate func() error
+			)
+			switch {
+			case gateway.IsLocalConfigMap(ref):
+				cm := &corev1.ConfigMap{}
+				obj, validate = cm, func() error {
+					if _, err := gateway.ValidateErrorPage(cm); err != nil {
+						return err
+					}
+					return checkErrorPageFallback(input, cm)
+				}
+			case gateway.IsLocalCaddyHTTPFilter(ref):
+				f := &v1alpha1.CaddyHTTPFilter{}
+				obj, validate = f, func() error {
+					return gateway.ValidateCaddyHTTPFilter(f, allowedHandlers)
+				}
+			default:
+				continue
+			}
+
+			key := client.ObjectKey{Namespace: input.GetNamespace(), Name: string(ref.Name)}
+			var invalid error
+			if err := input.GetClient().Get(input.GetContext(), key, obj); err != nil {
+				if !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+					return false, err
+				}
+				invalid = fmt.Errorf("%s %s not found", ref.Kind, key)
+			} else {
+				invalid = validate()
+			}
+			if invalid == nil {
+				continue
+			}
+			input.SetAllParentCondition(metav1.Condition{
+				Type:    string(gatewayv1.RouteConditionResolvedRefs),
+				Status:  metav1.ConditionFalse,
+				Reason:  RouteReasonInvalidFilter,
+				Message: invalid.Error(),
+			})
+		}
+	}
+	return true, nil
+}
+
+// checkErrorPageFallback checks the fallback Service of an error page exists
+// and has the fallback's port.
+func checkErrorPageFallback(input Input, cm *corev1.ConfigMap) error {
+	v := cm.Data[gateway.ErrorPageFallback]
+	if v == "" {
+		return nil
+	}
+	name, port, err := gateway.ParseErrorPageFallback(v)
+	if err != nil {
+		return err
+	}
+	svc := &corev1.Service{}
+	if err := input.GetClient().Get(input.GetContext(), client.ObjectKey{Namespace: input.GetNamespace(), Name: name}, svc); err != nil {
+		return fmt.Errorf("error page %s: fallback Service %s/%s: %w", cm.Name, input.GetNamespace(), name, err)
+	}
+	if _, err := gateway.ResolveServicePort(svc, port, corev1.ProtocolTCP); err != nil {
+		return fmt.Errorf("error page %s: %w", cm.Name, err)
+	}
+	return nil
+}
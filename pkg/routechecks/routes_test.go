@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package routechecks
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+)
+
+func TestCheckBackendWeights(t *testing.T) {
+	// backend returns a backendRef to the Service `name` with the weight, nil
+	// leaves the weight unset.
+	backend := func(name string, weight *int32) gatewayv1.HTTPBackendRef {
+		return gatewayv1.HTTPBackendRef{
+			BackendRef: gatewayv1.BackendRef{
+				BackendObjectReference: gatewayv1.BackendObjectReference{
+					Name: gatewayv1.ObjectName(name),
+					Port: ptr.To[gatewayv1.PortNumber](80),
+				},
+				Weight: weight,
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		rules [][]gatewayv1.HTTPBackendRef
+		want  bool
+	}{
+		{name: "no backends", rules: [][]gatewayv1.HTTPBackendRef{{}}, want: true},
+		{name: "unset weight", rules: [][]gatewayv1.HTTPBackendRef{{backend("a", nil)}}, want: true},
+		{
+			name:  "mixed weights",
+			rules: [][]gatewayv1.HTTPBackendRef{{backend("a", ptr.To[int32](1)), backend("b", nil), backend("c", ptr.To[int32](0))}},
+			want:  true,
+		},
+		{
+			// A rule whose backends all have a weight of zero is accepted, it
+			// just never routes requests.
+			name:  "all zero",
+			rules: [][]gatewayv1.HTTPBackendRef{{backend("a", ptr.To[int32](0)), backend("b", ptr.To[int32](0))}},
+			want:  true,
+		},
+		{name: "maximum weight", rules: [][]gatewayv1.HTTPBackendRef{{backend("a", ptr.To[int32](gateway.MaxBackendWeight))}}, want: true},
+		{name: "negative weight", rules: [][]gatewayv1.HTTPBackendRef{{backend("a", ptr.To[int32](-1))}}},
+		{name: "weight too large", rules: [][]gatewayv1.HTTPBackendRef{{backend("a", ptr.To[int32](gateway.MaxBackendWeight+1))}}},
+		{
+			name: "invalid weight in a later rule",
+			rules: [][]gatewayv1.HTTPBackendRef{
+				{backend("a", ptr.To[int32](1))},
+				{backend("b", ptr.To[int32](2)), backend("c", ptr.To[int32](-5))},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &gatewayv1.HTTPRoute{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "route"},
+				Spec: gatewayv1.HTTPRouteSpec{
+					CommonRouteSpec: gatewayv1.CommonRouteSpec{
+						ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+					},
+				},
+			}
+			for _, refs := range tt.rules {
+				route.Spec.Rules = append(route.Spec.Rules, gatewayv1.HTTPRouteRule{BackendRefs: refs})
+			}
+			input := &HTTPRouteInput{Ctx: context.Background(), HTTPRoute: route}
+
+			got, err := CheckBackendWeights(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CheckBackendWeights() = %t, want %t", got, tt.want)
+			}
+			var accepted *metav1.Condition
+			if len(route.Status.Parents) > 0 {
+				accepted = meta.FindStatusCondition(route.Status.Parents[0].Conditions, string(gatewayv1.RouteConditionAccepted))
+			}
+			switch {
+			case tt.want && accepted != nil:
+				t.Errorf("Accepted condition = %+v, want none", accepted)
+			case !tt.want && (accepted == nil || accepted.Status != metav1.ConditionFalse || accepted.Reason != string(gatewayv1.RouteReasonUnsupportedValue)):
+				t.Errorf("Accepted condition = %+v, want false with reason %s", accepted, gatewayv1.RouteReasonUnsupportedValue)
+			}
+		})
+	}
+}
+
+// filterClient is a client only able to get a CaddyHTTPFilter.
+type filterClient struct {
+	client.Client
+
+	filter *v1alpha1.CaddyHTTPFilter
+}
+
+func (c filterClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	f, ok := obj.(*v1alpha1.CaddyHTTPFilter)
+	if !ok || key != client.ObjectKeyFromObject(c.filter) {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	c.filter.DeepCopyInto(f)
+	return nil
+}
+
+func TestCheckExtensionRefsFilterHandlers(t *testing.T) {
+	filter := &v1alpha1.CaddyHTTPFilter{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "filter"},
+		Spec: v1alpha1.CaddyHTTPFilterSpec{
+			Handler: runtime.RawExtension{Raw: []byte(`{"handler":"file_server","root":"/var/run/secrets"}`)},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		allowedHandlers []string
+		wantResolved    bool
+	}{
+		{name: "allowed", allowedHandlers: []string{"encode", "file_server"}, wantResolved: true},
+		{name: "not allowed", allowedHandlers: []string{"encode"}},
+		{name: "nothing allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &gatewayv1.HTTPRoute{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "route"},
+				Spec: gatewayv1.HTTPRouteSpec{
+					CommonRouteSpec: gatewayv1.CommonRouteSpec{
+						ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+					},
+					Rules: []gatewayv1.HTTPRouteRule{{
+						Filters: []gatewayv1.HTTPRouteFilter{{
+							Type: gatewayv1.HTTPRouteFilterExtensionRef,
+							ExtensionRef: &gatewayv1.LocalObjectReference{
+								Group: gatewayv1.Group(v1alpha1.GroupVersion.Group),
+								Kind:  "CaddyHTTPFilter",
+								Name:  "filter",
+							},
+						}},
+					}},
+				},
+			}
+			input := &HTTPRouteInput{
+				Ctx:       context.Background(),
+				Client:    filterClient{filter: filter},
+				HTTPRoute: route,
+
+				AllowedFilterHandlers: tt.allowedHandlers,
+			}
+
+			if ok, err := CheckExtensionRefs(input); err != nil || !ok {
+				t.Fatalf("CheckExtensionRefs() = %t, %v, want the route to be accepted", ok, err)
+			}
+			var resolved *metav1.Condition
+			if len(route.Status.Parents) > 0 {
+				resolved = meta.FindStatusCondition(route.Status.Parents[0].Conditions, string(gatewayv1.RouteConditionResolvedRefs))
+			}
+			switch {
+			case tt.wantResolved && resolved != nil:
+				t.Errorf("ResolvedRefs condition = %+v, want none", resolved)
+			case !tt.wantResolved && (resolved == nil || resolved.Status != metav1.ConditionFalse || resolved.Reason != RouteReasonInvalidFilter):
+				t.Errorf("ResolvedRefs condition = %+v, want false with reason %s", resolved, RouteReasonInvalidFilter)
+			}
+		})
+	}
+}
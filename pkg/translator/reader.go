@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package translator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// objectReader is a client.Reader for the Secrets, ConfigMaps,
+// ClusterTrustBundles and CaddyHTTPFilters in Resources, standing in for the
+// cluster.
+type objectReader struct {
+	objects map[objectKey]client.Object
+}
+
+type objectKey struct {
+	typ reflect.Type
+	key client.ObjectKey
+}
+
+var _ client.Reader = (*objectReader)(nil)
+
+func newObjectReader(res *Resources) *objectReader {
+	r := &objectReader{objects: map[objectKey]client.Object{}}
+	for n := range res.Secrets {
+		r.add(&res.Secrets[n])
+	}
+	for n := range res.ConfigMaps {
+		r.add(&res.ConfigMaps[n])
+	}
+	for n := range res.ClusterTrustBundles {
+		r.add(&res.ClusterTrustBundles[n])
+	}
+	for n := range res.CaddyHTTPFilters {
+		r.add(&res.CaddyHTTPFilters[n])
+	}
+	return r
+}
+
+func (r *objectReader) add(obj client.Object) {
+	r.objects[objectKey{typ: reflect.TypeOf(obj), key: client.ObjectKeyFromObject(obj)}] = obj
+}
+
+// Get implements client.Reader.
+func (r *objectReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	found, ok := r.objects[objectKey{typ: reflect.TypeOf(obj), key: key}]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: reflect.TypeOf(obj).Elem().Name()}, key.String())
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(found.DeepCopyObject()).Elem())
+	return nil
+}
+
+// List implements client.Reader, it is never needed to translate a config.
+func (r *objectReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("translator: listing objects is not supported")
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+// Package translator translates Gateway API resources into Caddy configs,
+// using the same logic as the controller but without a connection to a
+// Kubernetes cluster. This allows other tools, such as CI validators or bots
+// that preview changes, to see exactly what config a Gateway would be
+// programmed with.
+//
+// This package follows semantic versioning along with the rest of the module,
+// exported types, fields and functions will not be removed or renamed without
+// a major version bump. The generated config itself may change between any
+// versions, as it does when upgrading the controller.
+package translator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	certificatesv1alpha1 "k8s.io/api/certificates/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1alpha3 "sigs.k8s.io/gateway-api/apis/v1alpha3"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/internal/caddy"
+	"github.com/caddyserver/gateway/pkg/caddyconfig"
+)
+
+// Resources are the resources a Gateway's config is translated from.
+//
+// Routes are only translated for the Gateway if they have been accepted by it,
+// as recorded in their status by the controller, the same as when the config
+// is generated by the controller. Resources that aren't referenced by the
+// Gateway or its routes are ignored.
+type Resources struct {
+	Gateway      *gatewayv1.Gateway
+	GatewayClass *gatewayv1.GatewayClass
+
+	HTTPRoutes []gatewayv1.HTTPRoute
+	GRPCRoutes []gatewayv1.GRPCRoute
+	TCPRoutes  []gatewayv1alpha2.TCPRoute
+	TLSRoutes  []gatewayv1alpha2.TLSRoute
+	UDPRoutes  []gatewayv1alpha2.UDPRoute
+
+	ReferenceGrants    []gatewayv1beta1.ReferenceGrant
+	BackendTLSPolicies []gatewayv1alpha3.BackendTLSPolicy
+
+	Services       []corev1.Service
+	EndpointSlices []discoveryv1.EndpointSlice
+
+	// Secrets, ConfigMaps and ClusterTrustBundles referenced by the Gateway,
+	// its GatewayClass (including the parameters ConfigMap) and its routes.
+	Secrets             []corev1.Secret
+	ConfigMaps          []corev1.ConfigMap
+	ClusterTrustBundles []certificatesv1alpha1.ClusterTrustBundle
+
+	// CaddyHTTPFilters referenced by ExtensionRef filters of the HTTPRoutes.
+	CaddyHTTPFilters []v1alpha1.CaddyHTTPFilter
+}
+
+// Options configure how configs are translated, they match the controller's
+// flags of the same name. Zero values use the same defaults as the controller.
+type Options struct {
+	// AdminListen is the address for Caddy's admin endpoint to listen on.
+	AdminListen string
+
+	// GracePeriod is how long Caddy waits for active connections to close
+	// when reloading its config.
+	GracePeriod time.Duration
+
+	// CatchAllStatusCode is the status code of the response to requests that
+	// don't match any route.
+	CatchAllStatusCode int
+
+	// DisableBackendAutoTLS disables connecting to backends over TLS when no
+	// BackendTLSPolicy targets them.
+	DisableBackendAutoTLS bool
+
+	// PodUpstreams proxies HTTP requests directly to the ready endpoints of a
+	// Service, from Resources.EndpointSlices, rather than to its ClusterIP.
+	PodUpstreams bool
+
+	// CaddyHTTPFilterHandlers are the Caddy HTTP handler modules
+	// CaddyHTTPFilters may use, filters using any other module are responded
+	// to with a 500.
+	CaddyHTTPFilterHandlers []string
+}
+
+// Translate returns the Caddy config for the Gateway in res.
+func Translate(res *Resources, opts Options) (*caddyconfig.Config, error) {
+	if res.Gateway == nil {
+		return nil, errors.New("translator: a Gateway is required")
+	}
+	if res.GatewayClass == nil {
+		return nil, errors.New("translator: a GatewayClass is required")
+	}
+	if string(res.Gateway.Spec.GatewayClassName) != res.GatewayClass.Name {
+		return nil, fmt.Errorf("translator: Gateway uses GatewayClass %q, not %q", res.Gateway.Spec.GatewayClassName, res.GatewayClass.Name)
+	}
+
+	r := newObjectReader(res)
+	params, err := getParameters(r, res.GatewayClass)
+	if err != nil {
+		return nil, err
+	}
+
+	gw := res.Gateway
+	i := &caddy.Input{
+		Gateway:      gw,
+		GatewayClass: res.GatewayClass,
+		Parameters:   params,
+
+		HTTPRoutes: filterRoutes(gw, res.HTTPRoutes, func(r *gatewayv1.HTTPRoute) []gatewayv1.RouteParentStatus { return r.Status.Parents }),
+		GRPCRoutes: filterRoutes(gw, res.GRPCRoutes, func(r *gatewayv1.GRPCRoute) []gatewayv1.RouteParentStatus { return r.Status.Parents }),
+		TCPRoutes:  filterRoutes(gw, res.TCPRoutes, func(r *gatewayv1alpha2.TCPRoute) []gatewayv1.RouteParentStatus { return r.Status.Parents }),
+		TLSRoutes:  filterRoutes(gw, res.TLSRoutes, func(r *gatewayv1alpha2.TLSRoute) []gatewayv1.RouteParentStatus { return r.Status.Parents }),
+		UDPRoutes:  filterRoutes(gw, res.UDPRoutes, func(r *gatewayv1alpha2.UDPRoute) []gatewayv1.RouteParentStatus { return r.Status.Parents }),
+
+		Grants:             res.ReferenceGrants,
+		BackendTLSPolicies: res.BackendTLSPolicies,
+
+		Services: res.Services,
+
+		Client: r,
+
+		GeneratorOptions: caddy.GeneratorOptions{
+			AdminListen:        opts.AdminListen,
+			GracePeriod:        opts.GracePeriod,
+			CatchAllStatusCode: opts.CatchAllStatusCode,
+
+			AllowedFilterHandlers: opts.CaddyHTTPFilterHandlers,
+		},
+
+		DisableBackendAutoTLS: opts.DisableBackendAutoTLS,
+		PodUpstreams:          opts.PodUpstreams,
+		EndpointSlices:        res.EndpointSlices,
+	}
+	return i.Build()
+}
+
+// filterRoutes returns the routes that have been accepted by the Gateway.
+func filterRoutes[T any, PT interface {
+	*T
+	client.Object
+}](gw *gatewayv1.Gateway, routes []T, parents func(PT) []gatewayv1.RouteParentStatus) []T {
+	var filtered []T
+	for n := range routes {
+		route := PT(&routes[n])
+		if gateway.IsRouteAttachable(gw, route, parents(route)) {
+			filtered = append(filtered, routes[n])
+		}
+	}
+	return filtered
+}
+
+// getParameters returns the parsed parameters of the GatewayClass, if any.
+func getParameters(r client.Reader, gwc *gatewayv1.GatewayClass) (*caddy.Parameters, error) {
+	ref := gwc.Spec.ParametersRef
+	if ref == nil {
+		return nil, nil
+	}
+	if ref.Group != "" || ref.Kind != "ConfigMap" || ref.Namespace == nil {
+		return nil, fmt.Errorf("translator: unsupported parametersRef %s/%s, only namespaced ConfigMaps are supported", ref.Group, ref.Kind)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: string(*ref.Namespace), Name: ref.Name}, cm); err != nil {
+		return nil, fmt.Errorf("translator: unable to get parameters: %w", err)
+	}
+	return caddy.ParseParameters(cm.Data)
+}
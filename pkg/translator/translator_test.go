@@ -0,0 +1,299 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package translator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/caddyserver/gateway/api/v1alpha1"
+	gateway "github.com/caddyserver/gateway/internal"
+	"github.com/caddyserver/gateway/pkg/caddyconfig"
+)
+
+// testResources returns the resources of a Gateway with an HTTP listener and
+// an accepted HTTPRoute proxying to the Service `app`.
+func testResources() *Resources {
+	parentRef := gatewayv1.ParentReference{Name: "gateway"}
+	return &Resources{
+		Gateway: &gatewayv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+			Spec: gatewayv1.GatewaySpec{
+				GatewayClassName: "caddy",
+				Listeners:        []gatewayv1.Listener{{Name: "http", Protocol: gatewayv1.HTTPProtocolType, Port: 80}},
+			},
+		},
+		GatewayClass: &gatewayv1.GatewayClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "caddy"},
+			Spec:       gatewayv1.GatewayClassSpec{ControllerName: gateway.ControllerName},
+		},
+		HTTPRoutes: []gatewayv1.HTTPRoute{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+			Spec: gatewayv1.HTTPRouteSpec{
+				CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{parentRef}},
+				Rules: []gatewayv1.HTTPRouteRule{{
+					BackendRefs: []gatewayv1.HTTPBackendRef{{
+						BackendRef: gatewayv1.BackendRef{
+							BackendObjectReference: gatewayv1.BackendObjectReference{
+								Name: "app",
+								Port: ptr.To[gatewayv1.PortNumber](80),
+							},
+						},
+					}},
+				}},
+			},
+			Status: gatewayv1.HTTPRouteStatus{
+				RouteStatus: gatewayv1.RouteStatus{
+					Parents: []gatewayv1.RouteParentStatus{{
+						ParentRef:      parentRef,
+						ControllerName: gateway.ControllerName,
+						Conditions: []metav1.Condition{{
+							Type:   string(gatewayv1.RouteConditionAccepted),
+							Status: metav1.ConditionTrue,
+						}},
+					}},
+				},
+			},
+		}},
+		Services: []corev1.Service{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+			Spec: corev1.ServiceSpec{
+				ClusterIP: "10.0.0.1",
+				Ports:     []corev1.ServicePort{{Name: "http", Port: 80}},
+			},
+		}},
+	}
+}
+
+// translateJSON translates the resources and returns the config as JSON.
+func translateJSON(t *testing.T, res *Resources) string {
+	t.Helper()
+	return translateJSONWith(t, res, Options{})
+}
+
+// translateJSONWith translates the resources with the options into a JSON
+// config.
+func translateJSONWith(t *testing.T, res *Resources, opts Options) string {
+	t.Helper()
+	config, err := Translate(res, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestTranslateCaddyHTTPFilter(t *testing.T) {
+	res := testResources()
+	res.HTTPRoutes[0].Spec.Rules[0].Filters = []gatewayv1.HTTPRouteFilter{{
+		Type: gatewayv1.HTTPRouteFilterExtensionRef,
+		ExtensionRef: &gatewayv1.LocalObjectReference{
+			Group: gatewayv1.Group(v1alpha1.GroupVersion.Group),
+			Kind:  "CaddyHTTPFilter",
+			Name:  "compress",
+		},
+	}}
+
+	opts := Options{CaddyHTTPFilterHandlers: []string{"encode"}}
+
+	// Without the filter, requests are responded to with a 500.
+	if got := translateJSONWith(t, res, opts); strings.Contains(got, `"handler":"encode"`) {
+		t.Errorf("config has the handler of a missing filter: %s", got)
+	}
+
+	res.CaddyHTTPFilters = []v1alpha1.CaddyHTTPFilter{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "compress"},
+		Spec: v1alpha1.CaddyHTTPFilterSpec{
+			Handler: runtime.RawExtension{Raw: []byte(`{"handler":"encode","encodings":{"gzip":{}}}`)},
+		},
+	}}
+	if got := translateJSONWith(t, res, opts); !strings.Contains(got, `"handler":"encode"`) {
+		t.Errorf("config doesn't have the handler of the filter: %s", got)
+	}
+
+	// Filters using handlers that aren't allowed are responded to with a 500.
+	if got := translateJSON(t, res); strings.Contains(got, `"handler":"encode"`) {
+		t.Errorf("config has the handler of a filter that isn't allowed: %s", got)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	res := testResources()
+	// Routes that haven't been accepted by the Gateway are skipped.
+	rejected := res.HTTPRoutes[0].DeepCopy()
+	rejected.Name = "rejected"
+	rejected.Spec.Hostnames = []gatewayv1.Hostname{"rejected.example.com"}
+	rejected.Status.Parents[0].Conditions[0].Status = metav1.ConditionFalse
+	res.HTTPRoutes = append(res.HTTPRoutes, *rejected)
+
+	got := translateJSON(t, res)
+	if !strings.Contains(got, `"listen":[":80"]`) {
+		t.Errorf("config doesn't listen on the Gateway's listener: %s", got)
+	}
+	if !strings.Contains(got, `"dial":"10.0.0.1:80"`) {
+		t.Errorf("config doesn't proxy to the route's backend: %s", got)
+	}
+	if strings.Contains(got, "rejected.example.com") {
+		t.Errorf("config has a route that wasn't accepted: %s", got)
+	}
+
+	// Translating the same resources always results in the same config, so
+	// it can be compared with the config of a running Gateway.
+	if again := translateJSON(t, res); again != got {
+		t.Errorf("translating the same resources resulted in a different config:\n%s\n%s", got, again)
+	}
+}
+
+func TestTranslateParameters(t *testing.T) {
+	res := testResources()
+	res.GatewayClass.Spec.ParametersRef = &gatewayv1.ParametersReference{
+		Kind:      "ConfigMap",
+		Name:      "caddy",
+		Namespace: ptr.To[gatewayv1.Namespace]("caddy-system"),
+	}
+	if _, err := Translate(res, Options{}); err == nil {
+		t.Error("Translate() succeeded without the parameters ConfigMap")
+	}
+
+	res.ConfigMaps = []corev1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "caddy-system", Name: "caddy"},
+		Data:       map[string]string{"catchAllStatusCode": "418"},
+	}}
+	if got := translateJSON(t, res); !strings.Contains(got, `"status_code":418`) && !strings.Contains(got, `"status_code":"418"`) {
+		t.Errorf("config doesn't use the GatewayClass's parameters: %s", got)
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Resources)
+	}{
+		{name: "no Gateway", modify: func(res *Resources) { res.Gateway = nil }},
+		{name: "no GatewayClass", modify: func(res *Resources) { res.GatewayClass = nil }},
+		{name: "other GatewayClass", modify: func(res *Resources) { res.GatewayClass.Name = "other" }},
+		{
+			name: "unsupported parametersRef",
+			modify: func(res *Resources) {
+				res.GatewayClass.Spec.ParametersRef = &gatewayv1.ParametersReference{
+					Group: "example.com",
+					Kind:  "Parameters",
+					Name:  "caddy",
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := testResources()
+			tt.modify(res)
+			if _, err := Translate(res, Options{}); err == nil {
+				t.Error("Translate() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestTranslateRoundTrip(t *testing.T) {
+	res := testResources()
+	res.Gateway.Spec.Listeners = append(res.Gateway.Spec.Listeners, gatewayv1.Listener{
+		Name:     "tls",
+		Protocol: gatewayv1.TLSProtocolType,
+		Port:     443,
+		TLS:      &gatewayv1.GatewayTLSConfig{Mode: ptr.To(gatewayv1.TLSModePassthrough)},
+	})
+	rule := &res.HTTPRoutes[0].Spec.Rules[0]
+	rule.Filters = []gatewayv1.HTTPRouteFilter{
+		{
+			Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+				Set: []gatewayv1.HTTPHeader{{Name: "X-Route", Value: "app"}},
+			},
+		},
+		{
+			Type: gatewayv1.HTTPRouteFilterURLRewrite,
+			URLRewrite: &gatewayv1.HTTPURLRewriteFilter{
+				Path: &gatewayv1.HTTPPathModifier{
+					Type:            gatewayv1.FullPathHTTPPathModifier,
+					ReplaceFullPath: ptr.To("/app"),
+				},
+			},
+		},
+		{
+			Type: gatewayv1.HTTPRouteFilterRequestMirror,
+			RequestMirror: &gatewayv1.HTTPRequestMirrorFilter{
+				BackendRef: gatewayv1.BackendObjectReference{Name: "app", Port: ptr.To[gatewayv1.PortNumber](80)},
+			},
+		},
+		{
+			Type: gatewayv1.HTTPRouteFilterExtensionRef,
+			ExtensionRef: &gatewayv1.LocalObjectReference{
+				Group: gatewayv1.Group(v1alpha1.GroupVersion.Group),
+				Kind:  "CaddyHTTPFilter",
+				Name:  "compress",
+			},
+		},
+	}
+	rule.BackendRefs[0].Weight = ptr.To[int32](1)
+	rule.BackendRefs = append(rule.BackendRefs, gatewayv1.HTTPBackendRef{
+		BackendRef: gatewayv1.BackendRef{
+			BackendObjectReference: gatewayv1.BackendObjectReference{Name: "app2", Port: ptr.To[gatewayv1.PortNumber](80)},
+			Weight:                 ptr.To[int32](2),
+		},
+	})
+	app2 := res.Services[0].DeepCopy()
+	app2.Name = "app2"
+	app2.Spec.ClusterIP = "10.0.0.2"
+	res.Services = append(res.Services, *app2)
+	res.CaddyHTTPFilters = []v1alpha1.CaddyHTTPFilter{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "compress"},
+		Spec: v1alpha1.CaddyHTTPFilterSpec{
+			Handler: runtime.RawExtension{Raw: []byte(`{"handler":"encode","encodings":{"gzip":{}}}`)},
+		},
+	}}
+	res.TLSRoutes = []gatewayv1alpha2.TLSRoute{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: gatewayv1alpha2.TLSRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}}},
+			Hostnames:       []gatewayv1.Hostname{"app.example.com"},
+			Rules: []gatewayv1alpha2.TLSRouteRule{{
+				BackendRefs: []gatewayv1.BackendRef{{
+					BackendObjectReference: gatewayv1.BackendObjectReference{Name: "app", Port: ptr.To[gatewayv1.PortNumber](80)},
+				}},
+			}},
+		},
+		Status: gatewayv1alpha2.TLSRouteStatus{RouteStatus: res.HTTPRoutes[0].Status.RouteStatus},
+	}}
+
+	// Translated configs stay the same after being unmarshalled and
+	// marshalled again, so they can be read back from a running Gateway.
+	want := translateJSONWith(t, res, Options{CaddyHTTPFilterHandlers: []string{"encode"}})
+	for _, s := range []string{`"handler":"mirror"`, `"handler":"rewrite"`, `"handler":"encode"`, `"handler":"proxy"`, `"policy":"weighted_round_robin"`} {
+		if !strings.Contains(want, s) {
+			t.Errorf("config doesn't contain %s: %s", s, want)
+		}
+	}
+	var config caddyconfig.Config
+	if err := json.Unmarshal([]byte(want), &config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("config changed after a round trip:\n%s\n%s", want, got)
+	}
+}
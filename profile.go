@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// profiles are presets of flags tuned for clusters of different sizes, so
+// operators don't have to discover every flag affecting scale themselves.
+var profiles = map[string]map[string]string{
+	// small sets every flag to its default, which suits clusters with a
+	// handful of Gateways and Caddy instances. Its values must be kept in
+	// sync with the defaults in main.
+	"small": {
+		"max-concurrent-reconciles": "1",
+		"programming-concurrency":   "0",
+		"targeted-programming":      "true",
+		"cache-tls-secrets-only":    "false",
+		"sync-period":               "10h",
+		"config-pull-interval":      "30s",
+	},
+	// large suits clusters with many Gateways, routes or Caddy instances.
+	// Gateways are reconciled in parallel, at most 20 Caddy instances are
+	// programmed at once, only TLS Secrets are cached and caches are resynced
+	// less often.
+	"large": {
+		"max-concurrent-reconciles": "8",
+		"programming-concurrency":   "20",
+		"targeted-programming":      "true",
+		"cache-tls-secrets-only":    "true",
+		"sync-period":               "24h",
+		"config-pull-interval":      "60s",
+	},
+}
+
+// profileNames returns the names of the profiles, sorted.
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// applyProfile sets the flags of a profile on fs, flags that were set
+// explicitly take precedence over the profile.
+func applyProfile(fs *flag.FlagSet, name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, must be one of %s", name, strings.Join(profileNames(), ", "))
+	}
+	set := map[string]struct{}{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = struct{}{}
+	})
+	for flagName, value := range profile {
+		if _, ok := set[flagName]; ok {
+			continue
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// SPDX-FileCopyrightText: Copyright (c) 2024 Matthew Penner
+
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newProfileFlagSet returns a flag set with the flags set by profiles, at the
+// defaults used by main.
+func newProfileFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Int("max-concurrent-reconciles", 1, "")
+	fs.Int("programming-concurrency", 0, "")
+	fs.Bool("targeted-programming", true, "")
+	fs.Bool("cache-tls-secrets-only", false, "")
+	fs.Duration("sync-period", 10*time.Hour, "")
+	fs.Duration("config-pull-interval", 30*time.Second, "")
+	return fs
+}
+
+func TestApplyProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		profile string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "no profile",
+			want: map[string]string{"max-concurrent-reconciles": "1", "programming-concurrency": "0", "sync-period": "10h0m0s"},
+		},
+		{
+			name:    "small",
+			profile: "small",
+			want: map[string]string{
+				"max-concurrent-reconciles": "1",
+				"programming-concurrency":   "0",
+				"targeted-programming":      "true",
+				"cache-tls-secrets-only":    "false",
+				"sync-period":               "10h0m0s",
+				"config-pull-interval":      "30s",
+			},
+		},
+		{
+			name:    "large",
+			profile: "large",
+			want: map[string]string{
+				"max-concurrent-reconciles": "8",
+				"programming-concurrency":   "20",
+				"cache-tls-secrets-only":    "true",
+				"sync-period":               "24h0m0s",
+				"config-pull-interval":      "1m0s",
+			},
+		},
+		{
+			name:    "explicit flags take precedence",
+			args:    []string{"--max-concurrent-reconciles=4", "--cache-tls-secrets-only=false"},
+			profile: "large",
+			want: map[string]string{
+				"max-concurrent-reconciles": "4",
+				"programming-concurrency":   "20",
+				"cache-tls-secrets-only":    "false",
+			},
+		},
+		{
+			name:    "explicit flags set to the default take precedence",
+			args:    []string{"--programming-concurrency=0"},
+			profile: "large",
+			want:    map[string]string{"max-concurrent-reconciles": "8", "programming-concurrency": "0"},
+		},
+		{name: "unknown profile", profile: "medium", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newProfileFlagSet()
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := applyProfile(fs, tt.profile)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("--%s = %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	// Every profile sets the same flags, so switching between them doesn't
+	// leave flags at a value only suited to another profile.
+	flagNames := func(profile map[string]string) []string {
+		var names []string
+		for name := range profile {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	want := flagNames(profiles["small"])
+	for name, profile := range profiles {
+		if got := flagNames(profile); !slices.Equal(got, want) {
+			t.Errorf("profile %s sets %v, want %v", name, got, want)
+		}
+		// The values of every profile must be valid for their flags.
+		if err := applyProfile(newProfileFlagSet(), name); err != nil {
+			t.Errorf("applying profile %s: %v", name, err)
+		}
+	}
+
+	// small sets every flag to its default.
+	fs := newProfileFlagSet()
+	if err := applyProfile(fs, "small"); err != nil {
+		t.Fatal(err)
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() != f.DefValue {
+			t.Errorf("small sets --%s to %s, want the default %s", f.Name, f.Value, f.DefValue)
+		}
+	})
+}